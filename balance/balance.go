@@ -0,0 +1,352 @@
+// Copyright 2017 Bankrs AG.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package balance reconstructs the historical daily balances of an account
+// from its current balance and its transactions.
+package balance
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"code.bankrs.com/bosgo"
+	"code.bankrs.com/bosgo/internal/money"
+)
+
+// Basis selects the date by which transactions are assigned to days.
+type Basis int
+
+const (
+	// EntryBasis assigns transactions to the day they were booked, which is
+	// how banks report the account balance.
+	EntryBasis Basis = iota
+
+	// SettlementBasis assigns transactions to their value date, producing the
+	// balance relevant for interest and overdraft calculations.
+	SettlementBasis
+)
+
+// Options control the reconstruction of a balance history.
+type Options struct {
+	Basis Basis
+
+	// From and To limit the days included in the history. By default the
+	// history starts at the earliest transaction and ends at the later of the
+	// balance date and the latest transaction.
+	From, To time.Time
+
+	// Checkpoints are balances known from other sources, such as account
+	// statements, that the reconstructed balances are checked against.
+	Checkpoints []Checkpoint
+
+	// MaxGap is the number of consecutive days without transactions after
+	// which a gap is reported. Zero disables gap detection.
+	MaxGap int
+}
+
+// Checkpoint is the known end of day balance of an account on a date.
+type Checkpoint struct {
+	Date    time.Time
+	Balance string
+}
+
+// Day is the balance of an account at the end of a day.
+type Day struct {
+	Date         time.Time
+	Balance      string
+	Change       string // Sum of the day's transactions
+	Transactions int
+}
+
+// IssueKind classifies problems found while reconstructing a history.
+type IssueKind string
+
+const (
+	IssueMismatch      IssueKind = "mismatch"       // A checkpoint does not reconcile
+	IssueOverdrawn     IssueKind = "overdrawn"      // The balance falls below the credit line
+	IssueGap           IssueKind = "gap"            // No transactions for longer than Options.MaxGap
+	IssueUndated       IssueKind = "undated"        // A transaction has no date
+	IssueCurrency      IssueKind = "currency"       // A transaction is in a different currency
+	IssueInvalidAmount IssueKind = "invalid_amount" // A transaction amount cannot be parsed
+)
+
+// Issue describes an inconsistency in a reconstructed history. Transactions
+// that cause an issue are not included in the balances.
+type Issue struct {
+	Kind          IssueKind
+	Date          time.Time // Day the issue occurs on or starts at
+	End           time.Time // Last day of a gap
+	TransactionID int64
+	Expected      string // Balance expected by a checkpoint or minimum balance
+	Actual        string // Reconstructed balance
+}
+
+func (i Issue) String() string {
+	switch i.Kind {
+	case IssueMismatch:
+		return fmt.Sprintf("%s: balance is %s, expected %s", isoDate(i.Date), i.Actual, i.Expected)
+	case IssueOverdrawn:
+		return fmt.Sprintf("%s: balance %s is below the limit of %s", isoDate(i.Date), i.Actual, i.Expected)
+	case IssueGap:
+		return fmt.Sprintf("%s to %s: no transactions", isoDate(i.Date), isoDate(i.End))
+	}
+	return fmt.Sprintf("transaction %d: %s", i.TransactionID, i.Kind)
+}
+
+// History is the reconstructed daily balance of an account.
+type History struct {
+	AccountID int64
+	Currency  string
+	Days      []Day // Consecutive days in ascending order
+	Issues    []Issue
+}
+
+// Consistent reports whether no issues were found.
+func (h *History) Consistent() bool {
+	return len(h.Issues) == 0
+}
+
+// Balance returns the balance at the end of the day containing t.
+func (h *History) Balance(t time.Time) (string, bool) {
+	if len(h.Days) == 0 {
+		return "", false
+	}
+	i := int(dayOf(t).Sub(h.Days[0].Date).Hours() / 24)
+	if i < 0 || i >= len(h.Days) {
+		return "", false
+	}
+	return h.Days[i].Balance, true
+}
+
+// Iterator is a source of transactions such as *bosgo.TransactionIterator.
+type Iterator interface {
+	Next() bool
+	Transaction() bosgo.Transaction
+	Err() error
+}
+
+// Fetch lists the transactions of acc using svc and reconstructs its history.
+func Fetch(ctx context.Context, svc *bosgo.TransactionsService, acc bosgo.Account, opts Options) (*History, error) {
+	return Reconstruct(acc, svc.List().Context(ctx).AccountID(acc.ID).Iter(), opts)
+}
+
+// Reconstruct computes the end of day balances of acc by starting at its
+// balance on the balance date and walking backwards and forwards through the
+// transactions read from it. Transactions of other accounts are ignored.
+//
+// The account balance is assumed to include all transactions booked up to the
+// balance date. With SettlementBasis the balance at the balance date is
+// adjusted for transactions whose value date falls on the other side of it.
+func Reconstruct(acc bosgo.Account, it Iterator, opts Options) (*History, error) {
+	anchor, err := money.Parse(acc.Balance)
+	if err != nil {
+		return nil, fmt.Errorf("balance: account %d has invalid balance %q", acc.ID, acc.Balance)
+	}
+	if acc.BalanceDate.IsZero() {
+		return nil, fmt.Errorf("balance: account %d has no balance date", acc.ID)
+	}
+	anchorDay := dayOf(acc.BalanceDate)
+
+	h := &History{AccountID: acc.ID, Currency: acc.Currency}
+	changes := map[time.Time]money.Amount{}
+	counts := map[time.Time]int{}
+	first, last := anchorDay, anchorDay
+
+	for it.Next() {
+		tx := it.Transaction()
+		if tx.UserAccountID != 0 && tx.UserAccountID != acc.ID {
+			continue
+		}
+		if tx.Amount == nil {
+			h.Issues = append(h.Issues, Issue{Kind: IssueInvalidAmount, TransactionID: tx.ID})
+			continue
+		}
+		if acc.Currency != "" && tx.Amount.Currency != acc.Currency {
+			h.Issues = append(h.Issues, Issue{Kind: IssueCurrency, TransactionID: tx.ID})
+			continue
+		}
+		amt, err := money.Parse(tx.Amount.Value)
+		if err != nil {
+			h.Issues = append(h.Issues, Issue{Kind: IssueInvalidAmount, TransactionID: tx.ID})
+			continue
+		}
+
+		entry, settlement := dayOf(tx.EntryDate), dayOf(tx.SettlementDate)
+		if entry.IsZero() {
+			entry = settlement
+		}
+		if settlement.IsZero() {
+			settlement = entry
+		}
+		if entry.IsZero() {
+			h.Issues = append(h.Issues, Issue{Kind: IssueUndated, TransactionID: tx.ID})
+			continue
+		}
+
+		day := entry
+		if opts.Basis == SettlementBasis {
+			day = settlement
+			// Move the anchor from booked to value dated balance.
+			if !entry.After(anchorDay) && settlement.After(anchorDay) {
+				anchor -= amt
+			} else if entry.After(anchorDay) && !settlement.After(anchorDay) {
+				anchor += amt
+			}
+		}
+
+		changes[day] += amt
+		counts[day]++
+		if day.Before(first) {
+			first = day
+		}
+		if day.After(last) {
+			last = day
+		}
+	}
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+
+	from, to := first, last
+	if !opts.From.IsZero() {
+		from = dayOf(opts.From)
+	}
+	if !opts.To.IsZero() {
+		to = dayOf(opts.To)
+	}
+	if from.After(to) {
+		return nil, fmt.Errorf("balance: start %s is after end %s", isoDate(from), isoDate(to))
+	}
+	if from.Before(first) {
+		first = from
+	}
+	if to.After(last) {
+		last = to
+	}
+
+	// Walk back from the anchor, then forward, over all days that have
+	// transactions or are requested.
+	n := days(first, last) + 1
+	balances := make([]money.Amount, n)
+	a := days(first, anchorDay)
+	balances[a] = anchor
+	for i := a - 1; i >= 0; i-- {
+		balances[i] = balances[i+1] - changes[first.AddDate(0, 0, i+1)]
+	}
+	for i := a + 1; i < n; i++ {
+		balances[i] = balances[i-1] + changes[first.AddDate(0, 0, i)]
+	}
+
+	for i := days(first, from); i <= days(first, to); i++ {
+		d := first.AddDate(0, 0, i)
+		h.Days = append(h.Days, Day{
+			Date:         d,
+			Balance:      balances[i].String(),
+			Change:       changes[d].String(),
+			Transactions: counts[d],
+		})
+	}
+
+	h.checkpoints(opts.Checkpoints)
+	h.overdrawn(acc.CreditLine)
+	if opts.MaxGap > 0 {
+		h.gaps(opts.MaxGap)
+	}
+	return h, nil
+}
+
+func (h *History) checkpoints(cps []Checkpoint) {
+	for _, cp := range cps {
+		actual, ok := h.Balance(cp.Date)
+		if !ok {
+			continue
+		}
+		want, err := money.Parse(cp.Balance)
+		if err != nil || want.String() != actual {
+			h.Issues = append(h.Issues, Issue{
+				Kind:     IssueMismatch,
+				Date:     dayOf(cp.Date),
+				Expected: cp.Balance,
+				Actual:   actual,
+			})
+		}
+	}
+}
+
+// overdrawn reports the first day of every period in which the balance is
+// below the negated credit line, which usually means transactions are missing.
+func (h *History) overdrawn(creditLine string) {
+	if creditLine == "" {
+		return
+	}
+	limit, err := money.Parse(creditLine)
+	if err != nil {
+		return
+	}
+	limit = -limit.Abs()
+
+	below := false
+	for _, d := range h.Days {
+		bal := money.MustParse(d.Balance)
+		if bal < limit && !below {
+			h.Issues = append(h.Issues, Issue{
+				Kind:     IssueOverdrawn,
+				Date:     d.Date,
+				Expected: limit.String(),
+				Actual:   d.Balance,
+			})
+		}
+		below = bal < limit
+	}
+}
+
+// gaps reports runs of more than max days without transactions.
+func (h *History) gaps(max int) {
+	start := -1
+	for i := 0; i <= len(h.Days); i++ {
+		if i < len(h.Days) && h.Days[i].Transactions == 0 {
+			if start == -1 {
+				start = i
+			}
+			continue
+		}
+		if start != -1 && i-start > max {
+			h.Issues = append(h.Issues, Issue{
+				Kind: IssueGap,
+				Date: h.Days[start].Date,
+				End:  h.Days[i-1].Date,
+			})
+		}
+		start = -1
+	}
+}
+
+// dayOf returns midnight UTC of the calendar day of t in its own location.
+func dayOf(t time.Time) time.Time {
+	if t.IsZero() {
+		return time.Time{}
+	}
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// days returns the number of days from a to b, both midnight UTC.
+func days(a, b time.Time) int {
+	return int(b.Sub(a).Hours() / 24)
+}
+
+func isoDate(t time.Time) string {
+	return t.Format("2006-01-02")
+}
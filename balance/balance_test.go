@@ -0,0 +1,182 @@
+// Copyright 2017 Bankrs AG.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package balance
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"code.bankrs.com/bosgo"
+	"code.bankrs.com/bosgo/testserver"
+)
+
+func date(month time.Month, day int) time.Time {
+	return time.Date(2017, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+func testAccount() bosgo.Account {
+	return bosgo.Account{
+		ID:          1,
+		Balance:     "100.00",
+		BalanceDate: time.Date(2017, 7, 31, 18, 0, 0, 0, time.UTC),
+		CreditLine:  "500.00",
+		Currency:    "EUR",
+	}
+}
+
+func testTransactions() []bosgo.Transaction {
+	eur := func(v string) *bosgo.MoneyAmount { return &bosgo.MoneyAmount{Currency: "EUR", Value: v} }
+	return []bosgo.Transaction{
+		{ID: 1, UserAccountID: 1, EntryDate: date(7, 31), SettlementDate: date(7, 30), Amount: eur("-20.00")},
+		{ID: 2, UserAccountID: 1, EntryDate: date(7, 28), SettlementDate: date(7, 28), Amount: eur("50.00")},
+		{ID: 3, UserAccountID: 1, EntryDate: date(8, 1), SettlementDate: date(7, 31), Amount: eur("-10.00")},
+		{ID: 4, UserAccountID: 2, EntryDate: date(7, 1), Amount: eur("-1000.00")},
+		{ID: 5, UserAccountID: 1, EntryDate: date(7, 29), Amount: &bosgo.MoneyAmount{Currency: "USD", Value: "5.00"}},
+	}
+}
+
+type sliceIterator struct {
+	txs []bosgo.Transaction
+	pos int
+}
+
+func (it *sliceIterator) Next() bool {
+	it.pos++
+	return it.pos <= len(it.txs)
+}
+
+func (it *sliceIterator) Transaction() bosgo.Transaction { return it.txs[it.pos-1] }
+func (it *sliceIterator) Err() error                     { return nil }
+
+func balances(h *History) []string {
+	var bs []string
+	for _, d := range h.Days {
+		bs = append(bs, d.Balance)
+	}
+	return bs
+}
+
+func TestReconstruct(t *testing.T) {
+	testCases := []struct {
+		name  string
+		basis Basis
+		want  []string
+	}{
+		{name: "entry", basis: EntryBasis, want: []string{"120.00", "120.00", "120.00", "100.00", "90.00"}},
+		{name: "settlement", basis: SettlementBasis, want: []string{"120.00", "120.00", "100.00", "90.00"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			h, err := Reconstruct(testAccount(), &sliceIterator{txs: testTransactions()}, Options{Basis: tc.basis})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !h.Days[0].Date.Equal(date(7, 28)) {
+				t.Errorf("got first day %s, wanted 2017-07-28", h.Days[0].Date)
+			}
+			if got := balances(h); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got balances %v, wanted %v", got, tc.want)
+			}
+			if len(h.Issues) != 1 || h.Issues[0].Kind != IssueCurrency || h.Issues[0].TransactionID != 5 {
+				t.Errorf("got issues %v, wanted currency issue for transaction 5", h.Issues)
+			}
+		})
+	}
+}
+
+func TestReconstructRange(t *testing.T) {
+	h, err := Reconstruct(testAccount(), &sliceIterator{txs: testTransactions()}, Options{
+		From: date(7, 26),
+		To:   date(7, 29),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []string{"70.00", "70.00", "120.00", "120.00"}; !reflect.DeepEqual(balances(h), want) {
+		t.Errorf("got balances %v, wanted %v", balances(h), want)
+	}
+	if bal, ok := h.Balance(time.Date(2017, 7, 28, 15, 0, 0, 0, time.UTC)); !ok || bal != "120.00" {
+		t.Errorf("got balance %q, wanted 120.00", bal)
+	}
+	if _, ok := h.Balance(date(7, 30)); ok {
+		t.Errorf("got balance outside of history")
+	}
+}
+
+func TestReconstructIssues(t *testing.T) {
+	acc := testAccount()
+	acc.CreditLine = "100.00"
+	txs := testTransactions()[:3]
+	txs = append(txs, bosgo.Transaction{ID: 6, UserAccountID: 1, EntryDate: date(7, 26), Amount: &bosgo.MoneyAmount{Currency: "EUR", Value: "200.00"}})
+
+	h, err := Reconstruct(acc, &sliceIterator{txs: txs}, Options{
+		Checkpoints: []Checkpoint{
+			{Date: date(7, 30), Balance: "120.00"},
+			{Date: date(7, 29), Balance: "119.00"},
+		},
+		From:   date(7, 25),
+		MaxGap: 1,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var kinds []IssueKind
+	for _, is := range h.Issues {
+		kinds = append(kinds, is.Kind)
+	}
+	want := []IssueKind{IssueMismatch, IssueOverdrawn, IssueGap}
+	if !reflect.DeepEqual(kinds, want) {
+		t.Fatalf("got issues %v, wanted kinds %v", h.Issues, want)
+	}
+	if got := h.Issues[0].String(); got != "2017-07-29: balance is 120.00, expected 119.00" {
+		t.Errorf("got %q", got)
+	}
+	if got := h.Issues[1].String(); got != "2017-07-25: balance -130.00 is below the limit of -100.00" {
+		t.Errorf("got %q", got)
+	}
+	if !h.Issues[2].Date.Equal(date(7, 29)) || !h.Issues[2].End.Equal(date(7, 30)) {
+		t.Errorf("got gap %v, wanted 2017-07-29 to 2017-07-30", h.Issues[2])
+	}
+	if h.Consistent() {
+		t.Errorf("history is consistent, wanted inconsistent")
+	}
+}
+
+func TestFetch(t *testing.T) {
+	s := testserver.NewWithDefaults()
+	defer s.Close()
+
+	if err := s.AssignTransactions(testserver.DefaultUsername, testTransactions()); err != nil {
+		t.Fatalf("failed to assign transactions: %v", err)
+	}
+
+	appClient := bosgo.NewAppClient(s.Client(), s.Addr(), testserver.DefaultApplicationID)
+	userClient, err := appClient.Users.Login(testserver.DefaultUsername, testserver.DefaultPassword).Send()
+	if err != nil {
+		t.Fatalf("failed to login as user: %v", err)
+	}
+
+	h, err := Fetch(context.Background(), userClient.Transactions, testAccount(), Options{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []string{"120.00", "120.00", "120.00", "100.00", "90.00"}; !reflect.DeepEqual(balances(h), want) {
+		t.Errorf("got balances %v, wanted %v", balances(h), want)
+	}
+}
@@ -0,0 +1,326 @@
+// Copyright 2017 Bankrs AG.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bosgo
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// UsernameIterator is a source of usernames such as the one returned by
+// ResolveUsernames.
+type UsernameIterator interface {
+	Next() bool
+	Username() string
+	Err() error
+}
+
+// Usernames returns an iterator over the given usernames.
+func Usernames(names ...string) UsernameIterator {
+	return &usernameList{names: names}
+}
+
+type usernameList struct {
+	names []string
+	pos   int
+}
+
+func (l *usernameList) Next() bool {
+	if l.pos >= len(l.names) {
+		return false
+	}
+	l.pos++
+	return true
+}
+
+func (l *usernameList) Username() string { return l.names[l.pos-1] }
+func (l *usernameList) Err() error       { return nil }
+
+// UserIDIterator is a source of user IDs such as *UserIterator.
+type UserIDIterator interface {
+	Next() bool
+	ID() string
+	Err() error
+}
+
+// ResolveUsernames returns an iterator over the usernames of the users whose
+// IDs are read from ids. Each user is looked up with UserInfo as the iterator
+// advances. Iteration stops with an error if a lookup fails.
+func (d *ApplicationsService) ResolveUsernames(ctx context.Context, applicationID string, ids UserIDIterator) UsernameIterator {
+	return &usernameResolver{ctx: ctx, svc: d, applicationID: applicationID, ids: ids}
+}
+
+type usernameResolver struct {
+	ctx           context.Context
+	svc           *ApplicationsService
+	applicationID string
+	ids           UserIDIterator
+	username      string
+	err           error
+}
+
+func (r *usernameResolver) Next() bool {
+	if r.err != nil || !r.ids.Next() {
+		return false
+	}
+	info, err := r.svc.UserInfo(r.applicationID, r.ids.ID()).Context(r.ctx).Send()
+	if err != nil {
+		r.err = err
+		return false
+	}
+	r.username = info.Username
+	return true
+}
+
+func (r *usernameResolver) Username() string { return r.username }
+
+func (r *usernameResolver) Err() error {
+	if r.err != nil {
+		return r.err
+	}
+	return r.ids.Err()
+}
+
+// Defaults used by BulkResetUsers for unset options.
+const (
+	DefaultResetBatchSize   = 100
+	DefaultResetConcurrency = 4
+	DefaultResetRetries     = 3
+	DefaultResetRetryDelay  = time.Second
+)
+
+// BulkResetOptions control the batching of BulkResetUsers.
+type BulkResetOptions struct {
+	BatchSize   int // Usernames per request
+	Concurrency int // Maximum number of requests in flight
+
+	// Retries is the number of times a failed request is retried, waiting
+	// RetryDelay before the first retry and doubling the delay each time.
+	// A negative value disables retries.
+	Retries    int
+	RetryDelay time.Duration
+
+	// Progress, if set, is called after each batch completes. Calls are not
+	// made concurrently.
+	Progress func(BulkResetProgress)
+}
+
+// BulkResetProgress reports the progress of BulkResetUsers.
+type BulkResetProgress struct {
+	Batches int // Batches completed
+	Users   int // Users processed
+	Reset   int // Users reset without problems
+	Failed  int // Users with problems or whose batch failed
+}
+
+// BulkResetOutcome is the result of resetting a single user.
+type BulkResetOutcome struct {
+	Username string
+	Problems []Problem // Problems reported by the API for the user
+	Err      error     // Error of the user's batch after all retries
+}
+
+// Succeeded reports whether the user was reset without problems.
+func (o BulkResetOutcome) Succeeded() bool {
+	return o.Err == nil && len(o.Problems) == 0
+}
+
+// BulkResetReport holds the outcome for every user in the order the usernames
+// were read, together with totals.
+type BulkResetReport struct {
+	Outcomes []BulkResetOutcome
+	Reset    int
+	Failed   int
+
+	// Problems counts the problems reported for all users by domain and
+	// code, joined by a slash.
+	Problems map[string]int
+}
+
+// Failures returns the outcomes of the users that were not reset.
+func (r *BulkResetReport) Failures() []BulkResetOutcome {
+	var fs []BulkResetOutcome
+	for _, o := range r.Outcomes {
+		if !o.Succeeded() {
+			fs = append(fs, o)
+		}
+	}
+	return fs
+}
+
+// ProblemCodes returns the keys of Problems ordered by descending count.
+func (r *BulkResetReport) ProblemCodes() []string {
+	codes := make([]string, 0, len(r.Problems))
+	for c := range r.Problems {
+		codes = append(codes, c)
+	}
+	sort.Slice(codes, func(i, j int) bool {
+		if r.Problems[codes[i]] != r.Problems[codes[j]] {
+			return r.Problems[codes[i]] > r.Problems[codes[j]]
+		}
+		return codes[i] < codes[j]
+	})
+	return codes
+}
+
+// BulkResetUsers resets the users read from users in batches, sending
+// several batches concurrently and retrying failed batches. Usernames may be
+// fed from a listing of the application's users, which lists user IDs:
+//
+//	ids := devClient.Applications.ListUsers(appID).Context(ctx).Iter()
+//	report, err := devClient.Applications.BulkResetUsers(ctx, appID,
+//	    devClient.Applications.ResolveUsernames(ctx, appID, ids), bosgo.BulkResetOptions{})
+//
+// Failed batches do not stop the reset; they are reported in the outcomes
+// of their users. An error is returned only if reading the usernames fails or
+// ctx is cancelled, together with the report of the batches completed so
+// far.
+func (d *ApplicationsService) BulkResetUsers(ctx context.Context, applicationID string, users UsernameIterator, opts BulkResetOptions) (*BulkResetReport, error) {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultResetBatchSize
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = DefaultResetConcurrency
+	}
+	if opts.Retries == 0 {
+		opts.Retries = DefaultResetRetries
+	}
+	if opts.RetryDelay <= 0 {
+		opts.RetryDelay = DefaultResetRetryDelay
+	}
+
+	type batch struct {
+		index int
+		names []string
+	}
+	batches := make(chan batch)
+
+	var mu sync.Mutex
+	var results [][]BulkResetOutcome
+	progress := BulkResetProgress{}
+
+	var wg sync.WaitGroup
+	for i := 0; i < opts.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for b := range batches {
+				outcomes := d.resetBatch(ctx, applicationID, b.names, opts)
+
+				mu.Lock()
+				for len(results) <= b.index {
+					results = append(results, nil)
+				}
+				results[b.index] = outcomes
+				progress.Batches++
+				for _, o := range outcomes {
+					progress.Users++
+					if o.Succeeded() {
+						progress.Reset++
+					} else {
+						progress.Failed++
+					}
+				}
+				if opts.Progress != nil {
+					opts.Progress(progress)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	var err error
+	names := make([]string, 0, opts.BatchSize)
+	index := 0
+	send := func() bool {
+		select {
+		case batches <- batch{index: index, names: names}:
+			index++
+			names = make([]string, 0, opts.BatchSize)
+			return true
+		case <-ctx.Done():
+			err = ctx.Err()
+			return false
+		}
+	}
+	for users.Next() {
+		names = append(names, users.Username())
+		if len(names) == opts.BatchSize && !send() {
+			break
+		}
+	}
+	if err == nil {
+		err = users.Err()
+	}
+	if err == nil && len(names) > 0 {
+		send()
+	}
+	close(batches)
+	wg.Wait()
+
+	report := &BulkResetReport{Problems: map[string]int{}}
+	for _, outcomes := range results {
+		for _, o := range outcomes {
+			report.Outcomes = append(report.Outcomes, o)
+			if o.Succeeded() {
+				report.Reset++
+			} else {
+				report.Failed++
+			}
+			for _, p := range o.Problems {
+				report.Problems[p.Domain+"/"+p.Code]++
+			}
+		}
+	}
+	if err == nil {
+		err = ctx.Err()
+	}
+	return report, err
+}
+
+// resetBatch resets a batch of users, retrying the request if it fails.
+func (d *ApplicationsService) resetBatch(ctx context.Context, applicationID string, names []string, opts BulkResetOptions) []BulkResetOutcome {
+	var res *ResetUsersResponse
+	var err error
+	delay := opts.RetryDelay
+	for attempt := 0; ; attempt++ {
+		res, err = d.ResetUsers(applicationID, names).Context(ctx).Send()
+		if err == nil || attempt >= opts.Retries || ctx.Err() != nil {
+			break
+		}
+		t := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+		case <-t.C:
+		}
+		delay *= 2
+	}
+
+	problems := map[string][]Problem{}
+	if res != nil {
+		for _, u := range res.Users {
+			problems[u.Username] = append(problems[u.Username], u.Problems...)
+		}
+	}
+
+	outcomes := make([]BulkResetOutcome, len(names))
+	for i, name := range names {
+		outcomes[i] = BulkResetOutcome{Username: name, Problems: problems[name], Err: err}
+	}
+	return outcomes
+}
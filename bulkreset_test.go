@@ -0,0 +1,124 @@
+// Copyright 2017 Bankrs AG.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bosgo
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBulkResetUsers(t *testing.T) {
+	var mu sync.Mutex
+	attempts := map[string]int{}
+	routes := routeMap{
+		"/v1/developers/users/reset": {
+			http.MethodPost: func(w http.ResponseWriter, r *http.Request) {
+				var data struct {
+					Usernames []string `json:"usernames"`
+				}
+				json.NewDecoder(r.Body).Decode(&data)
+
+				mu.Lock()
+				attempts[data.Usernames[0]]++
+				n := attempts[data.Usernames[0]]
+				mu.Unlock()
+
+				switch data.Usernames[0] {
+				case "user4":
+					// The second batch succeeds on the second attempt.
+					if n == 1 {
+						errorHandler(w, r)
+						return
+					}
+				case "user7":
+					errorHandler(w, r)
+					return
+				}
+
+				var res ResetUsersResponse
+				for _, u := range data.Usernames {
+					out := ResetUserOutcome{Username: u}
+					if u == "user2" || u == "user5" {
+						out.Problems = []Problem{{Domain: "users", Code: "not_found"}}
+					}
+					res.Users = append(res.Users, out)
+				}
+				w.Header().Set("Content-Type", "application/json; charset=utf-8")
+				json.NewEncoder(w).Encode(res)
+			},
+		},
+	}
+
+	hc, cleanup := startTestServer(t, routes)
+	defer cleanup()
+
+	devClient := NewDevClient(hc, SandboxAddr, "devtoken")
+	var progress []BulkResetProgress
+	report, err := devClient.Applications.BulkResetUsers(context.Background(), "app1",
+		Usernames("user1", "user2", "user3", "user4", "user5", "user6", "user7"),
+		BulkResetOptions{
+			BatchSize:   3,
+			Concurrency: 2,
+			Retries:     1,
+			RetryDelay:  time.Millisecond,
+			Progress:    func(p BulkResetProgress) { progress = append(progress, p) },
+		})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var names []string
+	for _, o := range report.Outcomes {
+		names = append(names, o.Username)
+	}
+	if want := []string{"user1", "user2", "user3", "user4", "user5", "user6", "user7"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("got outcomes for %v, wanted %v", names, want)
+	}
+	if report.Reset != 4 || report.Failed != 3 {
+		t.Errorf("got %d reset and %d failed, wanted 4 and 3", report.Reset, report.Failed)
+	}
+	if !reflect.DeepEqual(report.Problems, map[string]int{"users/not_found": 2}) {
+		t.Errorf("got problems %v", report.Problems)
+	}
+	if report.Outcomes[6].Err == nil {
+		t.Errorf("got nil error for failed batch, wanted non-nil")
+	}
+	if attempts["user4"] != 2 || attempts["user7"] != 2 {
+		t.Errorf("got attempts %v, wanted two for user4 and user7", attempts)
+	}
+
+	if len(progress) != 3 {
+		t.Fatalf("got %d progress reports, wanted 3", len(progress))
+	}
+	if last := progress[2]; last != (BulkResetProgress{Batches: 3, Users: 7, Reset: 4, Failed: 3}) {
+		t.Errorf("got final progress %+v", last)
+	}
+}
+
+func TestBulkResetUsersCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	devClient := NewDevClient(http.DefaultClient, SandboxAddr, "devtoken")
+	_, err := devClient.Applications.BulkResetUsers(ctx, "app1", Usernames("a", "b"), BulkResetOptions{BatchSize: 1})
+	if err != context.Canceled {
+		t.Errorf("got error %v, wanted context.Canceled", err)
+	}
+}
@@ -0,0 +1,218 @@
+// Copyright 2017 Bankrs AG.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bosgo
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultLanguage is the language used for category names when no name is
+// available in the requested language.
+const DefaultLanguage = "en"
+
+// LanguageFallback returns the languages to try, in order, when looking up a
+// name in the given BCP 47 language. Subtags are removed one at a time and the
+// default language is tried last, so "de-AT" yields "de-AT", "de" and "en".
+func LanguageFallback(lang string) []string {
+	lang = strings.Replace(lang, "_", "-", -1)
+	var langs []string
+	for lang != "" {
+		langs = append(langs, lang)
+		i := strings.LastIndex(lang, "-")
+		if i == -1 {
+			break
+		}
+		lang = lang[:i]
+	}
+	for _, l := range langs {
+		if strings.EqualFold(l, DefaultLanguage) {
+			return langs
+		}
+	}
+	return append(langs, DefaultLanguage)
+}
+
+// Name returns the name of the category in the given BCP 47 language using
+// the fallback described by LanguageFallback. Language tags are compared case
+// insensitively. It returns an empty string if no suitable name exists.
+func (c Category) Name(lang string) string {
+	for _, l := range LanguageFallback(lang) {
+		if name, ok := c.Names[l]; ok && name != "" {
+			return name
+		}
+		for k, name := range c.Names {
+			if name != "" && strings.EqualFold(strings.Replace(k, "_", "-", -1), l) {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+// CategoryGroup is a node of a CategoryTree holding all categories that share
+// the same group.
+type CategoryGroup struct {
+	Name       string
+	Categories []Category
+}
+
+// CategoryTree organises a CategoryList into groups and provides lookup of
+// categories by id and by localised name.
+type CategoryTree struct {
+	Groups []*CategoryGroup
+
+	groups map[string]*CategoryGroup
+	byID   map[int64]Category
+}
+
+// NewCategoryTree builds a tree from list. Groups are ordered by name and the
+// categories within a group by id.
+func NewCategoryTree(list CategoryList) *CategoryTree {
+	t := &CategoryTree{
+		groups: map[string]*CategoryGroup{},
+		byID:   make(map[int64]Category, len(list)),
+	}
+
+	for _, c := range list {
+		t.byID[c.ID] = c
+		g, exists := t.groups[c.Group]
+		if !exists {
+			g = &CategoryGroup{Name: c.Group}
+			t.groups[c.Group] = g
+			t.Groups = append(t.Groups, g)
+		}
+		g.Categories = append(g.Categories, c)
+	}
+
+	sort.Slice(t.Groups, func(i, j int) bool { return t.Groups[i].Name < t.Groups[j].Name })
+	for _, g := range t.Groups {
+		cats := g.Categories
+		sort.Slice(cats, func(i, j int) bool { return cats[i].ID < cats[j].ID })
+	}
+	return t
+}
+
+// Group returns the group with the given name.
+func (t *CategoryTree) Group(name string) (*CategoryGroup, bool) {
+	g, ok := t.groups[name]
+	return g, ok
+}
+
+// ByID returns the category with the given id.
+func (t *CategoryTree) ByID(id int64) (Category, bool) {
+	c, ok := t.byID[id]
+	return c, ok
+}
+
+// ByName returns the category whose name in the given language, after
+// fallback, equals name. Names are compared case insensitively. If several
+// categories share the name, the one with the lowest id is returned.
+func (t *CategoryTree) ByName(name string, lang string) (Category, bool) {
+	var found Category
+	var ok bool
+	for _, g := range t.Groups {
+		for _, c := range g.Categories {
+			if strings.EqualFold(c.Name(lang), name) && (!ok || c.ID < found.ID) {
+				found, ok = c, true
+			}
+		}
+	}
+	return found, ok
+}
+
+// Name returns the name of the category with the given id in the given
+// language, or an empty string if the category is unknown.
+func (t *CategoryTree) Name(id int64, lang string) string {
+	c, ok := t.byID[id]
+	if !ok {
+		return ""
+	}
+	return c.Name(lang)
+}
+
+// CachedCategories wraps a CategoriesService and keeps the list of categories
+// in memory, requesting it again only after the TTL has expired. It is safe
+// for concurrent use.
+type CachedCategories struct {
+	svc *CategoriesService
+	ttl time.Duration
+
+	mu      sync.Mutex
+	tree    *CategoryTree
+	list    CategoryList
+	fetched time.Time
+	now     func() time.Time // replaced in tests
+}
+
+// NewCachedCategories returns a cache of the categories provided by svc that
+// are refreshed after ttl has elapsed. A ttl of zero or less keeps the list
+// until Invalidate is called.
+func NewCachedCategories(svc *CategoriesService, ttl time.Duration) *CachedCategories {
+	return &CachedCategories{
+		svc: svc,
+		ttl: ttl,
+		now: time.Now,
+	}
+}
+
+// List returns the list of categories, requesting it from the API if it has
+// not been fetched yet or has expired.
+func (c *CachedCategories) List(ctx context.Context) (CategoryList, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.refresh(ctx); err != nil {
+		return nil, err
+	}
+	return c.list, nil
+}
+
+// Tree returns the categories organised as a CategoryTree, requesting them
+// from the API if they have not been fetched yet or have expired.
+func (c *CachedCategories) Tree(ctx context.Context) (*CategoryTree, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.refresh(ctx); err != nil {
+		return nil, err
+	}
+	return c.tree, nil
+}
+
+// Invalidate discards the cached categories so they are requested again by the
+// next call to List or Tree.
+func (c *CachedCategories) Invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.tree = nil
+	c.list = nil
+}
+
+func (c *CachedCategories) refresh(ctx context.Context) error {
+	if c.tree != nil && (c.ttl <= 0 || c.now().Sub(c.fetched) < c.ttl) {
+		return nil
+	}
+
+	list, err := c.svc.List().Context(ctx).Send()
+	if err != nil {
+		return err
+	}
+	c.list = *list
+	c.tree = NewCategoryTree(*list)
+	c.fetched = c.now()
+	return nil
+}
@@ -0,0 +1,162 @@
+// Copyright 2017 Bankrs AG.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bosgo
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var testCategoryList = CategoryList{
+	{ID: 7, Names: map[string]string{"en": "Rent", "de": "Miete"}, Group: "expenses"},
+	{ID: 5, Names: map[string]string{"en": "Groceries", "de": "Lebensmittel", "de-AT": "Greißler"}, Group: "expenses"},
+	{ID: 6, Names: map[string]string{"en": "Interest", "de": "Zinsen"}, Group: "income"},
+	{ID: 8, Names: map[string]string{"fr": "Divers"}, Group: "other"},
+}
+
+func TestLanguageFallback(t *testing.T) {
+	testCases := []struct {
+		lang string
+		want []string
+	}{
+		{lang: "de-AT", want: []string{"de-AT", "de", "en"}},
+		{lang: "zh_Hant_TW", want: []string{"zh-Hant-TW", "zh-Hant", "zh", "en"}},
+		{lang: "en-GB", want: []string{"en-GB", "en"}},
+		{lang: "", want: []string{"en"}},
+	}
+
+	for _, tc := range testCases {
+		if got := LanguageFallback(tc.lang); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%q: got %v, wanted %v", tc.lang, got, tc.want)
+		}
+	}
+}
+
+func TestCategoryName(t *testing.T) {
+	c := testCategoryList[1]
+	testCases := map[string]string{
+		"de-AT": "Greißler",
+		"de-at": "Greißler",
+		"de-CH": "Lebensmittel",
+		"fr":    "Groceries",
+	}
+	for lang, want := range testCases {
+		if got := c.Name(lang); got != want {
+			t.Errorf("%s: got %q, wanted %q", lang, got, want)
+		}
+	}
+	if got := testCategoryList[3].Name("de"); got != "" {
+		t.Errorf("got %q, wanted no name", got)
+	}
+}
+
+func TestCategoryTree(t *testing.T) {
+	tree := NewCategoryTree(testCategoryList)
+
+	var groups []string
+	for _, g := range tree.Groups {
+		groups = append(groups, g.Name)
+	}
+	if want := []string{"expenses", "income", "other"}; !reflect.DeepEqual(groups, want) {
+		t.Errorf("got groups %v, wanted %v", groups, want)
+	}
+
+	g, ok := tree.Group("expenses")
+	if !ok || len(g.Categories) != 2 || g.Categories[0].ID != 5 {
+		t.Errorf("got expenses group %+v, wanted categories 5 and 7", g)
+	}
+
+	if c, ok := tree.ByID(6); !ok || c.Group != "income" {
+		t.Errorf("got category %+v, wanted interest", c)
+	}
+	if _, ok := tree.ByID(99); ok {
+		t.Errorf("found unknown category")
+	}
+
+	if c, ok := tree.ByName("zinsen", "de-AT"); !ok || c.ID != 6 {
+		t.Errorf("got category %+v, wanted 6", c)
+	}
+	if c, ok := tree.ByName("Interest", "de"); ok {
+		t.Errorf("got category %+v for English name in German, wanted none", c)
+	}
+	clash := NewCategoryTree(CategoryList{
+		{ID: 9, Names: map[string]string{"en": "Fees"}, Group: "expenses"},
+		{ID: 3, Names: map[string]string{"en": "fees"}, Group: "income"},
+	})
+	if c, ok := clash.ByName("Fees", "en"); !ok || c.ID != 3 {
+		t.Errorf("got category %+v for clashing names, wanted 3", c)
+	}
+	if got := tree.Name(7, "de-AT"); got != "Miete" {
+		t.Errorf("got %q, wanted Miete", got)
+	}
+}
+
+func TestCachedCategories(t *testing.T) {
+	requests := 0
+	routes := routeMap{
+		"/v1/categories": {
+			http.MethodGet: func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				w.Header().Set("Content-Type", "application/json; charset=utf-8")
+				json.NewEncoder(w).Encode(testCategoryList)
+			},
+		},
+	}
+
+	hc, cleanup := startTestServer(t, routes)
+	defer cleanup()
+
+	appClient := NewAppClient(hc, SandboxAddr, "appid")
+	cache := NewCachedCategories(appClient.Categories, time.Hour)
+	now := time.Date(2017, 7, 1, 12, 0, 0, 0, time.UTC)
+	cache.now = func() time.Time { return now }
+
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		if _, err := cache.Tree(ctx); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	list, err := cache.List(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(list) != len(testCategoryList) {
+		t.Errorf("got %d categories, wanted %d", len(list), len(testCategoryList))
+	}
+	if requests != 1 {
+		t.Errorf("got %d requests, wanted 1", requests)
+	}
+
+	now = now.Add(time.Hour)
+	if _, err := cache.Tree(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if requests != 2 {
+		t.Errorf("got %d requests after expiry, wanted 2", requests)
+	}
+
+	cache.Invalidate()
+	if _, err := cache.List(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if requests != 3 {
+		t.Errorf("got %d requests after invalidation, wanted 3", requests)
+	}
+}
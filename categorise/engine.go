@@ -0,0 +1,255 @@
+// Copyright 2017 Bankrs AG.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package categorise
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"code.bankrs.com/bosgo"
+)
+
+// DefaultBatchSize is the number of assignments sent in a single request when
+// Engine.BatchSize is zero.
+const DefaultBatchSize = 100
+
+// Resolve sets the category id of every rule that refers to its category by
+// name. Names are compared case insensitively against the names of the
+// categories in all languages.
+func (rs *RuleSet) Resolve(cats bosgo.CategoryList) error {
+	ids := map[string]map[int64]bool{}
+	for _, cat := range cats {
+		for _, name := range cat.Names {
+			key := strings.ToLower(name)
+			if ids[key] == nil {
+				ids[key] = map[int64]bool{}
+			}
+			ids[key][cat.ID] = true
+		}
+	}
+
+	for i := range rs.rules {
+		r := &rs.rules[i]
+		if r.Category == "" {
+			continue
+		}
+		matches := ids[strings.ToLower(r.Category)]
+		switch len(matches) {
+		case 0:
+			return fmt.Errorf("categorise: rule %s: unknown category %q", r.Name, r.Category)
+		case 1:
+			for id := range matches {
+				r.CategoryID = id
+			}
+		default:
+			return fmt.Errorf("categorise: rule %s: category name %q is ambiguous", r.Name, r.Category)
+		}
+	}
+	return nil
+}
+
+// ResolveWith resolves category names like Resolve using the categories
+// listed by svc.
+func (rs *RuleSet) ResolveWith(ctx context.Context, svc *bosgo.CategoriesService) error {
+	cats, err := svc.List().Context(ctx).Send()
+	if err != nil {
+		return err
+	}
+	return rs.Resolve(*cats)
+}
+
+// Assignment is a change of a transaction's category decided by a rule.
+type Assignment struct {
+	Transaction bosgo.Transaction
+	Rule        string
+	From        int64 // Category before the change, zero if uncategorised
+	To          int64
+}
+
+// Evaluate applies the rules to each transaction and returns an assignment
+// for every transaction whose category would change. Rules must have been
+// resolved before if they refer to categories by name.
+func (rs *RuleSet) Evaluate(txs []bosgo.Transaction) ([]Assignment, error) {
+	var as []Assignment
+	for _, tx := range txs {
+		a, ok, err := rs.evaluate(tx)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			as = append(as, a)
+		}
+	}
+	return as, nil
+}
+
+// Iterator is a source of transactions such as *bosgo.TransactionIterator.
+type Iterator interface {
+	Next() bool
+	Transaction() bosgo.Transaction
+	Err() error
+}
+
+// EvaluateIter is like Evaluate but reads the transactions from it.
+func (rs *RuleSet) EvaluateIter(it Iterator) ([]Assignment, error) {
+	var as []Assignment
+	for it.Next() {
+		a, ok, err := rs.evaluate(it.Transaction())
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			as = append(as, a)
+		}
+	}
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+	return as, nil
+}
+
+func (rs *RuleSet) evaluate(tx bosgo.Transaction) (Assignment, bool, error) {
+	r, ok := rs.Match(tx)
+	if !ok {
+		return Assignment{}, false, nil
+	}
+	if r.CategoryID == 0 {
+		return Assignment{}, false, fmt.Errorf("categorise: rule %s: category %q has not been resolved", r.Name, r.Category)
+	}
+	if r.CategoryID == tx.CategoryID {
+		return Assignment{}, false, nil
+	}
+	return Assignment{
+		Transaction: tx,
+		Rule:        r.Name,
+		From:        tx.CategoryID,
+		To:          r.CategoryID,
+	}, true, nil
+}
+
+// Submit sends the assignments to the API in batches of at most batchSize
+// assignments. If a batch fails, the number of assignments that were
+// submitted successfully is returned along with the error.
+func Submit(ctx context.Context, svc *bosgo.TransactionsService, as []Assignment, batchSize int) (int, error) {
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+
+	sent := 0
+	for sent < len(as) {
+		end := sent + batchSize
+		if end > len(as) {
+			end = len(as)
+		}
+
+		req := svc.Categorise().Context(ctx)
+		for _, a := range as[sent:end] {
+			req.Category(strconv.FormatInt(a.Transaction.ID, 10), strconv.FormatInt(a.To, 10))
+		}
+		if err := req.Send(); err != nil {
+			return sent, err
+		}
+		sent = end
+	}
+	return sent, nil
+}
+
+// Engine evaluates a rule set over transactions and submits the resulting
+// category assignments.
+type Engine struct {
+	Rules        *RuleSet
+	Transactions *bosgo.TransactionsService
+	BatchSize    int
+
+	// DryRun prevents assignments from being submitted. If Diff is also set,
+	// a description of each assignment is written to it instead.
+	DryRun bool
+	Diff   io.Writer
+
+	// Categories are used to name categories in the diff.
+	Categories bosgo.CategoryList
+	Language   string
+}
+
+// Run evaluates the rules over the transactions from it and, unless DryRun is
+// set, submits the assignments. It returns the assignments that were made or,
+// in dry-run mode, would have been made.
+func (e *Engine) Run(ctx context.Context, it Iterator) ([]Assignment, error) {
+	as, err := e.Rules.EvaluateIter(it)
+	if err != nil {
+		return nil, err
+	}
+
+	if e.DryRun {
+		if e.Diff != nil {
+			if err := WriteDiff(e.Diff, as, e.Categories, e.Language); err != nil {
+				return as, err
+			}
+		}
+		return as, nil
+	}
+
+	n, err := Submit(ctx, e.Transactions, as, e.BatchSize)
+	if err != nil {
+		return as[:n], fmt.Errorf("categorise: submitted %d of %d assignments: %v", n, len(as), err)
+	}
+	return as, nil
+}
+
+// WriteDiff writes one line per assignment describing the change of category
+// to w. Category names are taken from cats in the given language, falling back
+// as described by bosgo.LanguageFallback and finally to the category id.
+func WriteDiff(w io.Writer, as []Assignment, cats bosgo.CategoryList, lang string) error {
+	for _, a := range as {
+		tx := a.Transaction
+		amount := ""
+		if tx.Amount != nil {
+			amount = tx.Amount.Value + " " + tx.Amount.Currency
+		}
+		date := ""
+		if !tx.EntryDate.IsZero() {
+			date = tx.EntryDate.Format("2006-01-02")
+		}
+		party := tx.Counterparty.Name
+		if tx.Counterparty.Merchant != nil && tx.Counterparty.Merchant.Name != "" {
+			party = tx.Counterparty.Merchant.Name
+		}
+
+		_, err := fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s -> %s\t(%s)\n", tx.ID, date, amount, party,
+			categoryName(cats, a.From, lang), categoryName(cats, a.To, lang), a.Rule)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func categoryName(cats bosgo.CategoryList, id int64, lang string) string {
+	if id == 0 {
+		return "-"
+	}
+	for _, cat := range cats {
+		if cat.ID != id {
+			continue
+		}
+		if name := cat.Name(lang); name != "" {
+			return name
+		}
+	}
+	return strconv.FormatInt(id, 10)
+}
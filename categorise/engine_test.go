@@ -0,0 +1,187 @@
+// Copyright 2017 Bankrs AG.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package categorise
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"code.bankrs.com/bosgo"
+)
+
+var testCategories = bosgo.CategoryList{
+	{ID: 5, Names: map[string]string{"en": "Shopping", "de": "Einkaufen"}, Group: "expenses"},
+	{ID: 6, Names: map[string]string{"en": "Interest", "de": "Zinsen"}, Group: "income"},
+	{ID: 7, Names: map[string]string{"en": "Rent", "de": "Miete"}, Group: "expenses"},
+}
+
+type categorisation struct {
+	ID         string `json:"id"`
+	CategoryID string `json:"category_id"`
+}
+
+// startAPI starts a server answering category listings and recording
+// categorisation requests.
+func startAPI(t *testing.T) (*bosgo.AppClient, *bosgo.UserClient, *[][]categorisation, func()) {
+	var batches [][]categorisation
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/categories", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(testCategories)
+	})
+	mux.HandleFunc("/v1/transactions/categorise", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		var batch []categorisation
+		if err := json.NewDecoder(r.Body).Decode(&batch); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		batches = append(batches, batch)
+	})
+
+	ts := httptest.NewTLSServer(mux)
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("failed to parse server URL: %v", err)
+	}
+
+	appClient := bosgo.NewAppClient(ts.Client(), u.Host, "appid")
+	userClient := bosgo.NewUserClient(ts.Client(), u.Host, "usertoken", "appid")
+	return appClient, userClient, &batches, ts.Close
+}
+
+type sliceIterator struct {
+	txs []bosgo.Transaction
+	pos int
+}
+
+func (it *sliceIterator) Next() bool {
+	it.pos++
+	return it.pos <= len(it.txs)
+}
+
+func (it *sliceIterator) Transaction() bosgo.Transaction { return it.txs[it.pos-1] }
+func (it *sliceIterator) Err() error                     { return nil }
+
+func TestResolve(t *testing.T) {
+	appClient, _, _, cleanup := startAPI(t)
+	defer cleanup()
+
+	rs, err := NewRuleSet([]Rule{
+		{Name: "a", Category: "einkaufen", Match: Match{Merchant: "x"}},
+		{Name: "b", Category: "Interest", Match: Match{Merchant: "y"}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := rs.ResolveWith(context.Background(), appClient.Categories); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	rules := rs.Rules()
+	if rules[0].CategoryID != 5 || rules[1].CategoryID != 6 {
+		t.Errorf("got category ids %d and %d, wanted 5 and 6", rules[0].CategoryID, rules[1].CategoryID)
+	}
+
+	unknown, _ := NewRuleSet([]Rule{{Name: "c", Category: "Travel", Match: Match{Merchant: "z"}}})
+	if err := unknown.Resolve(testCategories); err == nil {
+		t.Errorf("got no error for unknown category, wanted one")
+	}
+}
+
+func TestEngineRun(t *testing.T) {
+	_, userClient, batches, cleanup := startAPI(t)
+	defer cleanup()
+
+	rs, err := ReadRules(strings.NewReader(testRulesYAML), FormatYAML)
+	if err != nil {
+		t.Fatalf("failed to read rules: %v", err)
+	}
+	if err := rs.Resolve(testCategories); err != nil {
+		t.Fatalf("failed to resolve rules: %v", err)
+	}
+
+	e := &Engine{
+		Rules:        rs,
+		Transactions: userClient.Transactions,
+		BatchSize:    1,
+	}
+	as, err := e.Run(context.Background(), &sliceIterator{txs: testTransactions()})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Transaction 5 already has the interest category.
+	if len(as) != 2 {
+		t.Fatalf("got %d assignments, wanted 2", len(as))
+	}
+	if len(*batches) != 2 {
+		t.Fatalf("got %d batches, wanted 2", len(*batches))
+	}
+	want := []categorisation{{ID: "1", CategoryID: "5"}}
+	if got := (*batches)[0]; len(got) != 1 || got[0] != want[0] {
+		t.Errorf("got first batch %+v, wanted %+v", got, want)
+	}
+}
+
+func TestEngineDryRun(t *testing.T) {
+	_, userClient, batches, cleanup := startAPI(t)
+	defer cleanup()
+
+	rs, err := ReadRules(strings.NewReader(testRulesJSON), FormatJSON)
+	if err != nil {
+		t.Fatalf("failed to read rules: %v", err)
+	}
+	if err := rs.Resolve(testCategories); err != nil {
+		t.Fatalf("failed to resolve rules: %v", err)
+	}
+
+	txs := testTransactions()
+	txs[2].CategoryID = 5
+
+	var diff bytes.Buffer
+	e := &Engine{
+		Rules:        rs,
+		Transactions: userClient.Transactions,
+		DryRun:       true,
+		Diff:         &diff,
+		Categories:   testCategories,
+		Language:     "de",
+	}
+	as, err := e.Run(context.Background(), &sliceIterator{txs: txs})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(as) != 2 {
+		t.Errorf("got %d assignments, wanted 2", len(as))
+	}
+	if len(*batches) != 0 {
+		t.Errorf("got %d batches submitted in dry-run mode, wanted none", len(*batches))
+	}
+
+	want := "1\t\t-24.34 EUR\tPayPal\t- -> Einkaufen\t(paypal)\n" +
+		"3\t\t-850.00 EUR\tVermieter\tEinkaufen -> Miete\t(rent)\n"
+	if got := diff.String(); got != want {
+		t.Errorf("got diff:\n%s\nwanted:\n%s", got, want)
+	}
+}
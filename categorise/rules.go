@@ -0,0 +1,263 @@
+// Copyright 2017 Bankrs AG.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package categorise assigns categories to transactions using client side
+// rules and submits the assignments to the Bankrs OS API.
+package categorise
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"code.bankrs.com/bosgo"
+	"code.bankrs.com/bosgo/internal/money"
+)
+
+// Sign restricts a rule to incoming or outgoing transactions.
+type Sign string
+
+const (
+	SignAny    Sign = ""
+	SignCredit Sign = "credit" // Money received
+	SignDebit  Sign = "debit"  // Money spent
+)
+
+// Rule assigns a category to every transaction that satisfies all of its
+// conditions. The category is given either by its id or by its name, which is
+// resolved against the categories known to the API.
+type Rule struct {
+	Name       string `json:"name" yaml:"name"`
+	Priority   int    `json:"priority,omitempty" yaml:"priority,omitempty"`
+	Category   string `json:"category,omitempty" yaml:"category,omitempty"`
+	CategoryID int64  `json:"category_id,omitempty" yaml:"category_id,omitempty"`
+	Match      Match  `json:"match" yaml:"match"`
+}
+
+// Match holds the conditions of a rule. Empty conditions are ignored. Text
+// conditions other than Usage match case insensitively anywhere within the
+// transaction's field. Amounts are compared by absolute value and both bounds
+// are inclusive.
+type Match struct {
+	Counterparty    string `json:"counterparty,omitempty" yaml:"counterparty,omitempty"`
+	IBAN            string `json:"iban,omitempty" yaml:"iban,omitempty"`
+	Merchant        string `json:"merchant,omitempty" yaml:"merchant,omitempty"`
+	Usage           string `json:"usage,omitempty" yaml:"usage,omitempty"` // Regular expression
+	MinAmount       string `json:"min_amount,omitempty" yaml:"min_amount,omitempty"`
+	MaxAmount       string `json:"max_amount,omitempty" yaml:"max_amount,omitempty"`
+	Sign            Sign   `json:"sign,omitempty" yaml:"sign,omitempty"`
+	TransactionType string `json:"transaction_type,omitempty" yaml:"transaction_type,omitempty"`
+}
+
+type compiledRule struct {
+	Rule
+	usage    *regexp.Regexp
+	min, max *money.Amount
+}
+
+// RuleSet is an ordered set of rules. Rules with a higher priority are
+// evaluated first; rules with equal priority keep the order they were given
+// in.
+type RuleSet struct {
+	rules []compiledRule
+}
+
+// NewRuleSet validates and compiles the given rules.
+func NewRuleSet(rules []Rule) (*RuleSet, error) {
+	rs := &RuleSet{rules: make([]compiledRule, 0, len(rules))}
+	for i, r := range rules {
+		cr, err := compile(r)
+		if err != nil {
+			name := r.Name
+			if name == "" {
+				name = fmt.Sprintf("#%d", i+1)
+			}
+			return nil, fmt.Errorf("categorise: rule %s: %v", name, err)
+		}
+		rs.rules = append(rs.rules, cr)
+	}
+
+	sort.SliceStable(rs.rules, func(i, j int) bool {
+		return rs.rules[i].Priority > rs.rules[j].Priority
+	})
+	return rs, nil
+}
+
+func compile(r Rule) (compiledRule, error) {
+	cr := compiledRule{Rule: r}
+	if r.Category == "" && r.CategoryID == 0 {
+		return cr, fmt.Errorf("no category")
+	}
+
+	m := r.Match
+	if m == (Match{}) {
+		return cr, fmt.Errorf("no conditions")
+	}
+	if m.Usage != "" {
+		re, err := regexp.Compile(m.Usage)
+		if err != nil {
+			return cr, fmt.Errorf("invalid usage pattern: %v", err)
+		}
+		cr.usage = re
+	}
+	if m.MinAmount != "" {
+		v, err := money.Parse(m.MinAmount)
+		if err != nil {
+			return cr, fmt.Errorf("invalid min_amount: %v", err)
+		}
+		v = v.Abs()
+		cr.min = &v
+	}
+	if m.MaxAmount != "" {
+		v, err := money.Parse(m.MaxAmount)
+		if err != nil {
+			return cr, fmt.Errorf("invalid max_amount: %v", err)
+		}
+		v = v.Abs()
+		cr.max = &v
+	}
+	if cr.min != nil && cr.max != nil && *cr.min > *cr.max {
+		return cr, fmt.Errorf("min_amount is greater than max_amount")
+	}
+	switch m.Sign {
+	case SignAny, SignCredit, SignDebit:
+	default:
+		return cr, fmt.Errorf("invalid sign %q", m.Sign)
+	}
+	return cr, nil
+}
+
+// Rules returns the rules of the set in evaluation order.
+func (rs *RuleSet) Rules() []Rule {
+	rules := make([]Rule, len(rs.rules))
+	for i, cr := range rs.rules {
+		rules[i] = cr.Rule
+	}
+	return rules
+}
+
+// Match returns the first rule in evaluation order that matches tx.
+func (rs *RuleSet) Match(tx bosgo.Transaction) (Rule, bool) {
+	for _, cr := range rs.rules {
+		if cr.matches(tx) {
+			return cr.Rule, true
+		}
+	}
+	return Rule{}, false
+}
+
+func (cr *compiledRule) matches(tx bosgo.Transaction) bool {
+	m := cr.Match
+	if m.Counterparty != "" && !containsFold(tx.Counterparty.Name, m.Counterparty) {
+		return false
+	}
+	if m.IBAN != "" && compact(tx.Counterparty.Account.IBAN) != compact(m.IBAN) {
+		return false
+	}
+	if m.Merchant != "" && (tx.Counterparty.Merchant == nil || !containsFold(tx.Counterparty.Merchant.Name, m.Merchant)) {
+		return false
+	}
+	if cr.usage != nil && !cr.usage.MatchString(tx.Usage) {
+		return false
+	}
+	if m.TransactionType != "" && !strings.EqualFold(tx.TransactionType, m.TransactionType) {
+		return false
+	}
+
+	if m.Sign == SignAny && cr.min == nil && cr.max == nil {
+		return true
+	}
+	if tx.Amount == nil {
+		return false
+	}
+	amt, err := money.Parse(tx.Amount.Value)
+	if err != nil {
+		return false
+	}
+	switch {
+	case m.Sign == SignCredit && amt.Sign() < 0, m.Sign == SignDebit && amt.Sign() > 0:
+		return false
+	case cr.min != nil && amt.Abs() < *cr.min, cr.max != nil && amt.Abs() > *cr.max:
+		return false
+	}
+	return true
+}
+
+// Format is the encoding of a rules file.
+type Format string
+
+const (
+	FormatJSON Format = "json"
+	FormatYAML Format = "yaml"
+)
+
+// ruleFile is the top level structure of a rules file.
+type ruleFile struct {
+	Rules []Rule `json:"rules" yaml:"rules"`
+}
+
+// ReadRules reads a rule set from r in the given format. The document is an
+// object with a single "rules" list.
+func ReadRules(r io.Reader, format Format) (*RuleSet, error) {
+	var f ruleFile
+	switch format {
+	case FormatJSON:
+		dec := json.NewDecoder(r)
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&f); err != nil {
+			return nil, fmt.Errorf("categorise: failed to parse rules: %v", err)
+		}
+	case FormatYAML:
+		dec := yaml.NewDecoder(r)
+		dec.KnownFields(true)
+		if err := dec.Decode(&f); err != nil {
+			return nil, fmt.Errorf("categorise: failed to parse rules: %v", err)
+		}
+	default:
+		return nil, fmt.Errorf("categorise: unsupported rules format %q", format)
+	}
+	return NewRuleSet(f.Rules)
+}
+
+// LoadRules reads a rule set from the named file. Files with a .yaml or .yml
+// extension are read as YAML, all others as JSON.
+func LoadRules(filename string) (*RuleSet, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	format := FormatJSON
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".yaml", ".yml":
+		format = FormatYAML
+	}
+	return ReadRules(f, format)
+}
+
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
+
+func compact(iban string) string {
+	return strings.ToUpper(strings.Replace(iban, " ", "", -1))
+}
@@ -0,0 +1,147 @@
+// Copyright 2017 Bankrs AG.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package categorise
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"code.bankrs.com/bosgo"
+)
+
+const testRulesYAML = `
+rules:
+  - name: paypal
+    category: Shopping
+    match:
+      merchant: paypal
+      sign: debit
+  - name: rent
+    priority: 10
+    category_id: 7
+    match:
+      iban: DE56 2008 0095 0445 6889 21
+      usage: (?i)miete
+      min_amount: "500"
+      max_amount: "1500"
+  - name: interest
+    category: Interest
+    match:
+      transaction_type: interest
+`
+
+const testRulesJSON = `{
+  "rules": [
+    {"name": "paypal", "category": "Shopping", "match": {"merchant": "paypal", "sign": "debit"}},
+    {"name": "rent", "priority": 10, "category_id": 7, "match": {
+      "iban": "DE56 2008 0095 0445 6889 21", "usage": "(?i)miete", "min_amount": "500", "max_amount": "1500"}},
+    {"name": "interest", "category": "Interest", "match": {"transaction_type": "interest"}}
+  ]
+}`
+
+func testTransactions() []bosgo.Transaction {
+	return []bosgo.Transaction{
+		{
+			ID:           1,
+			Amount:       &bosgo.MoneyAmount{Currency: "EUR", Value: "-24.34"},
+			Counterparty: bosgo.Counterparty{Name: "PayPal Europe", Merchant: &bosgo.Merchant{Name: "PayPal"}},
+		},
+		{
+			ID:           2,
+			Amount:       &bosgo.MoneyAmount{Currency: "EUR", Value: "24.34"},
+			Counterparty: bosgo.Counterparty{Name: "PayPal Europe", Merchant: &bosgo.Merchant{Name: "PayPal"}},
+		},
+		{
+			ID:     3,
+			Amount: &bosgo.MoneyAmount{Currency: "EUR", Value: "-850.00"},
+			Counterparty: bosgo.Counterparty{
+				Name:    "Vermieter",
+				Account: bosgo.AccountRef{IBAN: "DE56200800950445688921"},
+			},
+			Usage: "MIETE August",
+		},
+		{
+			ID:     4,
+			Amount: &bosgo.MoneyAmount{Currency: "EUR", Value: "-1850.00"},
+			Counterparty: bosgo.Counterparty{
+				Name:    "Vermieter",
+				Account: bosgo.AccountRef{IBAN: "DE56200800950445688921"},
+			},
+			Usage: "Miete und Nachzahlung",
+		},
+		{
+			ID:              5,
+			Amount:          &bosgo.MoneyAmount{Currency: "EUR", Value: "0.05"},
+			TransactionType: "Interest",
+			CategoryID:      6,
+		},
+	}
+}
+
+func TestReadRules(t *testing.T) {
+	fromYAML, err := ReadRules(strings.NewReader(testRulesYAML), FormatYAML)
+	if err != nil {
+		t.Fatalf("failed to read YAML rules: %v", err)
+	}
+	fromJSON, err := ReadRules(strings.NewReader(testRulesJSON), FormatJSON)
+	if err != nil {
+		t.Fatalf("failed to read JSON rules: %v", err)
+	}
+
+	if !reflect.DeepEqual(fromYAML.Rules(), fromJSON.Rules()) {
+		t.Errorf("YAML rules %+v differ from JSON rules %+v", fromYAML.Rules(), fromJSON.Rules())
+	}
+
+	var names []string
+	for _, r := range fromYAML.Rules() {
+		names = append(names, r.Name)
+	}
+	if want := []string{"rent", "paypal", "interest"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("got rule order %v, wanted %v", names, want)
+	}
+}
+
+func TestReadRulesInvalid(t *testing.T) {
+	testCases := []string{
+		`{"rules": [{"name": "a", "match": {"merchant": "x"}}]}`,                                        // no category
+		`{"rules": [{"name": "a", "category_id": 1, "match": {}}]}`,                                     // no conditions
+		`{"rules": [{"name": "a", "category_id": 1, "match": {"usage": "("}}]}`,                         // bad regexp
+		`{"rules": [{"name": "a", "category_id": 1, "match": {"sign": "up"}}]}`,                         // bad sign
+		`{"rules": [{"name": "a", "category_id": 1, "match": {"min_amount": "5", "max_amount": "1"}}]}`, // bad range
+		`{"rules": [{"name": "a", "category_id": 1, "match": {"payee": "x"}}]}`,                         // unknown field
+	}
+
+	for _, tc := range testCases {
+		if _, err := ReadRules(strings.NewReader(tc), FormatJSON); err == nil {
+			t.Errorf("%s: got no error, wanted one", tc)
+		}
+	}
+}
+
+func TestRuleSetMatch(t *testing.T) {
+	rs, err := ReadRules(strings.NewReader(testRulesYAML), FormatYAML)
+	if err != nil {
+		t.Fatalf("failed to read rules: %v", err)
+	}
+
+	want := map[int64]string{1: "paypal", 3: "rent", 5: "interest"}
+	for _, tx := range testTransactions() {
+		r, ok := rs.Match(tx)
+		if ok != (want[tx.ID] != "") || r.Name != want[tx.ID] {
+			t.Errorf("transaction %d: got rule %q (matched %v), wanted %q", tx.ID, r.Name, ok, want[tx.ID])
+		}
+	}
+}
@@ -0,0 +1,294 @@
+// Copyright 2017 Bankrs AG.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package challengeform turns the challenges of a provider or a job into a
+// renderer neutral form description and validates the answers entered by a
+// user before they are sent to the API.
+//
+// A typical use when adding an access:
+//
+//	form := challengeform.FromProvider(provider)
+//	answers, err := form.Answers(values, true)
+//	if err != nil {
+//		// show err.(*challengeform.ValidationError).Problems next to the fields
+//	}
+//	req := userClient.Accesses.Add(provider.ID)
+//	for _, a := range answers {
+//		req.ChallengeAnswer(a)
+//	}
+package challengeform
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"code.bankrs.com/bosgo"
+)
+
+// Input is the kind of control suited to entering the answer of a field.
+type Input string
+
+const (
+	InputText     Input = "text"     // Free text entry
+	InputPassword Input = "password" // Text entry whose value must be masked
+	InputChoice   Input = "choice"   // Selection of one of the field's options
+)
+
+// Field describes a single answer requested by a challenge.
+type Field struct {
+	ID          string
+	Label       string
+	Input       Input
+	Type        bosgo.ChallengeType // Characters allowed in the answer, empty if unrestricted
+	Secure      bool                // The answer is secret and must not be displayed or logged
+	Required    bool
+	Storeable   bool              // The answer may be stored by the API
+	Stored      bool              // An answer is already stored and may be omitted
+	Default     string            // Previous answer to prefill, never set for secure fields
+	Options     []string          // Allowed answers of a choice field
+	Info        map[string]string // Additional information to display, such as a TAN challenge
+	Description string            // Reset hints and similar notes for the user
+}
+
+// Form is an ordered list of fields.
+type Form struct {
+	Fields []Field
+}
+
+// FromProvider returns the form for adding an access to the provider.
+func FromProvider(p bosgo.Provider) *Form {
+	return FromSpecs(p.Challenges)
+}
+
+// FromSpecs returns a form with a field for each challenge specification. All
+// fields of a specification are required.
+func FromSpecs(specs []bosgo.ChallengeSpec) *Form {
+	f := &Form{}
+	for _, s := range specs {
+		f.Fields = append(f.Fields, Field{
+			ID:        s.ID,
+			Label:     s.Description,
+			Input:     inputFor(s.Secure, s.Methods),
+			Type:      s.Type,
+			Secure:    s.Secure,
+			Required:  true,
+			Storeable: !s.UnStoreable,
+			Options:   s.Methods,
+			Info:      s.Info,
+		})
+	}
+	return f
+}
+
+// FromChallenge returns the form for answering the next challenges of a job.
+func FromChallenge(c bosgo.Challenge) *Form {
+	return FromFields(c.NextChallenges)
+}
+
+// FromFields returns a form with a field for each challenge field. Fields
+// whose answer is already stored are not required unless the stored answer
+// has been reset.
+func FromFields(fields []bosgo.ChallengeField) *Form {
+	f := &Form{}
+	for _, cf := range fields {
+		fld := Field{
+			ID:        cf.ID,
+			Label:     cf.Description,
+			Input:     inputFor(cf.Secure, cf.Methods),
+			Type:      bosgo.ChallengeType(cf.ChallengeType),
+			Secure:    cf.Secure,
+			Required:  !cf.Optional && (!cf.Stored || cf.Reset),
+			Storeable: !cf.UnStoreable,
+			Stored:    cf.Stored && !cf.Reset,
+			Options:   cf.Methods,
+			Info:      cf.Info,
+		}
+		if !cf.Secure {
+			fld.Default = cf.Previous
+		}
+		if cf.Reset {
+			fld.Description = "The stored answer is no longer valid and must be entered again."
+		}
+		f.Fields = append(f.Fields, fld)
+	}
+	return f
+}
+
+func inputFor(secure bool, methods []string) Input {
+	switch {
+	case len(methods) > 0:
+		return InputChoice
+	case secure:
+		return InputPassword
+	}
+	return InputText
+}
+
+// Field returns the field with the given id.
+func (f *Form) Field(id string) (Field, bool) {
+	for _, fld := range f.Fields {
+		if fld.ID == id {
+			return fld, true
+		}
+	}
+	return Field{}, false
+}
+
+// Problem codes reported in a FieldError.
+const (
+	ProblemRequired   = "required"
+	ProblemCharacters = "invalid_characters"
+	ProblemOption     = "unknown_option"
+	ProblemField      = "unknown_field"
+)
+
+// FieldError is a problem with the answer given for a field.
+type FieldError struct {
+	Field string
+	Code  string // One of the Problem constants
+}
+
+func (e FieldError) Error() string {
+	switch e.Code {
+	case ProblemRequired:
+		return e.Field + ": an answer is required"
+	case ProblemCharacters:
+		return e.Field + ": answer contains invalid characters"
+	case ProblemOption:
+		return e.Field + ": answer is not one of the allowed options"
+	case ProblemField:
+		return e.Field + ": not part of the form"
+	}
+	return e.Field + ": " + e.Code
+}
+
+// ValidationError reports all problems found while validating answers.
+type ValidationError struct {
+	Problems []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	if len(e.Problems) == 1 {
+		return "challengeform: " + e.Problems[0].Error()
+	}
+	msgs := make([]string, len(e.Problems))
+	for i, p := range e.Problems {
+		msgs[i] = p.Error()
+	}
+	return fmt.Sprintf("challengeform: %d validation problems: %s", len(e.Problems), strings.Join(msgs, "; "))
+}
+
+// Validate checks the answers, keyed by field id, against the form. Answers
+// for fields that are not part of the form are rejected. If any problems are
+// found it returns a *ValidationError listing all of them in field order.
+func (f *Form) Validate(values map[string]string) error {
+	verr := &ValidationError{}
+	for _, fld := range f.Fields {
+		if err := fld.Validate(values[fld.ID]); err != nil {
+			verr.Problems = append(verr.Problems, *err)
+		}
+	}
+
+	var unknown []string
+	for id := range values {
+		if _, ok := f.Field(id); !ok {
+			unknown = append(unknown, id)
+		}
+	}
+	sort.Strings(unknown)
+	for _, id := range unknown {
+		verr.Problems = append(verr.Problems, FieldError{Field: id, Code: ProblemField})
+	}
+
+	if len(verr.Problems) > 0 {
+		return verr
+	}
+	return nil
+}
+
+// Validate checks a single answer for the field. An empty answer is only
+// valid for fields that are not required.
+func (fld Field) Validate(value string) *FieldError {
+	if value == "" {
+		if fld.Required {
+			return &FieldError{Field: fld.ID, Code: ProblemRequired}
+		}
+		return nil
+	}
+
+	if len(fld.Options) > 0 {
+		for _, o := range fld.Options {
+			if o == value {
+				return nil
+			}
+		}
+		return &FieldError{Field: fld.ID, Code: ProblemOption}
+	}
+
+	if !ValidCharacters(fld.Type, value) {
+		return &FieldError{Field: fld.ID, Code: ProblemCharacters}
+	}
+	return nil
+}
+
+// ValidCharacters reports whether value consists only of the characters
+// allowed by the challenge type: letters for ChallengeTypeAlpha, the digits 0
+// to 9 for ChallengeTypeNumeric and both for ChallengeTypeAlphaNumeric. Values
+// of any other type are not restricted.
+func ValidCharacters(typ bosgo.ChallengeType, value string) bool {
+	for _, r := range value {
+		var ok bool
+		switch typ {
+		case bosgo.ChallengeTypeAlpha:
+			ok = unicode.IsLetter(r)
+		case bosgo.ChallengeTypeNumeric:
+			ok = r >= '0' && r <= '9'
+		case bosgo.ChallengeTypeAlphaNumeric:
+			ok = unicode.IsLetter(r) || (r >= '0' && r <= '9')
+		default:
+			ok = true
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// Answers validates the values and returns them as challenge answers in field
+// order, ready to be passed to AddAccessReq.ChallengeAnswer or
+// JobAnswerReq.ChallengeAnswer. Fields left empty are omitted. store requests
+// that the API keeps the answers; it is ignored for fields that are not
+// storeable.
+func (f *Form) Answers(values map[string]string, store bool) (bosgo.ChallengeAnswerList, error) {
+	if err := f.Validate(values); err != nil {
+		return nil, err
+	}
+
+	var answers bosgo.ChallengeAnswerList
+	for _, fld := range f.Fields {
+		v := values[fld.ID]
+		if v == "" {
+			continue
+		}
+		answers = append(answers, bosgo.ChallengeAnswer{
+			ID:    fld.ID,
+			Value: v,
+			Store: store && fld.Storeable,
+		})
+	}
+	return answers, nil
+}
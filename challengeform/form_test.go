@@ -0,0 +1,156 @@
+// Copyright 2017 Bankrs AG.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package challengeform
+
+import (
+	"reflect"
+	"testing"
+
+	"code.bankrs.com/bosgo"
+)
+
+var testProvider = bosgo.Provider{
+	ID: "DE-BIN-BLZ-10070000",
+	Challenges: []bosgo.ChallengeSpec{
+		{ID: "login", Description: "Login name", Type: bosgo.ChallengeTypeAlphaNumeric},
+		{ID: "pin", Description: "PIN", Type: bosgo.ChallengeTypeNumeric, Secure: true, UnStoreable: true},
+		{ID: "method", Description: "TAN method", Methods: []string{"901", "902"}},
+	},
+}
+
+func TestFromProvider(t *testing.T) {
+	f := FromProvider(testProvider)
+	if len(f.Fields) != 3 {
+		t.Fatalf("got %d fields, wanted 3", len(f.Fields))
+	}
+
+	want := []Field{
+		{ID: "login", Label: "Login name", Input: InputText, Type: bosgo.ChallengeTypeAlphaNumeric, Required: true, Storeable: true},
+		{ID: "pin", Label: "PIN", Input: InputPassword, Type: bosgo.ChallengeTypeNumeric, Secure: true, Required: true},
+		{ID: "method", Label: "TAN method", Input: InputChoice, Required: true, Storeable: true, Options: []string{"901", "902"}},
+	}
+	if !reflect.DeepEqual(f.Fields, want) {
+		t.Errorf("got fields\n%+v\nwanted\n%+v", f.Fields, want)
+	}
+}
+
+func TestFromChallenge(t *testing.T) {
+	f := FromChallenge(bosgo.Challenge{NextChallenges: []bosgo.ChallengeField{
+		{ID: "login", ChallengeType: "alphanumeric", Previous: "jdoe", Stored: true},
+		{ID: "pin", ChallengeType: "numeric", Previous: "1234", Secure: true, Stored: true, Reset: true},
+		{ID: "hint", Optional: true, Info: map[string]string{"text": "Enter a memo"}},
+	}})
+
+	login, _ := f.Field("login")
+	if login.Required || !login.Stored || login.Default != "jdoe" {
+		t.Errorf("got login field %+v, wanted optional stored field with default", login)
+	}
+	pin, _ := f.Field("pin")
+	if !pin.Required || pin.Stored || pin.Default != "" || pin.Description == "" {
+		t.Errorf("got pin field %+v, wanted required reset field without default", pin)
+	}
+	hint, _ := f.Field("hint")
+	if hint.Required || hint.Info["text"] != "Enter a memo" {
+		t.Errorf("got hint field %+v, wanted optional field with info", hint)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	f := FromProvider(testProvider)
+
+	testCases := []struct {
+		values map[string]string
+		want   []FieldError
+	}{
+		{
+			values: map[string]string{"login": "jdoe42", "pin": "1234", "method": "901"},
+		},
+		{
+			values: map[string]string{"login": "jdoe42", "pin": "12a4", "method": "903"},
+			want: []FieldError{
+				{Field: "pin", Code: ProblemCharacters},
+				{Field: "method", Code: ProblemOption},
+			},
+		},
+		{
+			values: map[string]string{"login": "j.doe", "method": "902", "extra": "x"},
+			want: []FieldError{
+				{Field: "login", Code: ProblemCharacters},
+				{Field: "pin", Code: ProblemRequired},
+				{Field: "extra", Code: ProblemField},
+			},
+		},
+	}
+
+	for i, tc := range testCases {
+		err := f.Validate(tc.values)
+		if tc.want == nil {
+			if err != nil {
+				t.Errorf("%d: unexpected error: %v", i, err)
+			}
+			continue
+		}
+		verr, ok := err.(*ValidationError)
+		if !ok {
+			t.Errorf("%d: got error %v, wanted *ValidationError", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(verr.Problems, tc.want) {
+			t.Errorf("%d: got problems %+v, wanted %+v", i, verr.Problems, tc.want)
+		}
+	}
+}
+
+func TestValidCharacters(t *testing.T) {
+	testCases := []struct {
+		typ   bosgo.ChallengeType
+		value string
+		want  bool
+	}{
+		{typ: bosgo.ChallengeTypeAlpha, value: "Müller", want: true},
+		{typ: bosgo.ChallengeTypeAlpha, value: "abc1", want: false},
+		{typ: bosgo.ChallengeTypeNumeric, value: "0815", want: true},
+		{typ: bosgo.ChallengeTypeNumeric, value: "٣", want: false},
+		{typ: bosgo.ChallengeTypeAlphaNumeric, value: "abc123", want: true},
+		{typ: bosgo.ChallengeTypeAlphaNumeric, value: "abc 123", want: false},
+		{typ: "", value: "any thing!", want: true},
+	}
+	for _, tc := range testCases {
+		if got := ValidCharacters(tc.typ, tc.value); got != tc.want {
+			t.Errorf("%s %q: got %v, wanted %v", tc.typ, tc.value, got, tc.want)
+		}
+	}
+}
+
+func TestAnswers(t *testing.T) {
+	f := FromProvider(testProvider)
+
+	answers, err := f.Answers(map[string]string{"login": "jdoe42", "pin": "1234", "method": "901"}, true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := bosgo.ChallengeAnswerList{
+		{ID: "login", Value: "jdoe42", Store: true},
+		{ID: "pin", Value: "1234", Store: false},
+		{ID: "method", Value: "901", Store: true},
+	}
+	if !reflect.DeepEqual(answers, want) {
+		t.Errorf("got answers %+v, wanted %+v", answers, want)
+	}
+
+	if _, err := f.Answers(map[string]string{"login": "jdoe42"}, false); err == nil {
+		t.Errorf("got nil error for missing answers, wanted non-nil")
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright 2017 Bankrs AG.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package challengeform
+
+import (
+	"encoding/json"
+
+	"code.bankrs.com/bosgo"
+)
+
+// SchemaVersion is the JSON Schema dialect of the schemas produced by
+// Form.Schema.
+const SchemaVersion = "http://json-schema.org/draft-07/schema#"
+
+// Schema is a JSON Schema describing the answers to a form as an object with
+// one string property per field.
+type Schema struct {
+	Schema               string               `json:"$schema"`
+	Type                 string               `json:"type"`
+	Properties           map[string]*Property `json:"properties"`
+	Required             []string             `json:"required,omitempty"`
+	AdditionalProperties bool                 `json:"additionalProperties"`
+
+	// Order lists the property names in the order the fields should be
+	// displayed since JSON objects are unordered.
+	Order []string `json:"x-order"`
+}
+
+// Property is the schema of a single field. Fields that are not part of
+// JSON Schema are prefixed with x-.
+type Property struct {
+	Type        string            `json:"type"`
+	Title       string            `json:"title,omitempty"`
+	Description string            `json:"description,omitempty"`
+	Pattern     string            `json:"pattern,omitempty"`
+	Enum        []string          `json:"enum,omitempty"`
+	Default     string            `json:"default,omitempty"`
+	WriteOnly   bool              `json:"writeOnly,omitempty"`
+	Format      string            `json:"format,omitempty"`
+	Storeable   bool              `json:"x-storeable"`
+	Stored      bool              `json:"x-stored,omitempty"`
+	Info        map[string]string `json:"x-info,omitempty"`
+}
+
+// patterns are the regular expressions matching the characters accepted by
+// ValidCharacters. They need a Unicode aware (ECMA 262 "u" flag) validator.
+var patterns = map[bosgo.ChallengeType]string{
+	bosgo.ChallengeTypeAlpha:        `^\p{L}+$`,
+	bosgo.ChallengeTypeNumeric:      `^[0-9]+$`,
+	bosgo.ChallengeTypeAlphaNumeric: `^[\p{L}0-9]+$`,
+}
+
+// Schema returns the JSON Schema of the form. Secure fields are marked as
+// write only with the password format.
+func (f *Form) Schema() *Schema {
+	s := &Schema{
+		Schema:     SchemaVersion,
+		Type:       "object",
+		Properties: make(map[string]*Property, len(f.Fields)),
+	}
+	for _, fld := range f.Fields {
+		p := &Property{
+			Type:        "string",
+			Title:       fld.Label,
+			Description: fld.Description,
+			Pattern:     patterns[fld.Type],
+			Enum:        fld.Options,
+			Default:     fld.Default,
+			Storeable:   fld.Storeable,
+			Stored:      fld.Stored,
+			Info:        fld.Info,
+		}
+		if len(fld.Options) > 0 {
+			p.Pattern = ""
+		}
+		if fld.Secure {
+			p.WriteOnly = true
+			p.Format = "password"
+		}
+		s.Properties[fld.ID] = p
+		s.Order = append(s.Order, fld.ID)
+		if fld.Required {
+			s.Required = append(s.Required, fld.ID)
+		}
+	}
+	return s
+}
+
+// MarshalJSON returns the JSON Schema of the form.
+func (f *Form) MarshalJSON() ([]byte, error) {
+	return json.Marshal(f.Schema())
+}
@@ -0,0 +1,54 @@
+// Copyright 2017 Bankrs AG.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package challengeform
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestSchema(t *testing.T) {
+	data, err := json.Marshal(FromProvider(testProvider))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var got map[string]interface{}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var want map[string]interface{}
+	err = json.Unmarshal([]byte(`{
+		"$schema": "http://json-schema.org/draft-07/schema#",
+		"type": "object",
+		"properties": {
+			"login": {"type": "string", "title": "Login name", "pattern": "^[\\p{L}0-9]+$", "x-storeable": true},
+			"pin": {"type": "string", "title": "PIN", "pattern": "^[0-9]+$", "writeOnly": true, "format": "password", "x-storeable": false},
+			"method": {"type": "string", "title": "TAN method", "enum": ["901", "902"], "x-storeable": true}
+		},
+		"required": ["login", "pin", "method"],
+		"additionalProperties": false,
+		"x-order": ["login", "pin", "method"]
+	}`), &want)
+	if err != nil {
+		t.Fatalf("invalid expected schema: %v", err)
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got schema\n%s", data)
+	}
+}
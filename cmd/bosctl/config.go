@@ -0,0 +1,135 @@
+// Copyright 2017 Bankrs AG.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// DefaultProfile is the name of the profile used when none is selected.
+const DefaultProfile = "default"
+
+// Config is the contents of the configuration file.
+type Config struct {
+	Current  string              `json:"current,omitempty"` // Profile selected by "profile use"
+	Profiles map[string]*Profile `json:"profiles"`
+}
+
+// Profile holds the settings and sessions for one API address.
+type Profile struct {
+	Addr           string `json:"addr,omitempty"`
+	Environment    string `json:"environment,omitempty"`
+	ApplicationID  string `json:"application_id,omitempty"`
+	DeveloperToken string `json:"developer_token,omitempty"`
+	UserToken      string `json:"user_token,omitempty"`
+	Username       string `json:"username,omitempty"` // User of the saved user session
+}
+
+func defaultConfigPath() string {
+	if p := os.Getenv("BOSCTL_CONFIG"); p != "" {
+		return p
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "bosctl.json"
+	}
+	return filepath.Join(dir, "bosctl", "config.json")
+}
+
+// LoadConfig reads the configuration file. A missing file results in an
+// empty configuration.
+func LoadConfig(filename string) (*Config, error) {
+	cfg := &Config{Profiles: map[string]*Profile{}}
+	data, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read config: %v", err)
+	}
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("parse config %s: %v", filename, err)
+	}
+	if cfg.Profiles == nil {
+		cfg.Profiles = map[string]*Profile{}
+	}
+	return cfg, nil
+}
+
+// Save writes the configuration file, which is only readable by the owner
+// since it contains session tokens.
+func (c *Config) Save(filename string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(filename)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("save config: %v", err)
+	}
+
+	f, err := ioutil.TempFile(dir, ".bosctl")
+	if err != nil {
+		return fmt.Errorf("save config: %v", err)
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return fmt.Errorf("save config: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("save config: %v", err)
+	}
+	if err := os.Rename(f.Name(), filename); err != nil {
+		return fmt.Errorf("save config: %v", err)
+	}
+	return nil
+}
+
+// ProfileName returns name if set, otherwise the current or default profile.
+func (c *Config) ProfileName(name string) string {
+	switch {
+	case name != "":
+		return name
+	case c.Current != "":
+		return c.Current
+	}
+	return DefaultProfile
+}
+
+// Profile returns the named profile, adding an empty one if it does not exist.
+func (c *Config) Profile(name string) *Profile {
+	p, ok := c.Profiles[name]
+	if !ok {
+		p = &Profile{}
+		c.Profiles[name] = p
+	}
+	return p
+}
+
+// Names returns the sorted names of the profiles.
+func (c *Config) Names() []string {
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
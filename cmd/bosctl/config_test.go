@@ -0,0 +1,64 @@
+// Copyright 2017 Bankrs AG.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestConfigRoundTrip(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "sub", "config.json")
+
+	cfg, err := LoadConfig(filename)
+	if err != nil {
+		t.Fatalf("load missing config: %v", err)
+	}
+	if got := cfg.ProfileName(""); got != DefaultProfile {
+		t.Errorf("profile name: got %q, want %q", got, DefaultProfile)
+	}
+
+	cfg.Current = "sandbox"
+	p := cfg.Profile("sandbox")
+	p.Addr = "api.sandbox.bankrs.com"
+	p.DeveloperToken = "token"
+	if err := cfg.Save(filename); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	fi, err := os.Stat(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := fi.Mode().Perm(); perm != 0600 {
+		t.Errorf("permissions: got %v, want 0600", perm)
+	}
+
+	loaded, err := LoadConfig(filename)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if !reflect.DeepEqual(loaded, cfg) {
+		t.Errorf("loaded config: got %+v, want %+v", loaded, cfg)
+	}
+	if got := loaded.ProfileName(""); got != "sandbox" {
+		t.Errorf("current profile: got %q, want sandbox", got)
+	}
+	if got := loaded.ProfileName("other"); got != "other" {
+		t.Errorf("explicit profile: got %q, want other", got)
+	}
+}
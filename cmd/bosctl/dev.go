@@ -0,0 +1,799 @@
+// Copyright 2017 Bankrs AG.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"code.bankrs.com/bosgo"
+)
+
+func init() {
+	register(
+		&command{"profile", "list", "", "List the profiles in the configuration file", profileList},
+		&command{"profile", "show", "", "Show the selected profile", profileShow},
+		&command{"profile", "use", "NAME", "Select the profile used by default", profileUse},
+		&command{"profile", "set", "[-addr ADDR] [-env ENV] [-app ID]", "Change the address, environment or application of the selected profile", profileSet},
+
+		&command{"dev", "login", "-email EMAIL [-password PASSWORD]", "Log in as a developer and save the session", devLogin},
+		&command{"dev", "logout", "", "End the saved developer session", devLogout},
+		&command{"dev", "profile", "", "Show the developer profile", devProfile},
+
+		&command{"app", "list", "", "List applications", appList},
+		&command{"app", "create", "LABEL", "Create an application", appCreate},
+		&command{"app", "update", "ID LABEL", "Change the label of an application", appUpdate},
+		&command{"app", "delete", "ID", "Delete an application", appDelete},
+		&command{"app", "settings", "[-app ID]", "Show the settings of an application", appSettings},
+		&command{"app", "set-settings", "[-app ID] -background-refresh BOOL", "Change the settings of an application", appSetSettings},
+
+		&command{"key", "list", "[-app ID]", "List the keys of an application", keyList},
+		&command{"key", "create", "[-app ID]", "Create a key for an application", keyCreate},
+		&command{"key", "delete", "KEY", "Delete an application key", keyDelete},
+
+		&command{"webhook", "list", "", "List webhooks", webhookList},
+		&command{"webhook", "get", "ID", "Show a webhook", webhookGet},
+		&command{"webhook", "create", "-url URL -events EVENT,... [-api-version N]", "Create a webhook", webhookCreate},
+		&command{"webhook", "update", "-url URL -events EVENT,... [-api-version N] ID", "Change a webhook", webhookUpdate},
+		&command{"webhook", "delete", "ID", "Delete a webhook", webhookDelete},
+		&command{"webhook", "test", "ID EVENT", "Send a test event to a webhook", webhookTest},
+
+		&command{"credential", "list", "[-app ID]", "List the provider credentials of an application", credentialList},
+		&command{"credential", "get", "ID", "Show a provider credential", credentialGet},
+		&command{"credential", "create", "[-app ID] PROVIDER KEY=VALUE...", "Create a provider credential", credentialCreate},
+		&command{"credential", "update", "ID KEY=VALUE...", "Change a provider credential", credentialUpdate},
+		&command{"credential", "delete", "ID", "Delete a provider credential", credentialDelete},
+		&command{"credential", "providers", "", "List the providers accepting credentials and their keys", credentialProviders},
+
+		&command{"stats", "users", "[-from DATE] [-to DATE]", "Show user statistics", statsUsers},
+		&command{"stats", "requests", "[-from DATE] [-to DATE]", "Show request statistics", statsRequests},
+		&command{"stats", "merchants", "[-from DATE] [-to DATE]", "Show merchant statistics", statsMerchants},
+		&command{"stats", "providers", "[-from DATE] [-to DATE]", "Show provider statistics", statsProviders},
+		&command{"stats", "transfers", "[-from DATE] [-to DATE]", "Show transfer statistics", statsTransfers},
+	)
+}
+
+func profileList(e *env, args []string) error {
+	if err := parse(e.flags("profile list"), args, 0); err != nil {
+		return err
+	}
+	t := &table{headers: []string{"name", "current", "addr", "environment", "application", "developer", "user"}}
+	for _, name := range e.cfg.Names() {
+		p := e.cfg.Profiles[name]
+		t.add(name, formatBool(name == e.name), p.Addr, p.Environment, p.ApplicationID, formatBool(p.DeveloperToken != ""), p.Username)
+	}
+	return e.out.print(e.cfg.Names(), t)
+}
+
+func profileShow(e *env, args []string) error {
+	if err := parse(e.flags("profile show"), args, 0); err != nil {
+		return err
+	}
+	p := *e.profile
+	p.DeveloperToken = redact(p.DeveloperToken)
+	p.UserToken = redact(p.UserToken)
+	return e.out.print(p, fields(
+		"name", e.name,
+		"addr", p.Addr,
+		"environment", p.Environment,
+		"application_id", p.ApplicationID,
+		"developer_token", p.DeveloperToken,
+		"user_token", p.UserToken,
+		"username", p.Username,
+	))
+}
+
+// redact hides a session token in output.
+func redact(token string) string {
+	if token == "" {
+		return ""
+	}
+	return "<saved>"
+}
+
+func profileUse(e *env, args []string) error {
+	fs := e.flags("profile use")
+	if err := parse(fs, args, 1); err != nil {
+		return err
+	}
+	e.cfg.Current = fs.Arg(0)
+	e.cfg.Profile(fs.Arg(0))
+	return e.saveProfile()
+}
+
+func profileSet(e *env, args []string) error {
+	fs := e.flags("profile set")
+	addr := fs.String("addr", "", "API host `address`")
+	environment := fs.String("env", "", "API `environment`")
+	app := fs.String("app", "", "application `ID`")
+	if err := parse(fs, args, 0); err != nil {
+		return err
+	}
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "addr":
+			e.profile.Addr = *addr
+		case "env":
+			e.profile.Environment = *environment
+		case "app":
+			if e.profile.ApplicationID != *app {
+				// A user session belongs to the application it was created for.
+				e.profile.UserToken = ""
+				e.profile.Username = ""
+			}
+			e.profile.ApplicationID = *app
+		}
+	})
+	return e.saveProfile()
+}
+
+func devLogin(e *env, args []string) error {
+	fs := e.flags("dev login")
+	email := fs.String("email", "", "developer `email` address")
+	password := fs.String("password", "", "`password`, read from $BOSCTL_PASSWORD or standard input if empty")
+	if err := parse(fs, args, 0); err != nil {
+		return err
+	}
+	if *email == "" {
+		fs.Usage()
+		return errUsage
+	}
+	pw, err := e.password(*password, "BOSCTL_PASSWORD")
+	if err != nil {
+		return err
+	}
+
+	dc, err := e.client().Login(*email, pw).Context(e.ctx).Send()
+	if err != nil {
+		return err
+	}
+	e.profile.DeveloperToken = dc.SessionToken()
+	if err := e.saveProfile(); err != nil {
+		return err
+	}
+	fmt.Fprintf(e.stderr, "Logged in as %s (profile %s)\n", *email, e.name)
+	return nil
+}
+
+func devLogout(e *env, args []string) error {
+	if err := parse(e.flags("dev logout"), args, 0); err != nil {
+		return err
+	}
+	dc, err := e.dev()
+	if err != nil {
+		return err
+	}
+	if err := dc.Logout().Context(e.ctx).Send(); err != nil {
+		return err
+	}
+	e.profile.DeveloperToken = ""
+	return e.saveProfile()
+}
+
+func devProfile(e *env, args []string) error {
+	if err := parse(e.flags("dev profile"), args, 0); err != nil {
+		return err
+	}
+	dc, err := e.dev()
+	if err != nil {
+		return err
+	}
+	p, err := dc.Profile().Context(e.ctx).Send()
+	if err != nil {
+		return err
+	}
+	return e.out.print(p, fields(
+		"company", p.Company,
+		"confirmed", formatBool(p.Confirmed),
+		"production_access", formatBool(p.HasProductionAccess),
+		"expires_at", p.ExpiresAt,
+	))
+}
+
+func appList(e *env, args []string) error {
+	if err := parse(e.flags("app list"), args, 0); err != nil {
+		return err
+	}
+	dc, err := e.dev()
+	if err != nil {
+		return err
+	}
+	page, err := dc.Applications.List().Context(e.ctx).Send()
+	if err != nil {
+		return err
+	}
+	t := &table{headers: []string{"id", "label"}}
+	for _, a := range page.Applications {
+		t.add(a.ApplicationID, a.Label)
+	}
+	return e.out.print(page.Applications, t)
+}
+
+func appCreate(e *env, args []string) error {
+	fs := e.flags("app create")
+	if err := parse(fs, args, 1); err != nil {
+		return err
+	}
+	dc, err := e.dev()
+	if err != nil {
+		return err
+	}
+	app, err := dc.Applications.Create(fs.Arg(0)).Context(e.ctx).Send()
+	if err != nil {
+		return err
+	}
+	return e.out.print(app, &table{headers: []string{"id", "label"}, rows: [][]string{{app.ApplicationID, app.Label}}})
+}
+
+func appUpdate(e *env, args []string) error {
+	fs := e.flags("app update")
+	if err := parse(fs, args, 2); err != nil {
+		return err
+	}
+	dc, err := e.dev()
+	if err != nil {
+		return err
+	}
+	return dc.Applications.Update(fs.Arg(0), fs.Arg(1)).Context(e.ctx).Send()
+}
+
+func appDelete(e *env, args []string) error {
+	fs := e.flags("app delete")
+	if err := parse(fs, args, 1); err != nil {
+		return err
+	}
+	dc, err := e.dev()
+	if err != nil {
+		return err
+	}
+	return dc.Applications.Delete(fs.Arg(0)).Context(e.ctx).Send()
+}
+
+// appFlag adds the -app flag selecting the application a command acts on.
+func appFlag(fs *flag.FlagSet) *string {
+	return fs.String("app", "", "application `ID`, defaults to the profile's application")
+}
+
+func appSettings(e *env, args []string) error {
+	fs := e.flags("app settings")
+	app := appFlag(fs)
+	if err := parse(fs, args, 0); err != nil {
+		return err
+	}
+	id, err := e.applicationID(*app)
+	if err != nil {
+		return err
+	}
+	dc, err := e.dev()
+	if err != nil {
+		return err
+	}
+	s, err := dc.Applications.Settings(id).Context(e.ctx).Send()
+	if err != nil {
+		return err
+	}
+	return e.out.print(s, fields("background_refresh", formatBool(s.BackgroundRefresh)))
+}
+
+func appSetSettings(e *env, args []string) error {
+	fs := e.flags("app set-settings")
+	app := appFlag(fs)
+	refresh := fs.Bool("background-refresh", false, "refresh accesses in the background")
+	if err := parse(fs, args, 0); err != nil {
+		return err
+	}
+	id, err := e.applicationID(*app)
+	if err != nil {
+		return err
+	}
+	dc, err := e.dev()
+	if err != nil {
+		return err
+	}
+	req := dc.Applications.UpdateSettings(id)
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "background-refresh" {
+			req.BackgroundRefresh(*refresh)
+		}
+	})
+	s, err := req.Context(e.ctx).Send()
+	if err != nil {
+		return err
+	}
+	return e.out.print(s, fields("background_refresh", formatBool(s.BackgroundRefresh)))
+}
+
+func keyList(e *env, args []string) error {
+	fs := e.flags("key list")
+	app := appFlag(fs)
+	if err := parse(fs, args, 0); err != nil {
+		return err
+	}
+	id, err := e.applicationID(*app)
+	if err != nil {
+		return err
+	}
+	dc, err := e.dev()
+	if err != nil {
+		return err
+	}
+	page, err := dc.Applications.ListKeys(id).Context(e.ctx).Send()
+	if err != nil {
+		return err
+	}
+	t := &table{headers: []string{"key", "created_at"}}
+	for _, k := range page.Keys {
+		t.add(k.Key, formatTime(k.CreatedAt))
+	}
+	return e.out.print(page.Keys, t)
+}
+
+func keyCreate(e *env, args []string) error {
+	fs := e.flags("key create")
+	app := appFlag(fs)
+	if err := parse(fs, args, 0); err != nil {
+		return err
+	}
+	id, err := e.applicationID(*app)
+	if err != nil {
+		return err
+	}
+	dc, err := e.dev()
+	if err != nil {
+		return err
+	}
+	k, err := dc.Applications.CreateKey(id).Context(e.ctx).Send()
+	if err != nil {
+		return err
+	}
+	return e.out.print(k, &table{headers: []string{"key", "created_at"}, rows: [][]string{{k.Key, formatTime(k.CreatedAt)}}})
+}
+
+func keyDelete(e *env, args []string) error {
+	fs := e.flags("key delete")
+	if err := parse(fs, args, 1); err != nil {
+		return err
+	}
+	dc, err := e.dev()
+	if err != nil {
+		return err
+	}
+	return dc.ApplicationKeys.Delete(fs.Arg(0)).Context(e.ctx).Send()
+}
+
+func webhookTable(hooks ...bosgo.Webhook) *table {
+	t := &table{headers: []string{"id", "url", "events", "api_version", "enabled", "environment", "created_at"}}
+	for _, w := range hooks {
+		t.add(w.ID, w.URL, strings.Join(w.Events, ","), strconv.Itoa(w.APIVersion), formatBool(w.Enabled), w.Environment, formatTime(w.CreatedAt))
+	}
+	return t
+}
+
+func webhookList(e *env, args []string) error {
+	if err := parse(e.flags("webhook list"), args, 0); err != nil {
+		return err
+	}
+	dc, err := e.dev()
+	if err != nil {
+		return err
+	}
+	page, err := dc.Webhooks.List().Context(e.ctx).Send()
+	if err != nil {
+		return err
+	}
+	return e.out.print(page.Webhooks, webhookTable(page.Webhooks...))
+}
+
+func webhookGet(e *env, args []string) error {
+	fs := e.flags("webhook get")
+	if err := parse(fs, args, 1); err != nil {
+		return err
+	}
+	dc, err := e.dev()
+	if err != nil {
+		return err
+	}
+	w, err := dc.Webhooks.Get(fs.Arg(0)).Context(e.ctx).Send()
+	if err != nil {
+		return err
+	}
+	return e.out.print(w, webhookTable(*w))
+}
+
+// webhookFlags adds the flags describing a webhook.
+func webhookFlags(fs *flag.FlagSet) (u, events *string, version *int) {
+	u = fs.String("url", "", "`URL` receiving the events")
+	events = fs.String("events", "", "comma separated `list` of events")
+	version = fs.Int("api-version", 1, "API `version` of the event payloads")
+	return u, events, version
+}
+
+func splitList(s string) []string {
+	var list []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+func webhookCreate(e *env, args []string) error {
+	fs := e.flags("webhook create")
+	u, events, version := webhookFlags(fs)
+	if err := parse(fs, args, 0); err != nil {
+		return err
+	}
+	if *u == "" || *events == "" {
+		fs.Usage()
+		return errUsage
+	}
+	dc, err := e.dev()
+	if err != nil {
+		return err
+	}
+	id, err := dc.Webhooks.Create(*version, *u, splitList(*events)).Context(e.ctx).Send()
+	if err != nil {
+		return err
+	}
+	return e.out.print(map[string]string{"id": id}, &table{headers: []string{"id"}, rows: [][]string{{id}}})
+}
+
+func webhookUpdate(e *env, args []string) error {
+	fs := e.flags("webhook update")
+	u, events, version := webhookFlags(fs)
+	if err := parse(fs, args, 1); err != nil {
+		return err
+	}
+	if *u == "" || *events == "" {
+		fs.Usage()
+		return errUsage
+	}
+	dc, err := e.dev()
+	if err != nil {
+		return err
+	}
+	return dc.Webhooks.Update(fs.Arg(0), *version, *u, splitList(*events)).Context(e.ctx).Send()
+}
+
+func webhookDelete(e *env, args []string) error {
+	fs := e.flags("webhook delete")
+	if err := parse(fs, args, 1); err != nil {
+		return err
+	}
+	dc, err := e.dev()
+	if err != nil {
+		return err
+	}
+	return dc.Webhooks.Delete(fs.Arg(0)).Context(e.ctx).Send()
+}
+
+func webhookTest(e *env, args []string) error {
+	fs := e.flags("webhook test")
+	if err := parse(fs, args, 2); err != nil {
+		return err
+	}
+	dc, err := e.dev()
+	if err != nil {
+		return err
+	}
+	res, err := dc.Webhooks.Test(fs.Arg(0), fs.Arg(1)).Context(e.ctx).Send()
+	if err != nil {
+		return err
+	}
+	return e.out.print(res, nil)
+}
+
+// keyValues parses KEY=VALUE arguments.
+func keyValues(args []string) (map[string]string, error) {
+	m := make(map[string]string, len(args))
+	for _, arg := range args {
+		i := strings.IndexByte(arg, '=')
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid argument %q, expected KEY=VALUE", arg)
+		}
+		m[arg[:i]] = arg[i+1:]
+	}
+	return m, nil
+}
+
+func credentialList(e *env, args []string) error {
+	fs := e.flags("credential list")
+	app := appFlag(fs)
+	if err := parse(fs, args, 0); err != nil {
+		return err
+	}
+	id, err := e.applicationID(*app)
+	if err != nil {
+		return err
+	}
+	dc, err := e.dev()
+	if err != nil {
+		return err
+	}
+	page, err := dc.Applications.ListCredentials(id).Context(e.ctx).Send()
+	if err != nil {
+		return err
+	}
+	t := &table{headers: []string{"id", "provider", "created_at"}}
+	for _, c := range page.Entries {
+		t.add(c.ID, c.Provider, formatTime(c.CreatedAt))
+	}
+	return e.out.print(page.Entries, t)
+}
+
+func credentialGet(e *env, args []string) error {
+	fs := e.flags("credential get")
+	if err := parse(fs, args, 1); err != nil {
+		return err
+	}
+	dc, err := e.dev()
+	if err != nil {
+		return err
+	}
+	c, err := dc.Credentials.Get(fs.Arg(0)).Context(e.ctx).Send()
+	if err != nil {
+		return err
+	}
+	// The credential keys are secrets and only included in JSON output,
+	// which must be requested explicitly.
+	keys := make([]string, 0, len(c.Credentials))
+	for k := range c.Credentials {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return e.out.print(c, fields(
+		"id", c.ID,
+		"provider", c.Provider,
+		"created_at", formatTime(c.CreatedAt),
+		"keys", strings.Join(keys, ","),
+	))
+}
+
+func credentialCreate(e *env, args []string) error {
+	fs := e.flags("credential create")
+	app := appFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() < 2 {
+		fs.Usage()
+		return errUsage
+	}
+	keys, err := keyValues(fs.Args()[1:])
+	if err != nil {
+		return err
+	}
+	id, err := e.applicationID(*app)
+	if err != nil {
+		return err
+	}
+	dc, err := e.dev()
+	if err != nil {
+		return err
+	}
+	cid, err := dc.Applications.CreateCredential(id, fs.Arg(0), keys).Context(e.ctx).Send()
+	if err != nil {
+		return err
+	}
+	return e.out.print(map[string]string{"id": cid}, &table{headers: []string{"id"}, rows: [][]string{{cid}}})
+}
+
+func credentialUpdate(e *env, args []string) error {
+	fs := e.flags("credential update")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() < 2 {
+		fs.Usage()
+		return errUsage
+	}
+	keys, err := keyValues(fs.Args()[1:])
+	if err != nil {
+		return err
+	}
+	dc, err := e.dev()
+	if err != nil {
+		return err
+	}
+	return dc.Credentials.Update(fs.Arg(0), keys).Context(e.ctx).Send()
+}
+
+func credentialDelete(e *env, args []string) error {
+	fs := e.flags("credential delete")
+	if err := parse(fs, args, 1); err != nil {
+		return err
+	}
+	dc, err := e.dev()
+	if err != nil {
+		return err
+	}
+	return dc.Credentials.Delete(fs.Arg(0)).Context(e.ctx).Send()
+}
+
+func credentialProviders(e *env, args []string) error {
+	if err := parse(e.flags("credential providers"), args, 0); err != nil {
+		return err
+	}
+	dc, err := e.dev()
+	if err != nil {
+		return err
+	}
+	page, err := dc.Credentials.ListProviders().Context(e.ctx).Send()
+	if err != nil {
+		return err
+	}
+	t := &table{headers: []string{"name", "keys"}}
+	for _, p := range page.Providers {
+		t.add(p.Name, strings.Join(p.Keys, ","))
+	}
+	return e.out.print(page.Providers, t)
+}
+
+// dateRange adds the -from and -to flags of the stats commands.
+type dateRange struct {
+	from, to string
+}
+
+func dateFlags(fs *flag.FlagSet) *dateRange {
+	r := &dateRange{}
+	fs.StringVar(&r.from, "from", "", "first `date` (YYYY-MM-DD)")
+	fs.StringVar(&r.to, "to", "", "last `date` (YYYY-MM-DD)")
+	return r
+}
+
+// apply calls the setters with the parsed dates that are set.
+func (r *dateRange) apply(from, to func(time.Time)) error {
+	for _, d := range []struct {
+		value string
+		set   func(time.Time)
+	}{{r.from, from}, {r.to, to}} {
+		if d.value == "" {
+			continue
+		}
+		t, err := time.Parse("2006-01-02", d.value)
+		if err != nil {
+			return fmt.Errorf("invalid date %q, expected YYYY-MM-DD", d.value)
+		}
+		d.set(t)
+	}
+	return nil
+}
+
+func statsUsers(e *env, args []string) error {
+	fs := e.flags("stats users")
+	dates := dateFlags(fs)
+	if err := parse(fs, args, 0); err != nil {
+		return err
+	}
+	dc, err := e.dev()
+	if err != nil {
+		return err
+	}
+	req := dc.Stats.Users()
+	if err := dates.apply(func(t time.Time) { req.FromDate(t) }, func(t time.Time) { req.ToDate(t) }); err != nil {
+		return err
+	}
+	s, err := req.Context(e.ctx).Send()
+	if err != nil {
+		return err
+	}
+	t := &table{headers: []string{"date", "new_users"}}
+	for _, d := range s.Stats {
+		t.add(d.Date, formatInt(d.NewUsers))
+	}
+	return e.out.print(s, t)
+}
+
+func statsRequests(e *env, args []string) error {
+	fs := e.flags("stats requests")
+	dates := dateFlags(fs)
+	if err := parse(fs, args, 0); err != nil {
+		return err
+	}
+	dc, err := e.dev()
+	if err != nil {
+		return err
+	}
+	req := dc.Stats.Requests()
+	if err := dates.apply(func(t time.Time) { req.FromDate(t) }, func(t time.Time) { req.ToDate(t) }); err != nil {
+		return err
+	}
+	s, err := req.Context(e.ctx).Send()
+	if err != nil {
+		return err
+	}
+	t := &table{headers: []string{"date", "requests"}}
+	for _, d := range s.Stats {
+		t.add(d.Date, formatInt(d.RequestsTotal))
+	}
+	return e.out.print(s, t)
+}
+
+func statsMerchants(e *env, args []string) error {
+	fs := e.flags("stats merchants")
+	dates := dateFlags(fs)
+	if err := parse(fs, args, 0); err != nil {
+		return err
+	}
+	dc, err := e.dev()
+	if err != nil {
+		return err
+	}
+	req := dc.Stats.Merchants()
+	if err := dates.apply(func(t time.Time) { req.FromDate(t) }, func(t time.Time) { req.ToDate(t) }); err != nil {
+		return err
+	}
+	s, err := req.Context(e.ctx).Send()
+	if err != nil {
+		return err
+	}
+	t := &table{headers: []string{"name", "value"}}
+	for _, d := range s.Stats {
+		t.add(d.Name, formatInt(d.Value))
+	}
+	return e.out.print(s, t)
+}
+
+func statsProviders(e *env, args []string) error {
+	fs := e.flags("stats providers")
+	dates := dateFlags(fs)
+	if err := parse(fs, args, 0); err != nil {
+		return err
+	}
+	dc, err := e.dev()
+	if err != nil {
+		return err
+	}
+	req := dc.Stats.Providers()
+	if err := dates.apply(func(t time.Time) { req.FromDate(t) }, func(t time.Time) { req.ToDate(t) }); err != nil {
+		return err
+	}
+	s, err := req.Context(e.ctx).Send()
+	if err != nil {
+		return err
+	}
+	t := &table{headers: []string{"name", "value"}}
+	for _, d := range s.Stats {
+		t.add(d.Name, formatInt(d.Value))
+	}
+	return e.out.print(s, t)
+}
+
+func statsTransfers(e *env, args []string) error {
+	fs := e.flags("stats transfers")
+	dates := dateFlags(fs)
+	if err := parse(fs, args, 0); err != nil {
+		return err
+	}
+	dc, err := e.dev()
+	if err != nil {
+		return err
+	}
+	req := dc.Stats.Transfers()
+	if err := dates.apply(func(t time.Time) { req.FromDate(t) }, func(t time.Time) { req.ToDate(t) }); err != nil {
+		return err
+	}
+	s, err := req.Context(e.ctx).Send()
+	if err != nil {
+		return err
+	}
+	// The transfer statistics are not decoded into a known structure.
+	return e.out.print(s, nil)
+}
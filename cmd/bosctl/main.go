@@ -0,0 +1,287 @@
+// Copyright 2017 Bankrs AG.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command bosctl is a command line client for the Bankrs OS API.
+//
+// Usage:
+//
+//	bosctl [global flags] <group> <command> [flags] [arguments]
+//
+// Run bosctl without arguments for a list of commands. Sessions obtained with
+// "bosctl dev login" and "bosctl user login" are saved in a named profile of
+// the configuration file together with the API address, environment and
+// application ID, so later commands can use them:
+//
+//	bosctl profile set -addr api.sandbox.bankrs.com -app 1a2b3c
+//	bosctl dev login -email dev@example.com
+//	bosctl -output csv app list
+//
+// The configuration file is read from $BOSCTL_CONFIG or bosctl/config.json in
+// the user configuration directory. The profile is chosen with -profile,
+// $BOSCTL_PROFILE or "bosctl profile use".
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+
+	"code.bankrs.com/bosgo"
+)
+
+// errUsage is returned by commands called with invalid arguments after the
+// usage has been printed.
+var errUsage = errors.New("invalid arguments")
+
+// command is a subcommand such as "app list".
+type command struct {
+	group   string
+	name    string
+	args    string // Synopsis of the flags and arguments
+	summary string
+	run     func(e *env, args []string) error
+}
+
+func (c *command) String() string { return c.group + " " + c.name }
+
+var commands []*command
+
+func register(cmds ...*command) { commands = append(commands, cmds...) }
+
+func findCommand(group, name string) *command {
+	for _, c := range commands {
+		if c.group == group && c.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// env is the environment a command runs in.
+type env struct {
+	ctx      context.Context
+	hc       *http.Client
+	cfg      *Config
+	cfgPath  string
+	name     string   // Name of the selected profile
+	profile  *Profile // Selected profile, saved by saveProfile
+	addr     string   // Address overriding the profile's for this run
+	envName  string   // Environment overriding the profile's for this run
+	out      *printer
+	prompter Prompter // Reads input, prompting on stderr
+	stderr   io.Writer
+}
+
+func main() {
+	os.Exit(run(context.Background(), http.DefaultClient, os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run executes bosctl with the arguments and returns the exit code.
+func run(ctx context.Context, hc *http.Client, args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("bosctl", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	cfgPath := fs.String("config", defaultConfigPath(), "configuration `file`")
+	profile := fs.String("profile", os.Getenv("BOSCTL_PROFILE"), "`name` of the profile to use")
+	output := fs.String("output", "table", "output `format`: table, json or csv")
+	addr := fs.String("addr", "", "API host `address`, overriding the profile")
+	envName := fs.String("env", "", "API `environment`, overriding the profile")
+	fs.Usage = func() { usage(stderr, fs) }
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() < 2 {
+		usage(stderr, fs)
+		return 2
+	}
+	cmd := findCommand(fs.Arg(0), fs.Arg(1))
+	if cmd == nil {
+		fmt.Fprintf(stderr, "bosctl: unknown command %q\n", fs.Arg(0)+" "+fs.Arg(1))
+		usage(stderr, fs)
+		return 2
+	}
+
+	out, err := newPrinter(*output, stdout)
+	if err != nil {
+		fmt.Fprintf(stderr, "bosctl: %v\n", err)
+		return 2
+	}
+	cfg, err := LoadConfig(*cfgPath)
+	if err != nil {
+		fmt.Fprintf(stderr, "bosctl: %v\n", err)
+		return 1
+	}
+	name := cfg.ProfileName(*profile)
+	e := &env{
+		ctx:      ctx,
+		hc:       hc,
+		cfg:      cfg,
+		cfgPath:  *cfgPath,
+		name:     name,
+		profile:  cfg.Profile(name),
+		addr:     *addr,
+		envName:  *envName,
+		out:      out,
+		prompter: newLinePrompter(stdin, stderr),
+		stderr:   stderr,
+	}
+
+	if err := cmd.run(e, fs.Args()[2:]); err != nil {
+		if err == errUsage || err == flag.ErrHelp {
+			return 2
+		}
+		fmt.Fprintf(stderr, "bosctl %s: %v\n", cmd, err)
+		return 1
+	}
+	if err := out.Flush(); err != nil {
+		fmt.Fprintf(stderr, "bosctl: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func usage(w io.Writer, fs *flag.FlagSet) {
+	fmt.Fprintln(w, "Usage: bosctl [global flags] <group> <command> [flags] [arguments]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Global flags:")
+	fs.PrintDefaults()
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+
+	cmds := append([]*command(nil), commands...)
+	sort.SliceStable(cmds, func(i, j int) bool { return cmds[i].group < cmds[j].group })
+	for _, c := range cmds {
+		fmt.Fprintf(w, "  %-28s %s\n", c.String(), c.summary)
+	}
+}
+
+// flags returns a flag set for the command's own flags.
+func (e *env) flags(cmd string) *flag.FlagSet {
+	fs := flag.NewFlagSet("bosctl "+cmd, flag.ContinueOnError)
+	fs.SetOutput(e.stderr)
+	c := findCommand(splitCommand(cmd))
+	fs.Usage = func() {
+		fmt.Fprintf(e.stderr, "Usage: bosctl %s %s\n", cmd, c.args)
+		if c.summary != "" {
+			fmt.Fprintf(e.stderr, "\n%s\n", c.summary)
+		}
+		fmt.Fprintln(e.stderr)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+func splitCommand(cmd string) (string, string) {
+	i := strings.IndexByte(cmd, ' ')
+	return cmd[:i], cmd[i+1:]
+}
+
+// parse parses the command's flags and checks that exactly n positional
+// arguments remain.
+func parse(fs *flag.FlagSet, args []string, n int) error {
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != n {
+		fs.Usage()
+		return errUsage
+	}
+	return nil
+}
+
+// client returns a client for the profile's address and environment.
+func (e *env) client() *bosgo.Client {
+	addr := e.profile.Addr
+	if e.addr != "" {
+		addr = e.addr
+	}
+	if addr == "" {
+		addr = bosgo.SandboxAddr
+	}
+	environment := e.profile.Environment
+	if e.envName != "" {
+		environment = e.envName
+	}
+
+	opts := []bosgo.ClientOption{bosgo.UserAgent("bosctl")}
+	if environment != "" {
+		opts = append(opts, bosgo.Environment(environment))
+	}
+	return bosgo.New(e.hc, addr, opts...)
+}
+
+// dev returns a developer client using the saved developer session.
+func (e *env) dev() (*bosgo.DevClient, error) {
+	if e.profile.DeveloperToken == "" {
+		return nil, fmt.Errorf("no developer session in profile %q, run bosctl dev login", e.name)
+	}
+	return e.client().WithDeveloperToken(e.profile.DeveloperToken), nil
+}
+
+// app returns an application client for the profile's application.
+func (e *env) app() (*bosgo.AppClient, error) {
+	if e.profile.ApplicationID == "" {
+		return nil, fmt.Errorf("no application ID in profile %q, run bosctl profile set -app ID", e.name)
+	}
+	return e.client().WithApplicationID(e.profile.ApplicationID), nil
+}
+
+// user returns a user client using the saved user session.
+func (e *env) user() (*bosgo.UserClient, error) {
+	if e.profile.UserToken == "" {
+		return nil, fmt.Errorf("no user session in profile %q, run bosctl user login", e.name)
+	}
+	ac, err := e.app()
+	if err != nil {
+		return nil, err
+	}
+	return ac.WithUserToken(e.profile.UserToken), nil
+}
+
+// applicationID returns id if set or the profile's application ID.
+func (e *env) applicationID(id string) (string, error) {
+	if id != "" {
+		return id, nil
+	}
+	if e.profile.ApplicationID == "" {
+		return "", errors.New("no application given, use -app or bosctl profile set -app ID")
+	}
+	return e.profile.ApplicationID, nil
+}
+
+// saveProfile writes the configuration with the changes made to the profile.
+func (e *env) saveProfile() error {
+	return e.cfg.Save(e.cfgPath)
+}
+
+// password returns pw if set, otherwise the value of the environment
+// variable or, failing that, the password entered at a prompt.
+func (e *env) password(pw, envVar string) (string, error) {
+	if pw != "" {
+		return pw, nil
+	}
+	if v := os.Getenv(envVar); v != "" {
+		return v, nil
+	}
+	pw, err := e.prompter.Prompt("Password: ", true)
+	if err != nil {
+		return "", fmt.Errorf("read password: %v", err)
+	}
+	return pw, nil
+}
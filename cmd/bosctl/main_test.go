@@ -0,0 +1,149 @@
+// Copyright 2017 Bankrs AG.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeAPI serves the endpoints used by the tests.
+func fakeAPI(t *testing.T) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/developers/login", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{"token": "devtoken"})
+	})
+	mux.HandleFunc("/v1/developers/applications", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("x-token") != "devtoken" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`[{"id":"app1","label":"First"},{"id":"app2","label":"Second, with comma"}]`))
+	})
+	mux.HandleFunc("/v1/users/login", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("x-application-id") != "app1" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id": "u1", "token": "usertoken"})
+	})
+	mux.HandleFunc("/v1/accesses", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("x-token") != "usertoken" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`[{"id":7,"name":"Bank","provider_id":"DE-BIN-1","enabled":true}]`))
+	})
+	ts := httptest.NewTLSServer(mux)
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+type runner struct {
+	t    *testing.T
+	ts   *httptest.Server
+	addr string
+	cfg  string
+}
+
+func newRunner(t *testing.T) *runner {
+	ts := fakeAPI(t)
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &runner{t: t, ts: ts, addr: u.Host, cfg: filepath.Join(t.TempDir(), "config.json")}
+}
+
+// run runs bosctl and returns the standard output, failing the test if the
+// exit code differs from code.
+func (r *runner) run(code int, stdin string, args ...string) string {
+	r.t.Helper()
+	var stdout, stderr bytes.Buffer
+	args = append([]string{"-config", r.cfg}, args...)
+	if got := run(context.Background(), r.ts.Client(), args, strings.NewReader(stdin), &stdout, &stderr); got != code {
+		r.t.Fatalf("bosctl %s: exit code %d, want %d\nstderr: %s", strings.Join(args, " "), got, code, stderr.String())
+	}
+	return stdout.String()
+}
+
+func TestLoginAndList(t *testing.T) {
+	r := newRunner(t)
+	r.run(0, "", "profile", "set", "-addr", r.addr, "-app", "app1")
+	r.run(0, "secret\n", "dev", "login", "-email", "dev@example.com")
+
+	cfg, err := LoadConfig(r.cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := cfg.Profiles[DefaultProfile].DeveloperToken; got != "devtoken" {
+		t.Errorf("saved developer token: got %q, want devtoken", got)
+	}
+
+	out := r.run(0, "", "-output", "csv", "app", "list")
+	want := "id,label\napp1,First\napp2,\"Second, with comma\"\n"
+	if out != want {
+		t.Errorf("csv output: got %q, want %q", out, want)
+	}
+
+	out = r.run(0, "", "-output", "json", "app", "list")
+	var apps []map[string]string
+	if err := json.Unmarshal([]byte(out), &apps); err != nil {
+		t.Fatalf("json output: %v\n%s", err, out)
+	}
+	if len(apps) != 2 || apps[0]["id"] != "app1" {
+		t.Errorf("json output: got %v", apps)
+	}
+
+	out = r.run(0, "", "app", "list")
+	if !strings.HasPrefix(out, "ID    LABEL\napp1  First\n") {
+		t.Errorf("table output: got %q", out)
+	}
+
+	r.run(0, "", "user", "login", "-username", "jane", "-password", "pw")
+	out = r.run(0, "", "-output", "csv", "access", "list")
+	if !strings.Contains(out, "7,Bank,DE-BIN-1,true,0,") {
+		t.Errorf("access list: got %q", out)
+	}
+}
+
+func TestProfiles(t *testing.T) {
+	r := newRunner(t)
+	r.run(0, "", "-profile", "prod", "profile", "set", "-addr", "api.bankrs.com", "-env", "production")
+	r.run(0, "", "profile", "use", "prod")
+
+	out := r.run(0, "", "-output", "csv", "profile", "show")
+	if !strings.Contains(out, "name,prod\n") || !strings.Contains(out, "addr,api.bankrs.com\n") {
+		t.Errorf("profile show: got %q", out)
+	}
+
+	// The developer session of another profile is not used.
+	r.run(1, "", "-profile", "other", "app", "list")
+}
+
+func TestUsage(t *testing.T) {
+	r := newRunner(t)
+	r.run(2, "")
+	r.run(2, "", "app", "frobnicate")
+	r.run(2, "", "app", "delete")
+	r.run(2, "", "-output", "xml", "app", "list")
+}
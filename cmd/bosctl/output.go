@@ -0,0 +1,116 @@
+// Copyright 2017 Bankrs AG.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Output formats.
+const (
+	FormatTable = "table"
+	FormatJSON  = "json"
+	FormatCSV   = "csv"
+)
+
+// table is the tabular form of a command's result.
+type table struct {
+	headers []string
+	rows    [][]string
+}
+
+func (t *table) add(row ...string) { t.rows = append(t.rows, row) }
+
+// printer writes command results in the selected format.
+type printer struct {
+	format string
+	w      io.Writer
+	tw     *tabwriter.Writer
+}
+
+func newPrinter(format string, w io.Writer) (*printer, error) {
+	switch format {
+	case FormatTable, FormatJSON, FormatCSV:
+	default:
+		return nil, fmt.Errorf("unknown output format %q", format)
+	}
+	return &printer{format: format, w: w}, nil
+}
+
+// print writes a result. JSON output is the encoding of v as returned by the
+// API; table and CSV output use t. Results without a tabular form are
+// written as JSON in every format.
+func (p *printer) print(v interface{}, t *table) error {
+	if p.format == FormatJSON || t == nil {
+		enc := json.NewEncoder(p.w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	}
+
+	if p.format == FormatCSV {
+		cw := csv.NewWriter(p.w)
+		if err := cw.Write(t.headers); err != nil {
+			return err
+		}
+		if err := cw.WriteAll(t.rows); err != nil {
+			return err
+		}
+		return cw.Error()
+	}
+
+	if p.tw == nil {
+		p.tw = tabwriter.NewWriter(p.w, 0, 4, 2, ' ', 0)
+	}
+	fmt.Fprintln(p.tw, strings.ToUpper(strings.Join(t.headers, "\t")))
+	for _, row := range t.rows {
+		fmt.Fprintln(p.tw, strings.Join(row, "\t"))
+	}
+	return nil
+}
+
+// Flush writes any buffered table output.
+func (p *printer) Flush() error {
+	if p.tw == nil {
+		return nil
+	}
+	return p.tw.Flush()
+}
+
+// fields returns a two column table of names and values for a single item.
+func fields(kv ...string) *table {
+	t := &table{headers: []string{"field", "value"}}
+	for i := 0; i+1 < len(kv); i += 2 {
+		t.add(kv[i], kv[i+1])
+	}
+	return t
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+func formatBool(b bool) string { return strconv.FormatBool(b) }
+
+func formatInt(i int64) string { return strconv.FormatInt(i, 10) }
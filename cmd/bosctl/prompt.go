@@ -0,0 +1,105 @@
+// Copyright 2017 Bankrs AG.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"golang.org/x/term"
+)
+
+// Prompter asks the user for a line of input.
+type Prompter interface {
+	// Prompt shows the label and returns the line entered without its line
+	// ending. The input of a secure prompt must not be echoed.
+	Prompt(label string, secure bool) (string, error)
+}
+
+// linePrompter reads answers line by line. When reading from a terminal,
+// secure prompts are read without echo and fail if echo cannot be turned
+// off.
+type linePrompter struct {
+	in  *bufio.Reader
+	out io.Writer
+	tty *os.File // Terminal the input is read from, if any
+}
+
+func newLinePrompter(in io.Reader, out io.Writer) *linePrompter {
+	p := &linePrompter{in: bufio.NewReader(in), out: out}
+	if f, ok := in.(*os.File); ok && term.IsTerminal(int(f.Fd())) {
+		p.tty = f
+	}
+	return p
+}
+
+func (p *linePrompter) Prompt(label string, secure bool) (string, error) {
+	fmt.Fprint(p.out, label)
+	if secure && p.tty != nil {
+		return p.readPassword()
+	}
+
+	line, err := p.in.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		if err == io.EOF {
+			return "", io.ErrUnexpectedEOF
+		}
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// readPassword reads a line from the terminal without echoing it. The state
+// of the terminal is restored as well if the process is interrupted or
+// terminated while reading.
+func (p *linePrompter) readPassword() (string, error) {
+	fd := int(p.tty.Fd())
+	state, err := term.GetState(fd)
+	if err != nil {
+		fmt.Fprintln(p.out)
+		return "", fmt.Errorf("cannot hide secure input: %v", err)
+	}
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	done := make(chan struct{})
+	go func() {
+		select {
+		case sig := <-sigs:
+			term.Restore(fd, state)
+			fmt.Fprintln(p.out)
+			// Deliver the signal again now that it is no longer caught
+			signal.Stop(sigs)
+			if proc, err := os.FindProcess(os.Getpid()); err == nil {
+				proc.Signal(sig)
+			}
+		case <-done:
+		}
+	}()
+
+	line, err := term.ReadPassword(fd)
+	close(done)
+	signal.Stop(sigs)
+	fmt.Fprintln(p.out)
+	if err != nil {
+		return "", err
+	}
+	return string(line), nil
+}
@@ -0,0 +1,356 @@
+// Copyright 2017 Bankrs AG.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"time"
+
+	"code.bankrs.com/bosgo"
+)
+
+func init() {
+	register(
+		&command{"user", "login", "-username NAME [-password PASSWORD]", "Log in as a user of the profile's application and save the session", userLogin},
+		&command{"user", "logout", "", "End the saved user session", userLogout},
+
+		&command{"access", "list", "", "List the user's accesses", accessList},
+		&command{"access", "get", "ID", "Show an access and its accounts", accessGet},
+		&command{"access", "delete", "ID", "Delete an access", accessDelete},
+		&command{"access", "refresh", "ID", "Start a refresh of an access and print the job", accessRefresh},
+		&command{"access", "refresh-all", "", "Start a refresh of all accesses and print the jobs", accessRefreshAll},
+
+		&command{"account", "list", "", "List the user's accounts", accountList},
+		&command{"account", "get", "ID", "Show an account", accountGet},
+
+		&command{"transaction", "list", "[-account ID] [-access ID] [-since DATE] [-limit N]", "List the user's transactions", transactionList},
+		&command{"transaction", "get", "ID", "Show a transaction", transactionGet},
+
+		&command{"job", "get", "URI", "Show the status of a job", jobGet},
+		&command{"job", "cancel", "URI", "Cancel a job", jobCancel},
+	)
+}
+
+func userLogin(e *env, args []string) error {
+	fs := e.flags("user login")
+	username := fs.String("username", "", "user `name`")
+	password := fs.String("password", "", "`password`, read from $BOSCTL_USER_PASSWORD or standard input if empty")
+	if err := parse(fs, args, 0); err != nil {
+		return err
+	}
+	if *username == "" {
+		fs.Usage()
+		return errUsage
+	}
+	ac, err := e.app()
+	if err != nil {
+		return err
+	}
+	pw, err := e.password(*password, "BOSCTL_USER_PASSWORD")
+	if err != nil {
+		return err
+	}
+
+	uc, err := ac.Users.Login(*username, pw).Context(e.ctx).Send()
+	if err != nil {
+		return err
+	}
+	e.profile.UserToken = uc.SessionToken()
+	e.profile.Username = *username
+	if err := e.saveProfile(); err != nil {
+		return err
+	}
+	fmt.Fprintf(e.stderr, "Logged in as %s (profile %s)\n", *username, e.name)
+	return nil
+}
+
+func userLogout(e *env, args []string) error {
+	if err := parse(e.flags("user logout"), args, 0); err != nil {
+		return err
+	}
+	uc, err := e.user()
+	if err != nil {
+		return err
+	}
+	if err := uc.Logout().Context(e.ctx).Send(); err != nil {
+		return err
+	}
+	e.profile.UserToken = ""
+	e.profile.Username = ""
+	return e.saveProfile()
+}
+
+// idArg parses the single numeric ID argument of a command.
+func idArg(fs *flag.FlagSet, args []string) (int64, error) {
+	if err := parse(fs, args, 1); err != nil {
+		return 0, err
+	}
+	id, err := strconv.ParseInt(fs.Arg(0), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid ID %q", fs.Arg(0))
+	}
+	return id, nil
+}
+
+func accessTable(accesses ...bosgo.Access) *table {
+	t := &table{headers: []string{"id", "name", "provider", "enabled", "accounts", "consent_expiration"}}
+	for _, a := range accesses {
+		t.add(formatInt(a.ID), a.Name, a.ProviderID, formatBool(a.Enabled), strconv.Itoa(len(a.Accounts)), formatTime(a.ConsentExpiration))
+	}
+	return t
+}
+
+func accessList(e *env, args []string) error {
+	if err := parse(e.flags("access list"), args, 0); err != nil {
+		return err
+	}
+	uc, err := e.user()
+	if err != nil {
+		return err
+	}
+	page, err := uc.Accesses.List().Context(e.ctx).Send()
+	if err != nil {
+		return err
+	}
+	return e.out.print(page.Accesses, accessTable(page.Accesses...))
+}
+
+func accessGet(e *env, args []string) error {
+	id, err := idArg(e.flags("access get"), args)
+	if err != nil {
+		return err
+	}
+	uc, err := e.user()
+	if err != nil {
+		return err
+	}
+	a, err := uc.Accesses.Get(id).Context(e.ctx).Send()
+	if err != nil {
+		return err
+	}
+	return e.out.print(a, accountTable(a.Accounts...))
+}
+
+func accessDelete(e *env, args []string) error {
+	id, err := idArg(e.flags("access delete"), args)
+	if err != nil {
+		return err
+	}
+	uc, err := e.user()
+	if err != nil {
+		return err
+	}
+	_, err = uc.Accesses.Delete(id).Context(e.ctx).Send()
+	return err
+}
+
+func jobTable(jobs ...bosgo.Job) *table {
+	t := &table{headers: []string{"uri"}}
+	for _, j := range jobs {
+		t.add(j.URI)
+	}
+	return t
+}
+
+func accessRefresh(e *env, args []string) error {
+	id, err := idArg(e.flags("access refresh"), args)
+	if err != nil {
+		return err
+	}
+	uc, err := e.user()
+	if err != nil {
+		return err
+	}
+	job, err := uc.Accesses.Refresh(id).Context(e.ctx).Send()
+	if err != nil {
+		return err
+	}
+	return e.out.print(job, jobTable(*job))
+}
+
+func accessRefreshAll(e *env, args []string) error {
+	if err := parse(e.flags("access refresh-all"), args, 0); err != nil {
+		return err
+	}
+	uc, err := e.user()
+	if err != nil {
+		return err
+	}
+	jobs, err := uc.Accesses.RefreshAll().Context(e.ctx).Send()
+	if err != nil {
+		return err
+	}
+	return e.out.print(jobs, jobTable(jobs...))
+}
+
+func accountTable(accounts ...bosgo.Account) *table {
+	t := &table{headers: []string{"id", "access", "name", "type", "iban", "balance", "currency", "balance_date"}}
+	for _, a := range accounts {
+		t.add(formatInt(a.ID), formatInt(a.BankAccessID), a.Name, string(a.Type), a.IBAN, a.Balance, a.Currency, formatTime(a.BalanceDate))
+	}
+	return t
+}
+
+func accountList(e *env, args []string) error {
+	if err := parse(e.flags("account list"), args, 0); err != nil {
+		return err
+	}
+	uc, err := e.user()
+	if err != nil {
+		return err
+	}
+	page, err := uc.Accounts.List().Context(e.ctx).Send()
+	if err != nil {
+		return err
+	}
+	return e.out.print(page.Accounts, accountTable(page.Accounts...))
+}
+
+func accountGet(e *env, args []string) error {
+	fs := e.flags("account get")
+	if err := parse(fs, args, 1); err != nil {
+		return err
+	}
+	uc, err := e.user()
+	if err != nil {
+		return err
+	}
+	a, err := uc.Accounts.Get(fs.Arg(0)).Context(e.ctx).Send()
+	if err != nil {
+		return err
+	}
+	return e.out.print(a, accountTable(*a))
+}
+
+func transactionTable(txs ...bosgo.Transaction) *table {
+	t := &table{headers: []string{"id", "account", "entry_date", "amount", "currency", "counterparty", "usage"}}
+	for _, tx := range txs {
+		var value, currency string
+		if tx.Amount != nil {
+			value, currency = tx.Amount.Value, tx.Amount.Currency
+		}
+		date := ""
+		if !tx.EntryDate.IsZero() {
+			date = tx.EntryDate.Format("2006-01-02")
+		}
+		t.add(formatInt(tx.ID), formatInt(tx.UserAccountID), date, value, currency, tx.Counterparty.Name, tx.Usage)
+	}
+	return t
+}
+
+func transactionList(e *env, args []string) error {
+	fs := e.flags("transaction list")
+	account := fs.Int64("account", 0, "only list transactions of the account with this `ID`")
+	access := fs.Int64("access", 0, "only list transactions of the access with this `ID`")
+	since := fs.String("since", "", "only list transactions entered on or after this `date` (YYYY-MM-DD)")
+	limit := fs.Int("limit", 0, "maximum `number` of transactions to list, 0 lists all")
+	if err := parse(fs, args, 0); err != nil {
+		return err
+	}
+	uc, err := e.user()
+	if err != nil {
+		return err
+	}
+
+	req := uc.Transactions.List()
+	if *account != 0 {
+		req.AccountID(*account)
+	}
+	if *access != 0 {
+		req.AccessID(*access)
+	}
+	if *since != "" {
+		t, err := time.Parse("2006-01-02", *since)
+		if err != nil {
+			return fmt.Errorf("invalid date %q, expected YYYY-MM-DD", *since)
+		}
+		req.Since(t)
+	}
+	if *limit > 0 {
+		req.Limit(*limit)
+	}
+
+	txs := []bosgo.Transaction{}
+	it := req.Context(e.ctx).Iter()
+	for it.Next() {
+		txs = append(txs, it.Transaction())
+		if *limit > 0 && len(txs) == *limit {
+			break
+		}
+	}
+	if err := it.Err(); err != nil {
+		return err
+	}
+	return e.out.print(txs, transactionTable(txs...))
+}
+
+func transactionGet(e *env, args []string) error {
+	fs := e.flags("transaction get")
+	if err := parse(fs, args, 1); err != nil {
+		return err
+	}
+	uc, err := e.user()
+	if err != nil {
+		return err
+	}
+	tx, err := uc.Transactions.Get(fs.Arg(0)).Context(e.ctx).Send()
+	if err != nil {
+		return err
+	}
+	return e.out.print(tx, transactionTable(*tx))
+}
+
+func jobGet(e *env, args []string) error {
+	fs := e.flags("job get")
+	if err := parse(fs, args, 1); err != nil {
+		return err
+	}
+	uc, err := e.user()
+	if err != nil {
+		return err
+	}
+	st, err := uc.Jobs.Get(fs.Arg(0)).Context(e.ctx).Send()
+	if err != nil {
+		return err
+	}
+
+	t := fields("finished", formatBool(st.Finished), "stage", string(st.Stage))
+	if st.Access != nil {
+		t.add("access", formatInt(st.Access.ID))
+	}
+	if st.Challenge != nil {
+		for _, f := range st.Challenge.NextChallenges {
+			t.add("challenge", f.ID)
+		}
+	}
+	for _, p := range st.Errors {
+		t.add("error", p.Domain+"/"+p.Code)
+	}
+	return e.out.print(st, t)
+}
+
+func jobCancel(e *env, args []string) error {
+	fs := e.flags("job cancel")
+	if err := parse(fs, args, 1); err != nil {
+		return err
+	}
+	uc, err := e.user()
+	if err != nil {
+		return err
+	}
+	return uc.Jobs.Cancel(fs.Arg(0)).Context(e.ctx).Send()
+}
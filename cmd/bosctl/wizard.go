@@ -0,0 +1,322 @@
+// Copyright 2017 Bankrs AG.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"code.bankrs.com/bosgo"
+	"code.bankrs.com/bosgo/challengeform"
+)
+
+func init() {
+	register(&command{"access", "add", "[-provider ID | -query TEXT] [-store] [-poll DURATION]", "Add an access interactively, answering the provider's challenges", accessAdd})
+}
+
+// maxProviderChoices is the number of search results offered for selection.
+const maxProviderChoices = 10
+
+func accessAdd(e *env, args []string) error {
+	fs := e.flags("access add")
+	providerID := fs.String("provider", "", "`ID` of the provider, skips the search")
+	query := fs.String("query", "", "provider search `text`, prompted for if empty")
+	store := fs.Bool("store", false, "ask the API to store the answers that may be stored")
+	poll := fs.Duration("poll", time.Second, "`interval` between job status requests")
+	if err := parse(fs, args, 0); err != nil {
+		return err
+	}
+	uc, err := e.user()
+	if err != nil {
+		return err
+	}
+	ac, err := e.app()
+	if err != nil {
+		return err
+	}
+
+	w := &accessWizard{
+		Providers: ac.Providers,
+		Accesses:  uc.Accesses,
+		Jobs:      uc.Jobs,
+		In:        e.prompter,
+		Out:       e.stderr,
+		Store:     *store,
+		Poll:      *poll,
+	}
+	p, err := w.Provider(e.ctx, *providerID, *query)
+	if err != nil {
+		return err
+	}
+	access, err := w.Add(e.ctx, p)
+	if err != nil {
+		return err
+	}
+
+	t := &table{headers: []string{"id", "name", "number", "iban"}}
+	for _, a := range access.Accounts {
+		t.add(formatInt(a.ID), a.Name, a.Number, a.IBAN)
+	}
+	return e.out.print(access, t)
+}
+
+// accessWizard guides the user through adding an access: choosing the
+// provider, entering the login fields and answering the challenges of the
+// resulting job. Prompts are shown through In and progress is written to Out.
+type accessWizard struct {
+	Providers *bosgo.ProvidersService
+	Accesses  *bosgo.AccessesService
+	Jobs      *bosgo.JobsService
+	In        Prompter
+	Out       io.Writer
+	Store     bool          // Ask the API to store storeable answers
+	Poll      time.Duration // Interval between job status requests
+}
+
+// Provider returns the provider with the given id or, if id is empty, lets
+// the user choose one of the results of a search for query, which is
+// prompted for if empty.
+func (w *accessWizard) Provider(ctx context.Context, id, query string) (*bosgo.Provider, error) {
+	if id != "" {
+		return w.Providers.Get(id).Context(ctx).Send()
+	}
+
+	for {
+		if query == "" {
+			var err error
+			if query, err = w.In.Prompt("Search providers: ", false); err != nil {
+				return nil, err
+			}
+			if query == "" {
+				continue
+			}
+		}
+
+		res, err := w.Providers.Search(query).Context(ctx).Send()
+		if err != nil {
+			return nil, err
+		}
+		if len(*res) == 0 {
+			fmt.Fprintf(w.Out, "No providers match %q.\n", query)
+			query = ""
+			continue
+		}
+
+		choices := *res
+		if len(choices) > maxProviderChoices {
+			choices = choices[:maxProviderChoices]
+		}
+		for i, r := range choices {
+			fmt.Fprintf(w.Out, "%3d) %s (%s)\n", i+1, r.Provider.Name, r.Provider.ID)
+		}
+		for {
+			v, err := w.In.Prompt(fmt.Sprintf("Provider [1-%d, empty to search again]: ", len(choices)), false)
+			if err != nil {
+				return nil, err
+			}
+			if v == "" {
+				break
+			}
+			n, err := strconv.Atoi(v)
+			if err == nil && n >= 1 && n <= len(choices) {
+				return &choices[n-1].Provider, nil
+			}
+			fmt.Fprintf(w.Out, "Enter a number between 1 and %d.\n", len(choices))
+		}
+		query = ""
+	}
+}
+
+// Add adds an access to the provider and answers the challenges of the job
+// until it finishes. It returns the imported access.
+func (w *accessWizard) Add(ctx context.Context, p *bosgo.Provider) (*bosgo.JobAccess, error) {
+	fmt.Fprintf(w.Out, "Log in to %s\n", p.Name)
+	answers, err := w.ask(challengeform.FromProvider(*p))
+	if err != nil {
+		return nil, err
+	}
+
+	req := w.Accesses.Add(p.ID).Context(ctx)
+	for _, a := range answers {
+		req.ChallengeAnswer(a)
+	}
+	job, err := req.Send()
+	if err != nil {
+		return nil, err
+	}
+	return w.follow(ctx, job.URI)
+}
+
+// follow polls the job, prompting for the answers to its challenges, until it
+// finishes. If the response to the answers reports the status of the job, it
+// is used in place of the next poll, so a challenge asked again is prompted
+// for again. Otherwise the answers are checked asynchronously and the
+// challenge that has been answered is not asked again until the job reports
+// a different stage or challenge.
+func (w *accessWizard) follow(ctx context.Context, uri string) (*bosgo.JobAccess, error) {
+	var stage bosgo.JobStage
+	var answered *bosgo.Challenge
+	var st *bosgo.JobStatus // Status reported by the last answers
+	for {
+		if st == nil {
+			var err error
+			st, err = w.Jobs.Get(uri).Context(ctx).Send()
+			if err != nil {
+				return nil, err
+			}
+		}
+		if st.Stage != stage {
+			fmt.Fprintf(w.Out, "Job stage: %s\n", st.Stage)
+			stage = st.Stage
+			answered = nil
+		}
+
+		if st.Finished {
+			if st.Stage != bosgo.JobStageImported || st.Access == nil {
+				return nil, fmt.Errorf("job finished in stage %s%s", st.Stage, problemList(st.Errors))
+			}
+			return st.Access, nil
+		}
+
+		cur := st
+		st = nil
+		pending := answered != nil && reflect.DeepEqual(answered, cur.Challenge)
+		if cur.Stage == bosgo.JobStageChallenge && cur.Challenge != nil && len(cur.Challenge.NextChallenges) > 0 && !pending {
+			for _, p := range append(cur.Challenge.LastProblems, cur.Errors...) {
+				fmt.Fprintf(w.Out, "Problem: %s\n", problemText(p))
+			}
+			answers, err := w.ask(challengeform.FromChallenge(*cur.Challenge))
+			if err != nil {
+				return nil, err
+			}
+			req := w.Jobs.Answer(uri).Context(ctx)
+			for _, a := range answers {
+				req.ChallengeAnswer(a)
+			}
+			if st, err = req.SendStatus(); err != nil {
+				return nil, err
+			}
+			answered = nil
+			if st == nil {
+				answered = cur.Challenge
+			}
+		}
+		if st != nil {
+			continue
+		}
+
+		t := time.NewTimer(w.Poll)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return nil, ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// ask prompts for the fields of the form until the answers are valid. After
+// a validation problem only the fields with problems are asked again.
+func (w *accessWizard) ask(form *challengeform.Form) (bosgo.ChallengeAnswerList, error) {
+	values := map[string]string{}
+	fields := form.Fields
+	for {
+		for _, fld := range fields {
+			v, err := w.prompt(fld)
+			if err != nil {
+				return nil, err
+			}
+			values[fld.ID] = v
+		}
+
+		answers, err := form.Answers(values, w.Store)
+		verr, ok := err.(*challengeform.ValidationError)
+		if !ok {
+			return answers, err
+		}
+		fields = fields[:0:0]
+		for _, p := range verr.Problems {
+			fmt.Fprintf(w.Out, "%s\n", p.Error())
+			if fld, ok := form.Field(p.Field); ok {
+				fields = append(fields, fld)
+			}
+		}
+	}
+}
+
+// prompt asks for a single field, returning its default if nothing is
+// entered.
+func (w *accessWizard) prompt(fld challengeform.Field) (string, error) {
+	if fld.Description != "" {
+		fmt.Fprintln(w.Out, fld.Description)
+	}
+	keys := make([]string, 0, len(fld.Info))
+	for k := range fld.Info {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(w.Out, "  %s: %s\n", k, fld.Info[k])
+	}
+	if len(fld.Options) > 0 {
+		fmt.Fprintf(w.Out, "  Options: %s\n", strings.Join(fld.Options, ", "))
+	}
+
+	label := fld.Label
+	if label == "" {
+		label = fld.ID
+	}
+	switch {
+	case fld.Default != "":
+		label += " [" + fld.Default + "]"
+	case fld.Stored:
+		label += " [stored]"
+	case !fld.Required:
+		label += " (optional)"
+	}
+
+	v, err := w.In.Prompt(label+": ", fld.Secure)
+	if err != nil {
+		return "", err
+	}
+	if v == "" {
+		v = fld.Default
+	}
+	return v, nil
+}
+
+func problemText(p bosgo.Problem) string {
+	if p.Domain == "" {
+		return p.Code
+	}
+	return p.Domain + "/" + p.Code
+}
+
+func problemList(problems []bosgo.Problem) string {
+	if len(problems) == 0 {
+		return ""
+	}
+	codes := make([]string, len(problems))
+	for i, p := range problems {
+		codes[i] = problemText(p)
+	}
+	return ": " + strings.Join(codes, ", ")
+}
@@ -0,0 +1,215 @@
+// Copyright 2017 Bankrs AG.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"code.bankrs.com/bosgo"
+	"code.bankrs.com/bosgo/testserver"
+)
+
+// scriptedPrompter answers prompts from a list of answers per field label.
+type scriptedPrompter struct {
+	t       *testing.T
+	answers map[string][]string
+	secure  map[string]bool // Labels prompted for securely
+}
+
+func (p *scriptedPrompter) Prompt(label string, secure bool) (string, error) {
+	name := strings.TrimSuffix(label, ": ")
+	if i := strings.IndexAny(name, " ["); i > 0 {
+		name = name[:i]
+	}
+	queue := p.answers[name]
+	if len(queue) == 0 {
+		p.t.Fatalf("unexpected prompt %q", label)
+	}
+	p.answers[name] = queue[1:]
+	if secure {
+		p.secure[name] = true
+	}
+	return queue[0], nil
+}
+
+func TestAccessWizard(t *testing.T) {
+	s := testserver.NewWithDefaults()
+	defer s.Close()
+
+	ac := bosgo.NewAppClient(s.Client(), s.Addr(), testserver.DefaultApplicationID)
+	uc, err := ac.Users.Login(testserver.DefaultUsername, testserver.DefaultPassword).Send()
+	if err != nil {
+		t.Fatalf("login: %v", err)
+	}
+
+	in := &scriptedPrompter{
+		t: t,
+		answers: map[string][]string{
+			"Search":   {"default"},
+			"Provider": {"3", "1"},
+			"Login":    {testserver.DefaultAccessLogin},
+			"PIN":      {"12a", "0000"},
+			"login":    {""},
+			"pin":      {testserver.DefaultAccessPIN},
+		},
+		secure: map[string]bool{},
+	}
+	var out bytes.Buffer
+	w := &accessWizard{
+		Providers: ac.Providers,
+		Accesses:  uc.Accesses,
+		Jobs:      uc.Jobs,
+		In:        in,
+		Out:       &out,
+		Poll:      time.Millisecond,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	p, err := w.Provider(ctx, "", "")
+	if err != nil {
+		t.Fatalf("provider: %v", err)
+	}
+	access, err := w.Add(ctx, p)
+	if err != nil {
+		t.Fatalf("add: %v\n%s", err, out.String())
+	}
+
+	if len(access.Accounts) != 2 {
+		t.Errorf("imported accounts: got %d, want 2", len(access.Accounts))
+	}
+	if !in.secure["PIN"] || in.secure["Login"] {
+		t.Errorf("secure prompts: got %v, want only PIN", in.secure)
+	}
+	for name, queue := range in.answers {
+		if len(queue) > 0 {
+			t.Errorf("unused answers for %s: %v", name, queue)
+		}
+	}
+	for _, want := range []string{
+		"Enter a number between 1 and 1.",
+		"pin: answer contains invalid characters",
+		"Problem: user_wrong_pin",
+		"Job stage: imported",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output does not contain %q:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestAccessWizardWaitsForAnswer(t *testing.T) {
+	challenge := &bosgo.Challenge{
+		NextChallenges: []bosgo.ChallengeField{{ID: "tan", Description: "TAN", ChallengeType: "numeric"}},
+	}
+	var mu sync.Mutex
+	polls := 0 // Polls since the challenge was answered
+	answered := false
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		st := bosgo.JobStatus{Stage: bosgo.JobStageChallenge, Challenge: challenge}
+		switch {
+		case r.Method == http.MethodPut:
+			answered = true
+			return
+		case answered && polls >= 3:
+			st = bosgo.JobStatus{Stage: bosgo.JobStageImported, Finished: true, Access: &bosgo.JobAccess{ID: 1}}
+		case answered:
+			// The bank takes a while to check the answer
+			polls++
+		}
+		json.NewEncoder(w).Encode(st)
+	}))
+	defer ts.Close()
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("failed to parse server URL: %v", err)
+	}
+
+	in := &scriptedPrompter{t: t, answers: map[string][]string{"TAN": {"123456"}}, secure: map[string]bool{}}
+	w := &accessWizard{
+		Jobs: bosgo.NewUserClient(ts.Client(), u.Host, "token", "app").Jobs,
+		In:   in,
+		Out:  ioutil.Discard,
+		Poll: time.Millisecond,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	access, err := w.follow(ctx, "/jobs/1")
+	if err != nil {
+		t.Fatalf("follow: %v", err)
+	}
+	if access.ID != 1 {
+		t.Errorf("got access %+v, wanted 1", access)
+	}
+}
+
+func TestAccessWizardWrongAnswersInARow(t *testing.T) {
+	s := testserver.NewWithDefaults()
+	defer s.Close()
+	s.AddAccess(testserver.AccessDetails{
+		Access: bosgo.Access{ProviderID: "tan-provider-id", Name: "TAN Bank"},
+		Scenario: &testserver.Scenario{
+			Rounds: []testserver.ChallengeRound{{Fields: []testserver.ScenarioField{
+				{ID: "tan", Description: "TAN", Type: bosgo.ChallengeTypeNumeric, Answer: "123456"},
+			}}},
+		},
+	})
+
+	ac := bosgo.NewAppClient(s.Client(), s.Addr(), testserver.DefaultApplicationID)
+	uc, err := ac.Users.Login(testserver.DefaultUsername, testserver.DefaultPassword).Send()
+	if err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	job, err := uc.Accesses.Add("tan-provider-id").Send()
+	if err != nil {
+		t.Fatalf("add: %v", err)
+	}
+
+	// The server asks for the TAN again with the same problems after each
+	// wrong answer
+	in := &scriptedPrompter{t: t, answers: map[string][]string{"TAN": {"111111", "111111", "123456"}}, secure: map[string]bool{}}
+	var out bytes.Buffer
+	w := &accessWizard{
+		Jobs: uc.Jobs,
+		In:   in,
+		Out:  &out,
+		Poll: time.Millisecond,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, err := w.follow(ctx, job.URI); err != nil {
+		t.Fatalf("follow: %v\n%s", err, out.String())
+	}
+	if n := strings.Count(out.String(), "Problem: user_wrong_answer"); n != 2 {
+		t.Errorf("got %d wrong answer problems, wanted 2:\n%s", n, out.String())
+	}
+	if len(in.answers["TAN"]) > 0 {
+		t.Errorf("unused answers: %v", in.answers["TAN"])
+	}
+}
@@ -0,0 +1,161 @@
+// Copyright 2017 Bankrs AG.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command bostestserver runs the test server of package testserver as a
+// standalone HTTP server, for testing clients that are not written in Go.
+//
+// Usage:
+//
+//	bostestserver [-addr ADDR] [-tls] [-fixtures FILE] [-state FILE] [-admin-token TOKEN]
+//
+// The server starts with the data of the JSON or YAML fixtures file, or with
+// the default developer, application and user of testserver.NewWithDefaults
+// if no fixtures are given. If a state file is given, the state is saved to it
+// periodically and on exit and restored from it on start.
+//
+// With -tls the server uses the certificate given by -cert and -key or, if
+// none is given, a self-signed certificate generated at startup.
+//
+// Admin endpoints are served to clients giving the token of -admin-token in
+// an "Authorization: Bearer TOKEN" header or, if no token is set, to clients
+// on loopback addresses only:
+//
+//	POST /_admin/reset     reset to the fixtures or defaults
+//	GET  /_admin/state     download the current state
+//	PUT  /_admin/state     replace the state with an uploaded one
+//	POST /_admin/snapshot  save the state to the state file now
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"code.bankrs.com/bosgo/testserver"
+)
+
+func main() {
+	addr := flag.String("addr", "localhost:8080", "`address` to listen on")
+	useTLS := flag.Bool("tls", false, "serve HTTPS instead of HTTP")
+	certFile := flag.String("cert", "", "TLS certificate `file`, a self-signed certificate is generated if empty")
+	keyFile := flag.String("key", "", "TLS key `file`")
+	fixtures := flag.String("fixtures", "", "JSON or YAML fixtures `file`, the defaults are used if empty")
+	state := flag.String("state", "", "`file` the state is saved to and restored from")
+	interval := flag.Duration("save-interval", 30*time.Second, "`interval` between saves of the state file")
+	adminToken := flag.String("admin-token", "", "`token` required by the admin endpoints, which only serve loopback clients if empty")
+	verbose := flag.Bool("v", false, "log every request")
+	flag.Parse()
+	log.SetPrefix("bostestserver: ")
+	log.SetFlags(0)
+
+	if (*certFile == "") != (*keyFile == "") {
+		log.Fatal("-cert and -key must be given together")
+	}
+
+	a := &app{statePath: *state, adminToken: *adminToken}
+	if *verbose {
+		a.logger = stdLogger{}
+	}
+	if *fixtures != "" {
+		f, err := testserver.LoadFixtures(*fixtures)
+		if err != nil {
+			log.Fatalf("failed to load fixtures: %v", err)
+		}
+		a.fixtures = f
+	}
+	restored, err := a.restore()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if restored {
+		log.Printf("restored state from %s", *state)
+	} else if err := a.Reset(); err != nil {
+		log.Fatal(err)
+	}
+
+	hs := &http.Server{Addr: *addr, Handler: a}
+	if *useTLS && *certFile == "" {
+		cert, err := selfSignedCert(hostOf(*addr))
+		if err != nil {
+			log.Fatalf("failed to generate certificate: %v", err)
+		}
+		hs.TLSConfig = tlsConfig(cert)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if *state != "" && *interval > 0 {
+		go a.saveEvery(ctx, *interval)
+	}
+
+	scheme := "http"
+	if *useTLS {
+		scheme = "https"
+	}
+	log.Printf("listening on %s://%s", scheme, *addr)
+	errc := make(chan error, 1)
+	go func() {
+		if *useTLS {
+			errc <- hs.ListenAndServeTLS(*certFile, *keyFile)
+			return
+		}
+		errc <- hs.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errc:
+		log.Fatal(err)
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := hs.Shutdown(shutdownCtx); err != nil {
+		log.Printf("shutdown: %v", err)
+	}
+	if *state != "" {
+		if err := a.Save(); err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("saved state to %s", *state)
+	}
+}
+
+func (a *app) saveEvery(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if err := a.Save(); err != nil {
+				log.Print(err)
+			}
+		}
+	}
+}
+
+// stdLogger logs the test server's messages with the standard logger.
+type stdLogger struct{}
+
+func (stdLogger) Logf(format string, args ...interface{}) {
+	log.Output(2, fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,196 @@
+// Copyright 2017 Bankrs AG.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"code.bankrs.com/bosgo/testserver"
+)
+
+// adminPrefix is the path prefix of the admin endpoints.
+const adminPrefix = "/_admin/"
+
+// app serves the API of the current test server, which is replaced on reset
+// or when a state is uploaded, and the admin endpoints.
+type app struct {
+	fixtures   *testserver.Fixtures // nil to use the defaults
+	statePath  string
+	logger     testserver.Logger
+	adminToken string // required by the admin endpoints, loopback clients only if empty
+
+	mu  sync.RWMutex // guards srv
+	srv *testserver.Server
+}
+
+func (a *app) server() *testserver.Server {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.srv
+}
+
+func (a *app) setServer(s *testserver.Server) {
+	if a.logger != nil {
+		s.SetLogger(a.logger)
+	}
+	a.mu.Lock()
+	a.srv = s
+	a.mu.Unlock()
+}
+
+// Reset replaces the server with one holding only the fixtures or defaults.
+func (a *app) Reset() error {
+	s := testserver.NewUnstarted()
+	if a.fixtures == nil {
+		s.AddDefaults()
+	} else if err := s.Load(a.fixtures); err != nil {
+		return fmt.Errorf("failed to load fixtures: %v", err)
+	}
+	a.setServer(s)
+	return nil
+}
+
+// restore replaces the server with one holding the state read from the
+// state file. It reports whether a state file was found.
+func (a *app) restore() (bool, error) {
+	if a.statePath == "" {
+		return false, nil
+	}
+	data, err := ioutil.ReadFile(a.statePath)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	s := testserver.NewUnstarted()
+	if err := s.ReadState(bytes.NewReader(data)); err != nil {
+		return false, fmt.Errorf("failed to read state %s: %v", a.statePath, err)
+	}
+	a.setServer(s)
+	return true, nil
+}
+
+// Save writes the state to the state file, replacing it atomically.
+func (a *app) Save() error {
+	if a.statePath == "" {
+		return fmt.Errorf("no state file")
+	}
+	var buf bytes.Buffer
+	if err := a.server().WriteState(&buf); err != nil {
+		return fmt.Errorf("failed to write state: %v", err)
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(a.statePath), ".bostestserver")
+	if err != nil {
+		return fmt.Errorf("failed to save state: %v", err)
+	}
+	defer os.Remove(f.Name())
+	if _, err := buf.WriteTo(f); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to save state: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to save state: %v", err)
+	}
+	if err := os.Rename(f.Name(), a.statePath); err != nil {
+		return fmt.Errorf("failed to save state: %v", err)
+	}
+	return nil
+}
+
+func (a *app) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if strings.HasPrefix(req.URL.Path, adminPrefix) {
+		a.serveAdmin(w, req)
+		return
+	}
+	a.server().ServeHTTP(w, req)
+}
+
+// adminAllowed reports whether the request may use the admin endpoints. If
+// an admin token is set the request must give it as bearer token, otherwise
+// only requests from loopback addresses are allowed.
+func (a *app) adminAllowed(w http.ResponseWriter, req *http.Request) bool {
+	if a.adminToken != "" {
+		token := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(a.adminToken)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "admin token required", http.StatusUnauthorized)
+			return false
+		}
+		return true
+	}
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if ip := net.ParseIP(host); err != nil || ip == nil || !ip.IsLoopback() {
+		http.Error(w, "admin endpoints are only served to loopback clients without -admin-token", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+func (a *app) serveAdmin(w http.ResponseWriter, req *http.Request) {
+	if !a.adminAllowed(w, req) {
+		return
+	}
+	switch endpoint := req.Method + " " + strings.TrimPrefix(req.URL.Path, adminPrefix); endpoint {
+	case "POST reset":
+		if err := a.Reset(); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	case "GET state":
+		var buf bytes.Buffer
+		if err := a.server().WriteState(&buf); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		buf.WriteTo(w)
+
+	case "PUT state":
+		s := testserver.NewUnstarted()
+		if err := s.ReadState(req.Body); err != nil {
+			http.Error(w, "invalid state: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		a.setServer(s)
+		w.WriteHeader(http.StatusNoContent)
+
+	case "POST snapshot":
+		if a.statePath == "" {
+			http.Error(w, "no state file configured", http.StatusConflict)
+			return
+		}
+		if err := a.Save(); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.NotFound(w, req)
+	}
+}
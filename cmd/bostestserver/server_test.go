@@ -0,0 +1,215 @@
+// Copyright 2017 Bankrs AG.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"crypto/x509"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+
+	"code.bankrs.com/bosgo"
+	"code.bankrs.com/bosgo/testserver"
+)
+
+func startApp(t *testing.T, a *app) (*httptest.Server, *bosgo.AppClient) {
+	t.Helper()
+	ts := httptest.NewTLSServer(a)
+	t.Cleanup(ts.Close)
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ts, bosgo.NewAppClient(ts.Client(), u.Host, testserver.DefaultApplicationID)
+}
+
+func admin(t *testing.T, ts *httptest.Server, method, path string, body []byte) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(method, ts.URL+adminPrefix+path, bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	t.Cleanup(func() { res.Body.Close() })
+	return res
+}
+
+func countAccesses(t *testing.T, ac *bosgo.AppClient) int {
+	t.Helper()
+	uc, err := ac.Users.Login(testserver.DefaultUsername, testserver.DefaultPassword).Send()
+	if err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	page, err := uc.Accesses.List().Send()
+	if err != nil {
+		t.Fatalf("list accesses: %v", err)
+	}
+	return len(page.Accesses)
+}
+
+func addAccess(t *testing.T, ac *bosgo.AppClient) {
+	t.Helper()
+	uc, err := ac.Users.Login(testserver.DefaultUsername, testserver.DefaultPassword).Send()
+	if err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	_, err = uc.Accesses.Add(testserver.DefaultProviderID).
+		ChallengeAnswer(bosgo.ChallengeAnswer{ID: testserver.ChallengeLogin, Value: testserver.DefaultAccessLogin}).
+		ChallengeAnswer(bosgo.ChallengeAnswer{ID: testserver.ChallengePIN, Value: testserver.DefaultAccessPIN}).
+		Send()
+	if err != nil {
+		t.Fatalf("add access: %v", err)
+	}
+}
+
+func TestAdminResetAndState(t *testing.T) {
+	a := &app{}
+	if err := a.Reset(); err != nil {
+		t.Fatal(err)
+	}
+	ts, ac := startApp(t, a)
+
+	addAccess(t, ac)
+	if n := countAccesses(t, ac); n != 1 {
+		t.Fatalf("accesses after add: got %d, want 1", n)
+	}
+
+	res := admin(t, ts, "GET", "state", nil)
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("get state: status %d", res.StatusCode)
+	}
+	state, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res := admin(t, ts, "POST", "reset", nil); res.StatusCode != http.StatusNoContent {
+		t.Fatalf("reset: status %d", res.StatusCode)
+	}
+	if n := countAccesses(t, ac); n != 0 {
+		t.Errorf("accesses after reset: got %d, want 0", n)
+	}
+
+	if res := admin(t, ts, "PUT", "state", state); res.StatusCode != http.StatusNoContent {
+		t.Fatalf("put state: status %d", res.StatusCode)
+	}
+	if n := countAccesses(t, ac); n != 1 {
+		t.Errorf("accesses after restoring state: got %d, want 1", n)
+	}
+
+	if res := admin(t, ts, "PUT", "state", []byte("{")); res.StatusCode != http.StatusBadRequest {
+		t.Errorf("put invalid state: status %d, want %d", res.StatusCode, http.StatusBadRequest)
+	}
+	if res := admin(t, ts, "POST", "snapshot", nil); res.StatusCode != http.StatusConflict {
+		t.Errorf("snapshot without state file: status %d, want %d", res.StatusCode, http.StatusConflict)
+	}
+}
+
+func TestAdminToken(t *testing.T) {
+	a := &app{adminToken: "secret"}
+	if err := a.Reset(); err != nil {
+		t.Fatal(err)
+	}
+	ts, _ := startApp(t, a)
+
+	if res := admin(t, ts, "GET", "state", nil); res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("get state without token: status %d, want %d", res.StatusCode, http.StatusUnauthorized)
+	}
+
+	req, err := http.NewRequest("GET", ts.URL+adminPrefix+"state", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer secret")
+	res, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("get state with token: status %d, want %d", res.StatusCode, http.StatusOK)
+	}
+}
+
+func TestAdminLoopbackOnly(t *testing.T) {
+	a := &app{}
+	if err := a.Reset(); err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest("POST", adminPrefix+"reset", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	rec := httptest.NewRecorder()
+	a.ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("reset from remote client: status %d, want %d", rec.Code, http.StatusForbidden)
+	}
+
+	req.RemoteAddr = "[::1]:1234"
+	rec = httptest.NewRecorder()
+	a.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("reset from loopback client: status %d, want %d", rec.Code, http.StatusNoContent)
+	}
+}
+
+func TestSnapshotAndRestore(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	a := &app{statePath: statePath}
+	if restored, err := a.restore(); err != nil || restored {
+		t.Fatalf("restore without state file: restored=%v, err=%v", restored, err)
+	}
+	if err := a.Reset(); err != nil {
+		t.Fatal(err)
+	}
+	ts, ac := startApp(t, a)
+	addAccess(t, ac)
+
+	if res := admin(t, ts, "POST", "snapshot", nil); res.StatusCode != http.StatusNoContent {
+		t.Fatalf("snapshot: status %d", res.StatusCode)
+	}
+
+	b := &app{statePath: statePath}
+	if restored, err := b.restore(); err != nil || !restored {
+		t.Fatalf("restore: restored=%v, err=%v", restored, err)
+	}
+	_, bc := startApp(t, b)
+	if n := countAccesses(t, bc); n != 1 {
+		t.Errorf("accesses after restart: got %d, want 1", n)
+	}
+}
+
+func TestSelfSignedCert(t *testing.T) {
+	cert, err := selfSignedCert("bos.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, host := range []string{"localhost", "127.0.0.1", "bos.test"} {
+		if err := leaf.VerifyHostname(host); err != nil {
+			t.Errorf("verify %s: %v", host, err)
+		}
+	}
+}
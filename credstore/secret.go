@@ -0,0 +1,113 @@
+// Copyright 2017 Bankrs AG.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package credstore keeps the provider credentials of Bankrs applications in
+// a local secret store and synchronises them with the credentials held by the
+// Bankrs API.
+//
+// Secret values are wrapped in the Secret type which never reveals its value
+// when formatted or marshalled, so credentials do not leak into logs.
+package credstore
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"code.bankrs.com/bosgo"
+)
+
+// Redacted is printed in place of a secret value.
+const Redacted = "[redacted]"
+
+// Secret is a secret value that prints as Redacted with every fmt verb and
+// marshals as Redacted to JSON and text. Use Reveal to obtain the value.
+type Secret string
+
+// Reveal returns the secret value.
+func (s Secret) Reveal() string { return string(s) }
+
+// String returns Redacted.
+func (s Secret) String() string { return Redacted }
+
+// GoString returns Redacted.
+func (s Secret) GoString() string { return Redacted }
+
+// Format writes Redacted regardless of the verb.
+func (s Secret) Format(f fmt.State, verb rune) { f.Write([]byte(Redacted)) }
+
+// MarshalText returns Redacted.
+func (s Secret) MarshalText() ([]byte, error) { return []byte(Redacted), nil }
+
+// Secrets are the secret values of a credential keyed by name.
+type Secrets map[string]Secret
+
+// NewSecrets wraps the values of m.
+func NewSecrets(m map[string]string) Secrets {
+	s := make(Secrets, len(m))
+	for k, v := range m {
+		s[k] = Secret(v)
+	}
+	return s
+}
+
+// Reveal returns the secret values as a plain map suitable for
+// ApplicationsService.CreateCredential and CredentialsService.Update.
+func (s Secrets) Reveal() map[string]string {
+	m := make(map[string]string, len(s))
+	for k, v := range s {
+		m[k] = v.Reveal()
+	}
+	return m
+}
+
+// Keys returns the names of the secrets in alphabetical order.
+func (s Secrets) Keys() []string {
+	keys := make([]string, 0, len(s))
+	for k := range s {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Validate checks that the secrets contain a non-empty value for every key
+// required by the provider and no other keys.
+func (s Secrets) Validate(p bosgo.CredentialProvider) error {
+	required := map[string]bool{}
+	var missing, unknown []string
+	for _, k := range p.Keys {
+		required[k] = true
+		if s[k] == "" {
+			missing = append(missing, k)
+		}
+	}
+	for _, k := range s.Keys() {
+		if !required[k] {
+			unknown = append(unknown, k)
+		}
+	}
+
+	var problems []string
+	if len(missing) > 0 {
+		problems = append(problems, "missing "+strings.Join(missing, ", "))
+	}
+	if len(unknown) > 0 {
+		problems = append(problems, "unknown "+strings.Join(unknown, ", "))
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("credstore: invalid keys for provider %s: %s", p.Name, strings.Join(problems, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+// Copyright 2017 Bankrs AG.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package credstore
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"testing"
+
+	"code.bankrs.com/bosgo"
+)
+
+func TestSecretRedacted(t *testing.T) {
+	s := Secret("hunter2")
+	e := Entry{Provider: "figo", Secrets: Secrets{"client_secret": s}}
+
+	var buf bytes.Buffer
+	log.New(&buf, "", 0).Printf("%v %+v %#v %s %q %x", s, e, e, s, s, s)
+	data, err := json.Marshal(e)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out := buf.String() + fmt.Sprint(s, e.Secrets) + string(data)
+
+	if strings.Contains(out, "hunter2") || strings.Contains(out, fmt.Sprintf("%x", "hunter2")) {
+		t.Errorf("secret value leaked: %s", out)
+	}
+	if !strings.Contains(out, Redacted) {
+		t.Errorf("got %s, wanted redacted values", out)
+	}
+	if s.Reveal() != "hunter2" {
+		t.Errorf("got revealed value %q, wanted hunter2", s.Reveal())
+	}
+}
+
+func TestSecretsValidate(t *testing.T) {
+	p := bosgo.CredentialProvider{Name: "figo", Keys: []string{"client_id", "client_secret"}}
+
+	testCases := []struct {
+		secrets map[string]string
+		err     string
+	}{
+		{secrets: map[string]string{"client_id": "id", "client_secret": "secret"}},
+		{
+			secrets: map[string]string{"client_id": "id", "client_secret": "", "token": "x"},
+			err:     "credstore: invalid keys for provider figo: missing client_secret; unknown token",
+		},
+	}
+
+	for _, tc := range testCases {
+		err := NewSecrets(tc.secrets).Validate(p)
+		switch {
+		case tc.err == "" && err != nil:
+			t.Errorf("%v: unexpected error: %v", tc.secrets, err)
+		case tc.err != "" && (err == nil || err.Error() != tc.err):
+			t.Errorf("%v: got error %v, wanted %q", tc.secrets, err, tc.err)
+		}
+	}
+}
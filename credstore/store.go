@@ -0,0 +1,298 @@
+// Copyright 2017 Bankrs AG.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package credstore
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrNotFound is returned by a SecretStore when no entry exists for a name.
+var ErrNotFound = errors.New("credstore: entry not found")
+
+// Entry is a credential held in a SecretStore.
+type Entry struct {
+	ApplicationID string
+	Provider      string
+	CredentialID  string // Id assigned by Bankrs, empty if not yet uploaded
+	Secrets       Secrets
+	UpdatedAt     time.Time
+}
+
+// SecretStore stores credentials under a name chosen by the caller.
+// Implementations must be safe for concurrent use.
+type SecretStore interface {
+	// Get returns the entry stored under name or ErrNotFound.
+	Get(name string) (Entry, error)
+
+	// Put stores the entry under name, replacing any previous entry.
+	Put(name string, e Entry) error
+
+	// Delete removes the entry stored under name. Deleting a name that does
+	// not exist is not an error.
+	Delete(name string) error
+
+	// Names returns the names of all entries in alphabetical order.
+	Names() ([]string, error)
+}
+
+// MemoryStore is a SecretStore that keeps entries in memory.
+type MemoryStore struct {
+	mu      sync.RWMutex
+	entries map[string]Entry
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: map[string]Entry{}}
+}
+
+// Get implements the SecretStore interface.
+func (m *MemoryStore) Get(name string) (Entry, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	e, ok := m.entries[name]
+	if !ok {
+		return Entry{}, ErrNotFound
+	}
+	return copyEntry(e), nil
+}
+
+// Put implements the SecretStore interface.
+func (m *MemoryStore) Put(name string, e Entry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries[name] = copyEntry(e)
+	return nil
+}
+
+// Delete implements the SecretStore interface.
+func (m *MemoryStore) Delete(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.entries, name)
+	return nil
+}
+
+// Names implements the SecretStore interface.
+func (m *MemoryStore) Names() ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	names := make([]string, 0, len(m.entries))
+	for name := range m.entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func copyEntry(e Entry) Entry {
+	secrets := make(Secrets, len(e.Secrets))
+	for k, v := range e.Secrets {
+		secrets[k] = v
+	}
+	e.Secrets = secrets
+	return e
+}
+
+// KeySize is the size in bytes of the keys generated by NewKey, selecting
+// AES-256.
+const KeySize = 32
+
+// NewKey returns a random key for a FileStore.
+func NewKey() ([]byte, error) {
+	key := make([]byte, KeySize)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// FileStore is a SecretStore that keeps all entries in a single file
+// encrypted with AES-GCM. The file is rewritten on every change.
+type FileStore struct {
+	filename string
+	aead     cipher.AEAD
+
+	mu  sync.Mutex
+	mem *MemoryStore
+}
+
+// OpenFileStore opens the store in the named file using key, which must be
+// 16, 24 or 32 bytes long to select AES-128, AES-192 or AES-256. The file is
+// created on the first change if it does not exist.
+func OpenFileStore(filename string, key []byte) (*FileStore, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("credstore: %v", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("credstore: %v", err)
+	}
+
+	fs := &FileStore{filename: filename, aead: aead, mem: NewMemoryStore()}
+	if err := fs.load(); err != nil {
+		return nil, err
+	}
+	return fs, nil
+}
+
+// fileEntry is the form in which entries are encrypted. Secrets are stored
+// as plain strings since Secret marshals as Redacted.
+type fileEntry struct {
+	ApplicationID string            `json:"application_id,omitempty"`
+	Provider      string            `json:"provider"`
+	CredentialID  string            `json:"credential_id,omitempty"`
+	Secrets       map[string]string `json:"secrets"`
+	UpdatedAt     time.Time         `json:"updated_at"`
+}
+
+func (fs *FileStore) load() error {
+	data, err := ioutil.ReadFile(fs.filename)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	n := fs.aead.NonceSize()
+	if len(data) < n {
+		return fmt.Errorf("credstore: %s is not a secret store", fs.filename)
+	}
+	plain, err := fs.aead.Open(nil, data[:n], data[n:], nil)
+	if err != nil {
+		return fmt.Errorf("credstore: cannot decrypt %s: wrong key or corrupted file", fs.filename)
+	}
+
+	var entries map[string]fileEntry
+	if err := json.Unmarshal(plain, &entries); err != nil {
+		return fmt.Errorf("credstore: invalid contents of %s: %v", fs.filename, err)
+	}
+	for name, fe := range entries {
+		fs.mem.entries[name] = Entry{
+			ApplicationID: fe.ApplicationID,
+			Provider:      fe.Provider,
+			CredentialID:  fe.CredentialID,
+			Secrets:       NewSecrets(fe.Secrets),
+			UpdatedAt:     fe.UpdatedAt,
+		}
+	}
+	return nil
+}
+
+// save encrypts all entries and replaces the file with them. The new
+// contents are written to a temporary file first so a failed write does not
+// destroy the store.
+func (fs *FileStore) save() error {
+	entries := make(map[string]fileEntry, len(fs.mem.entries))
+	for name, e := range fs.mem.entries {
+		entries[name] = fileEntry{
+			ApplicationID: e.ApplicationID,
+			Provider:      e.Provider,
+			CredentialID:  e.CredentialID,
+			Secrets:       e.Secrets.Reveal(),
+			UpdatedAt:     e.UpdatedAt,
+		}
+	}
+	plain, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+
+	nonce := make([]byte, fs.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return err
+	}
+	data := fs.aead.Seal(nonce, nonce, plain, nil)
+
+	tmp, err := ioutil.TempFile(filepath.Dir(fs.filename), filepath.Base(fs.filename)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), fs.filename); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
+// Get implements the SecretStore interface.
+func (fs *FileStore) Get(name string) (Entry, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return fs.mem.Get(name)
+}
+
+// Put implements the SecretStore interface.
+func (fs *FileStore) Put(name string, e Entry) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	old, exists := fs.mem.entries[name]
+	fs.mem.Put(name, e)
+	if err := fs.save(); err != nil {
+		if exists {
+			fs.mem.entries[name] = old
+		} else {
+			delete(fs.mem.entries, name)
+		}
+		return err
+	}
+	return nil
+}
+
+// Delete implements the SecretStore interface.
+func (fs *FileStore) Delete(name string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	old, exists := fs.mem.entries[name]
+	if !exists {
+		return nil
+	}
+	delete(fs.mem.entries, name)
+	if err := fs.save(); err != nil {
+		fs.mem.entries[name] = old
+		return err
+	}
+	return nil
+}
+
+// Names implements the SecretStore interface.
+func (fs *FileStore) Names() ([]string, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return fs.mem.Names()
+}
@@ -0,0 +1,128 @@
+// Copyright 2017 Bankrs AG.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package credstore
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func testStore(t *testing.T, s SecretStore) {
+	e := Entry{
+		ApplicationID: "app1",
+		Provider:      "figo",
+		Secrets:       Secrets{"client_id": "id", "client_secret": "secret"},
+		UpdatedAt:     time.Date(2017, 7, 1, 12, 0, 0, 0, time.UTC),
+	}
+
+	if _, err := s.Get("figo"); err != ErrNotFound {
+		t.Fatalf("got error %v, wanted ErrNotFound", err)
+	}
+	if err := s.Put("figo", e); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := s.Put("other", Entry{Provider: "other"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got, err := s.Get("figo")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(got, e) {
+		t.Errorf("got entry %+v, wanted %+v", got, e)
+	}
+
+	// The store must not share the secrets map with the caller.
+	e.Secrets["client_secret"] = "changed"
+	if got, _ := s.Get("figo"); got.Secrets["client_secret"] != "secret" {
+		t.Errorf("stored entry was modified through the caller's map")
+	}
+
+	names, err := s.Names()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []string{"figo", "other"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("got names %v, wanted %v", names, want)
+	}
+
+	if err := s.Delete("other"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := s.Delete("other"); err != nil {
+		t.Fatalf("unexpected error deleting missing entry: %v", err)
+	}
+	if _, err := s.Get("other"); err != ErrNotFound {
+		t.Errorf("got error %v after delete, wanted ErrNotFound", err)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, NewMemoryStore())
+}
+
+func TestFileStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "credstore")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "secrets")
+	key, err := NewKey()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	fs, err := OpenFileStore(filename, key)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	testStore(t, fs)
+
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if bytes.Contains(data, []byte("secret")) || bytes.Contains(data, []byte("figo")) {
+		t.Errorf("store file contains plaintext")
+	}
+
+	reopened, err := OpenFileStore(filename, key)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	e, err := reopened.Get("figo")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if e.Secrets["client_secret"].Reveal() != "secret" || e.ApplicationID != "app1" {
+		t.Errorf("got entry %+v after reopening", e)
+	}
+
+	wrong, _ := NewKey()
+	if _, err := OpenFileStore(filename, wrong); err == nil {
+		t.Errorf("got nil error opening with wrong key, wanted non-nil")
+	}
+	if _, err := OpenFileStore(filename, key[:7]); err == nil {
+		t.Errorf("got nil error for invalid key size, wanted non-nil")
+	}
+}
@@ -0,0 +1,157 @@
+// Copyright 2017 Bankrs AG.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package credstore
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"code.bankrs.com/bosgo"
+)
+
+// Syncer copies credentials between a SecretStore and the Bankrs API.
+type Syncer struct {
+	Store SecretStore
+	Dev   *bosgo.DevClient
+
+	// Providers lists the keys required by each provider. If nil, it is
+	// requested from the API the first time secrets are validated.
+	Providers []bosgo.CredentialProvider
+
+	now func() time.Time // replaced in tests
+}
+
+// NewSyncer returns a Syncer for the store and the developer client.
+func NewSyncer(store SecretStore, dev *bosgo.DevClient) *Syncer {
+	return &Syncer{Store: store, Dev: dev, now: time.Now}
+}
+
+// Validate checks the secrets of the entry against the keys required by its
+// provider.
+func (s *Syncer) Validate(ctx context.Context, e Entry) error {
+	if s.Providers == nil {
+		page, err := s.Dev.Credentials.ListProviders().Context(ctx).Send()
+		if err != nil {
+			return err
+		}
+		s.Providers = page.Providers
+	}
+	for _, p := range s.Providers {
+		if p.Name == e.Provider {
+			return e.Secrets.Validate(p)
+		}
+	}
+	return fmt.Errorf("credstore: unknown credential provider %q", e.Provider)
+}
+
+// Push validates the entry stored under name and uploads it to Bankrs. An
+// entry without a credential id is created for its application and the id
+// assigned by Bankrs is saved in the store; otherwise the existing
+// credential is updated.
+func (s *Syncer) Push(ctx context.Context, name string) (Entry, error) {
+	e, err := s.Store.Get(name)
+	if err != nil {
+		return Entry{}, err
+	}
+	if err := s.Validate(ctx, e); err != nil {
+		return Entry{}, err
+	}
+
+	if e.CredentialID != "" {
+		if err := s.Dev.Credentials.Update(e.CredentialID, e.Secrets.Reveal()).Context(ctx).Send(); err != nil {
+			return Entry{}, err
+		}
+		return e, nil
+	}
+
+	if e.ApplicationID == "" {
+		return Entry{}, fmt.Errorf("credstore: entry %s has neither a credential nor an application id", name)
+	}
+	id, err := s.Dev.Applications.CreateCredential(e.ApplicationID, e.Provider, e.Secrets.Reveal()).Context(ctx).Send()
+	if err != nil {
+		return Entry{}, err
+	}
+	e.CredentialID = id
+	e.UpdatedAt = s.now()
+	if err := s.Store.Put(name, e); err != nil {
+		return Entry{}, fmt.Errorf("credstore: credential %s was created but could not be stored: %v", id, err)
+	}
+	return e, nil
+}
+
+// PushAll pushes every entry of the store. It continues after failures and
+// returns the names of the entries that were pushed along with the first
+// error.
+func (s *Syncer) PushAll(ctx context.Context) ([]string, error) {
+	names, err := s.Store.Names()
+	if err != nil {
+		return nil, err
+	}
+
+	var pushed []string
+	var first error
+	for _, name := range names {
+		if _, err := s.Push(ctx, name); err != nil {
+			if first == nil {
+				first = fmt.Errorf("credstore: %s: %v", name, err)
+			}
+			continue
+		}
+		pushed = append(pushed, name)
+	}
+	return pushed, first
+}
+
+// Pull fetches the credential with the given id from Bankrs and stores it
+// under name. The application id of an existing entry is kept.
+func (s *Syncer) Pull(ctx context.Context, name string, credentialID string) (Entry, error) {
+	cred, err := s.Dev.Credentials.Get(credentialID).Context(ctx).Send()
+	if err != nil {
+		return Entry{}, err
+	}
+
+	e := Entry{
+		Provider:     cred.Provider,
+		CredentialID: cred.ID,
+		Secrets:      NewSecrets(cred.Credentials),
+		UpdatedAt:    s.now(),
+	}
+	if old, err := s.Store.Get(name); err == nil {
+		e.ApplicationID = old.ApplicationID
+	}
+	if e.CredentialID == "" {
+		e.CredentialID = credentialID
+	}
+	if err := s.Store.Put(name, e); err != nil {
+		return Entry{}, err
+	}
+	return e, nil
+}
+
+// Delete removes the credential of the entry stored under name from Bankrs,
+// if it was uploaded, and then from the store.
+func (s *Syncer) Delete(ctx context.Context, name string) error {
+	e, err := s.Store.Get(name)
+	if err != nil {
+		return err
+	}
+	if e.CredentialID != "" {
+		if err := s.Dev.Credentials.Delete(e.CredentialID).Context(ctx).Send(); err != nil {
+			return err
+		}
+	}
+	return s.Store.Delete(name)
+}
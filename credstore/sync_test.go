@@ -0,0 +1,152 @@
+// Copyright 2017 Bankrs AG.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package credstore
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"code.bankrs.com/bosgo"
+)
+
+type credentialAPI struct {
+	created map[string]map[string]string // keyed by application id
+	updated map[string]map[string]string // keyed by credential id
+	deleted []string
+}
+
+// startAPI starts a server answering the developer credential endpoints.
+func startAPI(t *testing.T) (*bosgo.DevClient, *credentialAPI, func()) {
+	api := &credentialAPI{
+		created: map[string]map[string]string{},
+		updated: map[string]map[string]string{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/developers/credentials/providers", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]bosgo.CredentialProvider{
+			{Name: "figo", Keys: []string{"client_id", "client_secret"}},
+		})
+	})
+	mux.HandleFunc("/v1/developers/applications/app1/credentials", func(w http.ResponseWriter, r *http.Request) {
+		var data struct {
+			Provider string            `json:"provider"`
+			Keys     map[string]string `json:"keys"`
+		}
+		json.NewDecoder(r.Body).Decode(&data)
+		api.created["app1"] = data.Keys
+		json.NewEncoder(w).Encode(map[string]string{"id": "cred1"})
+	})
+	mux.HandleFunc("/v1/developers/credentials/cred1", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			json.NewEncoder(w).Encode(bosgo.Credential{
+				ID:          "cred1",
+				Provider:    "figo",
+				Credentials: map[string]string{"client_id": "remote", "client_secret": "remote-secret"},
+			})
+		case http.MethodPut:
+			var data struct {
+				Keys map[string]string `json:"keys"`
+			}
+			json.NewDecoder(r.Body).Decode(&data)
+			api.updated["cred1"] = data.Keys
+		case http.MethodDelete:
+			api.deleted = append(api.deleted, "cred1")
+		}
+	})
+
+	ts := httptest.NewTLSServer(mux)
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("failed to parse server URL: %v", err)
+	}
+	return bosgo.NewDevClient(ts.Client(), u.Host, "devtoken"), api, ts.Close
+}
+
+func TestSyncerPush(t *testing.T) {
+	dev, api, cleanup := startAPI(t)
+	defer cleanup()
+
+	store := NewMemoryStore()
+	store.Put("figo", Entry{
+		ApplicationID: "app1",
+		Provider:      "figo",
+		Secrets:       Secrets{"client_id": "id", "client_secret": "secret"},
+	})
+	store.Put("invalid", Entry{ApplicationID: "app1", Provider: "figo", Secrets: Secrets{"client_id": "id"}})
+
+	s := NewSyncer(store, dev)
+	now := time.Date(2017, 7, 1, 12, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+
+	pushed, err := s.PushAll(context.Background())
+	if err == nil {
+		t.Errorf("got nil error for invalid entry, wanted non-nil")
+	}
+	if want := []string{"figo"}; !reflect.DeepEqual(pushed, want) {
+		t.Errorf("got pushed %v, wanted %v", pushed, want)
+	}
+
+	want := map[string]string{"client_id": "id", "client_secret": "secret"}
+	if !reflect.DeepEqual(api.created["app1"], want) {
+		t.Errorf("got created keys %v, wanted %v", api.created["app1"], want)
+	}
+	e, _ := store.Get("figo")
+	if e.CredentialID != "cred1" || !e.UpdatedAt.Equal(now) {
+		t.Errorf("got entry %+v, wanted credential id cred1", e)
+	}
+
+	// A second push updates the existing credential.
+	if _, err := s.Push(context.Background(), "figo"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(api.updated["cred1"], want) {
+		t.Errorf("got updated keys %v, wanted %v", api.updated["cred1"], want)
+	}
+}
+
+func TestSyncerPullDelete(t *testing.T) {
+	dev, api, cleanup := startAPI(t)
+	defer cleanup()
+
+	store := NewMemoryStore()
+	store.Put("figo", Entry{ApplicationID: "app1", Provider: "figo"})
+	s := NewSyncer(store, dev)
+
+	e, err := s.Pull(context.Background(), "figo", "cred1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if e.ApplicationID != "app1" || e.CredentialID != "cred1" || e.Secrets["client_secret"].Reveal() != "remote-secret" {
+		t.Errorf("got entry %+v", e)
+	}
+
+	if err := s.Delete(context.Background(), "figo"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(api.deleted, []string{"cred1"}) {
+		t.Errorf("got deleted %v, wanted cred1", api.deleted)
+	}
+	if _, err := store.Get("figo"); err != ErrNotFound {
+		t.Errorf("got error %v, wanted ErrNotFound", err)
+	}
+}
@@ -0,0 +1,404 @@
+// Copyright 2017 Bankrs AG.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package dedupe finds transactions that would be counted twice when
+// analysing a user's finances: duplicates caused by connecting the same bank
+// account through several accesses, and transfers between the user's own
+// accounts.
+package dedupe
+
+import (
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"code.bankrs.com/bosgo"
+	"code.bankrs.com/bosgo/internal/money"
+)
+
+// Default values used when the corresponding Options field is zero.
+const (
+	DefaultDateWindow      = 3
+	DefaultUsageSimilarity = 0.8
+)
+
+// Options control the matching of transactions.
+type Options struct {
+	// DateWindow is the number of days by which the dates of two matching
+	// transactions may differ.
+	DateWindow int
+
+	// UsageSimilarity is the minimum similarity, between 0 and 1, of the usage
+	// texts of two transactions without a common remote id for them to be
+	// considered duplicates.
+	UsageSimilarity float64
+}
+
+func (o *Options) defaults() {
+	if o.DateWindow <= 0 {
+		o.DateWindow = DefaultDateWindow
+	}
+	if o.UsageSimilarity <= 0 {
+		o.UsageSimilarity = DefaultUsageSimilarity
+	}
+}
+
+// Reason explains why two transactions are considered duplicates.
+type Reason string
+
+const (
+	ReasonRemoteID Reason = "remote_id" // Same remote id and amount
+	ReasonSimilar  Reason = "similar"   // Same amount, close dates and similar usage
+)
+
+// Duplicate is a pair of transactions that describe the same booking.
+// Original is the transaction to keep; Copy should be excluded from reports.
+type Duplicate struct {
+	Original bosgo.Transaction
+	Copy     bosgo.Transaction
+	Reason   Reason
+	Score    float64 // Between 0 and 1
+}
+
+// TransferPair is a transfer between two of the user's own accounts, made up
+// of the outgoing and the incoming transaction.
+type TransferPair struct {
+	Debit  bosgo.Transaction
+	Credit bosgo.Transaction
+}
+
+// Result holds the outcome of Analyse.
+type Result struct {
+	Duplicates []Duplicate
+	Transfers  []TransferPair
+
+	// UnpairedTransfers are transactions to or from one of the user's own
+	// accounts whose counterpart was not found, for example because it lies
+	// outside the analysed period.
+	UnpairedTransfers []bosgo.Transaction
+
+	excluded map[int64]bool
+}
+
+// Excluded reports whether the transaction with the given id is a duplicate
+// copy or part of an internal transfer and should therefore be left out of
+// spending and income reports.
+func (r *Result) Excluded(id int64) bool {
+	return r.excluded[id]
+}
+
+// Filter returns the transactions of txs that are not excluded.
+func (r *Result) Filter(txs []bosgo.Transaction) []bosgo.Transaction {
+	var kept []bosgo.Transaction
+	for _, tx := range txs {
+		if !r.excluded[tx.ID] {
+			kept = append(kept, tx)
+		}
+	}
+	return kept
+}
+
+// Analyse finds duplicates among txs and pairs internal transfers between the
+// given accounts of the user. Duplicates are detected first, so copies are
+// not paired as transfers.
+func Analyse(txs []bosgo.Transaction, accounts []bosgo.Account, opts Options) *Result {
+	opts.defaults()
+	r := &Result{excluded: map[int64]bool{}}
+
+	r.Duplicates = FindDuplicates(txs, opts)
+	for _, d := range r.Duplicates {
+		r.excluded[d.Copy.ID] = true
+	}
+
+	var rest []bosgo.Transaction
+	for _, tx := range txs {
+		if !r.excluded[tx.ID] {
+			rest = append(rest, tx)
+		}
+	}
+	r.Transfers, r.UnpairedTransfers = PairTransfers(rest, accounts, opts)
+	for _, p := range r.Transfers {
+		r.excluded[p.Debit.ID] = true
+		r.excluded[p.Credit.ID] = true
+	}
+	for _, tx := range r.UnpairedTransfers {
+		r.excluded[tx.ID] = true
+	}
+	return r
+}
+
+// entry is a transaction with its parsed amount and date.
+type entry struct {
+	tx     bosgo.Transaction
+	amount money.Amount
+	date   time.Time
+	usage  string
+}
+
+func entries(txs []bosgo.Transaction) []entry {
+	es := make([]entry, 0, len(txs))
+	for _, tx := range txs {
+		if tx.Amount == nil {
+			continue
+		}
+		amt, err := money.Parse(tx.Amount.Value)
+		if err != nil {
+			continue
+		}
+		date := tx.EntryDate
+		if date.IsZero() {
+			date = tx.SettlementDate
+		}
+		es = append(es, entry{tx: tx, amount: amt, date: dayOf(date), usage: normalise(tx.Usage)})
+	}
+	return es
+}
+
+// FindDuplicates returns pairs of transactions from different accesses or
+// accounts that describe the same booking. Two transactions match if they
+// have the same amount and either share a remote id or have dates within the
+// date window and similar usage texts. If both transactions know the IBAN of
+// their account, the IBANs must be equal. Each transaction appears in at most
+// one pair; the transaction with the lower access id, and then the lower id,
+// is kept as the original.
+func FindDuplicates(txs []bosgo.Transaction, opts Options) []Duplicate {
+	opts.defaults()
+
+	buckets := map[string][]entry{}
+	for _, e := range entries(txs) {
+		key := e.tx.Amount.Currency + " " + e.amount.String()
+		buckets[key] = append(buckets[key], e)
+	}
+
+	var candidates []Duplicate
+	for _, es := range buckets {
+		for i := range es {
+			for j := i + 1; j < len(es); j++ {
+				if d, ok := duplicate(es[i], es[j], opts); ok {
+					candidates = append(candidates, d)
+				}
+			}
+		}
+	}
+
+	// Prefer the strongest matches when a transaction matches several others.
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].Score != candidates[j].Score {
+			return candidates[i].Score > candidates[j].Score
+		}
+		return candidates[i].Copy.ID < candidates[j].Copy.ID
+	})
+
+	used := map[int64]bool{}
+	var dups []Duplicate
+	for _, d := range candidates {
+		if used[d.Original.ID] || used[d.Copy.ID] {
+			continue
+		}
+		used[d.Original.ID] = true
+		used[d.Copy.ID] = true
+		dups = append(dups, d)
+	}
+
+	sort.SliceStable(dups, func(i, j int) bool { return dups[i].Original.ID < dups[j].Original.ID })
+	return dups
+}
+
+func duplicate(a, b entry, opts Options) (Duplicate, bool) {
+	if a.tx.ID == b.tx.ID {
+		return Duplicate{}, false
+	}
+	if a.tx.AccessID == b.tx.AccessID && a.tx.UserAccountID == b.tx.UserAccountID {
+		// Transactions of the same account are never duplicates of each
+		// other, however similar they look.
+		return Duplicate{}, false
+	}
+	ibanA, ibanB := compact(a.tx.UserAccount.IBAN), compact(b.tx.UserAccount.IBAN)
+	if ibanA != "" && ibanB != "" && ibanA != ibanB {
+		return Duplicate{}, false
+	}
+
+	if b.tx.AccessID < a.tx.AccessID || (b.tx.AccessID == a.tx.AccessID && b.tx.ID < a.tx.ID) {
+		a, b = b, a
+	}
+	d := Duplicate{Original: a.tx, Copy: b.tx}
+
+	if a.tx.RemoteID != "" && a.tx.RemoteID == b.tx.RemoteID {
+		d.Reason = ReasonRemoteID
+		d.Score = 1
+		return d, true
+	}
+
+	days := absDays(a.date, b.date)
+	if a.date.IsZero() || b.date.IsZero() || days > opts.DateWindow {
+		return Duplicate{}, false
+	}
+	sim := Similarity(a.usage, b.usage)
+	if sim < opts.UsageSimilarity {
+		return Duplicate{}, false
+	}
+
+	d.Reason = ReasonSimilar
+	// Same-day matches with identical usage score just below remote id
+	// matches; each day of difference lowers the score.
+	d.Score = sim * (0.99 - 0.1*float64(days)/float64(opts.DateWindow+1))
+	return d, true
+}
+
+// PairTransfers finds transactions between the user's own accounts. A
+// transaction is internal if the IBAN of its counterparty is the IBAN of one
+// of the accounts. Internal debits are paired with a credit of the same
+// amount on the counterparty's account within the date window. Internal
+// transactions without a counterpart are returned as unpaired.
+func PairTransfers(txs []bosgo.Transaction, accounts []bosgo.Account, opts Options) ([]TransferPair, []bosgo.Transaction) {
+	opts.defaults()
+
+	own := map[string]int64{}
+	ibans := map[int64]string{}
+	for _, acc := range accounts {
+		if iban := compact(acc.IBAN); iban != "" {
+			own[iban] = acc.ID
+			ibans[acc.ID] = iban
+		}
+	}
+	accountIBAN := func(tx bosgo.Transaction) string {
+		if iban := compact(tx.UserAccount.IBAN); iban != "" {
+			return iban
+		}
+		return ibans[tx.UserAccountID]
+	}
+
+	var debits, credits []entry
+	for _, e := range entries(txs) {
+		iban := compact(e.tx.Counterparty.Account.IBAN)
+		if _, ok := own[iban]; !ok || iban == accountIBAN(e.tx) {
+			continue
+		}
+		if e.amount.Sign() < 0 {
+			debits = append(debits, e)
+		} else {
+			credits = append(credits, e)
+		}
+	}
+
+	paired := map[int64]bool{}
+	var pairs []TransferPair
+	for _, d := range debits {
+		from := accountIBAN(d.tx)
+		to := compact(d.tx.Counterparty.Account.IBAN)
+
+		best, bestDays := -1, 0
+		for i, c := range credits {
+			if paired[c.tx.ID] || c.amount != -d.amount || c.tx.Amount.Currency != d.tx.Amount.Currency {
+				continue
+			}
+			if accountIBAN(c.tx) != to {
+				continue
+			}
+			if cp := compact(c.tx.Counterparty.Account.IBAN); from != "" && cp != from {
+				continue
+			}
+			days := absDays(d.date, c.date)
+			if days > opts.DateWindow {
+				continue
+			}
+			if best == -1 || days < bestDays {
+				best, bestDays = i, days
+			}
+		}
+		if best == -1 {
+			continue
+		}
+		paired[d.tx.ID] = true
+		paired[credits[best].tx.ID] = true
+		pairs = append(pairs, TransferPair{Debit: d.tx, Credit: credits[best].tx})
+	}
+
+	var unpaired []bosgo.Transaction
+	for _, e := range append(debits, credits...) {
+		if !paired[e.tx.ID] {
+			unpaired = append(unpaired, e.tx)
+		}
+	}
+	sort.SliceStable(unpaired, func(i, j int) bool { return unpaired[i].ID < unpaired[j].ID })
+	return pairs, unpaired
+}
+
+// Similarity returns the Sørensen–Dice coefficient of the character bigrams
+// of two texts after normalising case, punctuation and white space. It is 1
+// for equal texts and 0 for texts without common bigrams.
+func Similarity(a, b string) float64 {
+	a, b = normalise(a), normalise(b)
+	if a == b {
+		return 1
+	}
+	ba, bb := bigrams(a), bigrams(b)
+	if len(ba) == 0 || len(bb) == 0 {
+		return 0
+	}
+
+	counts := map[string]int{}
+	for _, g := range ba {
+		counts[g]++
+	}
+	common := 0
+	for _, g := range bb {
+		if counts[g] > 0 {
+			counts[g]--
+			common++
+		}
+	}
+	return 2 * float64(common) / float64(len(ba)+len(bb))
+}
+
+func bigrams(s string) []string {
+	rs := []rune(s)
+	if len(rs) < 2 {
+		return nil
+	}
+	gs := make([]string, 0, len(rs)-1)
+	for i := 0; i < len(rs)-1; i++ {
+		gs = append(gs, string(rs[i:i+2]))
+	}
+	return gs
+}
+
+// normalise lower cases s and replaces runs of characters other than letters
+// and digits with a single space.
+func normalise(s string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), " ")
+}
+
+func dayOf(t time.Time) time.Time {
+	if t.IsZero() {
+		return time.Time{}
+	}
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+func absDays(a, b time.Time) int {
+	d := int(a.Sub(b).Hours() / 24)
+	if d < 0 {
+		return -d
+	}
+	return d
+}
+
+func compact(iban string) string {
+	return strings.ToUpper(strings.Replace(iban, " ", "", -1))
+}
@@ -0,0 +1,163 @@
+// Copyright 2017 Bankrs AG.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dedupe
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"code.bankrs.com/bosgo"
+)
+
+const (
+	ibanChecking = "DE84200700245353762745"
+	ibanSavings  = "DE56200800950445688921"
+	ibanOther    = "GB82WEST12345698765432"
+)
+
+var testAccounts = []bosgo.Account{
+	{ID: 10, IBAN: ibanChecking},
+	{ID: 20, IBAN: ibanSavings},
+	{ID: 30, IBAN: ibanChecking}, // Same account connected through a second access
+}
+
+func date(day int) time.Time {
+	return time.Date(2017, 7, day, 0, 0, 0, 0, time.UTC)
+}
+
+func tx(id, access, account int64, day int, amount, usage string) bosgo.Transaction {
+	t := bosgo.Transaction{
+		ID:            id,
+		AccessID:      access,
+		UserAccountID: account,
+		EntryDate:     date(day),
+		Amount:        &bosgo.MoneyAmount{Currency: "EUR", Value: amount},
+		Usage:         usage,
+	}
+	for _, acc := range testAccounts {
+		if acc.ID == account {
+			t.UserAccount.IBAN = acc.IBAN
+		}
+	}
+	return t
+}
+
+func withCounterparty(t bosgo.Transaction, iban string) bosgo.Transaction {
+	t.Counterparty.Account.IBAN = iban
+	return t
+}
+
+func withRemoteID(t bosgo.Transaction, id string) bosgo.Transaction {
+	t.RemoteID = id
+	return t
+}
+
+func ids(txs []bosgo.Transaction) []int64 {
+	var ids []int64
+	for _, t := range txs {
+		ids = append(ids, t.ID)
+	}
+	return ids
+}
+
+func TestSimilarity(t *testing.T) {
+	testCases := []struct {
+		a, b string
+		min  float64
+		max  float64
+	}{
+		{a: "Rechnung 4711", b: "RECHNUNG-4711", min: 1, max: 1},
+		{a: "SEPA Lastschrift Rechnung 4711", b: "Lastschrift Rechnung 4711", min: 0.8, max: 0.99},
+		{a: "Miete Juli", b: "Strom Juni", min: 0, max: 0.3},
+		{a: "", b: "x", min: 0, max: 0},
+	}
+
+	for _, tc := range testCases {
+		got := Similarity(tc.a, tc.b)
+		if got < tc.min || got > tc.max {
+			t.Errorf("%q/%q: got %.3f, wanted between %.2f and %.2f", tc.a, tc.b, got, tc.min, tc.max)
+		}
+	}
+}
+
+func TestFindDuplicates(t *testing.T) {
+	txs := []bosgo.Transaction{
+		withRemoteID(tx(1, 1, 10, 3, "-12.00", "Coffee"), "R1"),
+		withRemoteID(tx(2, 2, 30, 4, "-12.00", "Something else"), "R1"),
+		tx(3, 1, 10, 10, "-99.90", "SEPA Lastschrift Rechnung 4711"),
+		tx(4, 2, 30, 11, "-99.90", "Lastschrift Rechnung 4711"),
+		tx(5, 1, 10, 12, "-5.00", "Bakery"),
+		tx(6, 1, 10, 12, "-5.00", "Bakery"),                          // Same account, genuine second purchase
+		tx(7, 2, 30, 20, "-99.90", "SEPA Lastschrift Rechnung 4711"), // Too late
+		tx(8, 2, 20, 3, "-12.00", "Coffee"),                          // Different account
+	}
+
+	dups := FindDuplicates(txs, Options{})
+	if len(dups) != 2 {
+		t.Fatalf("got %d duplicates, wanted 2: %+v", len(dups), dups)
+	}
+	if dups[0].Original.ID != 1 || dups[0].Copy.ID != 2 || dups[0].Reason != ReasonRemoteID {
+		t.Errorf("got duplicate %d/%d (%s), wanted 1/2 by remote id", dups[0].Original.ID, dups[0].Copy.ID, dups[0].Reason)
+	}
+	if dups[1].Original.ID != 3 || dups[1].Copy.ID != 4 || dups[1].Reason != ReasonSimilar {
+		t.Errorf("got duplicate %d/%d (%s), wanted 3/4 by similarity", dups[1].Original.ID, dups[1].Copy.ID, dups[1].Reason)
+	}
+	if dups[1].Score >= dups[0].Score {
+		t.Errorf("got similarity score %.3f, wanted less than remote id score %.3f", dups[1].Score, dups[0].Score)
+	}
+}
+
+func TestPairTransfers(t *testing.T) {
+	txs := []bosgo.Transaction{
+		withCounterparty(tx(1, 1, 10, 5, "-200.00", "Sparen"), ibanSavings),
+		withCounterparty(tx(2, 1, 20, 6, "200.00", "Sparen"), ibanChecking),
+		withCounterparty(tx(3, 1, 10, 5, "-50.00", "Rent"), ibanOther),
+		withCounterparty(tx(4, 1, 20, 25, "100.00", "Back"), ibanChecking), // Counterpart missing
+	}
+
+	pairs, unpaired := PairTransfers(txs, testAccounts, Options{})
+	if len(pairs) != 1 || pairs[0].Debit.ID != 1 || pairs[0].Credit.ID != 2 {
+		t.Errorf("got pairs %+v, wanted 1/2", pairs)
+	}
+	if got := ids(unpaired); !reflect.DeepEqual(got, []int64{4}) {
+		t.Errorf("got unpaired %v, wanted [4]", got)
+	}
+}
+
+func TestAnalyse(t *testing.T) {
+	txs := []bosgo.Transaction{
+		withCounterparty(tx(1, 1, 10, 5, "-200.00", "Sparen"), ibanSavings),
+		withCounterparty(tx(2, 1, 20, 6, "200.00", "Sparen"), ibanChecking),
+		withCounterparty(tx(3, 2, 30, 5, "-200.00", "Sparen"), ibanSavings), // Copy of 1
+		tx(4, 1, 10, 7, "-30.00", "Groceries"),
+		tx(5, 2, 30, 7, "-30.00", "Groceries"), // Copy of 4
+		tx(6, 1, 10, 8, "1500.00", "Salary"),
+	}
+
+	r := Analyse(txs, testAccounts, Options{})
+	if len(r.Duplicates) != 2 {
+		t.Errorf("got %d duplicates, wanted 2", len(r.Duplicates))
+	}
+	if len(r.Transfers) != 1 || len(r.UnpairedTransfers) != 0 {
+		t.Errorf("got %d transfers and %d unpaired, wanted 1 and 0", len(r.Transfers), len(r.UnpairedTransfers))
+	}
+	if got := ids(r.Filter(txs)); !reflect.DeepEqual(got, []int64{4, 6}) {
+		t.Errorf("got remaining transactions %v, wanted [4 6]", got)
+	}
+	if !r.Excluded(3) || r.Excluded(6) {
+		t.Errorf("got excluded 3=%v 6=%v, wanted true and false", r.Excluded(3), r.Excluded(6))
+	}
+}
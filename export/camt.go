@@ -0,0 +1,407 @@
+// Copyright 2017 Bankrs AG.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"encoding/xml"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"code.bankrs.com/bosgo"
+	"code.bankrs.com/bosgo/internal/money"
+)
+
+// CAMT053Namespace is the XML namespace of the ISO 20022 bank to customer
+// statement message written by WriteCAMT053.
+const CAMT053Namespace = "urn:iso:std:iso:20022:tech:xsd:camt.053.001.02"
+
+// WriteCAMT053 writes the statement to w as an ISO 20022 CAMT.053 bank to
+// customer statement message.
+func WriteCAMT053(w io.Writer, s *Statement) error {
+	d, err := s.prepare()
+	if err != nil {
+		return err
+	}
+
+	doc := camtDocument{
+		Xmlns: CAMT053Namespace,
+		Stmt: camtBkToCstmrStmt{
+			GrpHdr: camtGrpHdr{
+				MsgID:   truncate(d.id, 35),
+				CreDtTm: d.created.Format(isoDateTime),
+			},
+			Stmt: camtStmt{
+				ID:           truncate(d.id, 35),
+				ElctrncSeqNb: d.sequence,
+				CreDtTm:      d.created.Format(isoDateTime),
+				FrToDt: camtFrToDt{
+					FrDtTm: d.from.Format(isoDateTime),
+					ToDtTm: d.to.Add(24*time.Hour - time.Second).Format(isoDateTime),
+				},
+				Acct: camtAccount(s.Account, s.BIC),
+				Bal: []camtBal{
+					camtBalance("OPBD", d.opening, d.currency, d.from),
+					camtBalance("CLBD", d.closing, d.currency, d.to),
+				},
+				TxsSummry: camtSummary(d),
+			},
+		},
+	}
+
+	for _, e := range d.entries {
+		doc.Stmt.Stmt.Ntry = append(doc.Stmt.Stmt.Ntry, camtEntry(e, d.currency))
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	if err := enc.Flush(); err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "\n")
+	return err
+}
+
+const isoDateTime = "2006-01-02T15:04:05Z07:00"
+
+type camtDocument struct {
+	XMLName xml.Name          `xml:"Document"`
+	Xmlns   string            `xml:"xmlns,attr"`
+	Stmt    camtBkToCstmrStmt `xml:"BkToCstmrStmt"`
+}
+
+type camtBkToCstmrStmt struct {
+	GrpHdr camtGrpHdr `xml:"GrpHdr"`
+	Stmt   camtStmt   `xml:"Stmt"`
+}
+
+type camtGrpHdr struct {
+	MsgID   string `xml:"MsgId"`
+	CreDtTm string `xml:"CreDtTm"`
+}
+
+type camtStmt struct {
+	ID           string         `xml:"Id"`
+	ElctrncSeqNb int            `xml:"ElctrncSeqNb"`
+	CreDtTm      string         `xml:"CreDtTm"`
+	FrToDt       camtFrToDt     `xml:"FrToDt"`
+	Acct         camtAcct       `xml:"Acct"`
+	Bal          []camtBal      `xml:"Bal"`
+	TxsSummry    *camtTxsSummry `xml:"TxsSummry,omitempty"`
+	Ntry         []camtNtry     `xml:"Ntry"`
+}
+
+type camtFrToDt struct {
+	FrDtTm string `xml:"FrDtTm"`
+	ToDtTm string `xml:"ToDtTm"`
+}
+
+type camtAcct struct {
+	ID   camtAcctID    `xml:"Id"`
+	Ccy  string        `xml:"Ccy,omitempty"`
+	Nm   string        `xml:"Nm,omitempty"`
+	Ownr *camtParty    `xml:"Ownr,omitempty"`
+	Svcr *camtServicer `xml:"Svcr,omitempty"`
+}
+
+type camtAcctID struct {
+	IBAN string      `xml:"IBAN,omitempty"`
+	Othr *camtOthrID `xml:"Othr,omitempty"`
+}
+
+type camtOthrID struct {
+	ID string `xml:"Id"`
+}
+
+type camtParty struct {
+	Nm string `xml:"Nm"`
+}
+
+type camtServicer struct {
+	FinInstnID camtFinInstnID `xml:"FinInstnId"`
+}
+
+type camtFinInstnID struct {
+	BIC string `xml:"BIC"`
+}
+
+type camtAmt struct {
+	Ccy   string `xml:"Ccy,attr"`
+	Value string `xml:",chardata"`
+}
+
+type camtBal struct {
+	Tp        camtBalTp `xml:"Tp"`
+	Amt       camtAmt   `xml:"Amt"`
+	CdtDbtInd string    `xml:"CdtDbtInd"`
+	Dt        camtDate  `xml:"Dt"`
+}
+
+type camtBalTp struct {
+	CdOrPrtry camtCd `xml:"CdOrPrtry"`
+}
+
+type camtCd struct {
+	Cd string `xml:"Cd"`
+}
+
+type camtDate struct {
+	Dt string `xml:"Dt"`
+}
+
+type camtTxsSummry struct {
+	TtlNtries    camtTtlNtries `xml:"TtlNtries"`
+	TtlCdtNtries camtNbAndSum  `xml:"TtlCdtNtries"`
+	TtlDbtNtries camtNbAndSum  `xml:"TtlDbtNtries"`
+}
+
+type camtTtlNtries struct {
+	NbOfNtries    int    `xml:"NbOfNtries"`
+	Sum           string `xml:"Sum"`
+	TtlNetNtryAmt string `xml:"TtlNetNtryAmt"`
+	CdtDbtInd     string `xml:"CdtDbtInd"`
+}
+
+type camtNbAndSum struct {
+	NbOfNtries int    `xml:"NbOfNtries"`
+	Sum        string `xml:"Sum"`
+}
+
+type camtNtry struct {
+	NtryRef      string       `xml:"NtryRef,omitempty"`
+	Amt          camtAmt      `xml:"Amt"`
+	CdtDbtInd    string       `xml:"CdtDbtInd"`
+	Sts          string       `xml:"Sts"`
+	BookgDt      camtDate     `xml:"BookgDt"`
+	ValDt        camtDate     `xml:"ValDt"`
+	AcctSvcrRef  string       `xml:"AcctSvcrRef,omitempty"`
+	BkTxCd       camtBkTxCd   `xml:"BkTxCd"`
+	NtryDtls     camtNtryDtls `xml:"NtryDtls"`
+	AddtlNtryInf string       `xml:"AddtlNtryInf,omitempty"`
+}
+
+type camtBkTxCd struct {
+	Prtry camtPrtryCd `xml:"Prtry"`
+}
+
+type camtPrtryCd struct {
+	Cd   string `xml:"Cd"`
+	Issr string `xml:"Issr,omitempty"`
+}
+
+type camtNtryDtls struct {
+	TxDtls camtTxDtls `xml:"TxDtls"`
+}
+
+type camtTxDtls struct {
+	AmtDtls   *camtAmtDtls   `xml:"AmtDtls,omitempty"`
+	RltdPties *camtRltdPties `xml:"RltdPties,omitempty"`
+	RmtInf    *camtRmtInf    `xml:"RmtInf,omitempty"`
+}
+
+type camtAmtDtls struct {
+	InstdAmt camtInstdAmt `xml:"InstdAmt"`
+	TxAmt    camtTxAmt    `xml:"TxAmt"`
+}
+
+type camtInstdAmt struct {
+	Amt     camtAmt      `xml:"Amt"`
+	CcyXchg *camtCcyXchg `xml:"CcyXchg,omitempty"`
+}
+
+type camtTxAmt struct {
+	Amt camtAmt `xml:"Amt"`
+}
+
+type camtCcyXchg struct {
+	SrcCcy   string `xml:"SrcCcy"`
+	TrgtCcy  string `xml:"TrgtCcy"`
+	XchgRate string `xml:"XchgRate"`
+}
+
+type camtRltdPties struct {
+	Dbtr      *camtParty `xml:"Dbtr,omitempty"`
+	DbtrAcct  *camtAcct  `xml:"DbtrAcct,omitempty"`
+	UltmtDbtr *camtParty `xml:"UltmtDbtr,omitempty"`
+	Cdtr      *camtParty `xml:"Cdtr,omitempty"`
+	CdtrAcct  *camtAcct  `xml:"CdtrAcct,omitempty"`
+	UltmtCdtr *camtParty `xml:"UltmtCdtr,omitempty"`
+}
+
+type camtRmtInf struct {
+	Ustrd []string `xml:"Ustrd"`
+}
+
+func camtAccount(acc bosgo.Account, bic string) camtAcct {
+	a := camtAcct{
+		Ccy: acc.Currency,
+		Nm:  truncate(acc.Name, 70),
+	}
+	if acc.IBAN != "" {
+		a.ID.IBAN = compactIBAN(acc.IBAN)
+	} else {
+		a.ID.Othr = &camtOthrID{ID: truncate(acc.Number, 34)}
+	}
+	if acc.Holder != "" {
+		a.Ownr = &camtParty{Nm: truncate(acc.Holder, 70)}
+	}
+	if bic != "" {
+		a.Svcr = &camtServicer{FinInstnID: camtFinInstnID{BIC: bic}}
+	}
+	return a
+}
+
+func camtBalance(code string, amt money.Amount, currency string, day time.Time) camtBal {
+	return camtBal{
+		Tp:        camtBalTp{CdOrPrtry: camtCd{Cd: code}},
+		Amt:       camtAmt{Ccy: currency, Value: amt.Abs().String()},
+		CdtDbtInd: creditDebit(amt),
+		Dt:        camtDate{Dt: day.Format(isoDate)},
+	}
+}
+
+func camtSummary(d *statementData) *camtTxsSummry {
+	if len(d.entries) == 0 {
+		return nil
+	}
+
+	var sum camtTxsSummry
+	var credits, debits money.Amount
+	for _, e := range d.entries {
+		if e.amount.Sign() < 0 {
+			sum.TtlDbtNtries.NbOfNtries++
+			debits -= e.amount
+		} else {
+			sum.TtlCdtNtries.NbOfNtries++
+			credits += e.amount
+		}
+	}
+	net := credits - debits
+
+	sum.TtlNtries = camtTtlNtries{
+		NbOfNtries:    len(d.entries),
+		Sum:           (credits + debits).String(),
+		TtlNetNtryAmt: net.Abs().String(),
+		CdtDbtInd:     creditDebit(net),
+	}
+	sum.TtlCdtNtries.Sum = credits.String()
+	sum.TtlDbtNtries.Sum = debits.String()
+	return &sum
+}
+
+func camtEntry(e entry, currency string) camtNtry {
+	tx := e.tx
+	n := camtNtry{
+		NtryRef:      strconv.FormatInt(tx.ID, 10),
+		Amt:          camtAmt{Ccy: currency, Value: e.amount.Abs().String()},
+		CdtDbtInd:    creditDebit(e.amount),
+		Sts:          "BOOK",
+		BookgDt:      camtDate{Dt: bookingDate(tx).Format(isoDate)},
+		ValDt:        camtDate{Dt: valueDate(tx).Format(isoDate)},
+		AcctSvcrRef:  truncate(tx.RemoteID, 35),
+		BkTxCd:       camtBankTransactionCode(tx),
+		AddtlNtryInf: truncate(tx.TransactionType, 500),
+	}
+
+	if orig, ccy, ok := originalAmount(tx); ok {
+		dtls := &camtAmtDtls{
+			InstdAmt: camtInstdAmt{
+				Amt: camtAmt{Ccy: ccy, Value: orig.Abs().String()},
+			},
+			TxAmt: camtTxAmt{
+				Amt: camtAmt{Ccy: currency, Value: e.amount.Abs().String()},
+			},
+		}
+		if rate := strings.TrimSpace(tx.OriginalAmount.ExchangeRate); rate != "" {
+			dtls.InstdAmt.CcyXchg = &camtCcyXchg{
+				SrcCcy:   ccy,
+				TrgtCcy:  currency,
+				XchgRate: rate,
+			}
+		}
+		n.NtryDtls.TxDtls.AmtDtls = dtls
+	}
+
+	cp := tx.Counterparty
+	name := counterpartyName(tx)
+	var merchant string
+	if cp.Merchant != nil && cp.Merchant.Name != "" && cp.Merchant.Name != name {
+		merchant = cp.Merchant.Name
+	}
+	if name != "" || cp.Account.IBAN != "" || cp.Account.Number != "" || merchant != "" {
+		parties := &camtRltdPties{}
+		var party *camtParty
+		if name != "" {
+			party = &camtParty{Nm: truncate(name, 70)}
+		}
+		var acct *camtAcct
+		if cp.Account.IBAN != "" {
+			acct = &camtAcct{ID: camtAcctID{IBAN: compactIBAN(cp.Account.IBAN)}}
+		} else if cp.Account.Number != "" {
+			acct = &camtAcct{ID: camtAcctID{Othr: &camtOthrID{ID: truncate(cp.Account.Number, 34)}}}
+		}
+		var ultimate *camtParty
+		if merchant != "" {
+			ultimate = &camtParty{Nm: truncate(merchant, 70)}
+		}
+
+		// The counterparty of an incoming payment is its debtor, the
+		// counterparty of an outgoing payment its creditor.
+		if e.amount.Sign() < 0 {
+			parties.Cdtr, parties.CdtrAcct, parties.UltmtCdtr = party, acct, ultimate
+		} else {
+			parties.Dbtr, parties.DbtrAcct, parties.UltmtDbtr = party, acct, ultimate
+		}
+		n.NtryDtls.TxDtls.RltdPties = parties
+	}
+
+	if usage := strings.TrimSpace(tx.Usage); usage != "" {
+		n.NtryDtls.TxDtls.RmtInf = &camtRmtInf{Ustrd: chunk(usage, 140)}
+	}
+
+	return n
+}
+
+var gvcodePattern = regexp.MustCompile(`^[0-9]{3}$`)
+
+// camtBankTransactionCode maps the German business transaction code (GVC) of
+// a transaction to a proprietary bank transaction code as used by German
+// banks in their CAMT statements.
+func camtBankTransactionCode(tx bosgo.Transaction) camtBkTxCd {
+	if gvcodePattern.MatchString(tx.Gvcode) {
+		return camtBkTxCd{Prtry: camtPrtryCd{Cd: "NTRF+" + tx.Gvcode, Issr: "ZKA"}}
+	}
+	return camtBkTxCd{Prtry: camtPrtryCd{Cd: "NMSC"}}
+}
+
+func creditDebit(amt money.Amount) string {
+	if amt.Sign() < 0 {
+		return "DBIT"
+	}
+	return "CRDT"
+}
+
+// compactIBAN removes the spaces used when printing IBANs.
+func compactIBAN(iban string) string {
+	return strings.ToUpper(strings.Replace(iban, " ", "", -1))
+}
@@ -0,0 +1,358 @@
+// Copyright 2017 Bankrs AG.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+
+	"code.bankrs.com/bosgo"
+)
+
+func testAccount() bosgo.Account {
+	return bosgo.Account{
+		ID:               12,
+		Name:             "Account 1",
+		Holder:           "Max Mustermann",
+		Number:           "704357300",
+		Balance:          "971.20",
+		AvailableBalance: "1471.20",
+		BalanceDate:      time.Date(2017, 7, 31, 22, 0, 0, 0, time.UTC),
+		Currency:         "EUR",
+		IBAN:             "DE84200700245353762745",
+	}
+}
+
+func testTransactions() []bosgo.Transaction {
+	return []bosgo.Transaction{
+		{
+			ID:            3,
+			UserAccountID: 12,
+			RemoteID:      "r3",
+			Amount:        &bosgo.MoneyAmount{Currency: "EUR", Value: "-24.34"},
+			OriginalAmount: &bosgo.OriginalAmount{
+				Value:        &bosgo.MoneyAmount{Currency: "USD", Value: "-28.00"},
+				ExchangeRate: "1.1504",
+			},
+			EntryDate:      time.Date(2017, 7, 31, 0, 0, 0, 0, time.UTC),
+			SettlementDate: time.Date(2017, 7, 30, 0, 0, 0, 0, time.UTC),
+			Usage:          "Goods bought",
+			Gvcode:         "106",
+			Counterparty: bosgo.Counterparty{
+				Name:     "PayPal Europe Sarl",
+				Account:  bosgo.AccountRef{IBAN: "DE84 2007 0024 5353 7627 45"},
+				Merchant: &bosgo.Merchant{Name: "PayPal"},
+			},
+		},
+		{
+			ID:             2,
+			UserAccountID:  12,
+			RemoteID:       "r2",
+			Amount:         &bosgo.MoneyAmount{Currency: "EUR", Value: "0.05"},
+			EntryDate:      time.Date(2017, 7, 30, 0, 0, 0, 0, time.UTC),
+			SettlementDate: time.Date(2017, 7, 30, 0, 0, 0, 0, time.UTC),
+			Usage:          "Interest payment",
+		},
+		{
+			ID:             1,
+			UserAccountID:  12,
+			RemoteID:       "r1",
+			Amount:         &bosgo.MoneyAmount{Currency: "EUR", Value: "60.00"},
+			EntryDate:      time.Date(2017, 7, 25, 0, 0, 0, 0, time.UTC),
+			SettlementDate: time.Date(2017, 7, 25, 0, 0, 0, 0, time.UTC),
+			Usage:          "Money transfer",
+			Gvcode:         "166",
+			Counterparty: bosgo.Counterparty{
+				Name:    "Erika Müller",
+				Account: bosgo.AccountRef{IBAN: "DE56200800950445688921"},
+			},
+		},
+		{
+			// belongs to another account
+			ID:            9,
+			UserAccountID: 13,
+			Amount:        &bosgo.MoneyAmount{Currency: "EUR", Value: "1000.00"},
+			EntryDate:     time.Date(2017, 7, 26, 0, 0, 0, 0, time.UTC),
+		},
+	}
+}
+
+func TestStatementBalances(t *testing.T) {
+	testCases := []struct {
+		name        string
+		from        time.Time
+		to          time.Time
+		wantOpening string
+		wantClosing string
+	}{
+		{
+			name:        "full",
+			wantOpening: "935.49",
+			wantClosing: "971.20",
+		},
+		{
+			name:        "ends before balance date",
+			from:        time.Date(2017, 7, 1, 0, 0, 0, 0, time.UTC),
+			to:          time.Date(2017, 7, 29, 0, 0, 0, 0, time.UTC),
+			wantOpening: "935.49",
+			wantClosing: "995.49",
+		},
+		{
+			name:        "ends after balance date",
+			from:        time.Date(2017, 7, 31, 0, 0, 0, 0, time.UTC),
+			to:          time.Date(2017, 8, 2, 0, 0, 0, 0, time.UTC),
+			wantOpening: "995.54",
+			wantClosing: "971.20",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := NewStatement(testAccount(), testTransactions())
+			s.From, s.To = tc.from, tc.to
+			opening, closing, err := s.Balances()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if opening.Value != tc.wantOpening {
+				t.Errorf("got opening balance %s, wanted %s", opening.Value, tc.wantOpening)
+			}
+			if closing.Value != tc.wantClosing {
+				t.Errorf("got closing balance %s, wanted %s", closing.Value, tc.wantClosing)
+			}
+			if opening.Currency != "EUR" || closing.Currency != "EUR" {
+				t.Errorf("got currencies %s/%s, wanted EUR", opening.Currency, closing.Currency)
+			}
+		})
+	}
+}
+
+func TestStatementCurrencyMismatch(t *testing.T) {
+	txs := testTransactions()
+	txs[0].Amount.Currency = "USD"
+	s := NewStatement(testAccount(), txs)
+	if _, _, err := s.Balances(); err == nil {
+		t.Errorf("got no error, wanted one")
+	}
+}
+
+// camtSchema describes the content model of the subset of camt.053.001.02
+// elements written by WriteCAMT053. Each element lists its permitted children
+// in schema sequence order and whether they are required.
+var camtSchema = map[string][]schemaChild{
+	"Document":      {{"BkToCstmrStmt", true}},
+	"BkToCstmrStmt": {{"GrpHdr", true}, {"Stmt", true}},
+	"GrpHdr":        {{"MsgId", true}, {"CreDtTm", true}, {"MsgRcpt", false}, {"MsgPgntn", false}, {"AddtlInf", false}},
+	"Stmt": {
+		{"Id", true}, {"ElctrncSeqNb", false}, {"LglSeqNb", false}, {"CreDtTm", true}, {"FrToDt", false},
+		{"CpyDplctInd", false}, {"RptgSrc", false}, {"Acct", true}, {"RltdAcct", false}, {"Intrst", false},
+		{"Bal", true}, {"TxsSummry", false}, {"Ntry", false}, {"AddtlStmtInf", false},
+	},
+	"FrToDt":       {{"FrDtTm", true}, {"ToDtTm", true}},
+	"Acct":         {{"Id", true}, {"Tp", false}, {"Ccy", false}, {"Nm", false}, {"Ownr", false}, {"Svcr", false}},
+	"DbtrAcct":     {{"Id", true}, {"Tp", false}, {"Ccy", false}, {"Nm", false}},
+	"CdtrAcct":     {{"Id", true}, {"Tp", false}, {"Ccy", false}, {"Nm", false}},
+	"Bal":          {{"Tp", true}, {"CdtLine", false}, {"Amt", true}, {"CdtDbtInd", true}, {"Dt", true}, {"Avlbty", false}},
+	"CdOrPrtry":    {{"Cd", false}, {"Prtry", false}},
+	"TxsSummry":    {{"TtlNtries", false}, {"TtlCdtNtries", false}, {"TtlDbtNtries", false}, {"TtlNtriesPerBkTxCd", false}},
+	"TtlNtries":    {{"NbOfNtries", false}, {"Sum", false}, {"TtlNetNtryAmt", false}, {"CdtDbtInd", false}},
+	"TtlCdtNtries": {{"NbOfNtries", false}, {"Sum", false}},
+	"TtlDbtNtries": {{"NbOfNtries", false}, {"Sum", false}},
+	"Ntry": {
+		{"NtryRef", false}, {"Amt", true}, {"CdtDbtInd", true}, {"RvslInd", false}, {"Sts", true},
+		{"BookgDt", false}, {"ValDt", false}, {"AcctSvcrRef", false}, {"Avlbty", false}, {"BkTxCd", true},
+		{"ComssnWvrInd", false}, {"AddtlInfInd", false}, {"AmtDtls", false}, {"Chrgs", false},
+		{"TechInptChanl", false}, {"Intrst", false}, {"NtryDtls", false}, {"AddtlNtryInf", false},
+	},
+	"BkTxCd":   {{"Domn", false}, {"Prtry", false}},
+	"NtryDtls": {{"Btch", false}, {"TxDtls", false}},
+	"TxDtls": {
+		{"Refs", false}, {"AmtDtls", false}, {"Avlbty", false}, {"BkTxCd", false}, {"Chrgs", false},
+		{"Intrst", false}, {"RltdPties", false}, {"RltdAgts", false}, {"Purp", false}, {"RltdRmtInf", false},
+		{"RmtInf", false}, {"RltdDts", false}, {"RltdPric", false}, {"RltdQties", false}, {"FinInstrmId", false},
+		{"Tax", false}, {"RtrInf", false}, {"CorpActn", false}, {"SfkpgAcct", false}, {"AddtlTxInf", false},
+	},
+	"AmtDtls":   {{"InstdAmt", false}, {"TxAmt", false}, {"CntrValAmt", false}, {"AnncdPstngAmt", false}, {"PrtryAmt", false}},
+	"InstdAmt":  {{"Amt", true}, {"CcyXchg", false}},
+	"TxAmt":     {{"Amt", true}, {"CcyXchg", false}},
+	"CcyXchg":   {{"SrcCcy", true}, {"TrgtCcy", false}, {"UnitCcy", false}, {"XchgRate", true}, {"CtrctId", false}, {"QtnDt", false}},
+	"RltdPties": {{"InitgPty", false}, {"Dbtr", false}, {"DbtrAcct", false}, {"UltmtDbtr", false}, {"Cdtr", false}, {"CdtrAcct", false}, {"UltmtCdtr", false}, {"TradgPty", false}, {"Prtry", false}},
+	"RmtInf":    {{"Ustrd", false}, {"Strd", false}},
+}
+
+type schemaChild struct {
+	name     string
+	required bool
+}
+
+type xmlNode struct {
+	XMLName  xml.Name
+	Attrs    []xml.Attr `xml:",any,attr"`
+	Children []xmlNode  `xml:",any"`
+	Text     string     `xml:",chardata"`
+}
+
+// validateStructure checks that the children of n and its descendants appear
+// in the order required by camtSchema and that required children are present.
+func validateStructure(t *testing.T, path string, n xmlNode) {
+	path = path + "/" + n.XMLName.Local
+	model, known := camtSchema[n.XMLName.Local]
+	if n.XMLName.Local == "Tp" || n.XMLName.Local == "Id" || n.XMLName.Local == "Prtry" {
+		// These names are reused with different content models; their
+		// contents are checked by the tests for specific values.
+		known = false
+	}
+	if !known {
+		for _, c := range n.Children {
+			validateStructure(t, path, c)
+		}
+		return
+	}
+
+	pos := 0
+	seen := map[string]bool{}
+	for _, c := range n.Children {
+		found := false
+		for i := pos; i < len(model); i++ {
+			if model[i].name == c.XMLName.Local {
+				pos = i
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Errorf("%s: unexpected or out of order element %s", path, c.XMLName.Local)
+		}
+		seen[c.XMLName.Local] = true
+		validateStructure(t, path, c)
+	}
+	for _, m := range model {
+		if m.required && !seen[m.name] {
+			t.Errorf("%s: missing required element %s", path, m.name)
+		}
+	}
+}
+
+func find(n xmlNode, path ...string) []xmlNode {
+	if len(path) == 0 {
+		return []xmlNode{n}
+	}
+	var found []xmlNode
+	for _, c := range n.Children {
+		if c.XMLName.Local == path[0] {
+			found = append(found, find(c, path[1:]...)...)
+		}
+	}
+	return found
+}
+
+func TestWriteCAMT053(t *testing.T) {
+	s := NewStatement(testAccount(), testTransactions())
+	s.ID = "STMT-1"
+	s.Created = time.Date(2017, 8, 1, 9, 0, 0, 0, time.UTC)
+	s.BIC = "DEUTDEDBBER"
+
+	var buf bytes.Buffer
+	if err := WriteCAMT053(&buf, s); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var doc xmlNode
+	if err := xml.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("failed to parse output: %v\n%s", err, buf.String())
+	}
+
+	if doc.XMLName.Space != CAMT053Namespace {
+		t.Errorf("got namespace %q, wanted %q", doc.XMLName.Space, CAMT053Namespace)
+	}
+	validateStructure(t, "", doc)
+
+	stmt := find(doc, "BkToCstmrStmt", "Stmt")
+	if len(stmt) != 1 {
+		t.Fatalf("got %d statements, wanted 1", len(stmt))
+	}
+
+	if iban := find(stmt[0], "Acct", "Id", "IBAN"); len(iban) != 1 || iban[0].Text != "DE84200700245353762745" {
+		t.Errorf("got account IBAN %v, wanted DE84200700245353762745", iban)
+	}
+
+	bals := find(stmt[0], "Bal")
+	if len(bals) != 2 {
+		t.Fatalf("got %d balances, wanted 2", len(bals))
+	}
+	wantBals := []struct{ code, amt, ind, date string }{
+		{"OPBD", "935.49", "CRDT", "2017-07-25"},
+		{"CLBD", "971.20", "CRDT", "2017-07-31"},
+	}
+	for i, want := range wantBals {
+		if got := find(bals[i], "Tp", "CdOrPrtry", "Cd")[0].Text; got != want.code {
+			t.Errorf("balance %d: got code %s, wanted %s", i, got, want.code)
+		}
+		if got := find(bals[i], "Amt")[0].Text; got != want.amt {
+			t.Errorf("balance %d: got amount %s, wanted %s", i, got, want.amt)
+		}
+		if got := find(bals[i], "CdtDbtInd")[0].Text; got != want.ind {
+			t.Errorf("balance %d: got indicator %s, wanted %s", i, got, want.ind)
+		}
+		if got := find(bals[i], "Dt", "Dt")[0].Text; got != want.date {
+			t.Errorf("balance %d: got date %s, wanted %s", i, got, want.date)
+		}
+	}
+
+	entries := find(stmt[0], "Ntry")
+	if len(entries) != 3 {
+		t.Fatalf("got %d entries, wanted 3", len(entries))
+	}
+
+	// Entries are ordered by booking date
+	first := entries[0]
+	if got := find(first, "NtryDtls", "TxDtls", "RltdPties", "Dbtr", "Nm"); len(got) != 1 || got[0].Text != "Erika Müller" {
+		t.Errorf("got debtor %v, wanted Erika Müller", got)
+	}
+	if got := find(first, "BkTxCd", "Prtry", "Cd")[0].Text; got != "NTRF+166" {
+		t.Errorf("got bank transaction code %s, wanted NTRF+166", got)
+	}
+
+	last := entries[2]
+	checks := []struct {
+		path []string
+		want string
+	}{
+		{[]string{"Amt"}, "24.34"},
+		{[]string{"CdtDbtInd"}, "DBIT"},
+		{[]string{"BookgDt", "Dt"}, "2017-07-31"},
+		{[]string{"ValDt", "Dt"}, "2017-07-30"},
+		{[]string{"AcctSvcrRef"}, "r3"},
+		{[]string{"NtryDtls", "TxDtls", "AmtDtls", "InstdAmt", "Amt"}, "28.00"},
+		{[]string{"NtryDtls", "TxDtls", "AmtDtls", "InstdAmt", "CcyXchg", "XchgRate"}, "1.1504"},
+		{[]string{"NtryDtls", "TxDtls", "RltdPties", "Cdtr", "Nm"}, "PayPal Europe Sarl"},
+		{[]string{"NtryDtls", "TxDtls", "RltdPties", "CdtrAcct", "Id", "IBAN"}, "DE84200700245353762745"},
+		{[]string{"NtryDtls", "TxDtls", "RltdPties", "UltmtCdtr", "Nm"}, "PayPal"},
+		{[]string{"NtryDtls", "TxDtls", "RmtInf", "Ustrd"}, "Goods bought"},
+	}
+	for _, c := range checks {
+		got := find(last, c.path...)
+		if len(got) != 1 || strings.TrimSpace(got[0].Text) != c.want {
+			t.Errorf("%s: got %v, wanted %q", strings.Join(c.path, "/"), got, c.want)
+		}
+	}
+
+	if got := find(stmt[0], "TxsSummry", "TtlNtries", "TtlNetNtryAmt")[0].Text; got != "35.71" {
+		t.Errorf("got net entry amount %s, wanted 35.71", got)
+	}
+}
@@ -0,0 +1,257 @@
+// Copyright 2017 Bankrs AG.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"code.bankrs.com/bosgo"
+	"code.bankrs.com/bosgo/internal/money"
+)
+
+// Column identifies a column of a CSV export.
+type Column string
+
+const (
+	ColumnID               Column = "id"
+	ColumnAccountID        Column = "account_id"
+	ColumnAccountIBAN      Column = "account_iban"
+	ColumnEntryDate        Column = "entry_date"
+	ColumnSettlementDate   Column = "settlement_date"
+	ColumnAmount           Column = "amount"
+	ColumnCurrency         Column = "currency"
+	ColumnOriginalAmount   Column = "original_amount"
+	ColumnOriginalCurrency Column = "original_currency"
+	ColumnExchangeRate     Column = "exchange_rate"
+	ColumnCounterparty     Column = "counterparty"
+	ColumnCounterpartyIBAN Column = "counterparty_iban"
+	ColumnMerchant         Column = "merchant"
+	ColumnCategory         Column = "category"
+	ColumnUsage            Column = "usage"
+	ColumnTransactionType  Column = "transaction_type"
+	ColumnRemoteID         Column = "remote_id"
+)
+
+// DefaultColumns are the columns written by WriteCSV when no columns are
+// configured.
+var DefaultColumns = []Column{
+	ColumnEntryDate,
+	ColumnSettlementDate,
+	ColumnAmount,
+	ColumnCurrency,
+	ColumnCounterparty,
+	ColumnCounterpartyIBAN,
+	ColumnMerchant,
+	ColumnCategory,
+	ColumnUsage,
+}
+
+// Locale controls the formatting of values in a CSV export.
+type Locale struct {
+	Comma            rune              // field delimiter
+	DecimalSeparator string            // separator between the whole and fractional part of amounts
+	DateFormat       string            // layout used to format dates, as understood by time.Format
+	Headers          map[Column]string // optional header titles, the column name is used for missing titles
+}
+
+var (
+	// LocaleEnglish formats amounts with a decimal point and dates as ISO 8601.
+	LocaleEnglish = Locale{
+		Comma:            ',',
+		DecimalSeparator: ".",
+		DateFormat:       "2006-01-02",
+	}
+
+	// LocaleGerman formats amounts with a decimal comma and dates as
+	// DD.MM.YYYY, using a semicolon as field delimiter as expected by German
+	// spreadsheet software.
+	LocaleGerman = Locale{
+		Comma:            ';',
+		DecimalSeparator: ",",
+		DateFormat:       "02.01.2006",
+		Headers: map[Column]string{
+			ColumnID:               "ID",
+			ColumnAccountID:        "Konto-ID",
+			ColumnAccountIBAN:      "Konto-IBAN",
+			ColumnEntryDate:        "Buchungstag",
+			ColumnSettlementDate:   "Valuta",
+			ColumnAmount:           "Betrag",
+			ColumnCurrency:         "Währung",
+			ColumnOriginalAmount:   "Originalbetrag",
+			ColumnOriginalCurrency: "Originalwährung",
+			ColumnExchangeRate:     "Wechselkurs",
+			ColumnCounterparty:     "Auftraggeber/Empfänger",
+			ColumnCounterpartyIBAN: "IBAN",
+			ColumnMerchant:         "Händler",
+			ColumnCategory:         "Kategorie",
+			ColumnUsage:            "Verwendungszweck",
+			ColumnTransactionType:  "Buchungstext",
+			ColumnRemoteID:         "Referenz",
+		},
+	}
+)
+
+// CSVOptions configures WriteCSV.
+type CSVOptions struct {
+	Columns    []Column   // columns to write, DefaultColumns if empty
+	Locale     Locale     // formatting of values, LocaleEnglish if zero
+	Categories Categories // names used for the category column
+	NoHeader   bool       // omit the header row
+}
+
+// WriteCSV writes the transactions yielded by it to w as CSV, one row per
+// transaction. Rows are written as the iterator advances.
+func WriteCSV(w io.Writer, it TransactionIterator, opts CSVOptions) error {
+	cols := opts.Columns
+	if len(cols) == 0 {
+		cols = DefaultColumns
+	}
+	loc := opts.Locale
+	if loc.Comma == 0 {
+		loc.Comma = LocaleEnglish.Comma
+	}
+	if loc.DecimalSeparator == "" {
+		loc.DecimalSeparator = LocaleEnglish.DecimalSeparator
+	}
+	if loc.DateFormat == "" {
+		loc.DateFormat = LocaleEnglish.DateFormat
+	}
+
+	cw := csv.NewWriter(w)
+	cw.Comma = loc.Comma
+
+	row := make([]string, len(cols))
+	if !opts.NoHeader {
+		for i, c := range cols {
+			row[i] = string(c)
+			if title, ok := loc.Headers[c]; ok {
+				row[i] = title
+			}
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+
+	for it.Next() {
+		tx := it.Transaction()
+		for i, c := range cols {
+			v, err := csvValue(tx, c, loc, opts.Categories)
+			if err != nil {
+				return err
+			}
+			row[i] = v
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	if err := it.Err(); err != nil {
+		return err
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+func csvValue(tx bosgo.Transaction, c Column, loc Locale, cats Categories) (string, error) {
+	switch c {
+	case ColumnID:
+		return strconv.FormatInt(tx.ID, 10), nil
+	case ColumnAccountID:
+		return strconv.FormatInt(tx.UserAccountID, 10), nil
+	case ColumnAccountIBAN:
+		return tx.UserAccount.IBAN, nil
+	case ColumnEntryDate:
+		return formatDate(tx.EntryDate, loc.DateFormat), nil
+	case ColumnSettlementDate:
+		return formatDate(tx.SettlementDate, loc.DateFormat), nil
+	case ColumnAmount:
+		if tx.Amount == nil {
+			return "", nil
+		}
+		return formatAmount(tx.Amount.Value, loc.DecimalSeparator)
+	case ColumnCurrency:
+		if tx.Amount == nil {
+			return "", nil
+		}
+		return tx.Amount.Currency, nil
+	case ColumnOriginalAmount:
+		if tx.OriginalAmount == nil || tx.OriginalAmount.Value == nil {
+			return "", nil
+		}
+		return formatAmount(tx.OriginalAmount.Value.Value, loc.DecimalSeparator)
+	case ColumnOriginalCurrency:
+		if tx.OriginalAmount == nil || tx.OriginalAmount.Value == nil {
+			return "", nil
+		}
+		return tx.OriginalAmount.Value.Currency, nil
+	case ColumnExchangeRate:
+		if tx.OriginalAmount == nil || tx.OriginalAmount.ExchangeRate == "" {
+			return "", nil
+		}
+		return localiseDecimal(tx.OriginalAmount.ExchangeRate, loc.DecimalSeparator), nil
+	case ColumnCounterparty:
+		return tx.Counterparty.Name, nil
+	case ColumnCounterpartyIBAN:
+		return tx.Counterparty.Account.IBAN, nil
+	case ColumnMerchant:
+		return merchant(tx), nil
+	case ColumnCategory:
+		return cats.Name(tx.CategoryID), nil
+	case ColumnUsage:
+		return tx.Usage, nil
+	case ColumnTransactionType:
+		return tx.TransactionType, nil
+	case ColumnRemoteID:
+		return tx.RemoteID, nil
+	}
+	return "", fmt.Errorf("export: unknown column %q", c)
+}
+
+func formatDate(t time.Time, layout string) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(layout)
+}
+
+func formatAmount(v string, sep string) (string, error) {
+	if v == "" {
+		return "", nil
+	}
+	amt, err := money.Parse(v)
+	if err != nil {
+		return "", fmt.Errorf("export: %v", err)
+	}
+	return amt.Format(2, sep), nil
+}
+
+func localiseDecimal(v string, sep string) string {
+	if sep == "." {
+		return v
+	}
+	b := []byte(v)
+	for i := range b {
+		if b[i] == '.' {
+			return string(b[:i]) + sep + string(b[i+1:])
+		}
+	}
+	return v
+}
@@ -0,0 +1,129 @@
+// Copyright 2017 Bankrs AG.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"code.bankrs.com/bosgo"
+	"code.bankrs.com/bosgo/testserver"
+)
+
+var testCategories = bosgo.CategoryList{
+	{ID: 5, Names: map[string]string{"en": "Shopping", "de": "Einkaufen"}, Group: "expenses"},
+	{ID: 6, Names: map[string]string{"en": "Interest"}, Group: "income"},
+}
+
+func TestNewCategories(t *testing.T) {
+	cats := NewCategories(testCategories, "de-AT")
+	if got := cats.Name(5); got != "Einkaufen" {
+		t.Errorf("got %q, wanted Einkaufen", got)
+	}
+	if got := cats.Name(6); got != "Interest" {
+		t.Errorf("got %q, wanted fallback Interest", got)
+	}
+	if got := cats.Name(7); got != "" {
+		t.Errorf("got %q for unknown category, wanted empty", got)
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	txs := testTransactions()[:3]
+	txs[0].CategoryID = 5
+	txs[1].CategoryID = 6
+
+	var buf bytes.Buffer
+	err := WriteCSV(&buf, Transactions(txs), CSVOptions{
+		Categories: NewCategories(testCategories, "en"),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := "entry_date,settlement_date,amount,currency,counterparty,counterparty_iban,merchant,category,usage\n" +
+		"2017-07-31,2017-07-30,-24.34,EUR,PayPal Europe Sarl,DE84 2007 0024 5353 7627 45,PayPal,Shopping,Goods bought\n" +
+		"2017-07-30,2017-07-30,0.05,EUR,,,,Interest,Interest payment\n" +
+		"2017-07-25,2017-07-25,60.00,EUR,Erika Müller,DE56200800950445688921,,,Money transfer\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwanted:\n%s", got, want)
+	}
+}
+
+func TestWriteCSVLocale(t *testing.T) {
+	txs := testTransactions()[:1]
+	txs[0].CategoryID = 5
+
+	var buf bytes.Buffer
+	err := WriteCSV(&buf, Transactions(txs), CSVOptions{
+		Columns:    []Column{ColumnEntryDate, ColumnAmount, ColumnOriginalAmount, ColumnExchangeRate, ColumnCategory},
+		Locale:     LocaleGerman,
+		Categories: NewCategories(testCategories, "de"),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := "Buchungstag;Betrag;Originalbetrag;Wechselkurs;Kategorie\n" +
+		"31.07.2017;-24,34;-28,00;1,1504;Einkaufen\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwanted:\n%s", got, want)
+	}
+}
+
+func TestWriteCSVUnknownColumn(t *testing.T) {
+	var buf bytes.Buffer
+	err := WriteCSV(&buf, Transactions(testTransactions()), CSVOptions{Columns: []Column{"foo"}})
+	if err == nil {
+		t.Errorf("got no error, wanted one")
+	}
+}
+
+func TestWriteCSVFromAPI(t *testing.T) {
+	s := testserver.NewWithDefaults()
+	defer s.Close()
+
+	var txs []bosgo.Transaction
+	for i := 0; i < 25; i++ {
+		txs = append(txs, bosgo.Transaction{
+			ID:     int64(i + 1),
+			Amount: &bosgo.MoneyAmount{Currency: "EUR", Value: "1.00"},
+		})
+	}
+	if err := s.AssignTransactions(testserver.DefaultUsername, txs); err != nil {
+		t.Fatalf("failed to assign transactions: %v", err)
+	}
+
+	appClient := bosgo.NewAppClient(s.Client(), s.Addr(), testserver.DefaultApplicationID)
+	userClient, err := appClient.Users.Login(testserver.DefaultUsername, testserver.DefaultPassword).Send()
+	if err != nil {
+		t.Fatalf("failed to login as user: %v", err)
+	}
+
+	var buf bytes.Buffer
+	it := userClient.Transactions.List().Limit(10).Iter()
+	if err := WriteCSV(&buf, it, CSVOptions{Columns: []Column{ColumnID}, NoHeader: true}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 25 {
+		t.Fatalf("got %d rows, wanted 25", len(lines))
+	}
+	if lines[24] != "25" {
+		t.Errorf("got last row %q, wanted 25", lines[24])
+	}
+}
@@ -0,0 +1,260 @@
+// Copyright 2017 Bankrs AG.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package export renders accounts and transactions obtained from the Bankrs
+// OS API in formats understood by accounting and banking software.
+package export
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"code.bankrs.com/bosgo"
+	"code.bankrs.com/bosgo/internal/money"
+)
+
+// Statement is an account statement covering a period of time. It is built
+// from an account and the transactions obtained from TransactionsService.List.
+type Statement struct {
+	ID       string    // statement identifier, derived from the account and period if empty
+	Sequence int       // electronic sequence number of the statement, defaults to 1
+	Created  time.Time // creation time of the statement, defaults to the current time
+	BIC      string    // optional BIC of the institution servicing the account
+
+	Account bosgo.Account
+
+	// From and To are the first and last booking days covered by the
+	// statement. If zero they are derived from the supplied transactions and
+	// the account's balance date.
+	From time.Time
+	To   time.Time
+
+	// Transactions holds the transactions booked to the account. It may
+	// contain transactions outside the statement period; they are used to
+	// roll the account balance to the period boundaries but are not listed
+	// as entries.
+	Transactions []bosgo.Transaction
+}
+
+// NewStatement returns a statement for an account containing the transactions
+// that belong to it.
+func NewStatement(acc bosgo.Account, txs []bosgo.Transaction) *Statement {
+	return &Statement{
+		Account:      acc,
+		Transactions: txs,
+	}
+}
+
+// entry is a transaction prepared for rendering.
+type entry struct {
+	tx     bosgo.Transaction
+	amount money.Amount
+	day    time.Time
+}
+
+// statementData is a statement with its balances derived.
+type statementData struct {
+	id       string
+	sequence int
+	created  time.Time
+	currency string
+	from     time.Time
+	to       time.Time
+	opening  money.Amount
+	closing  money.Amount
+	entries  []entry
+}
+
+// Balances returns the opening balance at the start of the statement period
+// and the closing balance at its end. The closing balance is derived from the
+// account balance by removing the effect of transactions booked after the end
+// of the period and adding those booked after the balance date, the opening
+// balance by removing the effect of the transactions within the period.
+func (s *Statement) Balances() (opening, closing bosgo.MoneyAmount, err error) {
+	d, err := s.prepare()
+	if err != nil {
+		return bosgo.MoneyAmount{}, bosgo.MoneyAmount{}, err
+	}
+	opening = bosgo.MoneyAmount{Currency: d.currency, Value: d.opening.String()}
+	closing = bosgo.MoneyAmount{Currency: d.currency, Value: d.closing.String()}
+	return opening, closing, nil
+}
+
+func (s *Statement) prepare() (*statementData, error) {
+	acc := s.Account
+	if acc.Currency == "" {
+		return nil, fmt.Errorf("export: account %d has no currency", acc.ID)
+	}
+
+	balance, err := money.Parse(acc.Balance)
+	if err != nil {
+		return nil, fmt.Errorf("export: account %d balance: %v", acc.ID, err)
+	}
+
+	all := make([]entry, 0, len(s.Transactions))
+	for _, tx := range s.Transactions {
+		if tx.UserAccountID != 0 && acc.ID != 0 && tx.UserAccountID != acc.ID {
+			continue
+		}
+		if tx.Amount == nil {
+			return nil, fmt.Errorf("export: transaction %d has no amount", tx.ID)
+		}
+		if tx.Amount.Currency != "" && tx.Amount.Currency != acc.Currency {
+			return nil, fmt.Errorf("export: transaction %d currency %s does not match account currency %s", tx.ID, tx.Amount.Currency, acc.Currency)
+		}
+		amt, err := money.Parse(tx.Amount.Value)
+		if err != nil {
+			return nil, fmt.Errorf("export: transaction %d amount: %v", tx.ID, err)
+		}
+		all = append(all, entry{tx: tx, amount: amt, day: dayOf(bookingDate(tx))})
+	}
+	sort.SliceStable(all, func(i, j int) bool { return all[i].day.Before(all[j].day) })
+
+	balanceDay := dayOf(acc.BalanceDate)
+	from, to := dayOf(s.From), dayOf(s.To)
+	if to.IsZero() {
+		to = balanceDay
+		if n := len(all); n > 0 && all[n-1].day.After(to) {
+			to = all[n-1].day
+		}
+	}
+	if from.IsZero() {
+		from = to
+		for _, e := range all {
+			if !e.day.After(to) {
+				from = e.day
+				break
+			}
+		}
+	}
+	if from.After(to) {
+		return nil, fmt.Errorf("export: statement period starts %s after it ends %s", from.Format(isoDate), to.Format(isoDate))
+	}
+
+	d := &statementData{
+		id:       s.ID,
+		sequence: s.Sequence,
+		created:  s.Created,
+		currency: acc.Currency,
+		from:     from,
+		to:       to,
+	}
+	if d.id == "" {
+		d.id = fmt.Sprintf("%d-%s", acc.ID, to.Format("20060102"))
+	}
+	if d.sequence == 0 {
+		d.sequence = 1
+	}
+	if d.created.IsZero() {
+		d.created = time.Now()
+	}
+
+	// Roll the balance from the balance date to the end of the period.
+	d.closing = balance
+	for _, e := range all {
+		switch {
+		case e.day.After(to) && !e.day.After(balanceDay):
+			d.closing -= e.amount
+		case e.day.After(balanceDay) && !e.day.After(to):
+			d.closing += e.amount
+		}
+	}
+
+	d.opening = d.closing
+	for _, e := range all {
+		if e.day.Before(from) || e.day.After(to) {
+			continue
+		}
+		d.entries = append(d.entries, e)
+		d.opening -= e.amount
+	}
+
+	return d, nil
+}
+
+const isoDate = "2006-01-02"
+
+// dayOf returns midnight UTC of the calendar day of t, or the zero time if t is zero.
+func dayOf(t time.Time) time.Time {
+	if t.IsZero() {
+		return time.Time{}
+	}
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// bookingDate returns the date a transaction was booked, falling back to the
+// settlement date when the entry date is unknown.
+func bookingDate(tx bosgo.Transaction) time.Time {
+	if !tx.EntryDate.IsZero() {
+		return tx.EntryDate
+	}
+	return tx.SettlementDate
+}
+
+// valueDate returns the date a transaction became effective, falling back to
+// the entry date when the settlement date is unknown.
+func valueDate(tx bosgo.Transaction) time.Time {
+	if !tx.SettlementDate.IsZero() {
+		return tx.SettlementDate
+	}
+	return tx.EntryDate
+}
+
+// originalAmount returns the parsed original amount of a transaction, if any.
+func originalAmount(tx bosgo.Transaction) (money.Amount, string, bool) {
+	if tx.OriginalAmount == nil || tx.OriginalAmount.Value == nil || tx.OriginalAmount.Value.Currency == "" {
+		return 0, "", false
+	}
+	amt, err := money.Parse(tx.OriginalAmount.Value.Value)
+	if err != nil {
+		return 0, "", false
+	}
+	return amt, tx.OriginalAmount.Value.Currency, true
+}
+
+// truncate shortens s to at most n runes.
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n])
+}
+
+// chunk splits s into pieces of at most n runes.
+func chunk(s string, n int) []string {
+	var parts []string
+	r := []rune(s)
+	for len(r) > n {
+		parts = append(parts, string(r[:n]))
+		r = r[n:]
+	}
+	if len(r) > 0 {
+		parts = append(parts, string(r))
+	}
+	return parts
+}
+
+// counterpartyName returns the name of the counterparty, falling back to the
+// merchant name.
+func counterpartyName(tx bosgo.Transaction) string {
+	name := strings.TrimSpace(tx.Counterparty.Name)
+	if name == "" && tx.Counterparty.Merchant != nil {
+		name = strings.TrimSpace(tx.Counterparty.Merchant.Name)
+	}
+	return name
+}
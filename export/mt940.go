@@ -0,0 +1,189 @@
+// Copyright 2017 Bankrs AG.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"code.bankrs.com/bosgo"
+	"code.bankrs.com/bosgo/internal/money"
+)
+
+// WriteMT940 writes the statement to w as a SWIFT MT940 customer statement
+// message. The information to account owner field (:86:) uses the structured
+// layout defined by the German banking industry, keyed by the transaction's
+// business transaction code (Gvcode).
+func WriteMT940(w io.Writer, s *Statement) error {
+	d, err := s.prepare()
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	line := func(format string, args ...interface{}) {
+		fmt.Fprintf(bw, format, args...)
+		bw.WriteString("\r\n")
+	}
+
+	account := compactIBAN(s.Account.IBAN)
+	if account == "" {
+		account = swiftText(s.Account.Number)
+	}
+
+	line(":20:%s", truncate(swiftText(d.id), 16))
+	line(":25:%s", truncate(account, 35))
+	line(":28C:%05d/001", d.sequence%100000)
+	line(":60F:%s", mt940Balance(d.opening, d.currency, d.from))
+
+	for _, e := range d.entries {
+		line(":61:%s", mt940StatementLine(e))
+		if sup := mt940Supplementary(e.tx); sup != "" {
+			line("%s", sup)
+		}
+		for i, l := range chunk(mt940Information(e.tx), 65) {
+			if i == 0 {
+				line(":86:%s", l)
+				continue
+			}
+			if i == 6 {
+				break
+			}
+			line("%s", l)
+		}
+	}
+
+	line(":62F:%s", mt940Balance(d.closing, d.currency, d.to))
+	if s.Account.AvailableBalance != "" && d.to.Equal(dayOf(s.Account.BalanceDate)) {
+		if avail, err := money.Parse(s.Account.AvailableBalance); err == nil {
+			line(":64:%s", mt940Balance(avail, d.currency, d.to))
+		}
+	}
+	line("-")
+
+	return bw.Flush()
+}
+
+func mt940Balance(amt money.Amount, currency string, day time.Time) string {
+	return mt940Mark(amt) + day.Format("060102") + currency + mt940Amount(amt)
+}
+
+func mt940Mark(amt money.Amount) string {
+	if amt.Sign() < 0 {
+		return "D"
+	}
+	return "C"
+}
+
+func mt940Amount(amt money.Amount) string {
+	return amt.Abs().Format(2, ",")
+}
+
+// mt940StatementLine formats the contents of a :61: statement line.
+func mt940StatementLine(e entry) string {
+	tx := e.tx
+	code := "NMSC"
+	if tx.Counterparty.Account.IBAN != "" || tx.Counterparty.Account.Number != "" {
+		code = "NTRF"
+	}
+
+	ref := truncate(swiftText(tx.RemoteID), 16)
+	line := valueDate(tx).Format("060102") + bookingDate(tx).Format("0102") +
+		mt940Mark(e.amount) + mt940Amount(e.amount) + code + "NONREF"
+	if ref != "" {
+		line += "//" + ref
+	}
+	return line
+}
+
+// mt940Supplementary returns the supplementary details of a :61: statement
+// line, which carry the original amount of foreign currency transactions.
+func mt940Supplementary(tx bosgo.Transaction) string {
+	orig, ccy, ok := originalAmount(tx)
+	if !ok {
+		return ""
+	}
+	return truncate("/OCMT/"+ccy+mt940Amount(orig)+"/", 34)
+}
+
+// mt940Information formats the contents of the :86: information to account
+// owner field using the structured subfields ?00 (posting text), ?20-?29
+// (remittance information), ?31 (counterparty IBAN) and ?32-?33
+// (counterparty name).
+func mt940Information(tx bosgo.Transaction) string {
+	gvc := tx.Gvcode
+	if !gvcodePattern.MatchString(gvc) {
+		gvc = "999"
+	}
+
+	var b bytes.Buffer
+	b.WriteString(gvc)
+	if text := swiftText(tx.TransactionType); text != "" {
+		b.WriteString("?00" + truncate(text, 27))
+	}
+
+	usage := chunk(swiftText(tx.Usage), 27)
+	for i, u := range usage {
+		if i == 10 {
+			break
+		}
+		fmt.Fprintf(&b, "?%02d%s", 20+i, u)
+	}
+
+	if iban := compactIBAN(tx.Counterparty.Account.IBAN); iban != "" {
+		b.WriteString("?31" + iban)
+	} else if num := swiftText(tx.Counterparty.Account.Number); num != "" {
+		b.WriteString("?31" + truncate(num, 34))
+	}
+
+	name := chunk(swiftText(counterpartyName(tx)), 27)
+	for i, n := range name {
+		if i == 2 {
+			break
+		}
+		fmt.Fprintf(&b, "?%02d%s", 32+i, n)
+	}
+
+	return b.String()
+}
+
+var swiftReplacer = strings.NewReplacer(
+	"ä", "ae", "ö", "oe", "ü", "ue", "Ä", "Ae", "Ö", "Oe", "Ü", "Ue", "ß", "ss",
+	"\r", " ", "\n", " ", "\t", " ",
+)
+
+// swiftText converts s to the SWIFT X character set, transliterating German
+// umlauts and replacing other unsupported characters with a full stop.
+func swiftText(s string) string {
+	s = swiftReplacer.Replace(strings.TrimSpace(s))
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		case strings.ContainsRune("/-?:().,'+ ", r):
+			// The question mark introduces subfields in :86: and must not
+			// appear in free text.
+			if r == '?' {
+				return '.'
+			}
+			return r
+		}
+		return '.'
+	}, s)
+}
@@ -0,0 +1,93 @@
+// Copyright 2017 Bankrs AG.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWriteMT940(t *testing.T) {
+	s := NewStatement(testAccount(), testTransactions())
+	s.ID = "STMT-1"
+	s.Sequence = 7
+
+	var buf bytes.Buffer
+	if err := WriteMT940(&buf, s); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []string{
+		":20:STMT-1",
+		":25:DE84200700245353762745",
+		":28C:00007/001",
+		":60F:C170725EUR935,49",
+		":61:1707250725C60,00NTRFNONREF//r1",
+		":86:166?20Money transfer?31DE56200800950445688921?32Erika Mueller",
+		":61:1707300730C0,05NMSCNONREF//r2",
+		":86:999?20Interest payment",
+		":61:1707300731D24,34NTRFNONREF//r3",
+		"/OCMT/USD28,00/",
+		":86:106?20Goods bought?31DE84200700245353762745?32PayPal Europe Sarl",
+		":62F:C170731EUR971,20",
+		":64:C170731EUR1471,20",
+		"-",
+		"",
+	}
+
+	got := strings.Split(buf.String(), "\r\n")
+	if len(got) != len(want) {
+		t.Fatalf("got %d lines, wanted %d:\n%s", len(got), len(want), buf.String())
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("line %d: got %q, wanted %q", i+1, got[i], want[i])
+		}
+	}
+}
+
+func TestMT940LongInformation(t *testing.T) {
+	txs := testTransactions()
+	txs[0].Usage = strings.Repeat("Lorem ipsum dolor sit amet ", 20)
+	s := NewStatement(testAccount(), txs)
+
+	var buf bytes.Buffer
+	if err := WriteMT940(&buf, s); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, l := range strings.Split(buf.String(), "\r\n") {
+		if len(l) > 69 {
+			t.Errorf("line exceeds maximum length: %q", l)
+		}
+	}
+}
+
+func TestSwiftText(t *testing.T) {
+	testCases := []struct {
+		in   string
+		want string
+	}{
+		{in: "Müller & Söhne", want: "Mueller . Soehne"},
+		{in: "Rechnung 12/2017?", want: "Rechnung 12/2017."},
+		{in: "line\nbreak", want: "line break"},
+	}
+	for _, tc := range testCases {
+		if got := swiftText(tc.in); got != tc.want {
+			t.Errorf("swiftText(%q): got %q, wanted %q", tc.in, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,235 @@
+// Copyright 2017 Bankrs AG.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"code.bankrs.com/bosgo"
+	"code.bankrs.com/bosgo/internal/money"
+)
+
+// OFXOptions configures WriteOFX.
+type OFXOptions struct {
+	// Account is the account the transactions belong to. Credit card
+	// accounts are written as credit card statements, all other accounts as
+	// bank statements.
+	Account bosgo.Account
+
+	// From and To are the start and end of the period covered by the
+	// transaction list. OFX requires them to precede the transactions so
+	// they cannot be derived while streaming. From defaults to the Unix
+	// epoch and To to the account's balance date.
+	From time.Time
+	To   time.Time
+
+	// Created is the server time reported in the signon response, defaults
+	// to the current time.
+	Created time.Time
+}
+
+const ofxHeader = `<?OFX OFXHEADER="200" VERSION="220" SECURITY="NONE" OLDFILEUID="NONE" NEWFILEUID="NONE"?>` + "\n"
+
+const ofxDateTime = "20060102150405"
+
+// WriteOFX writes the transactions yielded by it to w as an OFX 2.2 statement
+// download. Transactions are written as the iterator advances. The payee of
+// each transaction is its merchant name if known, otherwise the counterparty
+// name; OFX has no field for categories so they are not exported.
+func WriteOFX(w io.Writer, it TransactionIterator, opts OFXOptions) error {
+	acc := opts.Account
+	if acc.Currency == "" {
+		return fmt.Errorf("export: account %d has no currency", acc.ID)
+	}
+	from := opts.From
+	if from.IsZero() {
+		from = time.Unix(0, 0).UTC()
+	}
+	to := opts.To
+	if to.IsZero() {
+		to = acc.BalanceDate
+	}
+	created := opts.Created
+	if created.IsZero() {
+		created = time.Now()
+	}
+
+	creditCard := acc.Type == bosgo.AccountTypeCreditCard
+	msgs, trnrs, stmtrs, acctfrom := "BANKMSGSRSV1", "STMTTRNRS", "STMTRS", "BANKACCTFROM"
+	if creditCard {
+		msgs, trnrs, stmtrs, acctfrom = "CREDITCARDMSGSRSV1", "CCSTMTTRNRS", "CCSTMTRS", "CCACCTFROM"
+	}
+
+	if _, err := io.WriteString(w, xml.Header+ofxHeader); err != nil {
+		return err
+	}
+
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+
+	// The encoder reports errors on the next call and Flush, so individual
+	// token writes are not checked.
+	start := func(name string) { enc.EncodeToken(xml.StartElement{Name: xml.Name{Local: name}}) }
+	end := func(name string) { enc.EncodeToken(xml.EndElement{Name: xml.Name{Local: name}}) }
+	elem := func(name, value string) { enc.EncodeElement(value, xml.StartElement{Name: xml.Name{Local: name}}) }
+
+	start("OFX")
+	start("SIGNONMSGSRSV1")
+	start("SONRS")
+	enc.Encode(ofxOK)
+	elem("DTSERVER", created.UTC().Format(ofxDateTime))
+	elem("LANGUAGE", "ENG")
+	end("SONRS")
+	end("SIGNONMSGSRSV1")
+
+	start(msgs)
+	start(trnrs)
+	elem("TRNUID", "0")
+	enc.Encode(ofxOK)
+	start(stmtrs)
+	elem("CURDEF", acc.Currency)
+	start(acctfrom)
+	if !creditCard {
+		elem("BANKID", ofxBankID(acc))
+	}
+	elem("ACCTID", ofxAccountID(acc))
+	if !creditCard {
+		elem("ACCTTYPE", ofxAccountType(acc.Type))
+	}
+	end(acctfrom)
+
+	start("BANKTRANLIST")
+	elem("DTSTART", from.UTC().Format(ofxDateTime))
+	elem("DTEND", to.UTC().Format(ofxDateTime))
+	for it.Next() {
+		trn, err := ofxTransaction(it.Transaction())
+		if err != nil {
+			return err
+		}
+		if err := enc.Encode(trn); err != nil {
+			return err
+		}
+	}
+	if err := it.Err(); err != nil {
+		return err
+	}
+	end("BANKTRANLIST")
+
+	if acc.Balance != "" {
+		bal, err := money.Parse(acc.Balance)
+		if err != nil {
+			return fmt.Errorf("export: account %d balance: %v", acc.ID, err)
+		}
+		start("LEDGERBAL")
+		elem("BALAMT", bal.String())
+		elem("DTASOF", acc.BalanceDate.UTC().Format(ofxDateTime))
+		end("LEDGERBAL")
+	}
+	if acc.AvailableBalance != "" {
+		if avail, err := money.Parse(acc.AvailableBalance); err == nil {
+			start("AVAILBAL")
+			elem("BALAMT", avail.String())
+			elem("DTASOF", acc.BalanceDate.UTC().Format(ofxDateTime))
+			end("AVAILBAL")
+		}
+	}
+
+	end(stmtrs)
+	end(trnrs)
+	end(msgs)
+	end("OFX")
+
+	if err := enc.Flush(); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+type ofxStatus struct {
+	XMLName  xml.Name `xml:"STATUS"`
+	Code     int      `xml:"CODE"`
+	Severity string   `xml:"SEVERITY"`
+}
+
+var ofxOK = ofxStatus{Code: 0, Severity: "INFO"}
+
+type ofxStmtTrn struct {
+	XMLName  xml.Name `xml:"STMTTRN"`
+	TrnType  string   `xml:"TRNTYPE"`
+	DtPosted string   `xml:"DTPOSTED"`
+	DtAvail  string   `xml:"DTAVAIL,omitempty"`
+	TrnAmt   string   `xml:"TRNAMT"`
+	FitID    string   `xml:"FITID"`
+	Name     string   `xml:"NAME,omitempty"`
+	Memo     string   `xml:"MEMO,omitempty"`
+}
+
+func ofxTransaction(tx bosgo.Transaction) (ofxStmtTrn, error) {
+	if tx.Amount == nil {
+		return ofxStmtTrn{}, fmt.Errorf("export: transaction %d has no amount", tx.ID)
+	}
+	amt, err := money.Parse(tx.Amount.Value)
+	if err != nil {
+		return ofxStmtTrn{}, fmt.Errorf("export: transaction %d amount: %v", tx.ID, err)
+	}
+
+	trn := ofxStmtTrn{
+		TrnType:  "CREDIT",
+		DtPosted: bookingDate(tx).UTC().Format(ofxDateTime),
+		TrnAmt:   amt.String(),
+		FitID:    strconv.FormatInt(tx.ID, 10),
+		Name:     truncate(payee(tx), 32),
+		Memo:     truncate(tx.Usage, 255),
+	}
+	if amt.Sign() < 0 {
+		trn.TrnType = "DEBIT"
+	}
+	if !tx.SettlementDate.IsZero() {
+		trn.DtAvail = tx.SettlementDate.UTC().Format(ofxDateTime)
+	}
+	return trn, nil
+}
+
+// ofxBankID returns the routing number of the account's bank. For German
+// IBANs this is the bank code (BLZ) embedded in the IBAN.
+func ofxBankID(acc bosgo.Account) string {
+	iban := compactIBAN(acc.IBAN)
+	if len(iban) == 22 && iban[:2] == "DE" {
+		return iban[4:12]
+	}
+	return acc.ProviderID
+}
+
+func ofxAccountID(acc bosgo.Account) string {
+	if iban := compactIBAN(acc.IBAN); iban != "" {
+		return iban
+	}
+	return acc.Number
+}
+
+func ofxAccountType(t bosgo.AccountType) string {
+	switch t {
+	case bosgo.AccountTypeSavings:
+		return "SAVINGS"
+	case bosgo.AccountTypeLoan:
+		return "CREDITLINE"
+	}
+	return "CHECKING"
+}
@@ -0,0 +1,126 @@
+// Copyright 2017 Bankrs AG.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+
+	"code.bankrs.com/bosgo"
+)
+
+type ofxDoc struct {
+	XMLName xml.Name `xml:"OFX"`
+	Signon  struct {
+		Status ofxStatus `xml:"SONRS>STATUS"`
+	} `xml:"SIGNONMSGSRSV1"`
+	Bank struct {
+		CurDef   string `xml:"STMTTRNRS>STMTRS>CURDEF"`
+		BankID   string `xml:"STMTTRNRS>STMTRS>BANKACCTFROM>BANKID"`
+		AcctID   string `xml:"STMTTRNRS>STMTRS>BANKACCTFROM>ACCTID"`
+		AcctType string `xml:"STMTTRNRS>STMTRS>BANKACCTFROM>ACCTTYPE"`
+		List     struct {
+			DtStart string       `xml:"DTSTART"`
+			DtEnd   string       `xml:"DTEND"`
+			Trns    []ofxStmtTrn `xml:"STMTTRN"`
+		} `xml:"STMTTRNRS>STMTRS>BANKTRANLIST"`
+		Ledger string `xml:"STMTTRNRS>STMTRS>LEDGERBAL>BALAMT"`
+	} `xml:"BANKMSGSRSV1"`
+	CreditCard struct {
+		AcctID string `xml:"CCSTMTTRNRS>CCSTMTRS>CCACCTFROM>ACCTID"`
+	} `xml:"CREDITCARDMSGSRSV1"`
+}
+
+func TestWriteOFX(t *testing.T) {
+	var buf bytes.Buffer
+	err := WriteOFX(&buf, Transactions(testTransactions()[:3]), OFXOptions{
+		Account: testAccount(),
+		From:    time.Date(2017, 7, 1, 0, 0, 0, 0, time.UTC),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !strings.Contains(buf.String(), `<?OFX OFXHEADER="200" VERSION="220"`) {
+		t.Errorf("missing OFX processing instruction:\n%s", buf.String())
+	}
+
+	var doc ofxDoc
+	if err := xml.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("failed to parse output: %v\n%s", err, buf.String())
+	}
+
+	if doc.Signon.Status.Severity != "INFO" {
+		t.Errorf("got signon severity %q, wanted INFO", doc.Signon.Status.Severity)
+	}
+	if doc.Bank.CurDef != "EUR" {
+		t.Errorf("got currency %q, wanted EUR", doc.Bank.CurDef)
+	}
+	if doc.Bank.BankID != "20070024" {
+		t.Errorf("got bank id %q, wanted 20070024", doc.Bank.BankID)
+	}
+	if doc.Bank.AcctID != "DE84200700245353762745" {
+		t.Errorf("got account id %q, wanted DE84200700245353762745", doc.Bank.AcctID)
+	}
+	if doc.Bank.AcctType != "CHECKING" {
+		t.Errorf("got account type %q, wanted CHECKING", doc.Bank.AcctType)
+	}
+	if doc.Bank.List.DtStart != "20170701000000" || doc.Bank.List.DtEnd != "20170731220000" {
+		t.Errorf("got period %s-%s, wanted 20170701000000-20170731220000", doc.Bank.List.DtStart, doc.Bank.List.DtEnd)
+	}
+	if doc.Bank.Ledger != "971.20" {
+		t.Errorf("got ledger balance %q, wanted 971.20", doc.Bank.Ledger)
+	}
+
+	if len(doc.Bank.List.Trns) != 3 {
+		t.Fatalf("got %d transactions, wanted 3", len(doc.Bank.List.Trns))
+	}
+	trn := doc.Bank.List.Trns[0]
+	if trn.TrnType != "DEBIT" || trn.TrnAmt != "-24.34" || trn.FitID != "3" {
+		t.Errorf("got transaction %+v, wanted DEBIT -24.34 with id 3", trn)
+	}
+	if trn.Name != "PayPal" {
+		t.Errorf("got payee %q, wanted merchant name PayPal", trn.Name)
+	}
+	if trn.Memo != "Goods bought" {
+		t.Errorf("got memo %q, wanted Goods bought", trn.Memo)
+	}
+	if trn.DtPosted != "20170731000000" || trn.DtAvail != "20170730000000" {
+		t.Errorf("got dates %s/%s, wanted 20170731000000/20170730000000", trn.DtPosted, trn.DtAvail)
+	}
+}
+
+func TestWriteOFXCreditCard(t *testing.T) {
+	acc := testAccount()
+	acc.Type = bosgo.AccountTypeCreditCard
+	acc.IBAN = ""
+	acc.Number = "4111"
+
+	var buf bytes.Buffer
+	if err := WriteOFX(&buf, Transactions(nil), OFXOptions{Account: acc}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var doc ofxDoc
+	if err := xml.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("failed to parse output: %v\n%s", err, buf.String())
+	}
+	if doc.CreditCard.AcctID != "4111" {
+		t.Errorf("got credit card account %q, wanted 4111", doc.CreditCard.AcctID)
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright 2017 Bankrs AG.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"code.bankrs.com/bosgo"
+	"code.bankrs.com/bosgo/internal/money"
+)
+
+// QIFOptions configures WriteQIF.
+type QIFOptions struct {
+	AccountType bosgo.AccountType // selects the QIF account type header, defaults to a bank account
+	Categories  Categories        // names written to the category field
+	DateFormat  string            // layout of dates, defaults to MM/DD/YYYY
+}
+
+// WriteQIF writes the transactions yielded by it to w in Quicken Interchange
+// Format. Transactions are written as the iterator advances.
+func WriteQIF(w io.Writer, it TransactionIterator, opts QIFOptions) error {
+	layout := opts.DateFormat
+	if layout == "" {
+		layout = "01/02/2006"
+	}
+
+	header := "!Type:Bank"
+	if opts.AccountType == bosgo.AccountTypeCreditCard {
+		header = "!Type:CCard"
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, header)
+
+	for it.Next() {
+		tx := it.Transaction()
+		if tx.Amount == nil {
+			return fmt.Errorf("export: transaction %d has no amount", tx.ID)
+		}
+		amt, err := money.Parse(tx.Amount.Value)
+		if err != nil {
+			return fmt.Errorf("export: transaction %d amount: %v", tx.ID, err)
+		}
+
+		fmt.Fprintf(bw, "D%s\n", bookingDate(tx).Format(layout))
+		fmt.Fprintf(bw, "T%s\n", amt.String())
+		if p := qifText(payee(tx)); p != "" {
+			fmt.Fprintf(bw, "P%s\n", p)
+		}
+		if m := qifText(tx.Usage); m != "" {
+			fmt.Fprintf(bw, "M%s\n", m)
+		}
+		if c := qifText(opts.Categories.Name(tx.CategoryID)); c != "" {
+			fmt.Fprintf(bw, "L%s\n", c)
+		}
+		if tx.RemoteID != "" {
+			fmt.Fprintf(bw, "N%s\n", qifText(tx.RemoteID))
+		}
+		fmt.Fprintln(bw, "C*")
+		fmt.Fprintln(bw, "^")
+	}
+	if err := it.Err(); err != nil {
+		return err
+	}
+
+	return bw.Flush()
+}
+
+var qifReplacer = strings.NewReplacer("\r\n", " ", "\n", " ", "\r", " ")
+
+// qifText removes line breaks, which would start a new field.
+func qifText(s string) string {
+	return strings.TrimSpace(qifReplacer.Replace(s))
+}
@@ -0,0 +1,45 @@
+// Copyright 2017 Bankrs AG.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"bytes"
+	"testing"
+
+	"code.bankrs.com/bosgo"
+)
+
+func TestWriteQIF(t *testing.T) {
+	txs := testTransactions()[:2]
+	txs[0].CategoryID = 5
+	txs[1].Usage = "Interest\npayment"
+
+	page := &bosgo.TransactionPage{Transactions: txs}
+
+	var buf bytes.Buffer
+	err := WriteQIF(&buf, Pages(page), QIFOptions{
+		Categories: NewCategories(testCategories, "en"),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := "!Type:Bank\n" +
+		"D07/31/2017\nT-24.34\nPPayPal\nMGoods bought\nLShopping\nNr3\nC*\n^\n" +
+		"D07/30/2017\nT0.05\nMInterest payment\nNr2\nC*\n^\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwanted:\n%s", got, want)
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright 2017 Bankrs AG.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"strings"
+
+	"code.bankrs.com/bosgo"
+)
+
+// TransactionIterator yields transactions one at a time. It is implemented
+// by bosgo.TransactionIterator, which allows the CSV, OFX and QIF writers to
+// stream an arbitrary amount of transaction history straight from the API.
+type TransactionIterator interface {
+	Next() bool
+	Transaction() bosgo.Transaction
+	Err() error
+}
+
+// Transactions returns an iterator over a slice of transactions.
+func Transactions(txs []bosgo.Transaction) TransactionIterator {
+	return &sliceIterator{txs: txs}
+}
+
+// Pages returns an iterator over the transactions contained in a sequence of
+// transaction pages.
+func Pages(pages ...*bosgo.TransactionPage) TransactionIterator {
+	var txs []bosgo.Transaction
+	for _, p := range pages {
+		if p != nil {
+			txs = append(txs, p.Transactions...)
+		}
+	}
+	return &sliceIterator{txs: txs}
+}
+
+type sliceIterator struct {
+	txs []bosgo.Transaction
+	pos int
+	tx  bosgo.Transaction
+}
+
+func (it *sliceIterator) Next() bool {
+	if it.pos >= len(it.txs) {
+		return false
+	}
+	it.tx = it.txs[it.pos]
+	it.pos++
+	return true
+}
+
+func (it *sliceIterator) Transaction() bosgo.Transaction { return it.tx }
+func (it *sliceIterator) Err() error                     { return nil }
+
+// Categories maps category IDs to display names.
+type Categories map[int64]string
+
+// NewCategories returns the names of the categories in list in the given
+// language, falling back as described by bosgo.LanguageFallback.
+func NewCategories(list bosgo.CategoryList, lang string) Categories {
+	cats := make(Categories, len(list))
+	for _, c := range list {
+		if name := c.Name(lang); name != "" {
+			cats[c.ID] = name
+		}
+	}
+	return cats
+}
+
+// LoadCategories requests the list of categories from the API and returns
+// their names in the given language.
+func LoadCategories(svc *bosgo.CategoriesService, lang string) (Categories, error) {
+	list, err := svc.List().Send()
+	if err != nil {
+		return nil, err
+	}
+	return NewCategories(*list, lang), nil
+}
+
+// Name returns the name of the category with the given ID, or an empty string
+// if the category is unknown or c is nil.
+func (c Categories) Name(id int64) string {
+	if c == nil || id == 0 {
+		return ""
+	}
+	return c[id]
+}
+
+// payee returns the name to show as the payee of a transaction, preferring
+// the merchant name over the counterparty name.
+func payee(tx bosgo.Transaction) string {
+	if tx.Counterparty.Merchant != nil {
+		if name := strings.TrimSpace(tx.Counterparty.Merchant.Name); name != "" {
+			return name
+		}
+	}
+	return strings.TrimSpace(tx.Counterparty.Name)
+}
+
+// merchant returns the merchant name of a transaction, if any.
+func merchant(tx bosgo.Transaction) string {
+	if tx.Counterparty.Merchant == nil {
+		return ""
+	}
+	return strings.TrimSpace(tx.Counterparty.Merchant.Name)
+}
@@ -1 +1,8 @@
 module code.bankrs.com/bosgo
+
+go 1.16
+
+require (
+	golang.org/x/term v0.0.0-20210422114643-f5beecf764ed
+	gopkg.in/yaml.v3 v3.0.1
+)
@@ -0,0 +1,236 @@
+// Copyright 2017 Bankrs AG.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package money provides fixed point arithmetic for the decimal strings used
+// by the Bankrs OS API to represent monetary values.
+package money
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// Scale is the number of decimal places held by an Amount.
+const Scale = 4
+
+const unit = 10000 // 10^Scale
+
+// Amount is a monetary value held as an integer number of ten-thousandths of
+// a currency unit. The zero value is zero.
+type Amount int64
+
+// Parse parses a decimal string such as "-24.34" into an Amount. It returns
+// an error if the string is not a plain decimal number or has more than Scale
+// significant decimal places.
+func Parse(s string) (Amount, error) {
+	str := strings.TrimSpace(s)
+	if str == "" {
+		return 0, fmt.Errorf("money: empty amount")
+	}
+
+	neg := false
+	switch str[0] {
+	case '-':
+		neg = true
+		str = str[1:]
+	case '+':
+		str = str[1:]
+	}
+
+	whole, frac := str, ""
+	if dot := strings.IndexByte(str, '.'); dot != -1 {
+		whole, frac = str[:dot], str[dot+1:]
+	}
+	if whole == "" && frac == "" {
+		return 0, fmt.Errorf("money: invalid amount %q", s)
+	}
+
+	frac = strings.TrimRight(frac, "0")
+	if len(frac) > Scale {
+		return 0, fmt.Errorf("money: amount %q has too many decimal places", s)
+	}
+
+	var v int64
+	for _, c := range whole {
+		if c < '0' || c > '9' {
+			return 0, fmt.Errorf("money: invalid amount %q", s)
+		}
+		v = v*10 + int64(c-'0')
+		if v > (1<<63-1)/unit {
+			return 0, fmt.Errorf("money: amount %q out of range", s)
+		}
+	}
+	v *= unit
+
+	mul := int64(unit / 10)
+	for _, c := range frac {
+		if c < '0' || c > '9' {
+			return 0, fmt.Errorf("money: invalid amount %q", s)
+		}
+		v += int64(c-'0') * mul
+		mul /= 10
+	}
+
+	if neg {
+		v = -v
+	}
+	return Amount(v), nil
+}
+
+// MustParse is like Parse but panics if the string cannot be parsed.
+func MustParse(s string) Amount {
+	a, err := Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return a
+}
+
+// Places returns the number of decimal places written in the decimal string
+// s, including trailing zeros, but at most Scale. It does not check that s is
+// a valid amount.
+func Places(s string) int {
+	dot := strings.IndexByte(s, '.')
+	if dot == -1 {
+		return 0
+	}
+	n := len(strings.TrimSpace(s[dot+1:]))
+	if n > Scale {
+		n = Scale
+	}
+	return n
+}
+
+// FromInt returns an Amount representing a whole number of currency units.
+func FromInt(v int64) Amount {
+	return Amount(v * unit)
+}
+
+// Sign returns -1, 0 or 1 depending on whether a is negative, zero or positive.
+func (a Amount) Sign() int {
+	switch {
+	case a < 0:
+		return -1
+	case a > 0:
+		return 1
+	}
+	return 0
+}
+
+// Abs returns the absolute value of a.
+func (a Amount) Abs() Amount {
+	if a < 0 {
+		return -a
+	}
+	return a
+}
+
+// Float64 returns the nearest floating point representation of a. It should
+// only be used for ratios and scores, never for further monetary arithmetic.
+func (a Amount) Float64() float64 {
+	return float64(a) / unit
+}
+
+// Round rounds a to the given number of decimal places, with halves rounded
+// away from zero.
+func (a Amount) Round(places int) Amount {
+	if places >= Scale {
+		return a
+	}
+	if places < 0 {
+		places = 0
+	}
+	step := int64(1)
+	for i := places; i < Scale; i++ {
+		step *= 10
+	}
+	v := int64(a)
+	r := v % step
+	v -= r
+	if r >= step/2 {
+		v += step
+	} else if r <= -step/2 {
+		v -= step
+	}
+	return Amount(v)
+}
+
+// Mul returns a multiplied by factor, a decimal string such as an exchange
+// rate, rounded half away from zero to the precision of an Amount. Unlike
+// Parse it accepts any number of decimal places in factor.
+func (a Amount) Mul(factor string) (Amount, error) {
+	str := strings.TrimSpace(factor)
+	digits := strings.TrimLeft(str, "+-")
+	if digits == "" || digits == "." || len(str)-len(digits) > 1 || strings.Count(digits, ".") > 1 || strings.Trim(digits, ".0123456789") != "" {
+		return 0, fmt.Errorf("money: invalid factor %q", factor)
+	}
+	r, ok := new(big.Rat).SetString(str)
+	if !ok {
+		return 0, fmt.Errorf("money: invalid factor %q", factor)
+	}
+
+	num := new(big.Int).Mul(big.NewInt(int64(a)), r.Num())
+	q, m := new(big.Int).QuoRem(num, r.Denom(), new(big.Int))
+	if m.Sign() != 0 && new(big.Int).Mul(new(big.Int).Abs(m), big.NewInt(2)).Cmp(r.Denom()) >= 0 {
+		q.Add(q, big.NewInt(int64(num.Sign())))
+	}
+	if !q.IsInt64() {
+		return 0, fmt.Errorf("money: product of %s and %q out of range", a, factor)
+	}
+	return Amount(q.Int64()), nil
+}
+
+// String formats a with two decimal places using a dot as the decimal
+// separator, matching the format used by the Bankrs OS API.
+func (a Amount) String() string {
+	return a.Format(2, ".")
+}
+
+// Format formats a rounded to the given number of decimal places using sep as
+// the decimal separator. Negative amounts are prefixed with a minus sign.
+func (a Amount) Format(places int, sep string) string {
+	if places > Scale {
+		places = Scale
+	}
+	if places < 0 {
+		places = 0
+	}
+	v := int64(a.Round(places))
+
+	sign := ""
+	if v < 0 {
+		sign = "-"
+		v = -v
+	}
+
+	whole := v / unit
+	frac := v % unit
+	if places == 0 {
+		return fmt.Sprintf("%s%d", sign, whole)
+	}
+	for i := places; i < Scale; i++ {
+		frac /= 10
+	}
+	return fmt.Sprintf("%s%d%s%0*d", sign, whole, sep, places, frac)
+}
+
+// Sum returns the total of the supplied amounts.
+func Sum(amounts ...Amount) Amount {
+	var total Amount
+	for _, a := range amounts {
+		total += a
+	}
+	return total
+}
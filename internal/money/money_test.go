@@ -0,0 +1,123 @@
+// Copyright 2017 Bankrs AG.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package money
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	testCases := []struct {
+		in   string
+		want Amount
+	}{
+		{in: "0", want: 0},
+		{in: "24.34", want: 243400},
+		{in: "-24.34", want: -243400},
+		{in: "+1.5", want: 15000},
+		{in: ".05", want: 500},
+		{in: "500", want: 5000000},
+		{in: "1.23450", want: 12345},
+	}
+
+	for _, tc := range testCases {
+		got, err := Parse(tc.in)
+		if err != nil {
+			t.Errorf("Parse(%q): unexpected error: %v", tc.in, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("Parse(%q): got %d, wanted %d", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, in := range []string{"", "-", ".", "1,50", "abc", "1.23456", "1e5"} {
+		if _, err := Parse(in); err == nil {
+			t.Errorf("Parse(%q): got no error, wanted one", in)
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	testCases := []struct {
+		in     Amount
+		places int
+		sep    string
+		want   string
+	}{
+		{in: MustParse("-24.34"), places: 2, sep: ".", want: "-24.34"},
+		{in: MustParse("24.345"), places: 2, sep: ",", want: "24,35"},
+		{in: MustParse("-24.345"), places: 2, sep: ".", want: "-24.35"},
+		{in: MustParse("0.05"), places: 2, sep: ".", want: "0.05"},
+		{in: MustParse("1234.5"), places: 0, sep: ".", want: "1235"},
+		{in: MustParse("1.2345"), places: 4, sep: ".", want: "1.2345"},
+	}
+
+	for _, tc := range testCases {
+		got := tc.in.Format(tc.places, tc.sep)
+		if got != tc.want {
+			t.Errorf("%d.Format(%d, %q): got %q, wanted %q", tc.in, tc.places, tc.sep, got, tc.want)
+		}
+	}
+}
+
+func TestPlaces(t *testing.T) {
+	testCases := []struct {
+		in   string
+		want int
+	}{
+		{in: "24", want: 0},
+		{in: "-24.3", want: 1},
+		{in: "24.340", want: 3},
+		{in: "0.123456", want: Scale},
+	}
+
+	for _, tc := range testCases {
+		if got := Places(tc.in); got != tc.want {
+			t.Errorf("Places(%q): got %d, wanted %d", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestMul(t *testing.T) {
+	testCases := []struct {
+		in     Amount
+		factor string
+		want   Amount
+	}{
+		{in: MustParse("-86.93"), factor: "1.1504", want: MustParse("-100.0043")},
+		{in: MustParse("10.00"), factor: "0.333333333", want: MustParse("3.3333")},
+		{in: MustParse("0.0001"), factor: "0.5", want: MustParse("0.0001")},
+		{in: MustParse("-0.0001"), factor: "0.5", want: MustParse("-0.0001")},
+		{in: MustParse("12.50"), factor: "-2", want: MustParse("-25.00")},
+	}
+
+	for _, tc := range testCases {
+		got, err := tc.in.Mul(tc.factor)
+		if err != nil {
+			t.Errorf("%s.Mul(%q): unexpected error: %v", tc.in, tc.factor, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("%s.Mul(%q): got %d, wanted %d", tc.in, tc.factor, got, tc.want)
+		}
+	}
+
+	for _, factor := range []string{"", ".", "1e5", "1/3", "1.2.3", "--1"} {
+		if _, err := MustParse("1").Mul(factor); err == nil {
+			t.Errorf("Mul(%q): got no error, wanted one", factor)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+// Copyright 2017 Bankrs AG.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bosgo
+
+import (
+	"strconv"
+)
+
+// Iter returns an iterator over all transactions matching the request. Pages
+// are requested from the API as the iterator advances, starting at the
+// request's offset and using its limit as the page size, so only a single
+// page of transactions is held in memory at any time.
+func (r *ListTransactionsReq) Iter() *TransactionIterator {
+	offset, _ := strconv.Atoi(r.req.par.Get("offset"))
+	return &TransactionIterator{
+		req:    r,
+		offset: offset,
+	}
+}
+
+// TransactionIterator iterates over the transactions returned by a
+// ListTransactionsReq. Call Next to advance the iterator and Transaction to
+// obtain the current transaction. Iteration stops when there are no more
+// transactions or an error occurs, which is reported by Err.
+//
+//	it := userClient.Transactions.List().Limit(100).Iter()
+//	for it.Next() {
+//	    tx := it.Transaction()
+//	    ...
+//	}
+//	if err := it.Err(); err != nil {
+//	    ...
+//	}
+type TransactionIterator struct {
+	req     *ListTransactionsReq
+	page    []Transaction
+	pos     int
+	offset  int
+	total   int
+	fetched bool
+	done    bool
+	tx      Transaction
+	err     error
+}
+
+// Next advances the iterator to the next transaction, which will then be
+// available through the Transaction method. It returns false when iteration
+// stops, either by reaching the end of the transactions or an error.
+func (it *TransactionIterator) Next() bool {
+	for it.pos >= len(it.page) {
+		if it.done || it.err != nil {
+			return false
+		}
+		it.fetch()
+	}
+	it.tx = it.page[it.pos]
+	it.pos++
+	return true
+}
+
+func (it *TransactionIterator) fetch() {
+	if it.fetched && it.offset >= it.total {
+		it.done = true
+		return
+	}
+
+	page, err := it.req.Offset(it.offset).Send()
+	if err != nil {
+		it.err = err
+		return
+	}
+
+	it.fetched = true
+	it.total = page.Total
+	it.page = page.Transactions
+	it.pos = 0
+	it.offset += len(page.Transactions)
+	if len(page.Transactions) == 0 {
+		it.done = true
+	}
+}
+
+// Transaction returns the current transaction.
+func (it *TransactionIterator) Transaction() Transaction {
+	return it.tx
+}
+
+// Total returns the total number of transactions reported by the API. It is
+// zero until the first page has been fetched.
+func (it *TransactionIterator) Total() int {
+	return it.total
+}
+
+// Err returns the first error that was encountered by the iterator.
+func (it *TransactionIterator) Err() error {
+	return it.err
+}
+
+// DefaultUserPageSize is the page size used by a UserIterator when the
+// request has no limit.
+const DefaultUserPageSize = 100
+
+// Iter returns an iterator over the IDs of all users of the application.
+// Pages are requested from the API as the iterator advances by following the
+// cursor returned with each page, starting at the request's cursor.
+func (r *ListDevUsersReq) Iter() *UserIterator {
+	if r.data.Limit == 0 {
+		r.data.Limit = DefaultUserPageSize
+	}
+	return &UserIterator{req: r}
+}
+
+// UserIterator iterates over the user IDs returned by a ListDevUsersReq.
+// It is used like a TransactionIterator. Usernames are looked up with
+// ApplicationsService.UserInfo or ResolveUsernames.
+type UserIterator struct {
+	req     *ListDevUsersReq
+	page    []string
+	pos     int
+	fetched bool
+	done    bool
+	id      string
+	err     error
+}
+
+// Next advances the iterator to the next user ID. It returns false when
+// iteration stops, either by reaching the end of the users or an error.
+func (it *UserIterator) Next() bool {
+	for it.pos >= len(it.page) {
+		if it.done || it.err != nil {
+			return false
+		}
+		it.fetch()
+	}
+	it.id = it.page[it.pos]
+	it.pos++
+	return true
+}
+
+func (it *UserIterator) fetch() {
+	if it.fetched && it.req.data.Cursor == "" {
+		it.done = true
+		return
+	}
+
+	page, err := it.req.Send()
+	if err != nil {
+		it.err = err
+		return
+	}
+
+	it.fetched = true
+	it.page = page.Users
+	it.pos = 0
+	it.req.data.Cursor = page.NextCursor
+	if len(page.Users) == 0 {
+		it.done = true
+	}
+}
+
+// ID returns the current user ID.
+func (it *UserIterator) ID() string {
+	return it.id
+}
+
+// Err returns the first error that was encountered by the iterator.
+func (it *UserIterator) Err() error {
+	return it.err
+}
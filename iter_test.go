@@ -0,0 +1,172 @@
+// Copyright 2017 Bankrs AG.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bosgo
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func pagedTransactionsHandler(total int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+		if limit == 0 {
+			limit = 50
+		}
+
+		page := TransactionPage{
+			Total:  total,
+			Limit:  limit,
+			Offset: offset,
+		}
+		for i := offset; i < offset+limit && i < total; i++ {
+			page.Transactions = append(page.Transactions, Transaction{ID: int64(i + 1)})
+		}
+
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(page)
+	}
+}
+
+func TestTransactionIterator(t *testing.T) {
+	routes := routeMap{
+		"/v1/transactions": {
+			http.MethodGet: pagedTransactionsHandler(7),
+		},
+	}
+
+	hc, cleanup := startTestServer(t, routes)
+	defer cleanup()
+
+	userClient := NewUserClient(hc, SandboxAddr, "usertoken", "appid")
+	it := userClient.Transactions.List().Limit(3).Iter()
+
+	var ids []int64
+	for it.Next() {
+		ids = append(ids, it.Transaction().ID)
+	}
+	if err := it.Err(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(ids) != 7 {
+		t.Fatalf("got %d transactions, wanted 7", len(ids))
+	}
+	for i, id := range ids {
+		if id != int64(i+1) {
+			t.Errorf("transaction %d: got id %d, wanted %d", i, id, i+1)
+		}
+	}
+	if it.Total() != 7 {
+		t.Errorf("got total %d, wanted 7", it.Total())
+	}
+}
+
+func TestTransactionIteratorOffset(t *testing.T) {
+	routes := routeMap{
+		"/v1/transactions": {
+			http.MethodGet: pagedTransactionsHandler(7),
+		},
+	}
+
+	hc, cleanup := startTestServer(t, routes)
+	defer cleanup()
+
+	userClient := NewUserClient(hc, SandboxAddr, "usertoken", "appid")
+	it := userClient.Transactions.List().Offset(5).Iter()
+
+	var n int
+	for it.Next() {
+		n++
+	}
+	if err := it.Err(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n != 2 {
+		t.Errorf("got %d transactions, wanted 2", n)
+	}
+}
+
+func TestTransactionIteratorError(t *testing.T) {
+	routes := routeMap{
+		"/v1/transactions": {
+			http.MethodGet: errorHandler,
+		},
+	}
+
+	hc, cleanup := startTestServer(t, routes)
+	defer cleanup()
+
+	userClient := NewUserClient(hc, SandboxAddr, "usertoken", "appid")
+	it := userClient.Transactions.List().Iter()
+	if it.Next() {
+		t.Fatalf("got a transaction, wanted none")
+	}
+	if it.Err() == nil {
+		t.Errorf("got no error, wanted one")
+	}
+}
+
+// pagedUsersHandler serves total user IDs id1 to idN, using the index of the
+// next user as cursor.
+func pagedUsersHandler(total int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var params PageParams
+		json.NewDecoder(r.Body).Decode(&params)
+		start, _ := strconv.Atoi(params.Cursor)
+
+		var page UserListPage
+		for i := start; i < start+params.Limit && i < total; i++ {
+			page.Users = append(page.Users, fmt.Sprintf("id%d", i+1))
+		}
+		if next := start + params.Limit; next < total {
+			page.NextCursor = strconv.Itoa(next)
+		}
+
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		json.NewEncoder(w).Encode(page)
+	}
+}
+
+func TestUserIterator(t *testing.T) {
+	routes := routeMap{
+		"/v1/developers/users": {
+			http.MethodPost: pagedUsersHandler(5),
+		},
+	}
+
+	hc, cleanup := startTestServer(t, routes)
+	defer cleanup()
+
+	devClient := NewDevClient(hc, SandboxAddr, "devtoken")
+	it := devClient.Applications.ListUsers("app1").Limit(2).Iter()
+
+	var ids []string
+	for it.Next() {
+		ids = append(ids, it.ID())
+	}
+	if err := it.Err(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []string{"id1", "id2", "id3", "id4", "id5"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("got %v, wanted %v", ids, want)
+	}
+}
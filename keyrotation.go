@@ -0,0 +1,319 @@
+// Copyright 2017 Bankrs AG.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bosgo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// RotationStage is the last completed stage of a key rotation.
+type RotationStage int
+
+const (
+	RotationStarted   RotationStage = iota // The existing keys have been recorded
+	RotationCreated                        // The new key has been created
+	RotationPublished                      // The new key has been published
+	RotationWaited                         // The grace period has elapsed
+	RotationVerified                       // The old keys are no longer in use
+	RotationComplete                       // The old keys have been deleted
+)
+
+var rotationStageNames = []string{"started", "created", "published", "waited", "verified", "complete"}
+
+func (s RotationStage) String() string {
+	if s < 0 || int(s) >= len(rotationStageNames) {
+		return fmt.Sprintf("RotationStage(%d)", int(s))
+	}
+	return rotationStageNames[s]
+}
+
+// ErrKeyInUse is returned by a key rotation when an old key is still in use
+// after the grace period. The rotation may be resumed later.
+var ErrKeyInUse = errors.New("application key is still in use")
+
+// KeyRotation is the state of a key rotation. It may be stored, for example
+// as JSON, and passed to KeyRotator.Resume to continue an interrupted
+// rotation.
+type KeyRotation struct {
+	ApplicationID string         `json:"application_id"`
+	Stage         RotationStage  `json:"stage"`
+	OldKeys       []string       `json:"old_keys"`
+	NewKey        ApplicationKey `json:"new_key"`
+	PublishedAt   time.Time      `json:"published_at"`
+	Deleted       []string       `json:"deleted,omitempty"` // Old keys deleted so far
+}
+
+// KeyRotator replaces the keys of an application with a new key. A rotation
+// creates the new key, publishes it, waits for the grace period, verifies
+// that the old keys are no longer in use and finally deletes them.
+type KeyRotator struct {
+	Applications *ApplicationsService
+	Keys         *ApplicationKeysService
+
+	// Publish makes the new key available to the application's clients, for
+	// example by writing it to their configuration. It may be called again
+	// with the same key when a rotation is resumed.
+	Publish func(ctx context.Context, key ApplicationKey) error
+
+	// Grace is the time to wait after publishing before the old keys are
+	// deleted, allowing clients to pick up the new key.
+	Grace time.Duration
+
+	// InUse, if set, reports whether a key is still used. A rotation stops
+	// with ErrKeyInUse before deleting a key that is in use.
+	InUse func(ctx context.Context, key string) (bool, error)
+
+	// Progress, if set, is called with the state of the rotation after every
+	// completed stage. Storing the state allows an interrupted rotation to be
+	// resumed.
+	Progress func(KeyRotation)
+
+	now   func() time.Time                                 // replaced in tests
+	sleep func(ctx context.Context, d time.Duration) error // replaced in tests
+}
+
+// NewKeyRotator returns a rotator using the services of the developer client.
+func NewKeyRotator(dc *DevClient, publish func(ctx context.Context, key ApplicationKey) error, grace time.Duration) *KeyRotator {
+	return &KeyRotator{
+		Applications: dc.Applications,
+		Keys:         dc.ApplicationKeys,
+		Publish:      publish,
+		Grace:        grace,
+	}
+}
+
+// RotateKey replaces all keys of the application with a new key that is
+// passed to publish, deleting the old keys once grace has elapsed. Use a
+// KeyRotator to verify key usage, observe progress or resume a rotation.
+func (d *ApplicationsService) RotateKey(ctx context.Context, applicationID string, publish func(ctx context.Context, key ApplicationKey) error, grace time.Duration) (*KeyRotation, error) {
+	return NewKeyRotator(d.client, publish, grace).Rotate(ctx, applicationID)
+}
+
+// Rotate starts a new rotation of the application's keys. On error the
+// returned state records the progress made and may be passed to Resume.
+func (r *KeyRotator) Rotate(ctx context.Context, applicationID string) (*KeyRotation, error) {
+	page, err := r.Applications.ListKeys(applicationID).Context(ctx).Send()
+	if err != nil {
+		return nil, err
+	}
+
+	st := &KeyRotation{ApplicationID: applicationID, Stage: RotationStarted}
+	for _, k := range page.Keys {
+		st.OldKeys = append(st.OldKeys, k.Key)
+	}
+	r.progress(st)
+	return r.Resume(ctx, st)
+}
+
+// Resume continues a rotation from the last completed stage recorded in st.
+// It returns the updated state, which is also modified in place.
+func (r *KeyRotator) Resume(ctx context.Context, st *KeyRotation) (*KeyRotation, error) {
+	for st.Stage < RotationComplete {
+		var err error
+		switch st.Stage {
+		case RotationStarted:
+			err = r.create(ctx, st)
+		case RotationCreated:
+			err = r.publish(ctx, st)
+		case RotationPublished:
+			err = r.wait(ctx, st)
+		case RotationWaited:
+			err = r.verify(ctx, st)
+		case RotationVerified:
+			err = r.delete(ctx, st)
+		default:
+			err = fmt.Errorf("unknown rotation stage %d", int(st.Stage))
+		}
+		if err != nil {
+			return st, err
+		}
+		st.Stage++
+		r.progress(st)
+	}
+	return st, nil
+}
+
+func (r *KeyRotator) create(ctx context.Context, st *KeyRotation) error {
+	key, err := r.Applications.CreateKey(st.ApplicationID).Context(ctx).Send()
+	if err != nil {
+		return err
+	}
+	st.NewKey = *key
+	return nil
+}
+
+func (r *KeyRotator) publish(ctx context.Context, st *KeyRotation) error {
+	if r.Publish != nil {
+		if err := r.Publish(ctx, st.NewKey); err != nil {
+			return fmt.Errorf("publish key: %v", err)
+		}
+	}
+	st.PublishedAt = r.clock()
+	return nil
+}
+
+// wait sleeps for the remainder of the grace period, which may have partly
+// elapsed before the rotation was resumed.
+func (r *KeyRotator) wait(ctx context.Context, st *KeyRotation) error {
+	remaining := st.PublishedAt.Add(r.Grace).Sub(r.clock())
+	if remaining <= 0 {
+		return nil
+	}
+	if r.sleep != nil {
+		return r.sleep(ctx, remaining)
+	}
+	t := time.NewTimer(remaining)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// verify checks that the new key still exists and that none of the old keys
+// is still in use.
+func (r *KeyRotator) verify(ctx context.Context, st *KeyRotation) error {
+	page, err := r.Applications.ListKeys(st.ApplicationID).Context(ctx).Send()
+	if err != nil {
+		return err
+	}
+	found := false
+	for _, k := range page.Keys {
+		if k.Key == st.NewKey.Key {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return fmt.Errorf("new key %s no longer exists", st.NewKey.Key)
+	}
+
+	if r.InUse == nil {
+		return nil
+	}
+	for _, key := range st.OldKeys {
+		if key == st.NewKey.Key || contains(st.Deleted, key) {
+			continue
+		}
+		inUse, err := r.InUse(ctx, key)
+		if err != nil {
+			return err
+		}
+		if inUse {
+			return ErrKeyInUse
+		}
+	}
+	return nil
+}
+
+// delete removes the old keys. Keys that no longer exist are treated as
+// deleted.
+func (r *KeyRotator) delete(ctx context.Context, st *KeyRotation) error {
+	for _, key := range st.OldKeys {
+		if key == st.NewKey.Key || contains(st.Deleted, key) {
+			continue
+		}
+		err := r.Keys.Delete(key).Context(ctx).Send()
+		if serr, ok := err.(*Error); ok && serr.StatusCode == http.StatusNotFound {
+			err = nil
+		}
+		if err != nil {
+			return err
+		}
+		st.Deleted = append(st.Deleted, key)
+		r.progress(st)
+	}
+	return nil
+}
+
+func (r *KeyRotator) progress(st *KeyRotation) {
+	if r.Progress != nil {
+		r.Progress(*st)
+	}
+}
+
+func (r *KeyRotator) clock() time.Time {
+	if r.now != nil {
+		return r.now()
+	}
+	return time.Now()
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// KeyAgeViolation is an application key older than permitted by a policy.
+type KeyAgeViolation struct {
+	ApplicationID string
+	Key           ApplicationKey
+	Age           time.Duration
+}
+
+// CheckKeyAge returns the keys created more than maxAge before now, oldest
+// first. Keys without a creation time are reported with an age of zero since
+// their age cannot be determined.
+func CheckKeyAge(applicationID string, keys []ApplicationKey, maxAge time.Duration, now time.Time) []KeyAgeViolation {
+	var vs []KeyAgeViolation
+	for _, k := range keys {
+		if k.CreatedAt.IsZero() {
+			vs = append(vs, KeyAgeViolation{ApplicationID: applicationID, Key: k})
+			continue
+		}
+		if age := now.Sub(k.CreatedAt); age > maxAge {
+			vs = append(vs, KeyAgeViolation{ApplicationID: applicationID, Key: k, Age: age})
+		}
+	}
+	sort.SliceStable(vs, func(i, j int) bool { return vs[i].Age > vs[j].Age })
+	return vs
+}
+
+// CheckKeyAge lists the keys of the given applications, or of all
+// applications if none are given, and returns those older than maxAge as
+// described by the package level CheckKeyAge.
+func (d *ApplicationsService) CheckKeyAge(ctx context.Context, maxAge time.Duration, applicationIDs ...string) ([]KeyAgeViolation, error) {
+	if len(applicationIDs) == 0 {
+		page, err := d.List().Context(ctx).Send()
+		if err != nil {
+			return nil, err
+		}
+		for _, app := range page.Applications {
+			applicationIDs = append(applicationIDs, app.ApplicationID)
+		}
+	}
+
+	now := time.Now()
+	var vs []KeyAgeViolation
+	for _, id := range applicationIDs {
+		page, err := d.ListKeys(id).Context(ctx).Send()
+		if err != nil {
+			return nil, err
+		}
+		vs = append(vs, CheckKeyAge(id, page.Keys, maxAge, now)...)
+	}
+	return vs, nil
+}
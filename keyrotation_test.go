@@ -0,0 +1,166 @@
+// Copyright 2017 Bankrs AG.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bosgo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// keyAPI serves the application key endpoints of a single application.
+type keyAPI struct {
+	keys    []ApplicationKey
+	created int
+}
+
+func (a *keyAPI) routes() routeMap {
+	return routeMap{
+		"/v1/developers/applications/app1/keys": {
+			http.MethodGet: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json; charset=utf-8")
+				json.NewEncoder(w).Encode(a.keys)
+			},
+			http.MethodPost: func(w http.ResponseWriter, r *http.Request) {
+				a.created++
+				key := ApplicationKey{Key: fmt.Sprintf("new%d", a.created), CreatedAt: time.Date(2017, 7, 1, 0, 0, 0, 0, time.UTC)}
+				a.keys = append(a.keys, key)
+				w.Header().Set("Content-Type", "application/json; charset=utf-8")
+				json.NewEncoder(w).Encode(key)
+			},
+		},
+		"/v1/developers/application_keys/": {
+			http.MethodDelete: func(w http.ResponseWriter, r *http.Request) {
+				id := strings.TrimPrefix(r.URL.Path, "/v1/developers/application_keys/")
+				for i, k := range a.keys {
+					if k.Key == id {
+						a.keys = append(a.keys[:i], a.keys[i+1:]...)
+						w.WriteHeader(http.StatusNoContent)
+						return
+					}
+				}
+				w.WriteHeader(http.StatusNotFound)
+			},
+		},
+	}
+}
+
+func TestRotateKey(t *testing.T) {
+	api := &keyAPI{keys: []ApplicationKey{{Key: "old1"}, {Key: "old2"}}}
+	hc, cleanup := startTestServer(t, api.routes())
+	defer cleanup()
+
+	devClient := NewDevClient(hc, SandboxAddr, "devtoken")
+	var published []string
+	var stages []RotationStage
+	now := time.Date(2017, 7, 1, 12, 0, 0, 0, time.UTC)
+	var slept time.Duration
+
+	r := NewKeyRotator(devClient, func(ctx context.Context, key ApplicationKey) error {
+		published = append(published, key.Key)
+		return nil
+	}, time.Hour)
+	r.Progress = func(st KeyRotation) { stages = append(stages, st.Stage) }
+	r.now = func() time.Time { return now }
+	r.sleep = func(ctx context.Context, d time.Duration) error {
+		slept += d
+		return nil
+	}
+
+	st, err := r.Rotate(context.Background(), "app1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if st.Stage != RotationComplete {
+		t.Errorf("got stage %v, wanted complete", st.Stage)
+	}
+	if !reflect.DeepEqual(published, []string{"new1"}) {
+		t.Errorf("got published keys %v, wanted new1", published)
+	}
+	if slept != time.Hour {
+		t.Errorf("slept %v, wanted the grace period", slept)
+	}
+	if !reflect.DeepEqual(api.keys, []ApplicationKey{{Key: "new1", CreatedAt: time.Date(2017, 7, 1, 0, 0, 0, 0, time.UTC)}}) {
+		t.Errorf("got remaining keys %+v, wanted only new1", api.keys)
+	}
+	want := []RotationStage{RotationStarted, RotationCreated, RotationPublished, RotationWaited, RotationVerified, RotationVerified, RotationVerified, RotationComplete}
+	if !reflect.DeepEqual(stages, want) {
+		t.Errorf("got progress %v, wanted %v", stages, want)
+	}
+}
+
+func TestRotateKeyResume(t *testing.T) {
+	api := &keyAPI{keys: []ApplicationKey{{Key: "old1"}}}
+	hc, cleanup := startTestServer(t, api.routes())
+	defer cleanup()
+
+	devClient := NewDevClient(hc, SandboxAddr, "devtoken")
+	inUse := true
+	r := NewKeyRotator(devClient, nil, 0)
+	r.InUse = func(ctx context.Context, key string) (bool, error) { return inUse, nil }
+
+	st, err := r.Rotate(context.Background(), "app1")
+	if err != ErrKeyInUse {
+		t.Fatalf("got error %v, wanted ErrKeyInUse", err)
+	}
+	if st.Stage != RotationWaited || len(api.keys) != 2 {
+		t.Fatalf("got stage %v with %d keys, wanted waited with both keys", st.Stage, len(api.keys))
+	}
+
+	// Resume from a stored copy of the state.
+	data, _ := json.Marshal(st)
+	var stored KeyRotation
+	if err := json.Unmarshal(data, &stored); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	inUse = false
+	if _, err := r.Resume(context.Background(), &stored); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if api.created != 1 {
+		t.Errorf("created %d keys, wanted 1", api.created)
+	}
+	if len(api.keys) != 1 || api.keys[0].Key != "new1" {
+		t.Errorf("got remaining keys %+v, wanted only new1", api.keys)
+	}
+}
+
+func TestCheckKeyAge(t *testing.T) {
+	now := time.Date(2017, 7, 1, 0, 0, 0, 0, time.UTC)
+	keys := []ApplicationKey{
+		{Key: "fresh", CreatedAt: now.AddDate(0, 0, -10)},
+		{Key: "old", CreatedAt: now.AddDate(0, 0, -100)},
+		{Key: "unknown"},
+		{Key: "older", CreatedAt: now.AddDate(-1, 0, 0)},
+	}
+
+	vs := CheckKeyAge("app1", keys, 90*24*time.Hour, now)
+	var got []string
+	for _, v := range vs {
+		got = append(got, v.Key.Key)
+	}
+	if want := []string{"older", "old", "unknown"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got violations %v, wanted %v", got, want)
+	}
+	if vs[1].Age != 100*24*time.Hour || vs[1].ApplicationID != "app1" {
+		t.Errorf("got violation %+v", vs[1])
+	}
+}
@@ -0,0 +1,405 @@
+// Copyright 2017 Bankrs AG.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bosgo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// MinProviderScore is the lowest score a provider may have to be included in
+// the results of ProviderCatalog.Search.
+const MinProviderScore = 0.3
+
+// ProviderFilter reports whether a provider should be included in the
+// results of a catalog search.
+type ProviderFilter func(Provider) bool
+
+// ProviderCountry returns a filter that accepts providers located in one of
+// the given countries. Country codes are compared case insensitively.
+func ProviderCountry(countries ...string) ProviderFilter {
+	return func(p Provider) bool {
+		for _, c := range countries {
+			if strings.EqualFold(p.Country, c) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// ProviderSupports returns a filter that accepts providers allowing every
+// operation that is set in ops. For example, ProviderSupports with CreateRecTrf
+// set accepts only providers that support the creation of recurring transfers.
+func ProviderSupports(ops ProviderAllowedOperations) ProviderFilter {
+	return func(p Provider) bool {
+		have := p.Operations.AllowedOperations
+		return (!ops.PaymentTransfer || have.PaymentTransfer) &&
+			(!ops.AccountStatement || have.AccountStatement) &&
+			(!ops.AccountBalance || have.AccountBalance) &&
+			(!ops.CreditCardStatement || have.CreditCardStatement) &&
+			(!ops.CreditCardBalance || have.CreditCardBalance) &&
+			(!ops.CreateRecTrf || have.CreateRecTrf) &&
+			(!ops.ReadRecTrf || have.ReadRecTrf) &&
+			(!ops.UpdateRecTrf || have.UpdateRecTrf) &&
+			(!ops.DeleteRecTrf || have.DeleteRecTrf) &&
+			(!ops.ReadBeneficiaries || have.ReadBeneficiaries)
+	}
+}
+
+// ProviderCatalog holds the complete list of financial providers in memory so
+// they can be searched without contacting the API. A catalog is filled from
+// the API with Refresh or from a snapshot with ReadSnapshot. It is safe for
+// concurrent use.
+type ProviderCatalog struct {
+	svc *ProvidersService
+
+	mu        sync.RWMutex
+	providers []Provider
+	byID      map[string]int
+	updated   time.Time
+	now       func() time.Time // replaced in tests
+}
+
+// NewProviderCatalog returns an empty catalog that is filled from svc when
+// Refresh is called. svc may be nil if the catalog is only loaded from
+// snapshots.
+func NewProviderCatalog(svc *ProvidersService) *ProviderCatalog {
+	return &ProviderCatalog{
+		svc:  svc,
+		byID: map[string]int{},
+		now:  time.Now,
+	}
+}
+
+// LoadProviderCatalog returns a catalog filled with the providers listed by svc.
+func LoadProviderCatalog(ctx context.Context, svc *ProvidersService) (*ProviderCatalog, error) {
+	c := NewProviderCatalog(svc)
+	if err := c.Refresh(ctx); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Refresh replaces the providers of the catalog with those listed by the API.
+// The API has no separate listing endpoint, so all providers are requested by
+// searching with an empty query. The catalog is left unchanged if the request
+// fails.
+func (c *ProviderCatalog) Refresh(ctx context.Context) error {
+	if c.svc == nil {
+		return fmt.Errorf("provider catalog has no providers service")
+	}
+	res, err := c.svc.Search("").Context(ctx).Send()
+	if err != nil {
+		return err
+	}
+	providers := make([]Provider, 0, len(*res))
+	for _, r := range *res {
+		providers = append(providers, r.Provider)
+	}
+	c.Set(providers, c.now())
+	return nil
+}
+
+// RefreshEvery calls Refresh each time interval elapses until ctx is
+// cancelled. Errors are passed to onError, which may be nil, and do not stop
+// the refreshing. RefreshEvery blocks, so it is usually run in its own
+// goroutine.
+func (c *ProviderCatalog) RefreshEvery(ctx context.Context, interval time.Duration, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := c.Refresh(ctx); err != nil && onError != nil && ctx.Err() == nil {
+				onError(err)
+			}
+		}
+	}
+}
+
+// Set replaces the providers of the catalog. updated is the time the list was
+// obtained. If several providers share an id, the last one is kept.
+func (c *ProviderCatalog) Set(providers []Provider, updated time.Time) {
+	byID := make(map[string]int, len(providers))
+	var list []Provider
+	for _, p := range providers {
+		if i, exists := byID[p.ID]; exists {
+			list[i] = p
+			continue
+		}
+		byID[p.ID] = len(list)
+		list = append(list, p)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.providers = list
+	c.byID = byID
+	c.updated = updated
+}
+
+// Updated returns the time the providers of the catalog were obtained, or the
+// zero time if the catalog is empty.
+func (c *ProviderCatalog) Updated() time.Time {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.updated
+}
+
+// Len returns the number of providers in the catalog.
+func (c *ProviderCatalog) Len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.providers)
+}
+
+// Get returns the provider with the given id.
+func (c *ProviderCatalog) Get(id string) (Provider, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	i, ok := c.byID[id]
+	if !ok {
+		return Provider{}, false
+	}
+	return c.providers[i], true
+}
+
+// Providers returns the providers accepted by all filters, ordered by name.
+func (c *ProviderCatalog) Providers(filters ...ProviderFilter) []Provider {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var ps []Provider
+	for _, p := range c.providers {
+		if acceptProvider(p, filters) {
+			ps = append(ps, p)
+		}
+	}
+	sort.SliceStable(ps, func(i, j int) bool { return ps[i].Name < ps[j].Name })
+	return ps
+}
+
+// Search returns the providers accepted by all filters that match query,
+// ordered by descending score and then by name. Scores range from 0 to 1 like
+// those returned by ProvidersService.Search; an exact match of a provider's
+// name or id scores 1. Matching is case insensitive, ignores accents and
+// tolerates misspellings. Providers scoring below MinProviderScore are
+// omitted. An empty query matches every provider with a score of 1.
+func (c *ProviderCatalog) Search(query string, filters ...ProviderFilter) ProviderSearchResults {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	q := normaliseSearchText(query)
+	results := ProviderSearchResults{}
+	for _, p := range c.providers {
+		if !acceptProvider(p, filters) {
+			continue
+		}
+		score := scoreProvider(q, p)
+		if score < MinProviderScore {
+			continue
+		}
+		results = append(results, ProviderSearchResult{Score: score, Provider: p})
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].Provider.Name < results[j].Provider.Name
+	})
+	return results
+}
+
+type providerSnapshot struct {
+	Updated   time.Time  `json:"updated"`
+	Providers []Provider `json:"providers"`
+}
+
+// WriteSnapshot writes the providers of the catalog to w as JSON.
+func (c *ProviderCatalog) WriteSnapshot(w io.Writer) error {
+	c.mu.RLock()
+	snap := providerSnapshot{Updated: c.updated, Providers: c.providers}
+	c.mu.RUnlock()
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(snap)
+}
+
+// ReadSnapshot replaces the providers of the catalog with those of a snapshot
+// written by WriteSnapshot.
+func (c *ProviderCatalog) ReadSnapshot(r io.Reader) error {
+	var snap providerSnapshot
+	if err := json.NewDecoder(r).Decode(&snap); err != nil {
+		return fmt.Errorf("invalid provider snapshot: %v", err)
+	}
+	c.Set(snap.Providers, snap.Updated)
+	return nil
+}
+
+// LoadSnapshot reads a snapshot written by WriteSnapshot from the named file.
+func (c *ProviderCatalog) LoadSnapshot(filename string) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return c.ReadSnapshot(f)
+}
+
+// SaveSnapshot writes a snapshot of the catalog to the named file, replacing
+// it if it exists.
+func (c *ProviderCatalog) SaveSnapshot(filename string) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := c.WriteSnapshot(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func acceptProvider(p Provider, filters []ProviderFilter) bool {
+	for _, f := range filters {
+		if !f(p) {
+			return false
+		}
+	}
+	return true
+}
+
+// scoreProvider returns how well the normalised query q matches p. The name
+// and id are weighted fully, the description and address less so.
+func scoreProvider(q string, p Provider) float64 {
+	if q == "" {
+		return 1
+	}
+	best := 0.0
+	fields := []struct {
+		text   string
+		weight float64
+	}{
+		{p.Name, 1},
+		{p.ID, 1},
+		{p.Description, 0.8},
+		{p.Address + " " + p.PostalCode, 0.6},
+	}
+	for _, f := range fields {
+		if s := scoreText(q, normaliseSearchText(f.text)) * f.weight; s > best {
+			best = s
+		}
+	}
+	return best
+}
+
+// scoreText scores the normalised query q against the normalised text.
+// Whole text matches score highest; otherwise each query word is scored
+// against its best matching word of the text and the scores are averaged.
+func scoreText(q, text string) float64 {
+	switch {
+	case text == "":
+		return 0
+	case text == q:
+		return 1
+	case strings.HasPrefix(text, q):
+		return 0.95
+	}
+
+	words := strings.Fields(text)
+	var total float64
+	qwords := strings.Fields(q)
+	for _, qw := range qwords {
+		best := 0.0
+		for _, w := range words {
+			var s float64
+			switch {
+			case w == qw:
+				s = 1
+			case strings.HasPrefix(w, qw):
+				s = 0.9
+			case strings.Contains(w, qw):
+				s = 0.75
+			case len(qw) >= 4:
+				// Only longer words are matched approximately, short ones
+				// share bigrams with too many unrelated words.
+				if sim := bigramSimilarity(qw, w); sim >= 0.5 {
+					s = 0.7 * sim
+				}
+			}
+			if s > best {
+				best = s
+			}
+		}
+		total += best
+	}
+	return 0.9 * total / float64(len(qwords))
+}
+
+// bigramSimilarity returns the Dice coefficient of the character bigrams of
+// a and b.
+func bigramSimilarity(a, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	if len(ra) < 2 || len(rb) < 2 {
+		return 0
+	}
+	bigrams := map[[2]rune]int{}
+	for i := 0; i < len(ra)-1; i++ {
+		bigrams[[2]rune{ra[i], ra[i+1]}]++
+	}
+	shared := 0
+	for i := 0; i < len(rb)-1; i++ {
+		k := [2]rune{rb[i], rb[i+1]}
+		if bigrams[k] > 0 {
+			bigrams[k]--
+			shared++
+		}
+	}
+	return 2 * float64(shared) / float64(len(ra)+len(rb)-2)
+}
+
+var searchFolds = strings.NewReplacer(
+	"ä", "a", "ö", "o", "ü", "u", "ß", "ss",
+	"à", "a", "á", "a", "â", "a", "å", "a",
+	"è", "e", "é", "e", "ê", "e", "ë", "e",
+	"ì", "i", "í", "i", "î", "i", "ï", "i",
+	"ò", "o", "ó", "o", "ô", "o", "ø", "o",
+	"ù", "u", "ú", "u", "û", "u", "ñ", "n", "ç", "c",
+)
+
+// normaliseSearchText lower cases s, removes accents and replaces
+// punctuation by spaces.
+func normaliseSearchText(s string) string {
+	s = searchFolds.Replace(strings.ToLower(s))
+	s = strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return ' '
+	}, s)
+	return strings.Join(strings.Fields(s), " ")
+}
@@ -0,0 +1,180 @@
+// Copyright 2017 Bankrs AG.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bosgo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var testProviders = []Provider{
+	{
+		ID: "DE-BIN-BLZ-10070000", Name: "Deutsche Bank", Country: "DE", Description: "Deutsche Bank Privat- und Geschäftskunden",
+		Operations: ProviderOperations{AllowedOperations: ProviderAllowedOperations{PaymentTransfer: true, AccountStatement: true, CreateRecTrf: true}},
+	},
+	{
+		ID: "DE-BIN-BLZ-70150000", Name: "Stadtsparkasse München", Country: "DE",
+		Operations: ProviderOperations{AllowedOperations: ProviderAllowedOperations{PaymentTransfer: true, AccountStatement: true}},
+	},
+	{
+		ID: "AT-BIN-BLZ-20111", Name: "Erste Bank", Country: "AT", Address: "Am Belvedere 1, Wien", PostalCode: "1100",
+		Operations: ProviderOperations{AllowedOperations: ProviderAllowedOperations{AccountStatement: true, CreateRecTrf: true}},
+	},
+	{
+		ID: "DE-BIN-BLZ-50010517", Name: "ING-DiBa", Country: "DE",
+		Operations: ProviderOperations{AllowedOperations: ProviderAllowedOperations{AccountStatement: true}},
+	},
+}
+
+func resultIDs(rs ProviderSearchResults) []string {
+	ids := []string{}
+	for _, r := range rs {
+		ids = append(ids, r.Provider.ID)
+	}
+	return ids
+}
+
+func TestProviderCatalogSearch(t *testing.T) {
+	c := NewProviderCatalog(nil)
+	c.Set(testProviders, time.Date(2017, 7, 1, 0, 0, 0, 0, time.UTC))
+
+	testCases := []struct {
+		query   string
+		filters []ProviderFilter
+		want    []string
+	}{
+		{query: "deutsche bank", want: []string{"DE-BIN-BLZ-10070000", "AT-BIN-BLZ-20111"}},
+		{query: "sparkasse munchen", want: []string{"DE-BIN-BLZ-70150000"}},
+		{query: "ing", want: []string{"DE-BIN-BLZ-50010517"}},
+		{query: "sparkase", want: []string{"DE-BIN-BLZ-70150000"}},
+		{query: "bank", filters: []ProviderFilter{ProviderCountry("at")}, want: []string{"AT-BIN-BLZ-20111"}},
+		{query: "wien", want: []string{"AT-BIN-BLZ-20111"}},
+		{
+			query:   "",
+			filters: []ProviderFilter{ProviderCountry("DE"), ProviderSupports(ProviderAllowedOperations{CreateRecTrf: true})},
+			want:    []string{"DE-BIN-BLZ-10070000"},
+		},
+		{query: "xyzzy", want: []string{}},
+	}
+
+	for _, tc := range testCases {
+		got := c.Search(tc.query, tc.filters...)
+		if ids := resultIDs(got); !reflect.DeepEqual(ids, tc.want) {
+			t.Errorf("%q: got %v, wanted %v", tc.query, ids, tc.want)
+			continue
+		}
+		for i, r := range got {
+			if r.Score < MinProviderScore || r.Score > 1 || (i > 0 && r.Score > got[i-1].Score) {
+				t.Errorf("%q: got unexpected score %v for %s", tc.query, r.Score, r.Provider.ID)
+			}
+		}
+	}
+
+	for _, exact := range []string{"Deutsche Bank", "de-bin-blz-50010517"} {
+		got := c.Search(exact)
+		if len(got) == 0 || got[0].Score != 1 {
+			t.Errorf("%q: got %+v, wanted first result with score 1", exact, got)
+		} else if len(got) > 1 && got[1].Score >= 1 {
+			t.Errorf("%q: got second result with score %v, wanted less than 1", exact, got[1].Score)
+		}
+	}
+}
+
+func TestProviderCatalogProviders(t *testing.T) {
+	c := NewProviderCatalog(nil)
+	c.Set(testProviders, time.Time{})
+
+	var names []string
+	for _, p := range c.Providers(ProviderSupports(ProviderAllowedOperations{AccountStatement: true})) {
+		names = append(names, p.Name)
+	}
+	if want := []string{"Deutsche Bank", "Erste Bank", "ING-DiBa", "Stadtsparkasse München"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("got %v, wanted %v", names, want)
+	}
+
+	p, ok := c.Get("AT-BIN-BLZ-20111")
+	if !ok || p.Name != "Erste Bank" {
+		t.Errorf("got %+v, %v, wanted Erste Bank", p, ok)
+	}
+	if _, ok := c.Get("unknown"); ok {
+		t.Errorf("got provider for unknown id")
+	}
+}
+
+func TestProviderCatalogSnapshot(t *testing.T) {
+	updated := time.Date(2017, 7, 1, 12, 0, 0, 0, time.UTC)
+	c := NewProviderCatalog(nil)
+	c.Set(testProviders, updated)
+
+	var buf bytes.Buffer
+	if err := c.WriteSnapshot(&buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	loaded := NewProviderCatalog(nil)
+	if err := loaded.ReadSnapshot(&buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !loaded.Updated().Equal(updated) {
+		t.Errorf("got updated %v, wanted %v", loaded.Updated(), updated)
+	}
+	if !reflect.DeepEqual(loaded.Providers(), c.Providers()) {
+		t.Errorf("got providers %+v, wanted %+v", loaded.Providers(), c.Providers())
+	}
+
+	if err := loaded.ReadSnapshot(bytes.NewBufferString("{")); err == nil {
+		t.Errorf("got nil error for invalid snapshot, wanted non-nil")
+	}
+}
+
+func TestProviderCatalogRefresh(t *testing.T) {
+	var query string
+	routes := routeMap{
+		"/v1/providers": {
+			http.MethodGet: func(w http.ResponseWriter, r *http.Request) {
+				query = r.URL.Query().Get("q")
+				var res ProviderSearchResults
+				for _, p := range testProviders {
+					res = append(res, ProviderSearchResult{Score: 1, Provider: p})
+				}
+				w.Header().Set("Content-Type", "application/json; charset=utf-8")
+				json.NewEncoder(w).Encode(res)
+			},
+		},
+	}
+
+	hc, cleanup := startTestServer(t, routes)
+	defer cleanup()
+
+	appClient := NewAppClient(hc, SandboxAddr, "appid")
+	c, err := LoadProviderCatalog(context.Background(), appClient.Providers)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if query != "" {
+		t.Errorf("got query %q, wanted empty query", query)
+	}
+	if c.Len() != len(testProviders) {
+		t.Errorf("got %d providers, wanted %d", c.Len(), len(testProviders))
+	}
+	if c.Updated().IsZero() {
+		t.Errorf("got zero update time")
+	}
+}
@@ -0,0 +1,502 @@
+// Copyright 2017 Bankrs AG.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provision
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+
+	"code.bankrs.com/bosgo"
+)
+
+// Action is the kind of change made to a resource.
+type Action string
+
+const (
+	Create Action = "+"
+	Update Action = "~"
+	Delete Action = "-"
+)
+
+// Change is a single step of a plan.
+type Change struct {
+	Action   Action
+	Resource string   // application, settings, key, credential or webhook
+	Name     string   // Label, provider or URL identifying the resource
+	Details  []string // Description of the differences, never containing secrets
+
+	apply func(ctx context.Context, st *State) error
+}
+
+func (c Change) String() string {
+	s := fmt.Sprintf("%s %s", c.Action, c.Resource)
+	if c.Name != "" {
+		s += " " + c.Name
+	}
+	return s
+}
+
+// Plan is the list of changes needed to bring an application in line with a
+// spec.
+type Plan struct {
+	Changes []Change
+
+	dev     *bosgo.DevClient
+	state   *State
+	appID   string // Application id used for planning, recorded or adopted
+	created bool   // The application does not exist yet
+
+	// adopted records existing resources matched by the spec in the state
+	// when the plan is applied.
+	adopted []func(st *State)
+}
+
+// NewPlan compares the spec with the resources recorded in the state and
+// their current configuration, which is read using dev. Existing resources
+// the state does not record are adopted instead of created: the application
+// with the spec's label, credentials of the spec's providers and webhooks
+// with the spec's URLs. Adopted resources are recorded in the state by Apply;
+// planning leaves it unchanged. Credentials and webhooks recorded in the
+// state but missing from the spec are deleted; other resources are never
+// touched.
+func NewPlan(ctx context.Context, dev *bosgo.DevClient, spec *Spec, st *State) (*Plan, error) {
+	if err := spec.Validate(); err != nil {
+		return nil, err
+	}
+	if st == nil {
+		st = &State{}
+	}
+	st.init()
+
+	p := &Plan{dev: dev, state: st}
+	if err := p.planApplication(ctx, spec); err != nil {
+		return nil, err
+	}
+	if err := p.planSettings(ctx, spec); err != nil {
+		return nil, err
+	}
+	if err := p.planKeys(ctx, spec); err != nil {
+		return nil, err
+	}
+	if err := p.planCredentials(ctx, spec); err != nil {
+		return nil, err
+	}
+	if err := p.planWebhooks(ctx, spec); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *Plan) add(c Change) { p.Changes = append(p.Changes, c) }
+
+func (p *Plan) adopt(f func(st *State)) { p.adopted = append(p.adopted, f) }
+
+func (p *Plan) planApplication(ctx context.Context, spec *Spec) error {
+	page, err := p.dev.Applications.List().Context(ctx).Send()
+	if err != nil {
+		return err
+	}
+
+	if p.state.ApplicationID == "" {
+		var matches []bosgo.ApplicationMetadata
+		for _, app := range page.Applications {
+			if app.Label == spec.Label {
+				matches = append(matches, app)
+			}
+		}
+		switch len(matches) {
+		case 0:
+			p.created = true
+			p.add(Change{
+				Action:   Create,
+				Resource: "application",
+				Name:     spec.Label,
+				apply: func(ctx context.Context, st *State) error {
+					app, err := p.dev.Applications.Create(spec.Label).Context(ctx).Send()
+					if err != nil {
+						return err
+					}
+					st.ApplicationID = app.ApplicationID
+					return nil
+				},
+			})
+			return nil
+		case 1:
+			id := matches[0].ApplicationID
+			p.appID = id
+			p.adopt(func(st *State) { st.ApplicationID = id })
+			return nil
+		default:
+			return fmt.Errorf("provision: %d applications are labelled %q", len(matches), spec.Label)
+		}
+	}
+
+	p.appID = p.state.ApplicationID
+	for _, app := range page.Applications {
+		if app.ApplicationID != p.appID {
+			continue
+		}
+		if app.Label != spec.Label {
+			p.add(Change{
+				Action:   Update,
+				Resource: "application",
+				Name:     spec.Label,
+				Details:  []string{fmt.Sprintf("label %q -> %q", app.Label, spec.Label)},
+				apply: func(ctx context.Context, st *State) error {
+					return p.dev.Applications.Update(st.ApplicationID, spec.Label).Context(ctx).Send()
+				},
+			})
+		}
+		return nil
+	}
+	return fmt.Errorf("provision: application %s recorded in state does not exist", p.state.ApplicationID)
+}
+
+func (p *Plan) planSettings(ctx context.Context, spec *Spec) error {
+	if spec.Settings == nil || spec.Settings.BackgroundRefresh == nil {
+		return nil
+	}
+	want := *spec.Settings.BackgroundRefresh
+
+	current := bosgo.ApplicationSettings{}
+	if !p.created {
+		s, err := p.dev.Applications.Settings(p.appID).Context(ctx).Send()
+		if err != nil {
+			return err
+		}
+		current = *s
+	}
+	if !p.created && current.BackgroundRefresh == want {
+		return nil
+	}
+
+	p.add(Change{
+		Action:   Update,
+		Resource: "settings",
+		Details:  []string{fmt.Sprintf("background_refresh %v -> %v", current.BackgroundRefresh, want)},
+		apply: func(ctx context.Context, st *State) error {
+			_, err := p.dev.Applications.UpdateSettings(st.ApplicationID).BackgroundRefresh(want).Context(ctx).Send()
+			return err
+		},
+	})
+	return nil
+}
+
+func (p *Plan) planKeys(ctx context.Context, spec *Spec) error {
+	have := 0
+	if !p.created {
+		page, err := p.dev.Applications.ListKeys(p.appID).Context(ctx).Send()
+		if err != nil {
+			return err
+		}
+		have = len(page.Keys)
+	}
+	for i := have; i < spec.Keys; i++ {
+		p.add(Change{
+			Action:   Create,
+			Resource: "key",
+			Name:     fmt.Sprintf("%d of %d", i+1, spec.Keys),
+			apply: func(ctx context.Context, st *State) error {
+				_, err := p.dev.Applications.CreateKey(st.ApplicationID).Context(ctx).Send()
+				return err
+			},
+		})
+	}
+	return nil
+}
+
+func (p *Plan) planCredentials(ctx context.Context, spec *Spec) error {
+	existing := map[string][]string{} // Credential ids by provider
+	if !p.created {
+		page, err := p.dev.Applications.ListCredentials(p.appID).Context(ctx).Send()
+		if err != nil {
+			return err
+		}
+		for _, e := range page.Entries {
+			existing[e.Provider] = append(existing[e.Provider], e.ID)
+		}
+	}
+
+	wanted := map[string]bool{}
+	for _, c := range spec.Credentials {
+		c := c
+		wanted[c.Provider] = true
+
+		var cred *bosgo.Credential
+		if id, recorded := p.state.Credentials[c.Provider]; recorded {
+			cur, err := p.dev.Credentials.Get(id).Context(ctx).Send()
+			if err != nil && !isNotFound(err) {
+				return err
+			}
+			cred = cur
+		}
+		if cred == nil {
+			ids := existing[c.Provider]
+			if len(ids) > 1 {
+				return fmt.Errorf("provision: %d credentials exist for provider %q", len(ids), c.Provider)
+			}
+			if len(ids) == 1 {
+				cur, err := p.dev.Credentials.Get(ids[0]).Context(ctx).Send()
+				if err != nil {
+					return err
+				}
+				cred = cur
+				provider, id := c.Provider, ids[0]
+				p.adopt(func(st *State) { st.Credentials[provider] = id })
+			}
+		}
+
+		if cred != nil {
+			id := cred.ID
+			if details := diffKeys(cred.Credentials, c.Keys); len(details) > 0 {
+				p.add(Change{
+					Action:   Update,
+					Resource: "credential",
+					Name:     c.Provider,
+					Details:  details,
+					apply: func(ctx context.Context, st *State) error {
+						return p.dev.Credentials.Update(id, c.Keys).Context(ctx).Send()
+					},
+				})
+			}
+			continue
+		}
+
+		p.add(Change{
+			Action:   Create,
+			Resource: "credential",
+			Name:     c.Provider,
+			Details:  diffKeys(nil, c.Keys),
+			apply: func(ctx context.Context, st *State) error {
+				id, err := p.dev.Applications.CreateCredential(st.ApplicationID, c.Provider, c.Keys).Context(ctx).Send()
+				if err != nil {
+					return err
+				}
+				st.Credentials[c.Provider] = id
+				return nil
+			},
+		})
+	}
+
+	for _, provider := range sortedKeys(p.state.Credentials) {
+		if wanted[provider] {
+			continue
+		}
+		provider, id := provider, p.state.Credentials[provider]
+		p.add(Change{
+			Action:   Delete,
+			Resource: "credential",
+			Name:     provider,
+			apply: func(ctx context.Context, st *State) error {
+				if err := p.dev.Credentials.Delete(id).Context(ctx).Send(); err != nil && !isNotFound(err) {
+					return err
+				}
+				delete(st.Credentials, provider)
+				return nil
+			},
+		})
+	}
+	return nil
+}
+
+func (p *Plan) planWebhooks(ctx context.Context, spec *Spec) error {
+	page, err := p.dev.Webhooks.List().Context(ctx).Send()
+	if err != nil {
+		return err
+	}
+	existing := map[string]bosgo.Webhook{}
+	byURL := map[string][]bosgo.Webhook{}
+	for _, w := range page.Webhooks {
+		existing[w.ID] = w
+		byURL[w.URL] = append(byURL[w.URL], w)
+	}
+
+	wanted := map[string]bool{}
+	for _, ws := range spec.Webhooks {
+		ws := ws
+		if ws.APIVersion == 0 {
+			ws.APIVersion = DefaultAPIVersion
+		}
+		wanted[ws.URL] = true
+
+		cur, ok := existing[p.state.Webhooks[ws.URL]]
+		if !ok {
+			matches := byURL[ws.URL]
+			if len(matches) > 1 {
+				return fmt.Errorf("provision: %d webhooks exist for %s", len(matches), ws.URL)
+			}
+			if len(matches) == 1 {
+				cur, ok = matches[0], true
+				u, id := ws.URL, cur.ID
+				p.adopt(func(st *State) { st.Webhooks[u] = id })
+			}
+		}
+		if ok {
+			var details []string
+			if !sameEvents(cur.Events, ws.Events) {
+				details = append(details, fmt.Sprintf("events %s -> %s", strings.Join(cur.Events, ","), strings.Join(ws.Events, ",")))
+			}
+			if cur.APIVersion != ws.APIVersion {
+				details = append(details, fmt.Sprintf("api_version %d -> %d", cur.APIVersion, ws.APIVersion))
+			}
+			if len(details) > 0 {
+				id := cur.ID
+				p.add(Change{
+					Action:   Update,
+					Resource: "webhook",
+					Name:     ws.URL,
+					Details:  details,
+					apply: func(ctx context.Context, st *State) error {
+						return p.dev.Webhooks.Update(id, ws.APIVersion, ws.URL, ws.Events).Context(ctx).Send()
+					},
+				})
+			}
+			continue
+		}
+
+		p.add(Change{
+			Action:   Create,
+			Resource: "webhook",
+			Name:     ws.URL,
+			Details:  []string{"events " + strings.Join(ws.Events, ",")},
+			apply: func(ctx context.Context, st *State) error {
+				id, err := p.dev.Webhooks.Create(ws.APIVersion, ws.URL, ws.Events).Context(ctx).Send()
+				if err != nil {
+					return err
+				}
+				st.Webhooks[ws.URL] = id
+				return nil
+			},
+		})
+	}
+
+	for _, u := range sortedKeys(p.state.Webhooks) {
+		if wanted[u] {
+			continue
+		}
+		u, id := u, p.state.Webhooks[u]
+		if _, ok := existing[id]; !ok {
+			// Already gone, only the state needs updating.
+			p.add(Change{Action: Delete, Resource: "webhook", Name: u, apply: func(ctx context.Context, st *State) error {
+				delete(st.Webhooks, u)
+				return nil
+			}})
+			continue
+		}
+		p.add(Change{
+			Action:   Delete,
+			Resource: "webhook",
+			Name:     u,
+			apply: func(ctx context.Context, st *State) error {
+				if err := p.dev.Webhooks.Delete(id).Context(ctx).Send(); err != nil && !isNotFound(err) {
+					return err
+				}
+				delete(st.Webhooks, u)
+				return nil
+			},
+		})
+	}
+	return nil
+}
+
+// Empty reports whether the plan makes no changes.
+func (p *Plan) Empty() bool {
+	return len(p.Changes) == 0
+}
+
+// WriteDiff writes a line for every change, followed by indented details, to
+// w. Secret values are never written.
+func (p *Plan) WriteDiff(w io.Writer) error {
+	if p.Empty() {
+		_, err := fmt.Fprintln(w, "no changes")
+		return err
+	}
+	for _, c := range p.Changes {
+		if _, err := fmt.Fprintln(w, c); err != nil {
+			return err
+		}
+		for _, d := range c.Details {
+			if _, err := fmt.Fprintf(w, "    %s\n", d); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Apply records the adopted resources in the state, makes the changes of the
+// plan in order and returns the updated state. If a change fails, the state
+// reflects the changes made so far and should still be saved.
+func (p *Plan) Apply(ctx context.Context) (*State, error) {
+	for _, adopt := range p.adopted {
+		adopt(p.state)
+	}
+	for _, c := range p.Changes {
+		if err := c.apply(ctx, p.state); err != nil {
+			return p.state, fmt.Errorf("provision: %s: %v", c, err)
+		}
+	}
+	return p.state, nil
+}
+
+// diffKeys describes the differences between the current and wanted keys of
+// a credential by name only.
+func diffKeys(current, wanted map[string]string) []string {
+	var details []string
+	for _, k := range sortedKeys(wanted) {
+		v, ok := current[k]
+		switch {
+		case !ok:
+			details = append(details, "key "+k+" added")
+		case v != wanted[k]:
+			details = append(details, "key "+k+" changed")
+		}
+	}
+	for _, k := range sortedKeys(current) {
+		if _, ok := wanted[k]; !ok {
+			details = append(details, "key "+k+" removed")
+		}
+	}
+	return details
+}
+
+func sameEvents(a, b []string) bool {
+	a, b = append([]string(nil), a...), append([]string(nil), b...)
+	sort.Strings(a)
+	sort.Strings(b)
+	if len(a) == 0 && len(b) == 0 {
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func isNotFound(err error) bool {
+	serr, ok := err.(*bosgo.Error)
+	return ok && serr.StatusCode == http.StatusNotFound
+}
@@ -0,0 +1,390 @@
+// Copyright 2017 Bankrs AG.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provision
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"code.bankrs.com/bosgo"
+)
+
+// devAPI is an in-memory implementation of the developer endpoints used by
+// the provisioner.
+type devAPI struct {
+	mu       sync.Mutex
+	nextID   int
+	apps     map[string]*bosgo.ApplicationMetadata
+	settings map[string]bosgo.ApplicationSettings
+	keys     map[string][]bosgo.ApplicationKey
+	creds    map[string]*bosgo.Credential
+	credApps map[string]string // Application ids by credential id
+	webhooks map[string]*bosgo.Webhook
+	writes   int
+}
+
+func newDevAPI() *devAPI {
+	return &devAPI{
+		apps:     map[string]*bosgo.ApplicationMetadata{},
+		settings: map[string]bosgo.ApplicationSettings{},
+		keys:     map[string][]bosgo.ApplicationKey{},
+		creds:    map[string]*bosgo.Credential{},
+		credApps: map[string]string{},
+		webhooks: map[string]*bosgo.Webhook{},
+	}
+}
+
+func (a *devAPI) id(prefix string) string {
+	a.nextID++
+	return fmt.Sprintf("%s%d", prefix, a.nextID)
+}
+
+func (a *devAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if r.Method != http.MethodGet {
+		a.writes++
+	}
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")[1:]
+	var body map[string]interface{}
+	json.NewDecoder(r.Body).Decode(&body)
+	reply := func(v interface{}) { json.NewEncoder(w).Encode(v) }
+	str := func(k string) string { s, _ := body[k].(string); return s }
+	strs := func(k string) []string {
+		var out []string
+		for _, v := range body[k].([]interface{}) {
+			out = append(out, v.(string))
+		}
+		return out
+	}
+	keys := func() map[string]string {
+		m := map[string]string{}
+		for k, v := range body["keys"].(map[string]interface{}) {
+			m[k] = v.(string)
+		}
+		return m
+	}
+
+	switch {
+	case len(parts) == 2 && parts[1] == "applications" && r.Method == http.MethodGet:
+		apps := []bosgo.ApplicationMetadata{}
+		for _, app := range a.apps {
+			apps = append(apps, *app)
+		}
+		reply(apps)
+	case len(parts) == 2 && parts[1] == "applications":
+		app := &bosgo.ApplicationMetadata{ApplicationID: a.id("app"), Label: str("label")}
+		a.apps[app.ApplicationID] = app
+		reply(app)
+	case len(parts) == 3 && parts[1] == "applications":
+		a.apps[parts[2]].Label = str("label")
+	case len(parts) == 4 && parts[3] == "settings":
+		s := a.settings[parts[2]]
+		if r.Method == http.MethodPut {
+			s.BackgroundRefresh = body["background_refresh"].(bool)
+			a.settings[parts[2]] = s
+		}
+		reply(s)
+	case len(parts) == 4 && parts[3] == "keys" && r.Method == http.MethodGet:
+		reply(a.keys[parts[2]])
+	case len(parts) == 4 && parts[3] == "keys":
+		k := bosgo.ApplicationKey{Key: a.id("key")}
+		a.keys[parts[2]] = append(a.keys[parts[2]], k)
+		reply(k)
+	case len(parts) == 4 && parts[3] == "credentials" && r.Method == http.MethodGet:
+		entries := []bosgo.CredentialEntry{}
+		for _, c := range a.creds {
+			if a.credApps[c.ID] == parts[2] {
+				entries = append(entries, bosgo.CredentialEntry{ID: c.ID, Provider: c.Provider})
+			}
+		}
+		reply(entries)
+	case len(parts) == 4 && parts[3] == "credentials":
+		c := &bosgo.Credential{ID: a.id("cred"), Provider: str("provider"), Credentials: keys()}
+		a.creds[c.ID] = c
+		a.credApps[c.ID] = parts[2]
+		reply(map[string]string{"id": c.ID})
+	case len(parts) == 3 && parts[1] == "credentials":
+		c, ok := a.creds[parts[2]]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			reply(c)
+		case http.MethodPut:
+			c.Credentials = keys()
+		case http.MethodDelete:
+			delete(a.creds, c.ID)
+		}
+	case parts[0] == "webhooks" && len(parts) == 1 && r.Method == http.MethodGet:
+		webhooks := []bosgo.Webhook{}
+		for _, wh := range a.webhooks {
+			webhooks = append(webhooks, *wh)
+		}
+		reply(webhooks)
+	case parts[0] == "webhooks" && len(parts) == 1:
+		wh := &bosgo.Webhook{ID: a.id("wh"), URL: str("url"), Events: strs("events"), APIVersion: int(body["api_version"].(float64))}
+		a.webhooks[wh.ID] = wh
+		reply(map[string]string{"id": wh.ID})
+	case parts[0] == "webhooks" && len(parts) == 2:
+		switch r.Method {
+		case http.MethodPut:
+			wh := a.webhooks[parts[1]]
+			wh.Events = strs("events")
+			wh.APIVersion = int(body["api_version"].(float64))
+		case http.MethodDelete:
+			delete(a.webhooks, parts[1])
+		}
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func startAPI(t *testing.T) (*bosgo.DevClient, *devAPI, func()) {
+	api := newDevAPI()
+	ts := httptest.NewTLSServer(api)
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("failed to parse server URL: %v", err)
+	}
+	return bosgo.NewDevClient(ts.Client(), u.Host, "devtoken"), api, ts.Close
+}
+
+const testSpec = `
+label: Budget app
+settings:
+  background_refresh: true
+keys: 2
+credentials:
+  - provider: figo
+    keys:
+      client_id: id
+      client_secret: secret
+webhooks:
+  - url: https://example.com/hook
+    events: [access.created, transfer.updated]
+`
+
+func plan(t *testing.T, dev *bosgo.DevClient, spec string, st *State) *Plan {
+	s, err := ReadSpec(strings.NewReader(spec), FormatYAML)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	p, err := NewPlan(context.Background(), dev, s, st)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return p
+}
+
+func diff(t *testing.T, p *Plan) string {
+	var buf bytes.Buffer
+	if err := p.WriteDiff(&buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return buf.String()
+}
+
+func TestApply(t *testing.T) {
+	dev, api, cleanup := startAPI(t)
+	defer cleanup()
+
+	st := &State{}
+	p := plan(t, dev, testSpec, st)
+	want := `+ application Budget app
+~ settings
+    background_refresh false -> true
++ key 1 of 2
++ key 2 of 2
++ credential figo
+    key client_id added
+    key client_secret added
++ webhook https://example.com/hook
+    events access.created,transfer.updated
+`
+	if got := diff(t, p); got != want {
+		t.Errorf("got diff\n%s\nwanted\n%s", got, want)
+	}
+
+	st, err := p.Apply(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(api.apps) != 1 || len(api.keys[st.ApplicationID]) != 2 || !api.settings[st.ApplicationID].BackgroundRefresh {
+		t.Errorf("application not provisioned: %+v", api)
+	}
+	if len(st.Credentials) != 1 || len(st.Webhooks) != 1 {
+		t.Errorf("got state %+v, wanted one credential and webhook", st)
+	}
+
+	// Applying the same spec again does nothing.
+	writes := api.writes
+	p = plan(t, dev, testSpec, st)
+	if !p.Empty() {
+		t.Errorf("got changes on second run:\n%s", diff(t, p))
+	}
+	if _, err := p.Apply(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if api.writes != writes {
+		t.Errorf("got %d writes on second run, wanted none", api.writes-writes)
+	}
+
+	changed := `
+label: Budget
+settings:
+  background_refresh: true
+keys: 2
+webhooks:
+  - url: https://example.com/hook
+    events: [transfer.updated]
+`
+	p = plan(t, dev, changed, st)
+	want = `~ application Budget
+    label "Budget app" -> "Budget"
+- credential figo
+~ webhook https://example.com/hook
+    events access.created,transfer.updated -> transfer.updated
+`
+	if got := diff(t, p); got != want {
+		t.Errorf("got diff\n%s\nwanted\n%s", got, want)
+	}
+	if _, err := p.Apply(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(api.creds) != 0 || len(st.Credentials) != 0 {
+		t.Errorf("credential was not deleted")
+	}
+	if p := plan(t, dev, changed, st); !p.Empty() {
+		t.Errorf("got changes after update:\n%s", diff(t, p))
+	}
+}
+
+func TestCredentialUpdate(t *testing.T) {
+	dev, api, cleanup := startAPI(t)
+	defer cleanup()
+
+	st, err := plan(t, dev, testSpec, nil).Apply(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	p := plan(t, dev, strings.Replace(testSpec, "client_secret: secret", "client_secret: rotated", 1), st)
+	want := "~ credential figo\n    key client_secret changed\n"
+	if got := diff(t, p); got != want {
+		t.Errorf("got diff\n%s\nwanted\n%s", got, want)
+	}
+	if strings.Contains(diff(t, p), "rotated") {
+		t.Errorf("diff contains secret values")
+	}
+	if _, err := p.Apply(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cred := api.creds[st.Credentials["figo"]]
+	if cred.Credentials["client_secret"] != "rotated" {
+		t.Errorf("got credentials %v, wanted rotated secret", cred.Credentials)
+	}
+}
+
+func TestAdoptExisting(t *testing.T) {
+	dev, api, cleanup := startAPI(t)
+	defer cleanup()
+	api.apps["app9"] = &bosgo.ApplicationMetadata{ApplicationID: "app9", Label: "Budget app"}
+
+	api.keys["app9"] = []bosgo.ApplicationKey{{Key: "key1"}, {Key: "key2"}}
+	api.settings["app9"] = bosgo.ApplicationSettings{BackgroundRefresh: true}
+	api.creds["cred1"] = &bosgo.Credential{ID: "cred1", Provider: "figo", Credentials: map[string]string{"client_id": "id", "client_secret": "old"}}
+	api.credApps["cred1"] = "app9"
+	api.webhooks["wh1"] = &bosgo.Webhook{ID: "wh1", URL: "https://example.com/hook", Events: []string{"access.created", "transfer.updated"}, APIVersion: DefaultAPIVersion}
+
+	st := &State{}
+	p := plan(t, dev, testSpec, st)
+	want := "~ credential figo\n    key client_secret changed\n"
+	if got := diff(t, p); got != want {
+		t.Errorf("got diff\n%s\nwanted\n%s", got, want)
+	}
+	if st.ApplicationID != "" || len(st.Credentials) != 0 || len(st.Webhooks) != 0 {
+		t.Errorf("planning changed the state: %+v", st)
+	}
+
+	if _, err := p.Apply(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if st.ApplicationID != "app9" || st.Credentials["figo"] != "cred1" || st.Webhooks["https://example.com/hook"] != "wh1" {
+		t.Errorf("got state %+v, wanted adopted resources", st)
+	}
+	if len(api.apps) != 1 || len(api.creds) != 1 || len(api.webhooks) != 1 {
+		t.Errorf("got %d applications, %d credentials and %d webhooks, wanted one each", len(api.apps), len(api.creds), len(api.webhooks))
+	}
+	if p := plan(t, dev, testSpec, st); !p.Empty() {
+		t.Errorf("got changes after adoption:\n%s", diff(t, p))
+	}
+}
+
+func TestSpecValidation(t *testing.T) {
+	testCases := []string{
+		"keys: 1\n",
+		"label: x\nunknown: 1\n",
+		"label: x\ncredentials:\n  - provider: a\n  - provider: a\n",
+		"label: x\nwebhooks:\n  - url: u\n  - url: u\n",
+	}
+	for _, tc := range testCases {
+		if _, err := ReadSpec(strings.NewReader(tc), FormatYAML); err == nil {
+			t.Errorf("%q: got nil error, wanted non-nil", tc)
+		}
+	}
+}
+
+func TestState(t *testing.T) {
+	dir, err := ioutil.TempDir("", "provision")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "state.json")
+
+	st, err := LoadState(filename)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	st.ApplicationID = "app1"
+	st.Webhooks["https://example.com/hook"] = "wh1"
+	if err := SaveState(filename, st); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	loaded, err := LoadState(filename)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(loaded, st) {
+		t.Errorf("got state %+v, wanted %+v", loaded, st)
+	}
+}
@@ -0,0 +1,189 @@
+// Copyright 2017 Bankrs AG.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package provision creates and updates Bankrs applications from a
+// declarative specification. A spec is compared with the current state of the
+// application to produce a plan, which can be shown as a diff and then
+// applied. The ids of the resources created are recorded in a State so that
+// applying the same spec again makes no changes.
+package provision
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Spec describes the desired configuration of an application.
+type Spec struct {
+	Label       string           `json:"label" yaml:"label"`
+	Settings    *Settings        `json:"settings,omitempty" yaml:"settings,omitempty"`
+	Keys        int              `json:"keys,omitempty" yaml:"keys,omitempty"` // Minimum number of application keys
+	Credentials []CredentialSpec `json:"credentials,omitempty" yaml:"credentials,omitempty"`
+	Webhooks    []WebhookSpec    `json:"webhooks,omitempty" yaml:"webhooks,omitempty"`
+}
+
+// Settings are the application settings to enforce. Settings left unset are
+// not changed.
+type Settings struct {
+	BackgroundRefresh *bool `json:"background_refresh,omitempty" yaml:"background_refresh,omitempty"`
+}
+
+// CredentialSpec holds the keys of the credentials for a provider.
+type CredentialSpec struct {
+	Provider string            `json:"provider" yaml:"provider"`
+	Keys     map[string]string `json:"keys" yaml:"keys"`
+}
+
+// WebhookSpec describes a webhook. Webhooks are identified by their URL.
+type WebhookSpec struct {
+	URL        string   `json:"url" yaml:"url"`
+	Events     []string `json:"events" yaml:"events"`
+	APIVersion int      `json:"api_version,omitempty" yaml:"api_version,omitempty"`
+}
+
+// DefaultAPIVersion is the API version of webhooks whose spec does not name
+// one.
+const DefaultAPIVersion = 1
+
+// Validate checks the spec for missing and duplicate entries.
+func (s *Spec) Validate() error {
+	if s.Label == "" {
+		return fmt.Errorf("provision: spec has no label")
+	}
+	if s.Keys < 0 {
+		return fmt.Errorf("provision: negative number of keys")
+	}
+	providers := map[string]bool{}
+	for _, c := range s.Credentials {
+		if c.Provider == "" {
+			return fmt.Errorf("provision: credential without provider")
+		}
+		if providers[c.Provider] {
+			return fmt.Errorf("provision: duplicate credentials for provider %s", c.Provider)
+		}
+		providers[c.Provider] = true
+	}
+	urls := map[string]bool{}
+	for _, w := range s.Webhooks {
+		if w.URL == "" {
+			return fmt.Errorf("provision: webhook without url")
+		}
+		if urls[w.URL] {
+			return fmt.Errorf("provision: duplicate webhook %s", w.URL)
+		}
+		urls[w.URL] = true
+	}
+	return nil
+}
+
+// Format is the encoding of a spec.
+type Format string
+
+const (
+	FormatJSON Format = "json"
+	FormatYAML Format = "yaml"
+)
+
+// ReadSpec reads and validates a spec from r. Unknown fields are rejected.
+func ReadSpec(r io.Reader, format Format) (*Spec, error) {
+	var s Spec
+	switch format {
+	case FormatJSON:
+		dec := json.NewDecoder(r)
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&s); err != nil {
+			return nil, fmt.Errorf("provision: failed to parse spec: %v", err)
+		}
+	case FormatYAML:
+		dec := yaml.NewDecoder(r)
+		dec.KnownFields(true)
+		if err := dec.Decode(&s); err != nil {
+			return nil, fmt.Errorf("provision: failed to parse spec: %v", err)
+		}
+	default:
+		return nil, fmt.Errorf("provision: unsupported spec format %q", format)
+	}
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// LoadSpec reads a spec from the named file. Files with a .yaml or .yml
+// extension are read as YAML, all others as JSON.
+func LoadSpec(filename string) (*Spec, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	format := FormatJSON
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".yaml", ".yml":
+		format = FormatYAML
+	}
+	return ReadSpec(f, format)
+}
+
+// State records the ids of the resources managed for a spec.
+type State struct {
+	ApplicationID string            `json:"application_id,omitempty"`
+	Credentials   map[string]string `json:"credentials,omitempty"` // Credential ids by provider
+	Webhooks      map[string]string `json:"webhooks,omitempty"`    // Webhook ids by URL
+}
+
+func (st *State) init() {
+	if st.Credentials == nil {
+		st.Credentials = map[string]string{}
+	}
+	if st.Webhooks == nil {
+		st.Webhooks = map[string]string{}
+	}
+}
+
+// LoadState reads the state from the named file. A missing file yields an
+// empty state.
+func LoadState(filename string) (*State, error) {
+	st := &State{}
+	data, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		st.init()
+		return st, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, st); err != nil {
+		return nil, fmt.Errorf("provision: invalid state in %s: %v", filename, err)
+	}
+	st.init()
+	return st, nil
+}
+
+// SaveState writes the state to the named file.
+func SaveState(filename string, st *State) error {
+	data, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, append(data, '\n'), 0600)
+}
@@ -0,0 +1,419 @@
+// Copyright 2017 Bankrs AG.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package recurring detects recurring payments such as subscriptions, rents
+// and salaries in a user's transaction history.
+package recurring
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"code.bankrs.com/bosgo"
+	"code.bankrs.com/bosgo/internal/money"
+)
+
+// Default values used when the corresponding Options field is zero.
+const (
+	DefaultAmountTolerance = 0.1
+	DefaultMinOccurrences  = 3
+	DefaultMinConfidence   = 0.5
+)
+
+// Options control the detection of recurring series.
+type Options struct {
+	// AmountTolerance is the relative deviation from the typical amount of a
+	// series that a transaction may have and still belong to it.
+	AmountTolerance float64
+
+	// MinOccurrences is the number of transactions needed to form a series.
+	MinOccurrences int
+
+	// MinConfidence is the confidence below which series are discarded.
+	MinConfidence float64
+
+	// Now is used to decide whether a series has ended. If it is zero, series
+	// are assumed to be ongoing.
+	Now time.Time
+}
+
+// Series is a set of transactions that recur with a regular interval and a
+// similar amount.
+type Series struct {
+	AccountID    int64
+	Counterparty string
+	IBAN         string
+	Amount       bosgo.MoneyAmount // Median amount of the transactions
+	Rule         bosgo.RecurrenceRule
+	Next         time.Time // Expected date of the next transaction, zero if ended
+	Confidence   float64   // Between 0 and 1
+
+	// Transactions belonging to the series, ordered by date.
+	Transactions []bosgo.Transaction
+
+	// Known is the repeated transaction reported by the bank that
+	// corresponds to the series, if any.
+	Known *bosgo.RepeatedTransaction
+
+	party string // counterparty key the transactions were grouped by
+}
+
+// period is a candidate recurrence interval.
+type period struct {
+	frequency bosgo.Frequency
+	interval  int
+	days      float64 // nominal length in days
+	tolerance float64 // allowed deviation in days
+}
+
+var periods = []period{
+	{frequency: bosgo.FrequencyDaily, interval: 1, days: 1, tolerance: 0},
+	{frequency: bosgo.FrequencyWeekly, interval: 1, days: 7, tolerance: 1},
+	{frequency: bosgo.FrequencyWeekly, interval: 2, days: 14, tolerance: 2},
+	{frequency: bosgo.FrequencyMonthly, interval: 1, days: 30.44, tolerance: 4},
+	{frequency: bosgo.FrequencyMonthly, interval: 2, days: 60.88, tolerance: 6},
+	{frequency: bosgo.FrequencyMonthly, interval: 3, days: 91.31, tolerance: 8},
+	{frequency: bosgo.FrequencyMonthly, interval: 6, days: 182.62, tolerance: 12},
+	{frequency: bosgo.FrequencyYearly, interval: 1, days: 365.25, tolerance: 15},
+}
+
+// next returns the date one period after t.
+func (p period) next(t time.Time) time.Time {
+	switch p.frequency {
+	case bosgo.FrequencyDaily:
+		return t.AddDate(0, 0, p.interval)
+	case bosgo.FrequencyWeekly:
+		return t.AddDate(0, 0, 7*p.interval)
+	case bosgo.FrequencyMonthly:
+		return t.AddDate(0, p.interval, 0)
+	}
+	return t.AddDate(p.interval, 0, 0)
+}
+
+// entry is a transaction with its parsed amount, date and counterparty key.
+type entry struct {
+	tx     bosgo.Transaction
+	amount money.Amount
+	date   time.Time
+	party  string
+}
+
+// Detect finds recurring series in txs. Transactions are grouped by account,
+// counterparty, currency and direction and then split into clusters of
+// similar amounts. Clusters whose dates follow a regular interval become
+// series. Series that correspond to one of the known repeated transactions
+// have their Known field set. The result is ordered by descending confidence.
+func Detect(txs []bosgo.Transaction, known []bosgo.RepeatedTransaction, opts Options) []Series {
+	if opts.AmountTolerance <= 0 {
+		opts.AmountTolerance = DefaultAmountTolerance
+	}
+	if opts.MinOccurrences <= 0 {
+		opts.MinOccurrences = DefaultMinOccurrences
+	}
+	if opts.MinConfidence <= 0 {
+		opts.MinConfidence = DefaultMinConfidence
+	}
+
+	groups := map[string][]entry{}
+	var keys []string
+	for _, tx := range txs {
+		if tx.Amount == nil {
+			continue
+		}
+		amt, err := money.Parse(tx.Amount.Value)
+		if err != nil || amt == 0 {
+			continue
+		}
+		date := tx.EntryDate
+		if date.IsZero() {
+			date = tx.SettlementDate
+		}
+		party := counterpartyKey(tx)
+		if date.IsZero() || party == "" {
+			continue
+		}
+
+		key := strings.Join([]string{strconv.FormatInt(tx.UserAccountID, 10), party, tx.Amount.Currency, strconv.Itoa(amt.Sign())}, "|")
+		if _, exists := groups[key]; !exists {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], entry{tx: tx, amount: amt, date: date, party: party})
+	}
+
+	var series []Series
+	for _, key := range keys {
+		for _, cluster := range clusterAmounts(groups[key], opts.AmountTolerance) {
+			if len(cluster) < opts.MinOccurrences {
+				continue
+			}
+			s, ok := analyse(cluster, opts)
+			if !ok {
+				continue
+			}
+			s.Known = match(s, known, opts.AmountTolerance)
+			series = append(series, s)
+		}
+	}
+
+	sort.SliceStable(series, func(i, j int) bool {
+		return series[i].Confidence > series[j].Confidence
+	})
+	return series
+}
+
+// counterpartyKey identifies the counterparty of a transaction by IBAN,
+// merchant or name, in that order of preference.
+func counterpartyKey(tx bosgo.Transaction) string {
+	if iban := compact(tx.Counterparty.Account.IBAN); iban != "" {
+		return "iban:" + iban
+	}
+	if tx.Counterparty.Merchant != nil {
+		if name := normalise(tx.Counterparty.Merchant.Name); name != "" {
+			return "merchant:" + name
+		}
+	}
+	if name := normalise(tx.Counterparty.Name); name != "" {
+		return "name:" + name
+	}
+	return ""
+}
+
+// clusterAmounts splits entries into groups whose absolute amounts exceed the
+// smallest amount in the group by at most twice the relative tolerance, so
+// that every amount lies within the tolerance of the group's centre. Each
+// group is returned ordered by date.
+func clusterAmounts(entries []entry, tolerance float64) [][]entry {
+	sorted := append([]entry{}, entries...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].amount.Abs() < sorted[j].amount.Abs() })
+
+	var clusters [][]entry
+	var cur []entry
+	var base float64
+	for _, e := range sorted {
+		v := e.amount.Abs().Float64()
+		if len(cur) > 0 && v > base*(1+2*tolerance) {
+			clusters = append(clusters, cur)
+			cur = nil
+		}
+		if len(cur) == 0 {
+			base = v
+		}
+		cur = append(cur, e)
+	}
+	if len(cur) > 0 {
+		clusters = append(clusters, cur)
+	}
+
+	for _, c := range clusters {
+		sort.SliceStable(c, func(i, j int) bool { return c[i].date.Before(c[j].date) })
+	}
+	return clusters
+}
+
+// analyse determines the recurrence of a cluster of transactions ordered by
+// date and scores how regular it is. Transactions on the same day count as a
+// single occurrence.
+func analyse(entries []entry, opts Options) (Series, bool) {
+	var intervals []float64
+	prev := entries[0].date
+	for _, e := range entries[1:] {
+		days := e.date.Sub(prev).Hours() / 24
+		if days < 0.5 {
+			continue
+		}
+		intervals = append(intervals, days)
+		prev = e.date
+	}
+	occurrences := len(intervals) + 1
+	if occurrences < opts.MinOccurrences {
+		return Series{}, false
+	}
+
+	typical := median(intervals)
+	best := periods[0]
+	for _, p := range periods[1:] {
+		if math.Abs(p.days-typical) < math.Abs(best.days-typical) {
+			best = p
+		}
+	}
+	if math.Abs(best.days-typical) > best.tolerance+0.5 {
+		return Series{}, false
+	}
+
+	regular := 0
+	for _, d := range intervals {
+		if math.Abs(d-best.days) <= best.tolerance+0.5 {
+			regular++
+		}
+	}
+	regularity := float64(regular) / float64(len(intervals))
+
+	typicalAmount := medianAmount(entries)
+	var deviation float64
+	for _, e := range entries {
+		deviation += (e.amount - typicalAmount).Abs().Float64()
+	}
+	deviation /= float64(len(entries)) * typicalAmount.Abs().Float64()
+	consistency := math.Max(0, 1-deviation/opts.AmountTolerance/2)
+	support := 1 - math.Pow(0.5, float64(occurrences-1))
+
+	confidence := regularity * consistency * support
+	if confidence < opts.MinConfidence {
+		return Series{}, false
+	}
+
+	first, last := entries[0], entries[len(entries)-1]
+	s := Series{
+		AccountID:    first.tx.UserAccountID,
+		Counterparty: counterpartyName(last.tx),
+		IBAN:         compact(last.tx.Counterparty.Account.IBAN),
+		Amount: bosgo.MoneyAmount{
+			Currency: first.tx.Amount.Currency,
+			Value:    typicalAmount.Round(2).String(),
+		},
+		Rule: bosgo.RecurrenceRule{
+			Start:     first.date,
+			Frequency: best.frequency,
+			Interval:  best.interval,
+			ByDay:     byDay(entries, best),
+		},
+		Confidence: math.Round(confidence*1000) / 1000,
+		party:      first.party,
+	}
+	for _, e := range entries {
+		s.Transactions = append(s.Transactions, e.tx)
+	}
+
+	next := best.next(last.date)
+	if !opts.Now.IsZero() && opts.Now.Sub(next).Hours()/24 > best.days+best.tolerance {
+		// At least one expected transaction is missing, so the series is
+		// considered to have ended.
+		s.Rule.Until = last.date
+	} else {
+		s.Next = next
+	}
+	return s, true
+}
+
+// byDay returns the most common day of the month for monthly and yearly
+// series and the most common weekday, with Sunday as 0, for weekly series.
+func byDay(entries []entry, p period) int {
+	counts := map[int]int{}
+	for _, e := range entries {
+		switch p.frequency {
+		case bosgo.FrequencyMonthly, bosgo.FrequencyYearly:
+			counts[e.date.Day()]++
+		case bosgo.FrequencyWeekly:
+			counts[int(e.date.Weekday())]++
+		}
+	}
+	day, best := 0, 0
+	for d, n := range counts {
+		if n > best || (n == best && d < day) {
+			day, best = d, n
+		}
+	}
+	return day
+}
+
+// match returns the known repeated transaction corresponding to the series.
+func match(s Series, known []bosgo.RepeatedTransaction, tolerance float64) *bosgo.RepeatedTransaction {
+	want, err := money.Parse(s.Amount.Value)
+	if err != nil {
+		return nil
+	}
+	for i := range known {
+		rt := &known[i]
+		if rt.UserAccountID != 0 && s.AccountID != 0 && rt.UserAccountID != s.AccountID {
+			continue
+		}
+		if !sameCounterparty(s, rt) {
+			continue
+		}
+		if rt.Schedule.Frequency != "" && rt.Schedule.Frequency != s.Rule.Frequency {
+			continue
+		}
+		if rt.Amount == nil || rt.Amount.Currency != s.Amount.Currency {
+			continue
+		}
+		amt, err := money.Parse(rt.Amount.Value)
+		if err != nil || amt.Sign() != want.Sign() {
+			continue
+		}
+		if math.Abs(amt.Float64()-want.Float64()) > tolerance*math.Abs(want.Float64()) {
+			continue
+		}
+		return rt
+	}
+	return nil
+}
+
+// sameCounterparty reports whether the repeated transaction is made with the
+// counterparty of the series. Without an IBAN on both sides the label of the
+// remote account is compared to the merchant or name the series was grouped
+// by.
+func sameCounterparty(s Series, rt *bosgo.RepeatedTransaction) bool {
+	if iban := compact(rt.RemoteAccount.IBAN); iban != "" && s.IBAN != "" {
+		return iban == s.IBAN
+	}
+	label := normalise(rt.RemoteAccount.Label)
+	if label == "" {
+		return false
+	}
+	return s.party == "merchant:"+label || s.party == "name:"+label || normalise(s.Counterparty) == label
+}
+
+func counterpartyName(tx bosgo.Transaction) string {
+	if tx.Counterparty.Merchant != nil && strings.TrimSpace(tx.Counterparty.Merchant.Name) != "" {
+		return strings.TrimSpace(tx.Counterparty.Merchant.Name)
+	}
+	return strings.TrimSpace(tx.Counterparty.Name)
+}
+
+func median(vs []float64) float64 {
+	sorted := append([]float64{}, vs...)
+	sort.Float64s(sorted)
+	n := len(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
+
+// medianAmount returns the median amount of entries.
+func medianAmount(entries []entry) money.Amount {
+	amounts := make([]money.Amount, len(entries))
+	for i, e := range entries {
+		amounts[i] = e.amount
+	}
+	sort.Slice(amounts, func(i, j int) bool { return amounts[i] < amounts[j] })
+	n := len(amounts)
+	if n%2 == 1 {
+		return amounts[n/2]
+	}
+	return (amounts[n/2-1] + amounts[n/2]) / 2
+}
+
+// normalise lower cases a name and collapses white space so that minor
+// variations in the spelling of a counterparty are ignored.
+func normalise(name string) string {
+	return strings.Join(strings.Fields(strings.ToLower(name)), " ")
+}
+
+func compact(iban string) string {
+	return strings.ToUpper(strings.Replace(iban, " ", "", -1))
+}
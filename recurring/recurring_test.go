@@ -0,0 +1,199 @@
+// Copyright 2017 Bankrs AG.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package recurring
+
+import (
+	"testing"
+	"time"
+
+	"code.bankrs.com/bosgo"
+)
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+func tx(id int64, d time.Time, amount string, name string, iban string) bosgo.Transaction {
+	return bosgo.Transaction{
+		ID:            id,
+		UserAccountID: 1,
+		EntryDate:     d,
+		Amount:        &bosgo.MoneyAmount{Currency: "EUR", Value: amount},
+		Counterparty: bosgo.Counterparty{
+			Name:    name,
+			Account: bosgo.AccountRef{IBAN: iban},
+		},
+	}
+}
+
+func testTransactions() []bosgo.Transaction {
+	var txs []bosgo.Transaction
+	id := int64(0)
+	add := func(t bosgo.Transaction) {
+		id++
+		t.ID = id
+		txs = append(txs, t)
+	}
+
+	// Monthly rent on the first, one payment a few days late.
+	for m := time.January; m <= time.June; m++ {
+		d := date(2017, m, 1)
+		if m == time.March {
+			d = date(2017, m, 3)
+		}
+		add(tx(0, d, "-850.00", "Vermieter", "DE56200800950445688921"))
+	}
+
+	// Weekly streaming subscription paid by card with a varying amount.
+	for i, amt := range []string{"-9.99", "-9.99", "-10.49", "-9.99", "-9.99"} {
+		t := tx(0, date(2017, 5, 5).AddDate(0, 0, 7*i), amt, "", "")
+		t.Counterparty.Merchant = &bosgo.Merchant{Name: "Streamly"}
+		add(t)
+	}
+
+	// Irregular shopping at the same merchant.
+	for _, d := range []time.Time{date(2017, 1, 3), date(2017, 1, 20), date(2017, 3, 2), date(2017, 3, 4), date(2017, 6, 11)} {
+		t := tx(0, d, "-42.00", "", "")
+		t.Counterparty.Merchant = &bosgo.Merchant{Name: "Supermarkt"}
+		add(t)
+	}
+
+	// Gym membership that was cancelled in March.
+	for m := time.January; m <= time.March; m++ {
+		add(tx(0, date(2017, m, 15), "-29.90", "Fitness GmbH", "DE84200700245353762745"))
+	}
+
+	return txs
+}
+
+func TestDetect(t *testing.T) {
+	known := []bosgo.RepeatedTransaction{
+		{
+			ID:            100,
+			UserAccountID: 1,
+			RemoteAccount: bosgo.AccountRef{IBAN: "DE56 2008 0095 0445 6889 21"},
+			Amount:        &bosgo.MoneyAmount{Currency: "EUR", Value: "-850.00"},
+			Schedule:      bosgo.RecurrenceRule{Frequency: bosgo.FrequencyMonthly, Interval: 1},
+		},
+	}
+
+	series := Detect(testTransactions(), known, Options{Now: date(2017, 6, 20)})
+	if len(series) != 3 {
+		for _, s := range series {
+			t.Logf("%s %s %s/%d %.3f", s.Counterparty, s.Amount.Value, s.Rule.Frequency, s.Rule.Interval, s.Confidence)
+		}
+		t.Fatalf("got %d series, wanted 3", len(series))
+	}
+
+	byName := map[string]Series{}
+	for _, s := range series {
+		byName[s.Counterparty] = s
+	}
+
+	rent := byName["Vermieter"]
+	if rent.Rule.Frequency != bosgo.FrequencyMonthly || rent.Rule.Interval != 1 || rent.Rule.ByDay != 1 {
+		t.Errorf("got rent rule %+v, wanted monthly on the first", rent.Rule)
+	}
+	if len(rent.Transactions) != 6 {
+		t.Errorf("got %d rent transactions, wanted 6", len(rent.Transactions))
+	}
+	if rent.Amount.Value != "-850.00" {
+		t.Errorf("got rent amount %s, wanted -850.00", rent.Amount.Value)
+	}
+	if !rent.Next.Equal(date(2017, 7, 1)) {
+		t.Errorf("got next rent %s, wanted 2017-07-01", rent.Next)
+	}
+	if rent.Known == nil || rent.Known.ID != 100 {
+		t.Errorf("got known %+v, wanted repeated transaction 100", rent.Known)
+	}
+	if rent.Confidence <= byName["Fitness GmbH"].Confidence {
+		t.Errorf("got rent confidence %.3f, wanted more than gym %.3f", rent.Confidence, byName["Fitness GmbH"].Confidence)
+	}
+
+	stream := byName["Streamly"]
+	if stream.Rule.Frequency != bosgo.FrequencyWeekly || stream.Rule.ByDay != int(time.Friday) {
+		t.Errorf("got streaming rule %+v, wanted weekly on Friday", stream.Rule)
+	}
+	if stream.Known != nil {
+		t.Errorf("got known %+v for card payments, wanted none", stream.Known)
+	}
+	if stream.Confidence >= 1 || stream.Confidence < 0.5 {
+		t.Errorf("got streaming confidence %.3f, wanted between 0.5 and 1", stream.Confidence)
+	}
+
+	gym := byName["Fitness GmbH"]
+	if !gym.Rule.Until.Equal(date(2017, 3, 15)) || !gym.Next.IsZero() {
+		t.Errorf("got gym until %s next %s, wanted ended on 2017-03-15", gym.Rule.Until, gym.Next)
+	}
+}
+
+func TestDetectSeparatesAmounts(t *testing.T) {
+	var txs []bosgo.Transaction
+	for m := time.January; m <= time.April; m++ {
+		txs = append(txs, tx(int64(m), date(2017, m, 10), "-5.00", "Telco", "DE84200700245353762745"))
+		txs = append(txs, tx(int64(m)+10, date(2017, m, 20), "-40.00", "Telco", "DE84200700245353762745"))
+	}
+
+	series := Detect(txs, nil, Options{})
+	if len(series) != 2 {
+		t.Fatalf("got %d series, wanted 2", len(series))
+	}
+	for _, s := range series {
+		if len(s.Transactions) != 4 {
+			t.Errorf("got %d transactions in series of %s, wanted 4", len(s.Transactions), s.Amount.Value)
+		}
+	}
+}
+
+func TestDetectSameDay(t *testing.T) {
+	var txs []bosgo.Transaction
+	for m := time.January; m <= time.April; m++ {
+		txs = append(txs, tx(int64(m), date(2017, m, 10), "-15.00", "Telco", "DE84200700245353762745"))
+	}
+	// A correction booked on the day of a regular payment
+	txs = append(txs, tx(20, date(2017, 2, 10), "-15.50", "Telco", "DE84200700245353762745"))
+
+	series := Detect(txs, nil, Options{})
+	if len(series) != 1 {
+		t.Fatalf("got %d series, wanted 1", len(series))
+	}
+	if s := series[0]; s.Rule.Frequency != bosgo.FrequencyMonthly || len(s.Transactions) != 5 {
+		t.Errorf("got rule %+v with %d transactions, wanted monthly with 5", s.Rule, len(s.Transactions))
+	}
+}
+
+func TestDetectKnownWithoutIBAN(t *testing.T) {
+	var txs []bosgo.Transaction
+	for m := time.January; m <= time.April; m++ {
+		t := tx(int64(m), date(2017, m, 3), "-12.99", "", "")
+		t.Counterparty.Merchant = &bosgo.Merchant{Name: "Streamly"}
+		txs = append(txs, t)
+	}
+	known := []bosgo.RepeatedTransaction{
+		{
+			ID:            100,
+			RemoteAccount: bosgo.AccountRef{Label: "STREAMLY"},
+			Amount:        &bosgo.MoneyAmount{Currency: "EUR", Value: "-12.99"},
+		},
+	}
+
+	series := Detect(txs, known, Options{})
+	if len(series) != 1 {
+		t.Fatalf("got %d series, wanted 1", len(series))
+	}
+	if series[0].Known == nil || series[0].Known.ID != 100 {
+		t.Errorf("got known %+v, wanted repeated transaction 100", series[0].Known)
+	}
+}
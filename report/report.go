@@ -0,0 +1,412 @@
+// Copyright 2017 Bankrs AG.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package report aggregates transactions into income and expense summaries
+// grouped by category, merchant, account and period.
+package report
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"code.bankrs.com/bosgo"
+	"code.bankrs.com/bosgo/internal/money"
+)
+
+// Period is the length of the calendar periods transactions are grouped by.
+type Period string
+
+const (
+	PeriodDay     Period = "day"     // Keys like 2017-07-31
+	PeriodWeek    Period = "week"    // ISO weeks, keys like 2017-W31
+	PeriodMonth   Period = "month"   // Keys like 2017-07
+	PeriodQuarter Period = "quarter" // Keys like 2017-Q3
+	PeriodYear    Period = "year"    // Keys like 2017
+)
+
+// Key returns the key of the period containing t.
+func (p Period) Key(t time.Time) string {
+	switch p {
+	case PeriodDay:
+		return t.Format("2006-01-02")
+	case PeriodWeek:
+		y, w := t.ISOWeek()
+		return fmt.Sprintf("%04d-W%02d", y, w)
+	case PeriodQuarter:
+		return fmt.Sprintf("%04d-Q%d", t.Year(), (int(t.Month())+2)/3)
+	case PeriodYear:
+		return strconv.Itoa(t.Year())
+	}
+	return t.Format("2006-01")
+}
+
+// Dimension is an attribute transactions are grouped by.
+type Dimension string
+
+const (
+	DimensionCategoryGroup Dimension = "category_group"
+	DimensionCategory      Dimension = "category"
+	DimensionMerchant      Dimension = "merchant"
+	DimensionAccount       Dimension = "account"
+	DimensionPeriod        Dimension = "period"
+)
+
+var dimensions = []Dimension{DimensionCategoryGroup, DimensionCategory, DimensionMerchant, DimensionAccount, DimensionPeriod}
+
+// Options control how transactions are aggregated.
+type Options struct {
+	// Period is the length of the periods used for DimensionPeriod. It
+	// defaults to PeriodMonth.
+	Period Period
+
+	// Currency is the currency all amounts are converted to where possible.
+	// Transactions in another currency are converted using their original
+	// amount and exchange rate; those that cannot be converted are reported
+	// in a series of their own currency. If Currency is empty, every
+	// transaction is reported in the currency it was booked in.
+	Currency string
+
+	// Categories are used to find the group and name of a transaction's
+	// category, both in the given language.
+	Categories bosgo.CategoryList
+	Language   string
+
+	// Exclude, if set, is called for every transaction. Transactions for which
+	// it returns true, such as duplicates or internal transfers, are ignored.
+	Exclude func(bosgo.Transaction) bool
+}
+
+// Totals are the income and expenses of a set of transactions in one
+// currency. Expenses are reported as a positive value.
+type Totals struct {
+	Income   string
+	Expenses string
+	Net      string
+	Count    int
+
+	income, expenses money.Amount
+}
+
+func (t *Totals) add(amt money.Amount) {
+	if amt.Sign() < 0 {
+		t.expenses -= amt
+	} else {
+		t.income += amt
+	}
+	t.Count++
+	t.Income = t.income.String()
+	t.Expenses = t.expenses.String()
+	t.Net = (t.income - t.expenses).String()
+}
+
+// Entry holds the totals of the transactions sharing the same key in a
+// dimension. Transactions without a value for the dimension, such as
+// uncategorised transactions, have an empty key.
+type Entry struct {
+	Key string
+	Totals
+}
+
+// Series holds the totals of all transactions in one currency.
+type Series struct {
+	Currency string
+	Total    Totals
+
+	groups map[Dimension]map[string]*Entry
+}
+
+// Entries returns the entries of the dimension ordered by key.
+func (s *Series) Entries(dim Dimension) []Entry {
+	var es []Entry
+	for _, e := range s.groups[dim] {
+		es = append(es, *e)
+	}
+	sort.Slice(es, func(i, j int) bool { return es[i].Key < es[j].Key })
+	return es
+}
+
+// Entry returns the entry with the given key in the dimension.
+func (s *Series) Entry(dim Dimension, key string) (Entry, bool) {
+	e, ok := s.groups[dim][key]
+	if !ok {
+		return Entry{}, false
+	}
+	return *e, true
+}
+
+// Kind selects income or expenses.
+type Kind int
+
+const (
+	Expenses Kind = iota
+	Income
+)
+
+// Top returns up to n entries of the dimension with the highest expenses or
+// income, largest first. Entries without any income or expenses of the
+// requested kind are omitted. Ties are broken by key.
+func (s *Series) Top(dim Dimension, kind Kind, n int) []Entry {
+	value := func(e Entry) money.Amount {
+		if kind == Income {
+			return e.income
+		}
+		return e.expenses
+	}
+
+	var es []Entry
+	for _, e := range s.Entries(dim) {
+		if value(e) > 0 {
+			es = append(es, e)
+		}
+	}
+	sort.SliceStable(es, func(i, j int) bool { return value(es[i]) > value(es[j]) })
+	if n >= 0 && len(es) > n {
+		es = es[:n]
+	}
+	return es
+}
+
+// Report aggregates transactions into one series per currency. Transactions
+// are added with Add; the report may be inspected at any time.
+type Report struct {
+	opts    Options
+	groups  map[int64]string
+	names   map[int64]string
+	series  map[string]*Series
+	Skipped int // Transactions without a usable amount
+}
+
+// New returns an empty report.
+func New(opts Options) *Report {
+	if opts.Period == "" {
+		opts.Period = PeriodMonth
+	}
+	r := &Report{
+		opts:   opts,
+		groups: map[int64]string{},
+		names:  map[int64]string{},
+		series: map[string]*Series{},
+	}
+	for _, c := range opts.Categories {
+		r.groups[c.ID] = c.Group
+		r.names[c.ID] = c.Name(opts.Language)
+	}
+	return r
+}
+
+// Build returns a report of the given transactions.
+func Build(txs []bosgo.Transaction, opts Options) *Report {
+	r := New(opts)
+	for _, tx := range txs {
+		r.Add(tx)
+	}
+	return r
+}
+
+// Iterator is a source of transactions such as *bosgo.TransactionIterator.
+type Iterator interface {
+	Next() bool
+	Transaction() bosgo.Transaction
+	Err() error
+}
+
+// BuildIter returns a report of the transactions read from it.
+func BuildIter(it Iterator, opts Options) (*Report, error) {
+	r := New(opts)
+	for it.Next() {
+		r.Add(it.Transaction())
+	}
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Add adds a transaction to the report.
+func (r *Report) Add(tx bosgo.Transaction) {
+	if r.opts.Exclude != nil && r.opts.Exclude(tx) {
+		return
+	}
+	amt, currency, ok := r.convert(tx)
+	if !ok {
+		r.Skipped++
+		return
+	}
+
+	s, exists := r.series[currency]
+	if !exists {
+		s = &Series{Currency: currency, groups: map[Dimension]map[string]*Entry{}}
+		for _, dim := range dimensions {
+			s.groups[dim] = map[string]*Entry{}
+		}
+		r.series[currency] = s
+	}
+	s.Total.add(amt)
+
+	date := tx.EntryDate
+	if date.IsZero() {
+		date = tx.SettlementDate
+	}
+	var merchant, account, period string
+	if tx.Counterparty.Merchant != nil {
+		merchant = strings.TrimSpace(tx.Counterparty.Merchant.Name)
+	}
+	if tx.UserAccountID != 0 {
+		account = strconv.FormatInt(tx.UserAccountID, 10)
+	}
+	if !date.IsZero() {
+		period = r.opts.Period.Key(date)
+	}
+	keys := map[Dimension]string{
+		DimensionCategoryGroup: r.groups[tx.CategoryID],
+		DimensionCategory:      r.names[tx.CategoryID],
+		DimensionMerchant:      merchant,
+		DimensionAccount:       account,
+		DimensionPeriod:        period,
+	}
+	if keys[DimensionCategory] == "" && tx.CategoryID != 0 {
+		keys[DimensionCategory] = strconv.FormatInt(tx.CategoryID, 10)
+	}
+
+	for dim, key := range keys {
+		e, exists := s.groups[dim][key]
+		if !exists {
+			e = &Entry{Key: key}
+			s.groups[dim][key] = e
+		}
+		e.add(amt)
+	}
+}
+
+// convert returns the amount of tx in the report currency, or in its booked
+// currency if it cannot be converted.
+func (r *Report) convert(tx bosgo.Transaction) (money.Amount, string, bool) {
+	if tx.Amount == nil || tx.Amount.Currency == "" {
+		return 0, "", false
+	}
+	amt, err := money.Parse(tx.Amount.Value)
+	if err != nil {
+		return 0, "", false
+	}
+
+	target := r.opts.Currency
+	if target == "" || tx.Amount.Currency == target || tx.OriginalAmount == nil {
+		return amt, tx.Amount.Currency, true
+	}
+
+	orig := tx.OriginalAmount
+	if orig.Value != nil && orig.Value.Currency == target {
+		// The original amount is the booked amount times the exchange rate.
+		if v, err := amt.Mul(orig.ExchangeRate); err == nil && v.Sign() == amt.Sign() {
+			return v.Round(2), target, true
+		}
+		if v, err := money.Parse(orig.Value.Value); err == nil {
+			return v, target, true
+		}
+	}
+	return amt, tx.Amount.Currency, true
+}
+
+// Currencies returns the currencies of the report's series in alphabetical
+// order.
+func (r *Report) Currencies() []string {
+	var cs []string
+	for c := range r.series {
+		cs = append(cs, c)
+	}
+	sort.Strings(cs)
+	return cs
+}
+
+// Series returns the series of the given currency.
+func (r *Report) Series(currency string) (*Series, bool) {
+	s, ok := r.series[currency]
+	return s, ok
+}
+
+// A Budget provides the spending limits that reports are compared against.
+type Budget interface {
+	// Limit returns the maximum expenses for the key of a dimension in the
+	// given currency, and false if there is no limit.
+	Limit(dim Dimension, key string, currency string) (string, bool)
+}
+
+// BudgetFunc adapts an ordinary function to the Budget interface.
+type BudgetFunc func(dim Dimension, key string, currency string) (string, bool)
+
+// Limit calls f(dim, key, currency).
+func (f BudgetFunc) Limit(dim Dimension, key string, currency string) (string, bool) {
+	return f(dim, key, currency)
+}
+
+// Limits is a Budget with fixed limits per dimension and key that apply to
+// every currency.
+type Limits map[Dimension]map[string]string
+
+// Limit implements the Budget interface.
+func (l Limits) Limit(dim Dimension, key string, currency string) (string, bool) {
+	v, ok := l[dim][key]
+	return v, ok
+}
+
+// BudgetStatus compares the expenses of an entry with its budgeted limit.
+type BudgetStatus struct {
+	Dimension Dimension
+	Key       string
+	Currency  string
+	Limit     string
+	Spent     string
+	Remaining string  // Negative if the budget is exceeded
+	Used      float64 // Fraction of the limit spent
+	Exceeded  bool
+}
+
+// CompareBudget compares the expenses of every entry of the given dimensions
+// with the limits of the budget. Entries without a limit are omitted.
+// Statuses are ordered by currency, dimension and key.
+func (r *Report) CompareBudget(b Budget, dims ...Dimension) []BudgetStatus {
+	var statuses []BudgetStatus
+	for _, currency := range r.Currencies() {
+		s := r.series[currency]
+		for _, dim := range dims {
+			for _, e := range s.Entries(dim) {
+				v, ok := b.Limit(dim, e.Key, currency)
+				if !ok {
+					continue
+				}
+				limit, err := money.Parse(v)
+				if err != nil {
+					continue
+				}
+				st := BudgetStatus{
+					Dimension: dim,
+					Key:       e.Key,
+					Currency:  currency,
+					Limit:     limit.String(),
+					Spent:     e.expenses.String(),
+					Remaining: (limit - e.expenses).String(),
+					Exceeded:  e.expenses > limit,
+				}
+				if limit > 0 {
+					st.Used = e.expenses.Float64() / limit.Float64()
+				}
+				statuses = append(statuses, st)
+			}
+		}
+	}
+	return statuses
+}
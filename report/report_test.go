@@ -0,0 +1,173 @@
+// Copyright 2017 Bankrs AG.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package report
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"code.bankrs.com/bosgo"
+)
+
+var testCategories = bosgo.CategoryList{
+	{ID: 5, Names: map[string]string{"en": "Groceries", "de": "Lebensmittel"}, Group: "living"},
+	{ID: 6, Names: map[string]string{"en": "Rent"}, Group: "living"},
+	{ID: 7, Names: map[string]string{"en": "Salary"}, Group: "income"},
+	{ID: 8, Names: map[string]string{"en": "Travel"}, Group: "leisure"},
+}
+
+func eur(v string) *bosgo.MoneyAmount { return &bosgo.MoneyAmount{Currency: "EUR", Value: v} }
+
+func merchant(name string) bosgo.Counterparty {
+	return bosgo.Counterparty{Merchant: &bosgo.Merchant{Name: name}}
+}
+
+func testTransactions() []bosgo.Transaction {
+	d := func(m time.Month, day int) time.Time { return time.Date(2017, m, day, 0, 0, 0, 0, time.UTC) }
+	return []bosgo.Transaction{
+		{ID: 1, UserAccountID: 1, CategoryID: 7, EntryDate: d(6, 30), Amount: eur("2500.00")},
+		{ID: 2, UserAccountID: 1, CategoryID: 6, EntryDate: d(7, 1), Amount: eur("-850.00")},
+		{ID: 3, UserAccountID: 1, CategoryID: 5, EntryDate: d(7, 3), Amount: eur("-45.20"), Counterparty: merchant("Rewe")},
+		{ID: 4, UserAccountID: 2, CategoryID: 5, EntryDate: d(7, 10), Amount: eur("-30.00"), Counterparty: merchant("Edeka")},
+		{ID: 5, UserAccountID: 1, CategoryID: 5, EntryDate: d(7, 17), Amount: eur("-60.00"), Counterparty: merchant("Rewe")},
+		{
+			// Card payment in the US booked in EUR
+			ID: 6, UserAccountID: 2, CategoryID: 8, EntryDate: d(7, 20), Amount: eur("-86.93"),
+			Counterparty:   merchant("Amtrak"),
+			OriginalAmount: &bosgo.OriginalAmount{Value: &bosgo.MoneyAmount{Currency: "USD", Value: "-100.00"}, ExchangeRate: "1.1504"},
+		},
+		{ID: 7, UserAccountID: 3, EntryDate: d(7, 21), Amount: &bosgo.MoneyAmount{Currency: "GBP", Value: "-12.00"}},
+		{ID: 8, UserAccountID: 1, EntryDate: d(7, 22)},
+	}
+}
+
+func keys(es []Entry) []string {
+	var ks []string
+	for _, e := range es {
+		ks = append(ks, e.Key)
+	}
+	return ks
+}
+
+func TestBuild(t *testing.T) {
+	r := Build(testTransactions(), Options{Categories: testCategories})
+
+	if got := r.Currencies(); !reflect.DeepEqual(got, []string{"EUR", "GBP"}) {
+		t.Errorf("got currencies %v, wanted EUR and GBP", got)
+	}
+	if r.Skipped != 1 {
+		t.Errorf("got %d skipped transactions, wanted 1", r.Skipped)
+	}
+
+	s, _ := r.Series("EUR")
+	if s.Total.Income != "2500.00" || s.Total.Expenses != "1072.13" || s.Total.Net != "1427.87" || s.Total.Count != 6 {
+		t.Errorf("got totals %+v", s.Total)
+	}
+
+	if got := keys(s.Entries(DimensionCategoryGroup)); !reflect.DeepEqual(got, []string{"income", "leisure", "living"}) {
+		t.Errorf("got category groups %v", got)
+	}
+	living, _ := s.Entry(DimensionCategoryGroup, "living")
+	if living.Expenses != "985.20" || living.Count != 4 {
+		t.Errorf("got living totals %+v, wanted 985.20 in 4 transactions", living.Totals)
+	}
+
+	if got := keys(s.Entries(DimensionPeriod)); !reflect.DeepEqual(got, []string{"2017-06", "2017-07"}) {
+		t.Errorf("got periods %v", got)
+	}
+	acc, _ := s.Entry(DimensionAccount, "2")
+	if acc.Expenses != "116.93" {
+		t.Errorf("got account 2 expenses %s, wanted 116.93", acc.Expenses)
+	}
+	rewe, _ := s.Entry(DimensionMerchant, "Rewe")
+	if rewe.Expenses != "105.20" || rewe.Count != 2 {
+		t.Errorf("got Rewe totals %+v", rewe.Totals)
+	}
+}
+
+func TestBuildCurrencyConversion(t *testing.T) {
+	r := Build(testTransactions(), Options{Currency: "USD", Period: PeriodQuarter})
+
+	if got := r.Currencies(); !reflect.DeepEqual(got, []string{"EUR", "GBP", "USD"}) {
+		t.Errorf("got currencies %v", got)
+	}
+	usd, _ := r.Series("USD")
+	if usd.Total.Expenses != "100.00" || usd.Total.Count != 1 {
+		t.Errorf("got USD totals %+v, wanted converted card payment", usd.Total)
+	}
+	if got := keys(usd.Entries(DimensionPeriod)); !reflect.DeepEqual(got, []string{"2017-Q3"}) {
+		t.Errorf("got periods %v", got)
+	}
+
+	// Without an original value the exchange rate is applied.
+	tx := testTransactions()[5]
+	tx.OriginalAmount.Value.Value = ""
+	r = Build([]bosgo.Transaction{tx}, Options{Currency: "USD"})
+	if usd, ok := r.Series("USD"); !ok || usd.Total.Expenses != "100.00" {
+		t.Errorf("got USD series %+v, wanted 100.00 converted by rate", usd)
+	}
+
+	// The exchange rate takes precedence over a rounded original value.
+	tx.OriginalAmount.Value.Value = "-99.99"
+	r = Build([]bosgo.Transaction{tx}, Options{Currency: "USD"})
+	if usd, ok := r.Series("USD"); !ok || usd.Total.Expenses != "100.00" {
+		t.Errorf("got USD series %+v, wanted 100.00 converted by rate", usd)
+	}
+
+	// Without an exchange rate the original value is used.
+	tx.OriginalAmount.ExchangeRate = ""
+	r = Build([]bosgo.Transaction{tx}, Options{Currency: "USD"})
+	if usd, ok := r.Series("USD"); !ok || usd.Total.Expenses != "99.99" {
+		t.Errorf("got USD series %+v, wanted original value 99.99", usd)
+	}
+}
+
+func TestTop(t *testing.T) {
+	r := Build(testTransactions(), Options{
+		Exclude: func(tx bosgo.Transaction) bool { return tx.ID == 6 },
+	})
+	s, _ := r.Series("EUR")
+
+	top := s.Top(DimensionMerchant, Expenses, 2)
+	if got := keys(top); !reflect.DeepEqual(got, []string{"", "Rewe"}) {
+		t.Errorf("got top merchants %v, wanted unknown merchant and Rewe", got)
+	}
+	if got := keys(s.Top(DimensionAccount, Income, 5)); !reflect.DeepEqual(got, []string{"1"}) {
+		t.Errorf("got top income accounts %v", got)
+	}
+}
+
+func TestCompareBudget(t *testing.T) {
+	r := Build(testTransactions(), Options{Categories: testCategories, Language: "de"})
+
+	statuses := r.CompareBudget(Limits{
+		DimensionCategory: {"Lebensmittel": "100.00", "Travel": "200"},
+	}, DimensionCategory)
+
+	want := []BudgetStatus{
+		{Dimension: DimensionCategory, Key: "Lebensmittel", Currency: "EUR", Limit: "100.00", Spent: "135.20", Remaining: "-35.20", Used: 1.352, Exceeded: true},
+		{Dimension: DimensionCategory, Key: "Travel", Currency: "EUR", Limit: "200.00", Spent: "86.93", Remaining: "113.07", Used: 0.43465},
+	}
+	for i := range statuses {
+		if i < len(want) && math.Abs(statuses[i].Used-want[i].Used) < 1e-9 {
+			statuses[i].Used = want[i].Used
+		}
+	}
+	if !reflect.DeepEqual(statuses, want) {
+		t.Errorf("got statuses\n%+v\nwanted\n%+v", statuses, want)
+	}
+}
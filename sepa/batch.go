@@ -0,0 +1,259 @@
+// Copyright 2017 Bankrs AG.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sepa
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"code.bankrs.com/bosgo"
+)
+
+// DefaultMaxSteps is the number of authorisation steps after which a transfer
+// is abandoned when Batch.MaxSteps is zero.
+const DefaultMaxSteps = 10
+
+// Item is a single credit transfer of a batch together with the Bankrs account
+// it is debited from.
+type Item struct {
+	PaymentID     string
+	From          int64
+	ExecutionDate time.Time
+	Transfer      CreditTransfer
+}
+
+// Batch is a list of credit transfers that can be executed through the
+// TransfersService.
+type Batch struct {
+	Items []Item
+
+	// MaxSteps limits the number of authorisation steps performed for each
+	// transfer. Zero means DefaultMaxSteps.
+	MaxSteps int
+}
+
+// NewBatch converts an initiation into a batch. The debtor of each payment is
+// resolved to one of the given accounts by IBAN unless the debtor address
+// already carries a Bankrs account id.
+func NewBatch(in *Initiation, accounts []bosgo.Account) (*Batch, error) {
+	b := &Batch{}
+	for _, p := range in.Payments {
+		from := p.Debtor.AccountID
+		if from == 0 {
+			for _, acc := range accounts {
+				if acc.IBAN != "" && compact(acc.IBAN) == compact(p.Debtor.IBAN) {
+					from = acc.ID
+					break
+				}
+			}
+		}
+		if from == 0 {
+			return nil, fmt.Errorf("sepa: no account found for debtor IBAN %s of payment %s", compact(p.Debtor.IBAN), p.ID)
+		}
+
+		for _, ct := range p.Transfers {
+			b.Items = append(b.Items, Item{
+				PaymentID:     p.ID,
+				From:          from,
+				ExecutionDate: p.ExecutionDate,
+				Transfer:      ct,
+			})
+		}
+	}
+	return b, nil
+}
+
+// Request returns a request that creates the transfer described by the item.
+func (it Item) Request(svc *bosgo.TransfersService) *bosgo.CreateTransferReq {
+	to := it.Transfer.Creditor
+	to.IBAN = compact(to.IBAN)
+	req := svc.Create(it.From, to, it.Transfer.Amount)
+	if it.Transfer.Usage != "" {
+		req.Description(it.Transfer.Usage)
+	}
+	if !it.ExecutionDate.IsZero() && it.ExecutionDate.After(time.Now()) {
+		req.EntryDate(it.ExecutionDate)
+	}
+	return req
+}
+
+// Requests returns a create request for each item of the batch.
+func (b *Batch) Requests(svc *bosgo.TransfersService) []*bosgo.CreateTransferReq {
+	reqs := make([]*bosgo.CreateTransferReq, 0, len(b.Items))
+	for _, it := range b.Items {
+		reqs = append(reqs, it.Request(svc))
+	}
+	return reqs
+}
+
+// StepResponse holds the information supplied to complete one step of a
+// transfer.
+type StepResponse struct {
+	Answers []bosgo.ChallengeAnswer
+	Confirm bool
+}
+
+// An Authoriser supplies the challenge answers needed to complete the current
+// step of a transfer. Returning an error cancels the transfer.
+type Authoriser interface {
+	Authorise(ctx context.Context, item Item, tr *bosgo.Transfer) (StepResponse, error)
+}
+
+// AuthoriserFunc adapts an ordinary function to the Authoriser interface.
+type AuthoriserFunc func(ctx context.Context, item Item, tr *bosgo.Transfer) (StepResponse, error)
+
+// Authorise calls f(ctx, item, tr).
+func (f AuthoriserFunc) Authorise(ctx context.Context, item Item, tr *bosgo.Transfer) (StepResponse, error) {
+	return f(ctx, item, tr)
+}
+
+// StaticAuthoriser answers every step with fixed challenge answers keyed by
+// the intent of the step. Similar transfers are confirmed.
+type StaticAuthoriser map[bosgo.TransferIntent][]bosgo.ChallengeAnswer
+
+// Authorise implements the Authoriser interface.
+func (a StaticAuthoriser) Authorise(ctx context.Context, item Item, tr *bosgo.Transfer) (StepResponse, error) {
+	if tr.Step.Intent == bosgo.TransferIntentConfirmSimilarTransfer {
+		return StepResponse{Confirm: true}, nil
+	}
+	answers, ok := a[tr.Step.Intent]
+	if !ok {
+		return StepResponse{}, fmt.Errorf("sepa: no answer for step %s", tr.Step.Intent)
+	}
+	return StepResponse{Answers: answers}, nil
+}
+
+// Outcome is the result of executing a single item of a batch. Transfer holds
+// the last state of the transfer reported by the API, if it was created.
+type Outcome struct {
+	Item     Item
+	Transfer *bosgo.Transfer
+	Err      error
+}
+
+// Succeeded reports whether the transfer was executed successfully.
+func (o Outcome) Succeeded() bool {
+	return o.Err == nil && o.Transfer != nil && o.Transfer.State == bosgo.TransferStateSucceeded
+}
+
+// Report holds the outcomes of a batch execution in the order of the batch
+// items.
+type Report struct {
+	Outcomes []Outcome
+}
+
+// Succeeded returns the number of transfers that were executed successfully.
+func (r *Report) Succeeded() int {
+	n := 0
+	for _, o := range r.Outcomes {
+		if o.Succeeded() {
+			n++
+		}
+	}
+	return n
+}
+
+// Failed returns the outcomes of all transfers that were not executed
+// successfully.
+func (r *Report) Failed() []Outcome {
+	var failed []Outcome
+	for _, o := range r.Outcomes {
+		if !o.Succeeded() {
+			failed = append(failed, o)
+		}
+	}
+	return failed
+}
+
+// Execute creates each transfer of the batch in turn and drives it through
+// its authorisation steps using auth. A failing transfer does not stop the
+// remaining ones; each item's outcome is recorded in the returned report.
+// Items that were not attempted because ctx was cancelled report the
+// context's error.
+func (b *Batch) Execute(ctx context.Context, svc *bosgo.TransfersService, auth Authoriser) *Report {
+	maxSteps := b.MaxSteps
+	if maxSteps == 0 {
+		maxSteps = DefaultMaxSteps
+	}
+
+	rep := &Report{Outcomes: make([]Outcome, 0, len(b.Items))}
+	for _, it := range b.Items {
+		if err := ctx.Err(); err != nil {
+			rep.Outcomes = append(rep.Outcomes, Outcome{Item: it, Err: err})
+			continue
+		}
+		tr, err := execute(ctx, svc, auth, it, maxSteps)
+		rep.Outcomes = append(rep.Outcomes, Outcome{Item: it, Transfer: tr, Err: err})
+	}
+	return rep
+}
+
+func execute(ctx context.Context, svc *bosgo.TransfersService, auth Authoriser, it Item, maxSteps int) (*bosgo.Transfer, error) {
+	tr, err := it.Request(svc).Context(ctx).Send()
+	if err != nil {
+		return nil, err
+	}
+
+	for steps := 0; tr.State == bosgo.TransferStateOngoing; steps++ {
+		if steps == maxSteps {
+			return cancel(ctx, svc, tr, fmt.Errorf("sepa: transfer %s not completed after %d steps", tr.ID, maxSteps))
+		}
+		if tr.Step.Intent == "" {
+			return tr, transferError(tr)
+		}
+
+		resp, err := auth.Authorise(ctx, it, tr)
+		if err != nil {
+			return cancel(ctx, svc, tr, err)
+		}
+
+		req := svc.Process(tr.ID, tr.Step.Intent, tr.Version).Context(ctx).Confirm(resp.Confirm)
+		for _, ans := range resp.Answers {
+			req.ChallengeAnswer(ans)
+		}
+		next, err := req.Send()
+		if err != nil {
+			return tr, err
+		}
+		tr = next
+	}
+
+	if tr.State != bosgo.TransferStateSucceeded {
+		return tr, transferError(tr)
+	}
+	return tr, nil
+}
+
+// cancel attempts to cancel tr after it could not be completed. The original
+// error is returned along with the last known state of the transfer.
+func cancel(ctx context.Context, svc *bosgo.TransfersService, tr *bosgo.Transfer, cause error) (*bosgo.Transfer, error) {
+	if cancelled, err := svc.Cancel(tr.ID, tr.Version).Context(ctx).Send(); err == nil && cancelled.ID != "" {
+		tr = cancelled
+	}
+	return tr, cause
+}
+
+func transferError(tr *bosgo.Transfer) error {
+	if len(tr.Errors) == 0 {
+		return fmt.Errorf("sepa: transfer %s ended in state %s", tr.ID, tr.State)
+	}
+	codes := make([]string, 0, len(tr.Errors))
+	for _, p := range tr.Errors {
+		codes = append(codes, p.Code)
+	}
+	return fmt.Errorf("sepa: transfer %s ended in state %s: %s", tr.ID, tr.State, strings.Join(codes, ", "))
+}
@@ -0,0 +1,101 @@
+// Copyright 2017 Bankrs AG.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sepa
+
+import (
+	"context"
+	"testing"
+
+	"code.bankrs.com/bosgo"
+	"code.bankrs.com/bosgo/testserver"
+)
+
+func TestNewBatchUnknownDebtor(t *testing.T) {
+	_, err := NewBatch(testInitiation(), []bosgo.Account{{ID: 1, IBAN: "DE56200800950445688921"}})
+	if err == nil {
+		t.Errorf("got no error, wanted one")
+	}
+}
+
+func TestBatchExecute(t *testing.T) {
+	s := testserver.NewWithDefaults()
+	defer s.Close()
+
+	appClient := bosgo.NewAppClient(s.Client(), s.Addr(), testserver.DefaultApplicationID)
+	userClient, err := appClient.Users.Login(testserver.DefaultUsername, testserver.DefaultPassword).Send()
+	if err != nil {
+		t.Fatalf("failed to login as user: %v", err)
+	}
+
+	job, err := userClient.Accesses.Add(testserver.DefaultProviderID).
+		ChallengeAnswer(bosgo.ChallengeAnswer{ID: testserver.ChallengeLogin, Value: testserver.DefaultAccessLogin}).
+		ChallengeAnswer(bosgo.ChallengeAnswer{ID: testserver.ChallengePIN, Value: testserver.DefaultAccessPIN}).
+		Send()
+	if err != nil {
+		t.Fatalf("failed to add access: %v", err)
+	}
+	if _, err := userClient.Jobs.Get(job.URI).Send(); err != nil {
+		t.Fatalf("failed to get job status: %v", err)
+	}
+	accounts, err := userClient.Accounts.List().Send()
+	if err != nil {
+		t.Fatalf("failed to list accounts: %v", err)
+	}
+
+	in := testInitiation()
+	in.Payments[1].ExecutionDate = in.Payments[0].ExecutionDate
+	b, err := NewBatch(in, accounts.Accounts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(b.Items) != 3 {
+		t.Fatalf("got %d items, wanted 3", len(b.Items))
+	}
+
+	static := StaticAuthoriser{
+		bosgo.TransferIntentProvidePIN:             {{ID: "pin", Value: testserver.DefaultAccessPIN}},
+		bosgo.TransferIntentSelectAuthMethod:       {{ID: "auth_method", Value: testserver.DefaultAuthMethod}},
+		bosgo.TransferIntentProvideChallengeAnswer: {{ID: "tan", Value: testserver.DefaultAuthAnswer}},
+	}
+	auth := AuthoriserFunc(func(ctx context.Context, item Item, tr *bosgo.Transfer) (StepResponse, error) {
+		if item.Transfer.EndToEndID == "t2" && tr.Step.Intent == bosgo.TransferIntentProvideChallengeAnswer {
+			return StepResponse{Answers: []bosgo.ChallengeAnswer{{ID: "tan", Value: "0000"}}}, nil
+		}
+		return static.Authorise(ctx, item, tr)
+	})
+
+	rep := b.Execute(context.Background(), userClient.Transfers, auth)
+	if len(rep.Outcomes) != 3 {
+		t.Fatalf("got %d outcomes, wanted 3", len(rep.Outcomes))
+	}
+	if rep.Succeeded() != 2 {
+		t.Errorf("got %d succeeded transfers, wanted 2", rep.Succeeded())
+	}
+
+	failed := rep.Failed()
+	if len(failed) != 1 {
+		t.Fatalf("got %d failed transfers, wanted 1", len(failed))
+	}
+	if failed[0].Item.Transfer.EndToEndID != "t2" {
+		t.Errorf("got failed transfer %q, wanted t2", failed[0].Item.Transfer.EndToEndID)
+	}
+	if failed[0].Err == nil || failed[0].Transfer == nil {
+		t.Errorf("got outcome %+v, wanted error and transfer", failed[0])
+	}
+
+	if tr := rep.Outcomes[0].Transfer; tr == nil || tr.State != bosgo.TransferStateSucceeded {
+		t.Errorf("got transfer %+v, wanted succeeded transfer", tr)
+	}
+}
@@ -0,0 +1,504 @@
+// Copyright 2017 Bankrs AG.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package sepa builds and parses ISO 20022 pain.001 customer credit transfer
+// initiation messages and executes them as transfers through the Bankrs OS
+// API.
+package sepa
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"code.bankrs.com/bosgo"
+	"code.bankrs.com/bosgo/internal/money"
+)
+
+// Pain001Namespace is the XML namespace of the pain.001 version written by
+// WritePain001.
+const Pain001Namespace = "urn:iso:std:iso:20022:tech:xsd:pain.001.001.03"
+
+// Maximum field lengths defined by the SEPA implementation guidelines.
+const (
+	MaxIDLength    = 35
+	MaxNameLength  = 70
+	MaxUsageLength = 140
+)
+
+// notProvided is used in place of an end-to-end id or agent that is not known.
+const notProvided = "NOTPROVIDED"
+
+// Initiation is a customer credit transfer initiation message consisting of
+// one or more payments.
+type Initiation struct {
+	MessageID       string
+	Created         time.Time
+	InitiatingParty string
+	Payments        []Payment
+}
+
+// Payment is a group of credit transfers debited from the same account on the
+// same execution date.
+type Payment struct {
+	ID            string
+	Debtor        bosgo.TransferAddress
+	DebtorBIC     string // optional
+	ExecutionDate time.Time
+	Transfers     []CreditTransfer
+}
+
+// CreditTransfer is a single transfer of money to a creditor.
+type CreditTransfer struct {
+	EndToEndID  string
+	Creditor    bosgo.TransferAddress
+	CreditorBIC string // optional
+	Amount      bosgo.MoneyAmount
+	Usage       string
+}
+
+// NewCreditTransfer returns a credit transfer of amount to the given address.
+// The creditor name and usage are transliterated to the SEPA character set.
+func NewCreditTransfer(to bosgo.TransferAddress, amount bosgo.MoneyAmount, usage string) CreditTransfer {
+	to.Name = Transliterate(to.Name, MaxNameLength)
+	to.IBAN = compact(to.IBAN)
+	return CreditTransfer{
+		Creditor: to,
+		Amount:   amount,
+		Usage:    Transliterate(usage, MaxUsageLength),
+	}
+}
+
+// NewInitiation returns an initiation message containing the given transfers.
+// Transfers debited from the same account on the same entry date are grouped
+// into one payment. The transfer ids are used as end-to-end ids.
+func NewInitiation(messageID string, initiatingParty string, transfers ...bosgo.Transfer) *Initiation {
+	in := &Initiation{
+		MessageID:       messageID,
+		Created:         time.Now(),
+		InitiatingParty: Transliterate(initiatingParty, MaxNameLength),
+	}
+
+	index := map[string]int{}
+	for _, tr := range transfers {
+		var amount bosgo.MoneyAmount
+		if tr.Amount != nil {
+			amount = *tr.Amount
+		}
+		ct := NewCreditTransfer(tr.To, amount, tr.Usage)
+		ct.EndToEndID = tr.ID
+
+		key := compact(tr.From.IBAN) + "/" + isoDate(tr.EntryDate)
+		i, exists := index[key]
+		if !exists {
+			from := tr.From
+			from.Name = Transliterate(from.Name, MaxNameLength)
+			from.IBAN = compact(from.IBAN)
+			in.Payments = append(in.Payments, Payment{
+				ID:            fmt.Sprintf("%s-%d", messageID, len(in.Payments)+1),
+				Debtor:        from,
+				ExecutionDate: tr.EntryDate,
+			})
+			i = len(in.Payments) - 1
+			index[key] = i
+		}
+		in.Payments[i].Transfers = append(in.Payments[i].Transfers, ct)
+	}
+
+	return in
+}
+
+// NumberOfTransactions returns the number of credit transfers in all payments.
+func (in *Initiation) NumberOfTransactions() int {
+	n := 0
+	for _, p := range in.Payments {
+		n += len(p.Transfers)
+	}
+	return n
+}
+
+// ControlSum returns the sum of the amounts of all credit transfers.
+func (in *Initiation) ControlSum() (bosgo.MoneyAmount, error) {
+	var amounts []bosgo.MoneyAmount
+	for _, p := range in.Payments {
+		for _, ct := range p.Transfers {
+			amounts = append(amounts, ct.Amount)
+		}
+	}
+	return controlSum(amounts)
+}
+
+// ControlSum returns the sum of the amounts of the payment's credit transfers.
+func (p *Payment) ControlSum() (bosgo.MoneyAmount, error) {
+	var amounts []bosgo.MoneyAmount
+	for _, ct := range p.Transfers {
+		amounts = append(amounts, ct.Amount)
+	}
+	return controlSum(amounts)
+}
+
+func controlSum(amounts []bosgo.MoneyAmount) (bosgo.MoneyAmount, error) {
+	var sum money.Amount
+	for _, amt := range amounts {
+		v, err := money.Parse(amt.Value)
+		if err != nil {
+			return bosgo.MoneyAmount{}, err
+		}
+		sum += v
+	}
+	return bosgo.MoneyAmount{Currency: "EUR", Value: sum.String()}, nil
+}
+
+// ValidationError reports all problems found while validating an initiation.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	if len(e.Problems) == 1 {
+		return "sepa: " + e.Problems[0]
+	}
+	return fmt.Sprintf("sepa: %d validation problems: %s", len(e.Problems), strings.Join(e.Problems, "; "))
+}
+
+func (e *ValidationError) add(field string, err error) {
+	if err == nil {
+		return
+	}
+	e.Problems = append(e.Problems, field+": "+strings.TrimPrefix(err.Error(), "sepa: "))
+}
+
+// Validate checks the initiation against the SEPA rules for IBANs, BICs,
+// amounts, identifiers and the character set. If any problems are found it
+// returns a *ValidationError listing all of them.
+func (in *Initiation) Validate() error {
+	verr := &ValidationError{}
+	verr.add("message id", validateID(in.MessageID))
+	verr.add("initiating party", validateName(in.InitiatingParty))
+	if len(in.Payments) == 0 {
+		verr.add("payments", errors.New("no payments"))
+	}
+
+	for i, p := range in.Payments {
+		field := fmt.Sprintf("payment %d", i+1)
+		verr.add(field+" id", validateID(p.ID))
+		verr.add(field+" debtor name", validateName(p.Debtor.Name))
+		verr.add(field+" debtor IBAN", ValidateIBAN(p.Debtor.IBAN))
+		if p.DebtorBIC != "" {
+			verr.add(field+" debtor BIC", ValidateBIC(p.DebtorBIC))
+		}
+		if len(p.Transfers) == 0 {
+			verr.add(field, errors.New("no transfers"))
+		}
+
+		for j, ct := range p.Transfers {
+			field := fmt.Sprintf("payment %d transfer %d", i+1, j+1)
+			if ct.EndToEndID != "" {
+				verr.add(field+" end-to-end id", ValidateText(ct.EndToEndID, MaxIDLength))
+			}
+			verr.add(field+" creditor name", validateName(ct.Creditor.Name))
+			verr.add(field+" creditor IBAN", ValidateIBAN(ct.Creditor.IBAN))
+			if ct.CreditorBIC != "" {
+				verr.add(field+" creditor BIC", ValidateBIC(ct.CreditorBIC))
+			}
+			verr.add(field+" amount", ValidateAmount(ct.Amount))
+			verr.add(field+" usage", ValidateText(ct.Usage, MaxUsageLength))
+		}
+	}
+
+	if len(verr.Problems) > 0 {
+		return verr
+	}
+	return nil
+}
+
+func validateID(id string) error {
+	if id == "" {
+		return errors.New("missing")
+	}
+	if strings.HasPrefix(id, "/") || strings.Contains(id, "//") {
+		return fmt.Errorf("id %q must not start with or contain //", id)
+	}
+	return ValidateText(id, MaxIDLength)
+}
+
+func validateName(name string) error {
+	if name == "" {
+		return errors.New("missing")
+	}
+	return ValidateText(name, MaxNameLength)
+}
+
+// pain.001.001.03 document structure. Elements are declared in schema order.
+type painDocument struct {
+	XMLName xml.Name     `xml:"Document"`
+	Xmlns   string       `xml:"xmlns,attr,omitempty"`
+	Initn   painCstmrCdt `xml:"CstmrCdtTrfInitn"`
+}
+
+type painCstmrCdt struct {
+	GrpHdr painGrpHdr   `xml:"GrpHdr"`
+	PmtInf []painPmtInf `xml:"PmtInf"`
+}
+
+type painGrpHdr struct {
+	MsgID      string `xml:"MsgId"`
+	CreDtTm    string `xml:"CreDtTm"`
+	NbOfTxs    string `xml:"NbOfTxs"`
+	CtrlSum    string `xml:"CtrlSum,omitempty"`
+	InitgPtyNm string `xml:"InitgPty>Nm"`
+}
+
+type painPmtInf struct {
+	PmtInfID    string            `xml:"PmtInfId"`
+	PmtMtd      string            `xml:"PmtMtd"`
+	NbOfTxs     string            `xml:"NbOfTxs,omitempty"`
+	CtrlSum     string            `xml:"CtrlSum,omitempty"`
+	SvcLvlCd    string            `xml:"PmtTpInf>SvcLvl>Cd,omitempty"`
+	ReqdExctnDt string            `xml:"ReqdExctnDt"`
+	DbtrNm      string            `xml:"Dbtr>Nm"`
+	DbtrIBAN    string            `xml:"DbtrAcct>Id>IBAN"`
+	DbtrAgt     painAgent         `xml:"DbtrAgt"`
+	ChrgBr      string            `xml:"ChrgBr,omitempty"`
+	CdtTrfTxInf []painCdtTrfTxInf `xml:"CdtTrfTxInf"`
+}
+
+type painAgent struct {
+	BIC   string `xml:"FinInstnId>BIC,omitempty"`
+	Other string `xml:"FinInstnId>Othr>Id,omitempty"`
+}
+
+type painCdtTrfTxInf struct {
+	EndToEndID string     `xml:"PmtId>EndToEndId"`
+	InstdAmt   painAmount `xml:"Amt>InstdAmt"`
+	CdtrAgt    *painAgent `xml:"CdtrAgt,omitempty"`
+	CdtrNm     string     `xml:"Cdtr>Nm"`
+	CdtrIBAN   string     `xml:"CdtrAcct>Id>IBAN"`
+	Ustrd      string     `xml:"RmtInf>Ustrd,omitempty"`
+}
+
+type painAmount struct {
+	Ccy   string `xml:"Ccy,attr"`
+	Value string `xml:",chardata"`
+}
+
+// WritePain001 validates the initiation and writes it to w as a pain.001.001.03
+// XML document.
+func WritePain001(w io.Writer, in *Initiation) error {
+	if err := in.Validate(); err != nil {
+		return err
+	}
+
+	sum, err := in.ControlSum()
+	if err != nil {
+		return err
+	}
+	created := in.Created
+	if created.IsZero() {
+		created = time.Now()
+	}
+
+	doc := painDocument{
+		Xmlns: Pain001Namespace,
+		Initn: painCstmrCdt{
+			GrpHdr: painGrpHdr{
+				MsgID:      in.MessageID,
+				CreDtTm:    created.Format("2006-01-02T15:04:05"),
+				NbOfTxs:    strconv.Itoa(in.NumberOfTransactions()),
+				CtrlSum:    sum.Value,
+				InitgPtyNm: in.InitiatingParty,
+			},
+		},
+	}
+
+	for _, p := range in.Payments {
+		psum, err := p.ControlSum()
+		if err != nil {
+			return err
+		}
+		pi := painPmtInf{
+			PmtInfID:    p.ID,
+			PmtMtd:      "TRF",
+			NbOfTxs:     strconv.Itoa(len(p.Transfers)),
+			CtrlSum:     psum.Value,
+			SvcLvlCd:    "SEPA",
+			ReqdExctnDt: executionDate(p.ExecutionDate),
+			DbtrNm:      p.Debtor.Name,
+			DbtrIBAN:    compact(p.Debtor.IBAN),
+			DbtrAgt:     agent(p.DebtorBIC),
+			ChrgBr:      "SLEV",
+		}
+		for _, ct := range p.Transfers {
+			tx := painCdtTrfTxInf{
+				EndToEndID: ct.EndToEndID,
+				InstdAmt:   painAmount{Ccy: ct.Amount.Currency, Value: ct.Amount.Value},
+				CdtrNm:     ct.Creditor.Name,
+				CdtrIBAN:   compact(ct.Creditor.IBAN),
+				Ustrd:      ct.Usage,
+			}
+			if tx.EndToEndID == "" {
+				tx.EndToEndID = notProvided
+			}
+			if ct.CreditorBIC != "" {
+				a := agent(ct.CreditorBIC)
+				tx.CdtrAgt = &a
+			}
+			pi.CdtTrfTxInf = append(pi.CdtTrfTxInf, tx)
+		}
+		doc.Initn.PmtInf = append(doc.Initn.PmtInf, pi)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "\n")
+	return err
+}
+
+func agent(bic string) painAgent {
+	if bic == "" {
+		return painAgent{Other: notProvided}
+	}
+	return painAgent{BIC: bic}
+}
+
+// executionDate formats the requested execution date. A zero date requests
+// execution as soon as possible, which is expressed as 1999-01-01 by
+// convention.
+func executionDate(t time.Time) string {
+	if t.IsZero() {
+		return "1999-01-01"
+	}
+	return isoDate(t)
+}
+
+func isoDate(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format("2006-01-02")
+}
+
+// ReadPain001 parses a pain.001.001.03 document and validates the resulting
+// initiation. Number of transactions and control sums are checked when
+// present in the document.
+func ReadPain001(r io.Reader) (*Initiation, error) {
+	var doc painDocument
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("sepa: failed to parse document: %v", err)
+	}
+	if doc.XMLName.Space != "" && !strings.HasPrefix(doc.XMLName.Space, "urn:iso:std:iso:20022:tech:xsd:pain.001.001.") {
+		return nil, fmt.Errorf("sepa: unsupported document namespace %q", doc.XMLName.Space)
+	}
+
+	hdr := doc.Initn.GrpHdr
+	in := &Initiation{
+		MessageID:       hdr.MsgID,
+		InitiatingParty: hdr.InitgPtyNm,
+	}
+	if hdr.CreDtTm != "" {
+		created, err := parseDateTime(hdr.CreDtTm)
+		if err != nil {
+			return nil, fmt.Errorf("sepa: invalid creation time %q", hdr.CreDtTm)
+		}
+		in.Created = created
+	}
+
+	for _, pi := range doc.Initn.PmtInf {
+		if pi.PmtMtd != "TRF" {
+			return nil, fmt.Errorf("sepa: payment %s has unsupported payment method %q", pi.PmtInfID, pi.PmtMtd)
+		}
+		p := Payment{
+			ID:        pi.PmtInfID,
+			Debtor:    bosgo.TransferAddress{Name: pi.DbtrNm, IBAN: pi.DbtrIBAN},
+			DebtorBIC: pi.DbtrAgt.BIC,
+		}
+		if pi.ReqdExctnDt != "" && pi.ReqdExctnDt != "1999-01-01" {
+			date, err := time.Parse("2006-01-02", pi.ReqdExctnDt)
+			if err != nil {
+				return nil, fmt.Errorf("sepa: payment %s has invalid execution date %q", pi.PmtInfID, pi.ReqdExctnDt)
+			}
+			p.ExecutionDate = date
+		}
+
+		for _, tx := range pi.CdtTrfTxInf {
+			ct := CreditTransfer{
+				EndToEndID: tx.EndToEndID,
+				Creditor:   bosgo.TransferAddress{Name: tx.CdtrNm, IBAN: tx.CdtrIBAN},
+				Amount:     bosgo.MoneyAmount{Currency: tx.InstdAmt.Ccy, Value: strings.TrimSpace(tx.InstdAmt.Value)},
+				Usage:      tx.Ustrd,
+			}
+			if ct.EndToEndID == notProvided {
+				ct.EndToEndID = ""
+			}
+			if tx.CdtrAgt != nil {
+				ct.CreditorBIC = tx.CdtrAgt.BIC
+			}
+			p.Transfers = append(p.Transfers, ct)
+		}
+
+		if err := checkTotals("payment "+pi.PmtInfID, pi.NbOfTxs, pi.CtrlSum, len(p.Transfers), p.ControlSum); err != nil {
+			return nil, err
+		}
+		in.Payments = append(in.Payments, p)
+	}
+
+	if err := checkTotals("group header", hdr.NbOfTxs, hdr.CtrlSum, in.NumberOfTransactions(), in.ControlSum); err != nil {
+		return nil, err
+	}
+
+	if err := in.Validate(); err != nil {
+		return nil, err
+	}
+	return in, nil
+}
+
+func checkTotals(where string, nbOfTxs, ctrlSum string, n int, sum func() (bosgo.MoneyAmount, error)) error {
+	if nbOfTxs != "" && nbOfTxs != strconv.Itoa(n) {
+		return fmt.Errorf("sepa: %s declares %s transactions but contains %d", where, nbOfTxs, n)
+	}
+	if ctrlSum == "" {
+		return nil
+	}
+	want, err := money.Parse(ctrlSum)
+	if err != nil {
+		return fmt.Errorf("sepa: %s has invalid control sum %q", where, ctrlSum)
+	}
+	got, err := sum()
+	if err != nil {
+		return fmt.Errorf("sepa: %s contains an invalid amount: %v", where, err)
+	}
+	if got.Value != want.String() {
+		return fmt.Errorf("sepa: %s declares control sum %s but transactions sum to %s", where, want, got.Value)
+	}
+	return nil
+}
+
+func parseDateTime(s string) (time.Time, error) {
+	for _, layout := range []string{"2006-01-02T15:04:05", time.RFC3339, time.RFC3339Nano, "2006-01-02T15:04:05.999999999"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date time %q", s)
+}
@@ -0,0 +1,163 @@
+// Copyright 2017 Bankrs AG.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sepa
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"code.bankrs.com/bosgo"
+)
+
+func testInitiation() *Initiation {
+	from := bosgo.TransferAddress{Name: "Max Mustermann", IBAN: "DE84200700245353762745"}
+	exec := time.Date(2017, 8, 1, 0, 0, 0, 0, time.UTC)
+
+	in := NewInitiation("MSG-1", "Mustermann GmbH",
+		bosgo.Transfer{
+			ID:        "t1",
+			From:      from,
+			To:        bosgo.TransferAddress{Name: "Erika Müller", IBAN: "DE56 2008 0095 0445 6889 21"},
+			Amount:    &bosgo.MoneyAmount{Currency: "EUR", Value: "60.00"},
+			Usage:     "Miete August",
+			EntryDate: exec,
+		},
+		bosgo.Transfer{
+			ID:        "t2",
+			From:      from,
+			To:        bosgo.TransferAddress{Name: "Stadtwerke", IBAN: "GB82WEST12345698765432"},
+			Amount:    &bosgo.MoneyAmount{Currency: "EUR", Value: "12.5"},
+			Usage:     "Strom",
+			EntryDate: exec,
+		},
+		bosgo.Transfer{
+			ID:     "t3",
+			From:   from,
+			To:     bosgo.TransferAddress{Name: "Erika Müller", IBAN: "DE56200800950445688921"},
+			Amount: &bosgo.MoneyAmount{Currency: "EUR", Value: "1.00"},
+		},
+	)
+	in.Created = time.Date(2017, 7, 31, 12, 0, 0, 0, time.UTC)
+	in.Payments[0].Transfers[1].CreditorBIC = "WESTGB22"
+	return in
+}
+
+func TestNewInitiation(t *testing.T) {
+	in := testInitiation()
+
+	if len(in.Payments) != 2 {
+		t.Fatalf("got %d payments, wanted 2 grouped by execution date", len(in.Payments))
+	}
+	if got := len(in.Payments[0].Transfers); got != 2 {
+		t.Errorf("got %d transfers in first payment, wanted 2", got)
+	}
+	ct := in.Payments[0].Transfers[0]
+	if ct.Creditor.Name != "Erika Mueller" {
+		t.Errorf("got creditor name %q, wanted transliterated Erika Mueller", ct.Creditor.Name)
+	}
+	if ct.Creditor.IBAN != "DE56200800950445688921" {
+		t.Errorf("got creditor IBAN %q, wanted compacted IBAN", ct.Creditor.IBAN)
+	}
+	if ct.EndToEndID != "t1" {
+		t.Errorf("got end-to-end id %q, wanted t1", ct.EndToEndID)
+	}
+	if in.NumberOfTransactions() != 3 {
+		t.Errorf("got %d transactions, wanted 3", in.NumberOfTransactions())
+	}
+	sum, err := in.ControlSum()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if sum.Value != "73.50" {
+		t.Errorf("got control sum %s, wanted 73.50", sum.Value)
+	}
+}
+
+func TestWritePain001(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WritePain001(&buf, testInitiation()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	out := buf.String()
+	for _, want := range []string{
+		`<Document xmlns="urn:iso:std:iso:20022:tech:xsd:pain.001.001.03">`,
+		`<CreDtTm>2017-07-31T12:00:00</CreDtTm>`,
+		`<NbOfTxs>3</NbOfTxs>`,
+		`<CtrlSum>73.50</CtrlSum>`,
+		`<ReqdExctnDt>2017-08-01</ReqdExctnDt>`,
+		`<ReqdExctnDt>1999-01-01</ReqdExctnDt>`,
+		`<Id>NOTPROVIDED</Id>`,
+		`<BIC>WESTGB22</BIC>`,
+		`<InstdAmt Ccy="EUR">12.5</InstdAmt>`,
+		`<Ustrd>Miete August</Ustrd>`,
+		`<ChrgBr>SLEV</ChrgBr>`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output does not contain %s:\n%s", want, out)
+		}
+	}
+}
+
+func TestWritePain001Invalid(t *testing.T) {
+	in := testInitiation()
+	in.Payments[0].Transfers[0].Creditor.IBAN = "DE00200800950445688921"
+	in.Payments[1].Transfers[0].Amount.Value = "1.001"
+	in.Payments[1].Transfers[0].Usage = "Grüße"
+
+	err := WritePain001(&bytes.Buffer{}, in)
+	verr, ok := err.(*ValidationError)
+	if !ok {
+		t.Fatalf("got error %v, wanted *ValidationError", err)
+	}
+	if len(verr.Problems) != 3 {
+		t.Errorf("got %d problems, wanted 3: %v", len(verr.Problems), verr.Problems)
+	}
+}
+
+func TestPain001RoundTrip(t *testing.T) {
+	want := testInitiation()
+
+	var buf bytes.Buffer
+	if err := WritePain001(&buf, want); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got, err := ReadPain001(&buf)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The reader only knows about fields present in the document.
+	want.Payments[0].Transfers[1].Amount.Value = "12.5"
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, wanted %+v", got, want)
+	}
+}
+
+func TestReadPain001ControlSum(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WritePain001(&buf, testInitiation()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	doc := strings.Replace(buf.String(), "<CtrlSum>73.50</CtrlSum>", "<CtrlSum>73.51</CtrlSum>", 1)
+
+	if _, err := ReadPain001(strings.NewReader(doc)); err == nil {
+		t.Errorf("got no error for wrong control sum, wanted one")
+	}
+}
@@ -0,0 +1,159 @@
+// Copyright 2017 Bankrs AG.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sepa
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"code.bankrs.com/bosgo"
+)
+
+// ibanLengths holds the IBAN length of each country participating in SEPA.
+var ibanLengths = map[string]int{
+	"AD": 24, "AT": 20, "BE": 16, "BG": 22, "CH": 21, "CY": 28, "CZ": 24, "DE": 22,
+	"DK": 18, "EE": 20, "ES": 24, "FI": 18, "FR": 27, "GB": 22, "GI": 23, "GR": 27,
+	"HR": 21, "HU": 28, "IE": 22, "IS": 26, "IT": 27, "LI": 21, "LT": 20, "LU": 20,
+	"LV": 21, "MC": 27, "MT": 31, "NL": 18, "NO": 15, "PL": 28, "PT": 25, "RO": 24,
+	"SE": 24, "SI": 19, "SK": 24, "SM": 27, "VA": 22,
+}
+
+// ValidateIBAN checks that iban is a well formed IBAN of a SEPA country with a
+// valid check digit. Spaces are ignored.
+func ValidateIBAN(iban string) error {
+	iban = compact(iban)
+	if len(iban) < 5 {
+		return fmt.Errorf("sepa: IBAN %q is too short", iban)
+	}
+
+	for i, c := range iban {
+		switch {
+		case i < 2 && (c < 'A' || c > 'Z'):
+			return fmt.Errorf("sepa: IBAN %q has an invalid country code", iban)
+		case i >= 2 && i < 4 && (c < '0' || c > '9'):
+			return fmt.Errorf("sepa: IBAN %q has invalid check digits", iban)
+		case (c < 'A' || c > 'Z') && (c < '0' || c > '9'):
+			return fmt.Errorf("sepa: IBAN %q contains invalid characters", iban)
+		}
+	}
+
+	length, known := ibanLengths[iban[:2]]
+	if !known {
+		return fmt.Errorf("sepa: IBAN %q is not from a SEPA country", iban)
+	}
+	if len(iban) != length {
+		return fmt.Errorf("sepa: IBAN %q has length %d, wanted %d", iban, len(iban), length)
+	}
+
+	if ibanMod97(iban) != 1 {
+		return fmt.Errorf("sepa: IBAN %q has incorrect check digits", iban)
+	}
+	return nil
+}
+
+// ibanMod97 computes the ISO 7064 MOD 97-10 remainder of a compacted IBAN.
+func ibanMod97(iban string) int {
+	rearranged := iban[4:] + iban[:4]
+	rem := 0
+	for _, c := range rearranged {
+		if c >= 'A' && c <= 'Z' {
+			v := int(c-'A') + 10
+			rem = (rem*100 + v) % 97
+			continue
+		}
+		rem = (rem*10 + int(c-'0')) % 97
+	}
+	return rem
+}
+
+var bicPattern = regexp.MustCompile(`^[A-Z]{4}[A-Z]{2}[A-Z0-9]{2}([A-Z0-9]{3})?$`)
+
+// ValidateBIC checks that bic is a well formed 8 or 11 character business
+// identifier code.
+func ValidateBIC(bic string) error {
+	if !bicPattern.MatchString(bic) {
+		return fmt.Errorf("sepa: BIC %q is invalid", bic)
+	}
+	return nil
+}
+
+var amountPattern = regexp.MustCompile(`^[0-9]{1,9}(\.[0-9]{1,2})?$`)
+
+// ValidateAmount checks that amt is a euro amount between 0.01 and
+// 999999999.99 with at most two decimal places.
+func ValidateAmount(amt bosgo.MoneyAmount) error {
+	if amt.Currency != "EUR" {
+		return fmt.Errorf("sepa: currency %q is not supported, wanted EUR", amt.Currency)
+	}
+	if !amountPattern.MatchString(amt.Value) {
+		return fmt.Errorf("sepa: amount %q is invalid", amt.Value)
+	}
+	if strings.Trim(amt.Value, "0.") == "" {
+		return fmt.Errorf("sepa: amount must be greater than zero")
+	}
+	return nil
+}
+
+// ValidateText checks that s only contains characters of the SEPA character
+// set and is at most max characters long.
+func ValidateText(s string, max int) error {
+	if len(s) > max {
+		return fmt.Errorf("sepa: text %q is longer than %d characters", s, max)
+	}
+	for _, r := range s {
+		if !isSEPAChar(r) {
+			return fmt.Errorf("sepa: text %q contains character %q which is not in the SEPA character set", s, r)
+		}
+	}
+	return nil
+}
+
+func isSEPAChar(r rune) bool {
+	switch {
+	case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		return true
+	}
+	return strings.ContainsRune("/-?:().,'+ ", r)
+}
+
+var transliterations = strings.NewReplacer(
+	"ä", "ae", "ö", "oe", "ü", "ue", "Ä", "Ae", "Ö", "Oe", "Ü", "Ue", "ß", "ss",
+	"à", "a", "á", "a", "â", "a", "é", "e", "è", "e", "ê", "e", "ë", "e",
+	"í", "i", "ì", "i", "î", "i", "ï", "i", "ó", "o", "ò", "o", "ô", "o",
+	"ú", "u", "ù", "u", "û", "u", "ç", "c", "ñ", "n", "&", "+",
+	"\r\n", " ", "\n", " ", "\t", " ",
+)
+
+// Transliterate converts s to the SEPA character set, replacing accented
+// letters with their base letters and other unsupported characters with a
+// full stop, and shortens it to at most max characters.
+func Transliterate(s string, max int) string {
+	s = transliterations.Replace(strings.TrimSpace(s))
+	s = strings.Map(func(r rune) rune {
+		if isSEPAChar(r) {
+			return r
+		}
+		return '.'
+	}, s)
+	if len(s) > max {
+		s = s[:max]
+	}
+	return s
+}
+
+func compact(iban string) string {
+	return strings.ToUpper(strings.Replace(iban, " ", "", -1))
+}
@@ -0,0 +1,106 @@
+// Copyright 2017 Bankrs AG.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sepa
+
+import (
+	"testing"
+
+	"code.bankrs.com/bosgo"
+)
+
+func TestValidateIBAN(t *testing.T) {
+	testCases := []struct {
+		iban  string
+		valid bool
+	}{
+		{iban: "DE84200700245353762745", valid: true},
+		{iban: "DE84 2007 0024 5353 7627 45", valid: true},
+		{iban: "de84200700245353762745", valid: true},
+		{iban: "GB82WEST12345698765432", valid: true},
+		{iban: "DE85200700245353762745", valid: false}, // wrong check digits
+		{iban: "DE8420070024535376274", valid: false},  // too short for DE
+		{iban: "US84200700245353762745", valid: false}, // not SEPA
+		{iban: "DE8420070024535376274!", valid: false},
+		{iban: "DE", valid: false},
+	}
+
+	for _, tc := range testCases {
+		err := ValidateIBAN(tc.iban)
+		if tc.valid && err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.iban, err)
+		}
+		if !tc.valid && err == nil {
+			t.Errorf("%s: got no error, wanted one", tc.iban)
+		}
+	}
+}
+
+func TestValidateBIC(t *testing.T) {
+	for _, bic := range []string{"DEUTDEFF", "DEUTDEFF500", "COBADEHD055"} {
+		if err := ValidateBIC(bic); err != nil {
+			t.Errorf("%s: unexpected error: %v", bic, err)
+		}
+	}
+	for _, bic := range []string{"", "DEUTDE", "deutdeff", "DEUTDEFF5", "DEU1DEFF"} {
+		if err := ValidateBIC(bic); err == nil {
+			t.Errorf("%s: got no error, wanted one", bic)
+		}
+	}
+}
+
+func TestValidateAmount(t *testing.T) {
+	for _, v := range []string{"0.01", "1", "12.5", "999999999.99"} {
+		if err := ValidateAmount(bosgo.MoneyAmount{Currency: "EUR", Value: v}); err != nil {
+			t.Errorf("%s: unexpected error: %v", v, err)
+		}
+	}
+	for _, v := range []string{"0", "0.00", "-1.00", "1.234", "1,00", "1000000000.00", ""} {
+		if err := ValidateAmount(bosgo.MoneyAmount{Currency: "EUR", Value: v}); err == nil {
+			t.Errorf("%s: got no error, wanted one", v)
+		}
+	}
+	if err := ValidateAmount(bosgo.MoneyAmount{Currency: "USD", Value: "1.00"}); err == nil {
+		t.Errorf("got no error for USD, wanted one")
+	}
+}
+
+func TestTransliterate(t *testing.T) {
+	testCases := []struct {
+		in   string
+		want string
+	}{
+		{in: "Erika Müller", want: "Erika Mueller"},
+		{in: "Straße 1 & Co", want: "Strasse 1 + Co"},
+		{in: "Rechnung #42\n2017", want: "Rechnung .42 2017"},
+		{in: "Café €", want: "Cafe ."},
+	}
+
+	for _, tc := range testCases {
+		got := Transliterate(tc.in, 140)
+		if got != tc.want {
+			t.Errorf("%q: got %q, wanted %q", tc.in, got, tc.want)
+		}
+		if err := ValidateText(got, 140); err != nil {
+			t.Errorf("%q: transliterated text is invalid: %v", tc.in, err)
+		}
+	}
+
+	if got := Transliterate("abcdef", 3); got != "abc" {
+		t.Errorf("got %q, wanted truncated abc", got)
+	}
+	if err := ValidateText("Müller", 70); err == nil {
+		t.Errorf("got no error for umlaut, wanted one")
+	}
+}
@@ -54,15 +54,15 @@ type routeMap map[string]map[string]http.HandlerFunc
 func startTestServer(t *testing.T, routes routeMap) (*http.Client, func()) {
 	mux := http.NewServeMux()
 	for path, methodHandlers := range routes {
-		for method, handler := range methodHandlers {
-			mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
-				if r.Method != method {
-					w.WriteHeader(http.StatusNotFound)
-					return
-				}
-				handler(w, r)
-			})
-		}
+		methodHandlers := methodHandlers
+		mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			handler, ok := methodHandlers[r.Method]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			handler(w, r)
+		})
 	}
 
 	ts := httptest.NewServer(mux)
@@ -0,0 +1,248 @@
+package testserver
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"code.bankrs.com/bosgo"
+)
+
+// seedCatalog adds the categories, providers and bank directory every server
+// starts with. The caller must hold s.mu or own s exclusively.
+func (s *Server) seedCatalog() {
+	s.Categories = bosgo.CategoryList{
+		{ID: 1, Names: map[string]string{"en": "Salary", "de": "Gehalt"}, Group: "income"},
+		{ID: 2, Names: map[string]string{"en": "Interest", "de": "Zinsen"}, Group: "income"},
+		{ID: 3, Names: map[string]string{"en": "Rent", "de": "Miete"}, Group: "expenses"},
+		{ID: 4, Names: map[string]string{"en": "Groceries", "de": "Lebensmittel"}, Group: "expenses"},
+		{ID: 5, Names: map[string]string{"en": "Shopping", "de": "Einkaufen"}, Group: "expenses"},
+		{ID: 6, Names: map[string]string{"en": "Transport", "de": "Verkehr"}, Group: "expenses"},
+		{ID: 7, Names: map[string]string{"en": "Insurance", "de": "Versicherung"}, Group: "expenses"},
+		{ID: 8, Names: map[string]string{"en": "Transfers", "de": "Umbuchungen"}, Group: "transfers"},
+	}
+
+	for _, p := range []bosgo.Provider{
+		bankProvider("DE-BIN-10010010", "Postbank", "Berlin", "10916"),
+		bankProvider("DE-BIN-20070024", "Deutsche Bank", "Hamburg", "20079"),
+		bankProvider("DE-BIN-37040044", "Commerzbank", "Köln", "50667"),
+		bankProvider("DE-BIN-50010517", "ING-DiBa", "Frankfurt am Main", "60628"),
+	} {
+		s.Providers[p.ID] = p
+	}
+
+	s.Banks = map[string]bosgo.IBANBank{
+		"DE10010010": {ID: "PBNKDEFFXXX", Label: "Postbank", Country: "DE", Provider: "BIC", ServiceContext: "SEPA"},
+		"DE20070024": {ID: "DEUTDEDBHAM", Label: "Deutsche Bank", Country: "DE", Provider: "BIC", ServiceContext: "SEPA"},
+		"DE37040044": {ID: "COBADEFFXXX", Label: "Commerzbank", Country: "DE", Provider: "BIC", ServiceContext: "SEPA"},
+		"DE50010517": {ID: "INGDDEFFXXX", Label: "ING-DiBa", Country: "DE", Provider: "BIC", ServiceContext: "SEPA"},
+		"GBNWBK":     {ID: "NWBKGB2LXXX", Label: "National Westminster Bank", Country: "GB", Provider: "BIC", ServiceContext: "SEPA"},
+		"NLABNA":     {ID: "ABNANL2AXXX", Label: "ABN AMRO", Country: "NL", Provider: "BIC", ServiceContext: "SEPA"},
+	}
+}
+
+// bankProvider returns a German bank provider with login and PIN challenges.
+func bankProvider(id, name, city, postalCode string) bosgo.Provider {
+	return bosgo.Provider{
+		ID:         id,
+		Name:       name,
+		Country:    "DE",
+		Address:    city,
+		PostalCode: postalCode,
+		Operations: bosgo.ProviderOperations{
+			Adapter: "testserver",
+			AllowedOperations: bosgo.ProviderAllowedOperations{
+				PaymentTransfer:  true,
+				AccountStatement: true,
+				AccountBalance:   true,
+			},
+		},
+		Challenges: []bosgo.ChallengeSpec{
+			{ID: ChallengeLogin, Description: "Login name", Type: bosgo.ChallengeTypeAlphaNumeric},
+			{ID: ChallengePIN, Description: "PIN", Type: bosgo.ChallengeTypeNumeric, Secure: true},
+		},
+	}
+}
+
+// AddProvider adds a provider to the catalog or replaces the one with the same ID.
+func (s *Server) AddProvider(p bosgo.Provider) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Providers[p.ID] = p
+}
+
+// SetCategories replaces the categories.
+func (s *Server) SetCategories(categories bosgo.CategoryList) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Categories = categories
+}
+
+// AddBank adds a bank to the directory used to describe IBANs. The bank is
+// found for IBANs with the country code and national bank code, for example
+// "DE" and "37040044".
+func (s *Server) AddBank(country, bankCode string, bank bosgo.IBANBank) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Banks[country+bankCode] = bank
+}
+
+func (s *Server) handleCategories(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(w, "405 Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if _, ok := s.requireApp(w, req); !ok {
+		return
+	}
+
+	s.mu.Lock()
+	categories := s.Categories
+	s.mu.Unlock()
+	if categories == nil {
+		categories = bosgo.CategoryList{}
+	}
+	s.sendJSON(w, http.StatusOK, categories)
+}
+
+func (s *Server) handleProviders(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(w, "405 Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if _, ok := s.requireApp(w, req); !ok {
+		return
+	}
+
+	terms := strings.Fields(strings.ToLower(req.URL.Query().Get("q")))
+
+	s.mu.Lock()
+	results := bosgo.ProviderSearchResults{}
+	for _, p := range s.Providers {
+		if score := providerScore(p, terms); score > 0 || len(terms) == 0 {
+			results = append(results, bosgo.ProviderSearchResult{Score: score, Provider: p})
+		}
+	}
+	s.mu.Unlock()
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].Provider.Name < results[j].Provider.Name
+	})
+	s.sendJSON(w, http.StatusOK, results)
+}
+
+// providerScore rates how well a provider matches the search terms between 0
+// and 1. Matches of the ID or the beginning of a word of the name count most.
+func providerScore(p bosgo.Provider, terms []string) float64 {
+	if len(terms) == 0 {
+		return 0
+	}
+
+	id := strings.ToLower(p.ID)
+	name := strings.ToLower(p.Name)
+	other := strings.ToLower(strings.Join([]string{p.Description, p.Address, p.PostalCode, p.Country, p.URL}, " "))
+
+	var total float64
+	for _, t := range terms {
+		switch {
+		case id == t || strings.HasSuffix(id, "-"+t):
+			total += 1
+		case hasWordPrefix(name, t):
+			total += 0.9
+		case strings.Contains(name, t):
+			total += 0.6
+		case strings.Contains(id, t) || strings.Contains(other, t):
+			total += 0.4
+		default:
+			// Every term must match somewhere
+			return 0
+		}
+	}
+	return total / float64(len(terms))
+}
+
+func hasWordPrefix(s, prefix string) bool {
+	for _, w := range strings.FieldsFunc(s, func(r rune) bool { return r == ' ' || r == '-' }) {
+		if strings.HasPrefix(w, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) handleProvider(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(w, "405 Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if _, ok := s.requireApp(w, req); !ok {
+		return
+	}
+
+	s.mu.Lock()
+	p, exists := s.Providers[strings.TrimPrefix(req.URL.Path, "/v1/providers/")]
+	s.mu.Unlock()
+	if !exists {
+		s.sendError(w, http.StatusNotFound, "resource_not_found")
+		return
+	}
+	s.sendJSON(w, http.StatusOK, p)
+}
+
+func (s *Server) handleIBAN(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(w, "405 Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if _, ok := s.requireApp(w, req); !ok {
+		return
+	}
+
+	iban := strings.ToUpper(strings.TrimPrefix(req.URL.Path, "/v1/iban/"))
+	if !validIBAN(iban) {
+		s.sendError(w, http.StatusBadRequest, "validation_bad_parameters")
+		return
+	}
+
+	details := bosgo.IBANDetails{
+		Account: bosgo.IBANAccount{IBAN: iban, Provider: "IBO"},
+		Banks:   []bosgo.IBANBank{},
+	}
+	s.mu.Lock()
+	for key, bank := range s.Banks {
+		if len(key) > 2 && key[:2] == iban[:2] && strings.HasPrefix(iban[4:], key[2:]) {
+			details.Banks = append(details.Banks, bank)
+		}
+	}
+	s.mu.Unlock()
+
+	s.sendJSON(w, http.StatusOK, details)
+}
+
+// validIBAN reports whether iban is well formed and has correct check digits.
+func validIBAN(iban string) bool {
+	if len(iban) < 15 || len(iban) > 34 {
+		return false
+	}
+	for i, c := range iban {
+		letter := c >= 'A' && c <= 'Z'
+		digit := c >= '0' && c <= '9'
+		if (i < 2 && !letter) || (i >= 2 && i < 4 && !digit) || (!letter && !digit) {
+			return false
+		}
+	}
+
+	// ISO 7064 MOD 97-10 over the IBAN with the first four characters moved to the end
+	rem := 0
+	for _, c := range iban[4:] + iban[:4] {
+		if c >= 'A' && c <= 'Z' {
+			rem = (rem*100 + int(c-'A') + 10) % 97
+			continue
+		}
+		rem = (rem*10 + int(c-'0')) % 97
+	}
+	return rem == 1
+}
@@ -0,0 +1,145 @@
+package testserver
+
+import (
+	"testing"
+
+	"code.bankrs.com/bosgo"
+)
+
+func TestProviderSearch(t *testing.T) {
+	s := NewWithDefaults()
+	if testing.Verbose() {
+		s.SetLogger(t)
+	}
+	defer s.Close()
+
+	s.AddProvider(bosgo.Provider{ID: "DE-BIN-12345678", Name: "Testbank Nord", Address: "Kiel"})
+	appClient := bosgo.NewAppClient(s.Client(), s.Addr(), DefaultApplicationID)
+
+	testCases := []struct {
+		query string
+		want  []string
+	}{
+		{"default", []string{DefaultProviderID}},
+		{"testbank", []string{"DE-BIN-12345678"}},
+		{"kiel", []string{"DE-BIN-12345678"}},
+		{"37040044", []string{"DE-BIN-37040044"}},
+		{"bank", []string{DefaultProviderID, "DE-BIN-20070024", "DE-BIN-37040044", "DE-BIN-10010010", "DE-BIN-12345678"}},
+		{"nowhere", nil},
+	}
+
+	for _, tc := range testCases {
+		res, err := appClient.Providers.Search(tc.query).Send()
+		if err != nil {
+			t.Fatalf("%s: failed to search providers: %v", tc.query, err)
+		}
+		var ids []string
+		for _, r := range *res {
+			ids = append(ids, r.Provider.ID)
+		}
+		if len(ids) != len(tc.want) {
+			t.Errorf("%s: got %v, want %v", tc.query, ids, tc.want)
+			continue
+		}
+		for i := range ids {
+			if ids[i] != tc.want[i] {
+				t.Errorf("%s: got %v, want %v", tc.query, ids, tc.want)
+				break
+			}
+		}
+	}
+}
+
+func TestProviderGet(t *testing.T) {
+	s := NewWithDefaults()
+	if testing.Verbose() {
+		s.SetLogger(t)
+	}
+	defer s.Close()
+
+	appClient := bosgo.NewAppClient(s.Client(), s.Addr(), DefaultApplicationID)
+	p, err := appClient.Providers.Get(DefaultProviderID).Send()
+	if err != nil {
+		t.Fatalf("failed to get provider: %v", err)
+	}
+	if len(p.Challenges) != 2 || !p.Challenges[1].Secure || !p.Operations.AllowedOperations.PaymentTransfer {
+		t.Errorf("provider: got %+v", p)
+	}
+
+	if _, err := appClient.Providers.Get("unknown").Send(); err == nil {
+		t.Errorf("got unknown provider, wanted error")
+	}
+}
+
+func TestCategories(t *testing.T) {
+	s := NewWithDefaults()
+	if testing.Verbose() {
+		s.SetLogger(t)
+	}
+	defer s.Close()
+
+	appClient := bosgo.NewAppClient(s.Client(), s.Addr(), DefaultApplicationID)
+	list, err := appClient.Categories.List().Send()
+	if err != nil {
+		t.Fatalf("failed to list categories: %v", err)
+	}
+	if len(*list) == 0 || (*list)[0].Names["de"] == "" || (*list)[0].Names["en"] == "" {
+		t.Errorf("categories: got %+v", *list)
+	}
+
+	s.SetCategories(bosgo.CategoryList{{ID: 42, Names: map[string]string{"en": "Other"}}})
+	list, err = appClient.Categories.List().Send()
+	if err != nil {
+		t.Fatalf("failed to list categories: %v", err)
+	}
+	if len(*list) != 1 || (*list)[0].ID != 42 {
+		t.Errorf("categories after set: got %+v", *list)
+	}
+}
+
+func TestIBANValidate(t *testing.T) {
+	s := NewWithDefaults()
+	if testing.Verbose() {
+		s.SetLogger(t)
+	}
+	defer s.Close()
+
+	s.AddBank("DE", "12345678", bosgo.IBANBank{ID: "TESTDEFFXXX", Label: "Testbank"})
+	appClient := bosgo.NewAppClient(s.Client(), s.Addr(), DefaultApplicationID)
+
+	testCases := []struct {
+		iban  string
+		valid bool
+		bank  string
+	}{
+		{"DE89370400440532013000", true, "COBADEFFXXX"},
+		{"GB29NWBK60161331926819", true, "NWBKGB2LXXX"},
+		{"DE44123456780000000000", true, "TESTDEFFXXX"},
+		{"DE84200700245353762745", true, "DEUTDEDBHAM"},
+		{"DE14500105000000000000", true, ""},
+		{"DE88370400440532013000", false, ""},
+		{"DE8937040044", false, ""},
+		{"XX89370400440532013000", false, ""},
+	}
+
+	for _, tc := range testCases {
+		details, err := appClient.IBAN.Validate(tc.iban).Send()
+		if !tc.valid {
+			if err == nil {
+				t.Errorf("%s: got no error, wanted one", tc.iban)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: failed to validate: %v", tc.iban, err)
+			continue
+		}
+		var bank string
+		if len(details.Banks) > 0 {
+			bank = details.Banks[0].ID
+		}
+		if bank != tc.bank {
+			t.Errorf("%s: got bank %q, want %q", tc.iban, bank, tc.bank)
+		}
+	}
+}
@@ -0,0 +1,278 @@
+package testserver
+
+import (
+	"sync"
+	"time"
+
+	"code.bankrs.com/bosgo"
+)
+
+// Clock tells the server the time. It drives the progress of jobs, the expiry
+// of consents and sessions and the execution of scheduled and repeated
+// transactions.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+// FakeClock is a Clock that only moves when it is advanced. It is safe for
+// concurrent use.
+type FakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewFakeClock returns a clock stopped at now.
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+// Now returns the time of the clock.
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Advance moves the clock forward by d.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// Set moves the clock to t.
+func (c *FakeClock) Set(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = t
+}
+
+// Timing configures how long things take on the server. Zero durations keep
+// jobs completing immediately and consents and sessions valid forever.
+type Timing struct {
+	JobAuthentication time.Duration // time a job stays unauthenticated before its answers are checked
+	JobImport         time.Duration // time an authenticated job takes to import the access
+	ConsentTTL        time.Duration // validity of the consent given when an access is added or refreshed
+	SessionTTL        time.Duration // validity of user and developer session tokens
+}
+
+// SetClock replaces the clock of the server, which is the system clock by
+// default.
+func (s *Server) SetClock(c Clock) {
+	s.clockMu.Lock()
+	defer s.clockMu.Unlock()
+	s.clock = c
+}
+
+// SetTiming sets the durations of jobs, consents and sessions.
+func (s *Server) SetTiming(t Timing) {
+	s.clockMu.Lock()
+	defer s.clockMu.Unlock()
+	s.timing = t
+}
+
+// now returns the time of the server's clock. It may be called while holding
+// s.mu.
+func (s *Server) now() time.Time {
+	s.clockMu.Lock()
+	defer s.clockMu.Unlock()
+	if s.clock == nil {
+		return time.Now()
+	}
+	return s.clock.Now()
+}
+
+func (s *Server) getTiming() Timing {
+	s.clockMu.Lock()
+	defer s.clockMu.Unlock()
+	return s.timing
+}
+
+// sessionExpiry returns the expiry of a session token issued now, or the zero
+// time if sessions do not expire. It may be called while holding s.mu.
+func (s *Server) sessionExpiry() time.Time {
+	if ttl := s.getTiming().SessionTTL; ttl > 0 {
+		return s.now().Add(ttl)
+	}
+	return time.Time{}
+}
+
+// tokenValid reports whether a session token has not expired and forgets it
+// if it has. The caller must hold s.mu.
+func (s *Server) tokenValid(token string) bool {
+	expiry, exists := s.tokenExpiry[token]
+	if !exists || s.now().Before(expiry) {
+		return true
+	}
+	delete(s.tokenExpiry, token)
+	delete(s.UserTokens, token)
+	delete(s.DevTokens, token)
+	return false
+}
+
+// consentExpiry returns the expiry of a consent given now, or the zero time if
+// consents do not expire.
+func (s *Server) consentExpiry() time.Time {
+	if ttl := s.getTiming().ConsentTTL; ttl > 0 {
+		return s.now().Add(ttl)
+	}
+	return time.Time{}
+}
+
+// consentExpired reports whether the consent of the user's access to the
+// provider has expired.
+func (s *Server) consentExpired(user User, providerID string) bool {
+	now := s.now()
+	for _, ac := range user.Accesses {
+		if ac.ProviderID == providerID && !ac.ConsentExpiration.IsZero() && !now.Before(ac.ConsentExpiration) {
+			return true
+		}
+	}
+	return false
+}
+
+// executeTransactions books the scheduled transactions of the user that are
+// due and the occurrences of repeated transactions that have become due since
+// it was last called for the user, except those of recurring transfers. The
+// caller must hold s.mu.
+func (s *Server) executeTransactions(userID string) {
+	user, exists := s.Users[userID]
+	if !exists {
+		return
+	}
+	now := s.now()
+	changed := false
+
+	var pending []bosgo.Transaction
+	for _, tx := range user.ScheduledTransactions {
+		if tx.EntryDate.After(now) {
+			pending = append(pending, tx)
+			continue
+		}
+		user.Transactions = append(user.Transactions, tx)
+		changed = true
+	}
+	if changed {
+		user.ScheduledTransactions = pending
+	}
+
+	switch {
+	case user.ExecutedUntil.IsZero():
+		// Repeated transactions are not executed retroactively
+		user.ExecutedUntil = now
+		changed = true
+	case now.After(user.ExecutedUntil):
+		for _, rtx := range user.RepeatedTransactions {
+			if _, ordered := s.RecurringTransfers[rtx.RemoteID]; ordered {
+				// Recurring transfers are booked by their orders
+				continue
+			}
+			for _, t := range occurrences(rtx.Schedule, user.ExecutedUntil, now) {
+				tx := bosgo.Transaction{
+					ID:             s.nextIDLocked(),
+					AccessID:       rtx.AccessID,
+					UserAccountID:  rtx.UserAccountID,
+					UserAccount:    rtx.UserAccount,
+					Amount:         rtx.Amount,
+					EntryDate:      t,
+					SettlementDate: t,
+					Usage:          rtx.Usage,
+					Counterparty:   bosgo.Counterparty{Account: rtx.RemoteAccount},
+				}
+				user.Transactions = append(user.Transactions, tx)
+			}
+		}
+		user.ExecutedUntil = now
+		changed = true
+	}
+
+	if changed {
+		s.Users[userID] = user
+	}
+}
+
+// occurrences returns the dates of the schedule after from and not after to.
+func occurrences(r bosgo.RecurrenceRule, from, to time.Time) []time.Time {
+	if r.Start.IsZero() {
+		return nil
+	}
+	interval := r.Interval
+	if interval < 1 {
+		interval = 1
+	}
+
+	var dates []time.Time
+	for i := skipOccurrences(r, interval, from); ; i++ {
+		var t time.Time
+		switch r.Frequency {
+		case bosgo.FrequencyOnce:
+			if i > 0 {
+				return dates
+			}
+			t = r.Start
+		case bosgo.FrequencyDaily:
+			t = r.Start.AddDate(0, 0, i*interval)
+		case bosgo.FrequencyWeekly:
+			t = r.Start.AddDate(0, 0, 7*i*interval)
+		case bosgo.FrequencyMonthly, bosgo.FrequencyYearly:
+			months := i * interval
+			if r.Frequency == bosgo.FrequencyYearly {
+				months *= 12
+			}
+			day := r.Start.Day()
+			if r.ByDay > 0 {
+				day = r.ByDay
+			}
+			first := time.Date(r.Start.Year(), r.Start.Month()+time.Month(months), 1, r.Start.Hour(), r.Start.Minute(), r.Start.Second(), 0, r.Start.Location())
+			// Days beyond the end of a month fall on its last day
+			if last := first.AddDate(0, 1, -1).Day(); day > last {
+				day = last
+			}
+			t = first.AddDate(0, 0, day-1)
+			if t.Before(r.Start) {
+				continue
+			}
+		default:
+			return nil
+		}
+
+		if t.After(to) || (!r.Until.IsZero() && t.After(r.Until)) {
+			return dates
+		}
+		if t.After(from) {
+			dates = append(dates, t)
+		}
+	}
+}
+
+// skipOccurrences returns the number of occurrences of the schedule that are
+// known to lie before from, so that occurrences need not step through the
+// whole history of a schedule. It stays one interval short of from to allow
+// for days shortened by daylight saving time and months shorter than the
+// day of the schedule.
+func skipOccurrences(r bosgo.RecurrenceRule, interval int, from time.Time) int {
+	if !from.After(r.Start) {
+		return 0
+	}
+	var n int
+	switch r.Frequency {
+	case bosgo.FrequencyDaily:
+		n = int(from.Sub(r.Start)/(24*time.Hour)) / interval
+	case bosgo.FrequencyWeekly:
+		n = int(from.Sub(r.Start)/(7*24*time.Hour)) / interval
+	case bosgo.FrequencyMonthly, bosgo.FrequencyYearly:
+		months := (from.Year()-r.Start.Year())*12 + int(from.Month()-r.Start.Month())
+		if r.Frequency == bosgo.FrequencyYearly {
+			interval *= 12
+		}
+		n = months / interval
+	}
+	if n < 1 {
+		return 0
+	}
+	return n - 1
+}
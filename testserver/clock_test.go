@@ -0,0 +1,395 @@
+package testserver
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"code.bankrs.com/bosgo"
+)
+
+func TestJobStagesWithClock(t *testing.T) {
+	s := NewWithDefaults()
+	if testing.Verbose() {
+		s.SetLogger(t)
+	}
+	defer s.Close()
+
+	clock := NewFakeClock(time.Now())
+	s.SetClock(clock)
+	s.SetTiming(Timing{JobAuthentication: 10 * time.Second, JobImport: 20 * time.Second})
+
+	userClient := loginUser(t, s)
+	uri := startAccess(t, userClient, false)
+
+	steps := []struct {
+		advance time.Duration
+		stage   bosgo.JobStage
+	}{
+		{0, bosgo.JobStageUnauthenticated},
+		{9 * time.Second, bosgo.JobStageUnauthenticated},
+		{time.Second, bosgo.JobStageAuthenticated},
+		{19 * time.Second, bosgo.JobStageAuthenticated},
+		{time.Second, bosgo.JobStageImported},
+	}
+	for i, st := range steps {
+		clock.Advance(st.advance)
+		status := jobStatus(t, userClient, uri)
+		if status.Stage != st.stage {
+			t.Fatalf("step %d: got stage %v, wanted %v", i, status.Stage, st.stage)
+		}
+		if status.Finished != (st.stage == bosgo.JobStageImported) {
+			t.Errorf("step %d: got finished %v in stage %v", i, status.Finished, status.Stage)
+		}
+	}
+
+	accesses, err := userClient.Accesses.List().Send()
+	if err != nil {
+		t.Fatalf("failed to list accesses: %v", err)
+	}
+	if len(accesses.Accesses) != 1 {
+		t.Errorf("got %d accesses, wanted 1", len(accesses.Accesses))
+	}
+}
+
+func TestJobParallelPolls(t *testing.T) {
+	s := NewWithDefaults()
+	if testing.Verbose() {
+		s.SetLogger(t)
+	}
+	defer s.Close()
+
+	clock := NewFakeClock(time.Now())
+	s.SetClock(clock)
+	s.SetTiming(Timing{JobImport: time.Minute})
+
+	userClient := loginUser(t, s)
+	uri := startAccess(t, userClient, false)
+	if status := jobStatus(t, userClient, uri); status.Stage != bosgo.JobStageAuthenticated {
+		t.Fatalf("got stage %v, wanted %v", status.Stage, bosgo.JobStageAuthenticated)
+	}
+
+	// All polls read the job before any of them stores it, but only one
+	// imports the access
+	clock.Advance(time.Minute)
+	const polls = 10
+	var ready, wg sync.WaitGroup
+	ready.Add(polls)
+	for i := 0; i < polls; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			first := true
+			s.updateJob(strings.TrimPrefix(uri, "/jobs/"), func(j *Job, fx *jobEffects) {
+				if first {
+					first = false
+					ready.Done()
+					ready.Wait()
+				}
+				s.advanceJob(j, fx)
+			})
+		}()
+	}
+	wg.Wait()
+
+	accesses, err := userClient.Accesses.List().Send()
+	if err != nil {
+		t.Fatalf("failed to list accesses: %v", err)
+	}
+	if len(accesses.Accesses) != 1 {
+		t.Errorf("got %d accesses, wanted 1", len(accesses.Accesses))
+	}
+}
+
+func TestJobAnswersBeforeAuthentication(t *testing.T) {
+	s := NewWithDefaults()
+	if testing.Verbose() {
+		s.SetLogger(t)
+	}
+	defer s.Close()
+
+	clock := NewFakeClock(time.Now())
+	s.SetClock(clock)
+	s.SetTiming(Timing{JobAuthentication: time.Minute})
+
+	userClient := loginUser(t, s)
+	job, err := userClient.Accesses.Add(DefaultProviderID).
+		ChallengeAnswer(bosgo.ChallengeAnswer{ID: ChallengeLogin, Value: DefaultAccessLogin}).
+		Send()
+	if err != nil {
+		t.Fatalf("failed to add access: %v", err)
+	}
+
+	// Answers given early are kept until the job authenticates
+	answer(t, userClient, job.URI, ChallengePIN, DefaultAccessPIN)
+	if status := jobStatus(t, userClient, job.URI); status.Stage != bosgo.JobStageUnauthenticated {
+		t.Fatalf("got stage %v, wanted %v", status.Stage, bosgo.JobStageUnauthenticated)
+	}
+
+	clock.Advance(time.Minute)
+	if status := jobStatus(t, userClient, job.URI); status.Stage != bosgo.JobStageImported {
+		t.Errorf("got stage %v, wanted %v", status.Stage, bosgo.JobStageImported)
+	}
+}
+
+func TestConsentExpiration(t *testing.T) {
+	s := NewWithDefaults()
+	if testing.Verbose() {
+		s.SetLogger(t)
+	}
+	defer s.Close()
+
+	start := time.Date(2020, 3, 1, 12, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(start)
+	s.SetClock(clock)
+	s.SetTiming(Timing{ConsentTTL: 90 * 24 * time.Hour})
+
+	userClient := loginUser(t, s)
+	accessID, _, err := addDefaultAccess(userClient, true)
+	if err != nil {
+		t.Fatalf("failed to add access: %v", err)
+	}
+	access, err := userClient.Accesses.Get(accessID).Send()
+	if err != nil {
+		t.Fatalf("failed to get access: %v", err)
+	}
+	if want := start.Add(90 * 24 * time.Hour); !access.ConsentExpiration.Equal(want) {
+		t.Errorf("got consent expiration %v, wanted %v", access.ConsentExpiration, want)
+	}
+
+	refresh := func() string {
+		t.Helper()
+		job, err := userClient.Accesses.Refresh(accessID).Send()
+		if err != nil {
+			t.Fatalf("failed to refresh access: %v", err)
+		}
+		return job.URI
+	}
+
+	if status := jobStatus(t, userClient, refresh()); status.Stage != bosgo.JobStageImported {
+		t.Fatalf("got stage %v, wanted %v", status.Stage, bosgo.JobStageImported)
+	}
+
+	// Stored answers are not used once the consent has expired
+	clock.Advance(91 * 24 * time.Hour)
+	uri := refresh()
+	status := jobStatus(t, userClient, uri)
+	if status.Stage != bosgo.JobStageChallenge || !hasProblem(status.Challenge.LastProblems, "consent_expired") {
+		t.Fatalf("got stage %v and challenge %+v, wanted expired consent", status.Stage, status.Challenge)
+	}
+	err = userClient.Jobs.Answer(uri).
+		ChallengeAnswer(bosgo.ChallengeAnswer{ID: ChallengeLogin, Value: DefaultAccessLogin}).
+		ChallengeAnswer(bosgo.ChallengeAnswer{ID: ChallengePIN, Value: DefaultAccessPIN}).
+		Send()
+	if err != nil {
+		t.Fatalf("failed to answer challenges: %v", err)
+	}
+	if status := jobStatus(t, userClient, uri); status.Stage != bosgo.JobStageImported {
+		t.Fatalf("got stage %v, wanted %v", status.Stage, bosgo.JobStageImported)
+	}
+
+	access, err = userClient.Accesses.Get(accessID).Send()
+	if err != nil {
+		t.Fatalf("failed to get access: %v", err)
+	}
+	if want := clock.Now().Add(90 * 24 * time.Hour); !access.ConsentExpiration.Equal(want) {
+		t.Errorf("got renewed consent expiration %v, wanted %v", access.ConsentExpiration, want)
+	}
+}
+
+func TestSessionTTL(t *testing.T) {
+	s := NewWithDefaults()
+	if testing.Verbose() {
+		s.SetLogger(t)
+	}
+	defer s.Close()
+
+	clock := NewFakeClock(time.Now())
+	s.SetClock(clock)
+	s.SetTiming(Timing{SessionTTL: time.Hour})
+
+	userClient := loginUser(t, s)
+	devClient := newDevClient(t, s)
+
+	clock.Advance(59 * time.Minute)
+	if _, err := userClient.Accesses.List().Send(); err != nil {
+		t.Fatalf("failed to list accesses before expiry: %v", err)
+	}
+	if _, err := devClient.Profile().Send(); err != nil {
+		t.Fatalf("failed to get profile before expiry: %v", err)
+	}
+
+	clock.Advance(time.Minute)
+	_, err := userClient.Accesses.List().Send()
+	if berr, ok := err.(*bosgo.Error); !ok || berr.StatusCode != http.StatusUnauthorized {
+		t.Errorf("user session: got error %v, wanted status %d", err, http.StatusUnauthorized)
+	}
+	_, err = devClient.Profile().Send()
+	if berr, ok := err.(*bosgo.Error); !ok || berr.StatusCode != http.StatusUnauthorized {
+		t.Errorf("developer session: got error %v, wanted status %d", err, http.StatusUnauthorized)
+	}
+}
+
+func TestExecuteTransactions(t *testing.T) {
+	s := NewWithDefaults()
+	if testing.Verbose() {
+		s.SetLogger(t)
+	}
+	defer s.Close()
+
+	start := time.Date(2020, 1, 15, 0, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(start)
+	s.SetClock(clock)
+
+	userClient := loginUser(t, s)
+	if _, err := userClient.Transactions.List().Send(); err != nil {
+		t.Fatalf("failed to list transactions: %v", err)
+	}
+
+	amount := &bosgo.MoneyAmount{Currency: "EUR", Value: "-10.00"}
+	err := s.AssignTransactions(DefaultUsername, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.AssignScheduledTransactions(DefaultUsername, []bosgo.Transaction{
+		{ID: 1, Amount: amount, EntryDate: start.AddDate(0, 0, 10), Usage: "scheduled"},
+		{ID: 2, Amount: amount, EntryDate: start.AddDate(0, 3, 0), Usage: "later"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.AssignRepeatedTransactions(DefaultUsername, []bosgo.RepeatedTransaction{
+		{
+			ID:     3,
+			Amount: amount,
+			Usage:  "rent",
+			Schedule: bosgo.RecurrenceRule{
+				Start:     time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC),
+				Frequency: bosgo.FrequencyMonthly,
+				Interval:  1,
+				ByDay:     31,
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clock.Advance(40 * 24 * time.Hour) // until 2020-02-24
+	page, err := userClient.Transactions.List().Send()
+	if err != nil {
+		t.Fatalf("failed to list transactions: %v", err)
+	}
+	var usages []string
+	for _, tx := range page.Transactions {
+		usages = append(usages, tx.Usage)
+	}
+	if len(usages) != 2 || usages[0] != "scheduled" || usages[1] != "rent" {
+		t.Fatalf("got transactions %v, wanted [scheduled rent]", usages)
+	}
+	if want := time.Date(2020, 1, 31, 0, 0, 0, 0, time.UTC); !page.Transactions[1].EntryDate.Equal(want) {
+		t.Errorf("got rent date %v, wanted %v", page.Transactions[1].EntryDate, want)
+	}
+
+	scheduled, err := userClient.ScheduledTransactions.List().Send()
+	if err != nil {
+		t.Fatalf("failed to list scheduled transactions: %v", err)
+	}
+	if len(scheduled) != 1 || scheduled[0].Usage != "later" {
+		t.Errorf("got scheduled transactions %+v, wanted the later one", scheduled)
+	}
+}
+
+func TestExecuteOverdueTransactions(t *testing.T) {
+	s := NewWithDefaults()
+	if testing.Verbose() {
+		s.SetLogger(t)
+	}
+	defer s.Close()
+
+	start := time.Date(2020, 1, 15, 0, 0, 0, 0, time.UTC)
+	s.SetClock(NewFakeClock(start))
+
+	amount := &bosgo.MoneyAmount{Currency: "EUR", Value: "-10.00"}
+	if err := s.AssignTransactions(DefaultUsername, nil); err != nil {
+		t.Fatal(err)
+	}
+	err := s.AssignScheduledTransactions(DefaultUsername, []bosgo.Transaction{
+		{ID: 1, Amount: amount, EntryDate: start.AddDate(0, 0, -1), Usage: "overdue"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Scheduled transactions that are due are booked by the first request too
+	userClient := loginUser(t, s)
+	page, err := userClient.Transactions.List().Send()
+	if err != nil {
+		t.Fatalf("failed to list transactions: %v", err)
+	}
+	if len(page.Transactions) != 1 || page.Transactions[0].Usage != "overdue" {
+		t.Errorf("got transactions %+v, wanted the overdue one", page.Transactions)
+	}
+}
+
+func TestOccurrences(t *testing.T) {
+	day := func(y int, m time.Month, d int) time.Time { return time.Date(y, m, d, 0, 0, 0, 0, time.UTC) }
+
+	testCases := []struct {
+		rule     bosgo.RecurrenceRule
+		from, to time.Time
+		want     []time.Time
+	}{
+		{
+			rule: bosgo.RecurrenceRule{Start: day(2020, 1, 31), Frequency: bosgo.FrequencyMonthly, Interval: 1},
+			from: day(2020, 1, 1), to: day(2020, 4, 1),
+			want: []time.Time{day(2020, 1, 31), day(2020, 2, 29), day(2020, 3, 31)},
+		},
+		{
+			rule: bosgo.RecurrenceRule{Start: day(2020, 1, 1), Until: day(2020, 1, 20), Frequency: bosgo.FrequencyWeekly, Interval: 2},
+			from: day(2019, 12, 1), to: day(2020, 2, 1),
+			want: []time.Time{day(2020, 1, 1), day(2020, 1, 15)},
+		},
+		{
+			rule: bosgo.RecurrenceRule{Start: day(2020, 1, 1), Frequency: bosgo.FrequencyOnce},
+			from: day(2020, 1, 1), to: day(2021, 1, 1),
+			want: nil,
+		},
+		{
+			rule: bosgo.RecurrenceRule{Start: day(2018, 5, 10), Frequency: bosgo.FrequencyYearly, ByDay: 1},
+			from: day(2019, 1, 1), to: day(2021, 1, 1),
+			want: []time.Time{day(2019, 5, 1), day(2020, 5, 1)},
+		},
+		// Schedules with a long history
+		{
+			rule: bosgo.RecurrenceRule{Start: day(2000, 1, 1), Frequency: bosgo.FrequencyDaily, Interval: 3},
+			from: day(2020, 3, 1), to: day(2020, 3, 10),
+			want: []time.Time{day(2020, 3, 4), day(2020, 3, 7), day(2020, 3, 10)},
+		},
+		{
+			rule: bosgo.RecurrenceRule{Start: day(1990, 1, 31), Frequency: bosgo.FrequencyMonthly, Interval: 2},
+			from: day(2020, 2, 1), to: day(2020, 6, 1),
+			want: []time.Time{day(2020, 3, 31), day(2020, 5, 31)},
+		},
+		{
+			rule: bosgo.RecurrenceRule{Start: day(1990, 1, 1), Frequency: bosgo.FrequencyWeekly, Interval: 1},
+			from: day(2020, 1, 6), to: day(2020, 1, 20),
+			want: []time.Time{day(2020, 1, 13), day(2020, 1, 20)},
+		},
+	}
+
+	for i, tc := range testCases {
+		got := occurrences(tc.rule, tc.from, tc.to)
+		if len(got) != len(tc.want) {
+			t.Errorf("%d: got %v, wanted %v", i, got, tc.want)
+			continue
+		}
+		for k := range got {
+			if !got[k].Equal(tc.want[k]) {
+				t.Errorf("%d: occurrence %d: got %v, wanted %v", i, k, got[k], tc.want[k])
+			}
+		}
+	}
+}
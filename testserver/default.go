@@ -11,29 +11,48 @@ const (
 	ChallengePIN   = "pin"
 	ChallengeTAN   = "tan"
 
-	DefaultDeveloperID   = "default-dev"
-	DefaultApplicationID = "default-app"
-	DefaultUserID        = "default-user"
-	DefaultUsername      = "username@example.com"
-	DefaultPassword      = "password"
-	DefaultProviderID    = "def-provider-id"
-	DefaultAccessLogin   = "user"
-	DefaultAccessPIN     = "1234"
-	DefaultAuthMethod    = "901"
-	DefaultAuthMessage   = "tan challenge - (enter 4321 as tan)"
-	DefaultAuthAnswer    = "4321"
+	DefaultDeveloperID       = "default-dev"
+	DefaultDeveloperEmail    = "developer@example.com"
+	DefaultDeveloperPassword = "password"
+	DefaultApplicationID     = "default-app"
+	DefaultUserID            = "default-user"
+	DefaultUsername          = "username@example.com"
+	DefaultPassword          = "password"
+	DefaultProviderID        = "def-provider-id"
+	DefaultAccessLogin       = "user"
+	DefaultAccessPIN         = "1234"
+	DefaultAuthMethod        = "901"
+	DefaultAuthMessage       = "tan challenge - (enter 4321 as tan)"
+	DefaultAuthAnswer        = "4321"
 )
 
 // NewWithDefaults creates a new test server with a default developer, application and user account
 func NewWithDefaults() *Server {
 	s := New()
+	s.AddDefaults()
+	return s
+}
+
+// AddDefaults adds the default developer, application, user and access to the server.
+func (s *Server) AddDefaults() {
+	dev := Dev{
+		ID:       DefaultDeveloperID,
+		Email:    DefaultDeveloperEmail,
+		Password: DefaultDeveloperPassword,
+	}
+	s.setDev(dev)
 
 	app := App{
 		ID:          DefaultApplicationID,
 		DeveloperID: DefaultDeveloperID,
+		Label:       "default application",
 	}
 	s.setApp(app)
 
+	provider := bankProvider(DefaultProviderID, "Default Bank", "Berlin", "10115")
+	provider.Description = "Bank of the default access"
+	s.AddProvider(provider)
+
 	user := User{
 		ID:            DefaultUserID,
 		Username:      DefaultUsername,
@@ -120,8 +139,8 @@ func NewWithDefaults() *Server {
 				Currency: "EUR",
 				Value:    "-943.34",
 			},
-			EntryDate:      time.Now().AddDate(0, 0, 1),
-			SettlementDate: time.Now().AddDate(0, 0, 1),
+			EntryDate:      s.now().AddDate(0, 0, 1),
+			SettlementDate: s.now().AddDate(0, 0, 1),
 			Usage:          "Goods bought in future",
 			Counterparty: bosgo.Counterparty{
 				Name: "PayPal Europe Sarl",
@@ -146,8 +165,8 @@ func NewWithDefaults() *Server {
 				Currency: "EUR",
 				Value:    "0.34",
 			},
-			EntryDate:      time.Now().AddDate(0, 0, 1),
-			SettlementDate: time.Now().AddDate(0, 0, 1),
+			EntryDate:      s.now().AddDate(0, 0, 1),
+			SettlementDate: s.now().AddDate(0, 0, 1),
 			Usage:          "Interesting payment",
 			Counterparty:   bosgo.Counterparty{},
 		},
@@ -198,8 +217,6 @@ func NewWithDefaults() *Server {
 		},
 	}
 	s.AddAccess(ad)
-
-	return s
 }
 
 // MakeAccess makes an access with an account
@@ -0,0 +1,675 @@
+package testserver
+
+import (
+	"encoding/base64"
+	"net/http"
+	"sort"
+	"strings"
+
+	"code.bankrs.com/bosgo"
+)
+
+// defaultUserPageSize is the number of users listed when no limit is given.
+const defaultUserPageSize = 100
+
+func (s *Server) getDev(id string) (Dev, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	dev, exists := s.Devs[id]
+	return dev, exists
+}
+
+func (s *Server) setDev(dev Dev) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Devs[dev.ID] = dev
+}
+
+// updateDev applies change to the stored developer with the given ID while
+// holding s.mu, so that concurrent changes are not lost. It returns the
+// changed developer and reports false without storing anything if the
+// developer does not exist or change returns false.
+func (s *Server) updateDev(id string, change func(dev *Dev) bool) (Dev, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	dev, exists := s.Devs[id]
+	if !exists || !change(&dev) {
+		return Dev{}, false
+	}
+	s.Devs[id] = dev
+	return dev, true
+}
+
+// updateApp applies change to the stored application with the given ID like
+// updateDev.
+func (s *Server) updateApp(id string, change func(app *App) bool) (App, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	app, exists := s.Apps[id]
+	if !exists || !change(&app) {
+		return App{}, false
+	}
+	s.Apps[id] = app
+	return app, true
+}
+
+func (s *Server) setDevLoggedIn(id string) string {
+	token := s.nextIDStr()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.DevTokens[token] = id
+	if expiry := s.sessionExpiry(); !expiry.IsZero() {
+		s.tokenExpiry[token] = expiry
+	}
+	return token
+}
+
+func (s *Server) requireDev(w http.ResponseWriter, req *http.Request) (Dev, string, bool) {
+	token := req.Header.Get("X-Token")
+
+	s.mu.Lock()
+	id, exists := s.DevTokens[token]
+	exists = exists && s.tokenValid(token)
+	s.mu.Unlock()
+
+	if !exists {
+		s.sendError(w, http.StatusUnauthorized, "authentication_failed")
+		return Dev{}, "", false
+	}
+	dev, found := s.getDev(id)
+	if !found {
+		s.sendError(w, http.StatusUnauthorized, "authentication_failed")
+		return Dev{}, "", false
+	}
+	return dev, token, true
+}
+
+// requireDevApp returns the application with the given ID or key if it
+// belongs to the developer.
+func (s *Server) requireDevApp(w http.ResponseWriter, dev Dev, id string) (App, bool) {
+	app, exists := s.getApp(id)
+	if !exists {
+		app, exists = s.getAppByKey(id)
+	}
+	if !exists || app.DeveloperID != dev.ID {
+		s.sendError(w, http.StatusNotFound, "resource_not_found")
+		return App{}, false
+	}
+	return app, true
+}
+
+func (s *Server) getAppByKey(key string) (App, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, app := range s.Apps {
+		for _, k := range app.Keys {
+			if k.Key == key {
+				return app, true
+			}
+		}
+	}
+	return App{}, false
+}
+
+// deleteApp removes an application together with its users and their
+// sessions. The caller must hold s.mu.
+func (s *Server) deleteApp(id string) {
+	delete(s.Apps, id)
+	for uid, u := range s.Users {
+		if u.ApplicationID != id {
+			continue
+		}
+		delete(s.Users, uid)
+		for token, tuid := range s.UserTokens {
+			if tuid == uid {
+				delete(s.UserTokens, token)
+				delete(s.tokenExpiry, token)
+			}
+		}
+	}
+}
+
+func (s *Server) handleDevelopers(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodPost:
+		s.handleDeveloperCreate(w, req)
+		return
+	case http.MethodDelete:
+		s.handleDeveloperDelete(w, req)
+		return
+	}
+
+	http.Error(w, "405 Method Not Allowed", http.StatusMethodNotAllowed)
+}
+
+func (s *Server) handleDeveloperCreate(w http.ResponseWriter, req *http.Request) {
+	var creds bosgo.DeveloperCredentials
+	if !s.readJSON(w, req, &creds) {
+		return
+	}
+
+	if creds.Email == "" {
+		s.sendError(w, http.StatusBadRequest, "authentication_email_invalid")
+		return
+	}
+
+	if creds.Password == "" {
+		s.sendError(w, http.StatusBadRequest, "authentication_secret_blank")
+		return
+	}
+
+	dev := Dev{
+		ID:       s.nextIDStr(),
+		Email:    creds.Email,
+		Password: creds.Password,
+	}
+
+	// The email is checked and claimed at once so that concurrent requests
+	// cannot both create it
+	s.mu.Lock()
+	for _, d := range s.Devs {
+		if d.Email == creds.Email {
+			s.mu.Unlock()
+			s.sendError(w, http.StatusBadRequest, "authentication_email_not_unique")
+			return
+		}
+	}
+	s.Devs[dev.ID] = dev
+	s.mu.Unlock()
+
+	token := s.setDevLoggedIn(dev.ID)
+
+	s.sendJSON(w, http.StatusCreated, map[string]string{"token": token})
+}
+
+func (s *Server) handleDeveloperDelete(w http.ResponseWriter, req *http.Request) {
+	dev, _, found := s.requireDev(w, req)
+	if !found {
+		return
+	}
+
+	s.mu.Lock()
+	delete(s.Devs, dev.ID)
+	for token, id := range s.DevTokens {
+		if id == dev.ID {
+			delete(s.DevTokens, token)
+			delete(s.tokenExpiry, token)
+		}
+	}
+	for id, app := range s.Apps {
+		if app.DeveloperID == dev.ID {
+			s.deleteApp(id)
+		}
+	}
+	s.mu.Unlock()
+
+	s.sendNoContent(w)
+}
+
+func (s *Server) handleDevelopersLogin(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "405 Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var creds bosgo.DeveloperCredentials
+	if !s.readJSON(w, req, &creds) {
+		return
+	}
+
+	s.mu.Lock()
+	var dev Dev
+	for _, d := range s.Devs {
+		if d.Email == creds.Email && d.Password == creds.Password {
+			dev = d
+			break
+		}
+	}
+	s.mu.Unlock()
+
+	if dev.ID == "" || creds.Email == "" {
+		s.sendError(w, http.StatusUnauthorized, "authentication_failed")
+		return
+	}
+
+	token := s.setDevLoggedIn(dev.ID)
+	s.sendJSON(w, http.StatusOK, map[string]string{"token": token})
+}
+
+func (s *Server) handleDevelopersLogout(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "405 Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	_, token, found := s.requireDev(w, req)
+	if !found {
+		return
+	}
+
+	s.mu.Lock()
+	delete(s.DevTokens, token)
+	delete(s.tokenExpiry, token)
+	s.mu.Unlock()
+	s.sendNoContent(w)
+}
+
+func (s *Server) handleDevelopersPassword(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "405 Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	dev, _, found := s.requireDev(w, req)
+	if !found {
+		return
+	}
+
+	var pwd struct {
+		OldPassword string `json:"old_password"`
+		NewPassword string `json:"new_password"`
+	}
+	if !s.readJSON(w, req, &pwd) {
+		return
+	}
+
+	if dev.Password != pwd.OldPassword {
+		s.sendError(w, http.StatusUnauthorized, "authentication_failed")
+		return
+	}
+	if pwd.NewPassword == "" {
+		s.sendError(w, http.StatusBadRequest, "authentication_secret_blank")
+		return
+	}
+
+	// The password is checked again in case it changed in the meantime
+	_, changed := s.updateDev(dev.ID, func(dev *Dev) bool {
+		if dev.Password != pwd.OldPassword {
+			return false
+		}
+		dev.Password = pwd.NewPassword
+		return true
+	})
+	if !changed {
+		s.sendError(w, http.StatusUnauthorized, "authentication_failed")
+		return
+	}
+	s.sendNoContent(w)
+}
+
+func (s *Server) handleDevelopersProfile(w http.ResponseWriter, req *http.Request) {
+	dev, _, found := s.requireDev(w, req)
+	if !found {
+		return
+	}
+
+	switch req.Method {
+	case http.MethodGet:
+		s.sendJSON(w, http.StatusOK, dev.Profile)
+		return
+	case http.MethodPut:
+		var profile bosgo.DeveloperProfile
+		if !s.readJSON(w, req, &profile) {
+			return
+		}
+		if _, found := s.updateDev(dev.ID, func(dev *Dev) bool {
+			dev.Profile = profile
+			return true
+		}); !found {
+			s.sendError(w, http.StatusUnauthorized, "authentication_failed")
+			return
+		}
+		s.sendNoContent(w)
+		return
+	}
+
+	http.Error(w, "405 Method Not Allowed", http.StatusMethodNotAllowed)
+}
+
+func (s *Server) handleApplications(w http.ResponseWriter, req *http.Request) {
+	dev, _, found := s.requireDev(w, req)
+	if !found {
+		return
+	}
+
+	switch req.Method {
+	case http.MethodGet:
+		s.mu.Lock()
+		apps := []bosgo.ApplicationMetadata{}
+		for _, app := range s.Apps {
+			if app.DeveloperID == dev.ID {
+				apps = append(apps, bosgo.ApplicationMetadata{ApplicationID: app.ID, Label: app.Label})
+			}
+		}
+		s.mu.Unlock()
+
+		sort.Slice(apps, func(i, j int) bool { return apps[i].ApplicationID < apps[j].ApplicationID })
+		s.sendJSON(w, http.StatusOK, apps)
+		return
+
+	case http.MethodPost:
+		var md bosgo.ApplicationMetadata
+		if !s.readJSON(w, req, &md) {
+			return
+		}
+		app := App{
+			ID:          s.nextIDStr(),
+			DeveloperID: dev.ID,
+			Label:       md.Label,
+		}
+
+		// The developer may have been deleted since the request was
+		// authenticated
+		s.mu.Lock()
+		_, exists := s.Devs[dev.ID]
+		if exists {
+			s.Apps[app.ID] = app
+		}
+		s.mu.Unlock()
+		if !exists {
+			s.sendError(w, http.StatusUnauthorized, "authentication_failed")
+			return
+		}
+		s.sendJSON(w, http.StatusCreated, bosgo.ApplicationMetadata{ApplicationID: app.ID, Label: app.Label})
+		return
+	}
+
+	http.Error(w, "405 Method Not Allowed", http.StatusMethodNotAllowed)
+}
+
+func (s *Server) handleApplication(w http.ResponseWriter, req *http.Request) {
+	dev, _, found := s.requireDev(w, req)
+	if !found {
+		return
+	}
+
+	parts := strings.Split(strings.TrimPrefix(req.URL.Path, "/v1/developers/applications/"), "/")
+	app, exists := s.requireDevApp(w, dev, parts[0])
+	if !exists {
+		return
+	}
+
+	switch {
+	case len(parts) == 1:
+		s.handleApplicationMetadata(w, req, app)
+	case len(parts) == 2 && parts[1] == "keys":
+		s.handleApplicationKeys(w, req, app)
+	case len(parts) == 2 && parts[1] == "settings":
+		s.handleApplicationSettings(w, req, app)
+	default:
+		s.sendError(w, http.StatusNotFound, "resource_not_found")
+	}
+}
+
+func (s *Server) handleApplicationMetadata(w http.ResponseWriter, req *http.Request, app App) {
+	switch req.Method {
+	case http.MethodPut:
+		var md bosgo.ApplicationMetadata
+		if !s.readJSON(w, req, &md) {
+			return
+		}
+		if _, found := s.updateApp(app.ID, func(app *App) bool {
+			app.Label = md.Label
+			return true
+		}); !found {
+			s.sendError(w, http.StatusNotFound, "resource_not_found")
+			return
+		}
+		s.sendNoContent(w)
+		return
+
+	case http.MethodDelete:
+		s.mu.Lock()
+		s.deleteApp(app.ID)
+		s.mu.Unlock()
+		s.sendNoContent(w)
+		return
+	}
+
+	http.Error(w, "405 Method Not Allowed", http.StatusMethodNotAllowed)
+}
+
+func (s *Server) handleApplicationKeys(w http.ResponseWriter, req *http.Request, app App) {
+	switch req.Method {
+	case http.MethodGet:
+		keys := app.Keys
+		if keys == nil {
+			keys = []bosgo.ApplicationKey{}
+		}
+		s.sendJSON(w, http.StatusOK, keys)
+		return
+
+	case http.MethodPost:
+		key := bosgo.ApplicationKey{
+			Key:       s.nextIDStr(),
+			CreatedAt: s.now().UTC(),
+		}
+		if _, found := s.updateApp(app.ID, func(app *App) bool {
+			app.Keys = append(app.Keys[:len(app.Keys):len(app.Keys)], key)
+			return true
+		}); !found {
+			s.sendError(w, http.StatusNotFound, "resource_not_found")
+			return
+		}
+		s.sendJSON(w, http.StatusCreated, key)
+		return
+	}
+
+	http.Error(w, "405 Method Not Allowed", http.StatusMethodNotAllowed)
+}
+
+func (s *Server) handleApplicationSettings(w http.ResponseWriter, req *http.Request, app App) {
+	switch req.Method {
+	case http.MethodGet:
+		s.sendJSON(w, http.StatusOK, app.Settings)
+		return
+
+	case http.MethodPut:
+		var settings struct {
+			BackgroundRefresh *bool `json:"background_refresh"`
+		}
+		if !s.readJSON(w, req, &settings) {
+			return
+		}
+		app, found := s.updateApp(app.ID, func(app *App) bool {
+			if settings.BackgroundRefresh != nil {
+				app.Settings.BackgroundRefresh = *settings.BackgroundRefresh
+			}
+			return true
+		})
+		if !found {
+			s.sendError(w, http.StatusNotFound, "resource_not_found")
+			return
+		}
+		s.sendJSON(w, http.StatusOK, app.Settings)
+		return
+	}
+
+	http.Error(w, "405 Method Not Allowed", http.StatusMethodNotAllowed)
+}
+
+func (s *Server) handleApplicationKey(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodDelete {
+		http.Error(w, "405 Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	dev, _, found := s.requireDev(w, req)
+	if !found {
+		return
+	}
+
+	key := strings.TrimPrefix(req.URL.Path, "/v1/developers/application_keys/")
+	app, exists := s.getAppByKey(key)
+	if !exists || app.DeveloperID != dev.ID {
+		s.sendError(w, http.StatusNotFound, "resource_not_found")
+		return
+	}
+
+	// The key may have been deleted since it was looked up
+	if _, removed := s.updateApp(app.ID, func(app *App) bool {
+		keys := app.Keys[:0:0]
+		for _, k := range app.Keys {
+			if k.Key != key {
+				keys = append(keys, k)
+			}
+		}
+		if len(keys) == len(app.Keys) {
+			return false
+		}
+		app.Keys = keys
+		return true
+	}); !removed {
+		s.sendError(w, http.StatusNotFound, "resource_not_found")
+		return
+	}
+	s.sendNoContent(w)
+}
+
+// requireDevAppHeader returns the developer's application named by the
+// X-Application-Id header.
+func (s *Server) requireDevAppHeader(w http.ResponseWriter, req *http.Request) (App, bool) {
+	dev, _, found := s.requireDev(w, req)
+	if !found {
+		return App{}, false
+	}
+	id := req.Header.Get("X-Application-Id")
+	if id == "" {
+		s.sendError(w, http.StatusUnauthorized, "authentication_app_id_invalid")
+		return App{}, false
+	}
+	return s.requireDevApp(w, dev, id)
+}
+
+// handleDevUsers lists the IDs of the application's users like the API does.
+// Their usernames are looked up with handleDevUser.
+func (s *Server) handleDevUsers(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet && req.Method != http.MethodPost {
+		http.Error(w, "405 Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	app, found := s.requireDevAppHeader(w, req)
+	if !found {
+		return
+	}
+
+	var params bosgo.PageParams
+	if req.Method == http.MethodPost && !s.readJSON(w, req, &params) {
+		return
+	}
+	if params.Limit < 0 {
+		s.sendError(w, http.StatusBadRequest, "validation_bad_parameters")
+		return
+	}
+	if params.Limit == 0 {
+		params.Limit = defaultUserPageSize
+	}
+
+	// The cursor is the encoded ID of the last user of the previous page, so
+	// users added or removed between pages do not shift the listing.
+	var after string
+	if params.Cursor != "" {
+		b, err := base64.RawURLEncoding.DecodeString(params.Cursor)
+		if err != nil {
+			s.sendError(w, http.StatusBadRequest, "validation_bad_parameters")
+			return
+		}
+		after = string(b)
+	}
+
+	s.mu.Lock()
+	var ids []string
+	for id, u := range s.Users {
+		if u.ApplicationID == app.ID && (after == "" || id > after) {
+			ids = append(ids, id)
+		}
+	}
+	s.mu.Unlock()
+	sort.Strings(ids)
+
+	var page bosgo.UserListPage
+	if len(ids) > params.Limit {
+		ids = ids[:params.Limit]
+		page.NextCursor = base64.RawURLEncoding.EncodeToString([]byte(ids[len(ids)-1]))
+	}
+	page.Users = ids
+	s.sendJSON(w, http.StatusOK, page)
+}
+
+func (s *Server) handleDevUser(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(w, "405 Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	app, found := s.requireDevAppHeader(w, req)
+	if !found {
+		return
+	}
+
+	user, exists := s.GetUser(strings.TrimPrefix(req.URL.Path, "/v1/developers/user/"))
+	if !exists || user.ApplicationID != app.ID {
+		s.sendError(w, http.StatusNotFound, "resource_not_found")
+		return
+	}
+
+	s.sendJSON(w, http.StatusOK, bosgo.DevUserInfo{Username: user.Username})
+}
+
+// handleDevUsersReset resets the application's users with the given
+// usernames, not IDs, like the API does.
+func (s *Server) handleDevUsersReset(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "405 Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	app, found := s.requireDevAppHeader(w, req)
+	if !found {
+		return
+	}
+
+	var data struct {
+		Usernames []string `json:"usernames"`
+	}
+	if !s.readJSON(w, req, &data) {
+		return
+	}
+
+	resp := bosgo.ResetUsersResponse{Users: []bosgo.ResetUserOutcome{}}
+	for _, name := range data.Usernames {
+		outcome := bosgo.ResetUserOutcome{Username: name, Problems: []bosgo.Problem{}}
+		user, exists := s.GetUserByName(name)
+		if !exists || user.ApplicationID != app.ID || !s.resetUser(user.ID) {
+			outcome.Problems = append(outcome.Problems, bosgo.Problem{Domain: "user", Code: "resource_not_found"})
+		}
+		resp.Users = append(resp.Users, outcome)
+	}
+
+	s.sendJSON(w, http.StatusOK, resp)
+}
+
+// resetUser removes all accesses and banking data of a user, keeping the
+// account and its sessions. It reports false if the user does not exist.
+func (s *Server) resetUser(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user, exists := s.Users[id]
+	if !exists {
+		return false
+	}
+	user.Accesses = nil
+	user.Transactions = nil
+	user.ScheduledTransactions = nil
+	user.RepeatedTransactions = nil
+	user.StoredAnswers = map[string][]bosgo.ChallengeAnswer{}
+	s.Users[id] = user
+
+	for jobID, job := range s.Jobs {
+		if job.UserID == id {
+			delete(s.Jobs, jobID)
+		}
+	}
+	return true
+}
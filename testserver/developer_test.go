@@ -0,0 +1,439 @@
+package testserver
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"code.bankrs.com/bosgo"
+)
+
+func newDevClient(t *testing.T, s *Server) *bosgo.DevClient {
+	t.Helper()
+	client := bosgo.New(s.Client(), s.Addr())
+	devClient, err := client.Login(DefaultDeveloperEmail, DefaultDeveloperPassword).Send()
+	if err != nil {
+		t.Fatalf("failed to login as developer: %v", err)
+	}
+	return devClient
+}
+
+func TestDeveloperCreateAndLogin(t *testing.T) {
+	s := NewWithDefaults()
+	if testing.Verbose() {
+		s.SetLogger(t)
+	}
+	defer s.Close()
+	s.SetTiming(Timing{SessionTTL: time.Hour})
+
+	client := bosgo.New(s.Client(), s.Addr())
+	if _, err := client.CreateDeveloper(DefaultDeveloperEmail, "other").Send(); err == nil {
+		t.Errorf("created developer with existing email, wanted error")
+	}
+
+	devClient, err := client.CreateDeveloper("new@example.com", "secret").Send()
+	if err != nil {
+		t.Fatalf("failed to create developer: %v", err)
+	}
+	if err := devClient.ChangePassword("wrong", "newsecret").Send(); err == nil {
+		t.Errorf("changed password with wrong old password, wanted error")
+	}
+	if err := devClient.ChangePassword("secret", "newsecret").Send(); err != nil {
+		t.Fatalf("failed to change password: %v", err)
+	}
+	if err := devClient.Logout().Send(); err != nil {
+		t.Fatalf("failed to logout: %v", err)
+	}
+	if _, err := devClient.Profile().Send(); err == nil {
+		t.Errorf("used session after logout, wanted error")
+	}
+
+	if _, err := client.Login("new@example.com", "secret").Send(); err == nil {
+		t.Errorf("logged in with old password, wanted error")
+	}
+	devClient, err = client.Login("new@example.com", "newsecret").Send()
+	if err != nil {
+		t.Fatalf("failed to login: %v", err)
+	}
+	if err := devClient.Delete().Send(); err != nil {
+		t.Fatalf("failed to delete developer: %v", err)
+	}
+	if _, err := client.Login("new@example.com", "newsecret").Send(); err == nil {
+		t.Errorf("logged in as deleted developer, wanted error")
+	}
+	s.mu.Lock()
+	if n := len(s.tokenExpiry); n != 0 {
+		t.Errorf("got %d session expiries after deletion, wanted none", n)
+	}
+	s.mu.Unlock()
+}
+
+func TestDeveloperCreateConcurrent(t *testing.T) {
+	s := NewWithDefaults()
+	if testing.Verbose() {
+		s.SetLogger(t)
+	}
+	defer s.Close()
+
+	client := bosgo.New(s.Client(), s.Addr())
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			client.CreateDeveloper("new@example.com", "secret").Send()
+		}()
+	}
+	wg.Wait()
+
+	n := 0
+	s.mu.Lock()
+	for _, d := range s.Devs {
+		if d.Email == "new@example.com" {
+			n++
+		}
+	}
+	s.mu.Unlock()
+	if n != 1 {
+		t.Errorf("got %d developers with the same email, wanted 1", n)
+	}
+}
+
+func TestDeveloperProfile(t *testing.T) {
+	s := NewWithDefaults()
+	if testing.Verbose() {
+		s.SetLogger(t)
+	}
+	defer s.Close()
+
+	devClient := newDevClient(t, s)
+	if err := devClient.SetProfile(&bosgo.DeveloperProfile{Company: "ACME"}).Send(); err != nil {
+		t.Fatalf("failed to set profile: %v", err)
+	}
+	profile, err := devClient.Profile().Send()
+	if err != nil {
+		t.Fatalf("failed to get profile: %v", err)
+	}
+	if profile.Company != "ACME" {
+		t.Errorf("company: got %q, want %q", profile.Company, "ACME")
+	}
+}
+
+func TestApplications(t *testing.T) {
+	s := NewWithDefaults()
+	if testing.Verbose() {
+		s.SetLogger(t)
+	}
+	defer s.Close()
+
+	devClient := newDevClient(t, s)
+	md, err := devClient.Applications.Create("second").Send()
+	if err != nil {
+		t.Fatalf("failed to create application: %v", err)
+	}
+	if err := devClient.Applications.Update(md.ApplicationID, "renamed").Send(); err != nil {
+		t.Fatalf("failed to update application: %v", err)
+	}
+
+	page, err := devClient.Applications.List().Send()
+	if err != nil {
+		t.Fatalf("failed to list applications: %v", err)
+	}
+	labels := map[string]string{}
+	for _, app := range page.Applications {
+		labels[app.ApplicationID] = app.Label
+	}
+	if len(labels) != 2 || labels[md.ApplicationID] != "renamed" {
+		t.Errorf("applications: got %+v", page.Applications)
+	}
+
+	if err := devClient.Applications.Delete(md.ApplicationID).Send(); err != nil {
+		t.Fatalf("failed to delete application: %v", err)
+	}
+	if err := devClient.Applications.Delete(md.ApplicationID).Send(); err == nil {
+		t.Errorf("deleted application twice, wanted error")
+	}
+
+	// Applications of other developers are not visible
+	other, err := bosgo.New(s.Client(), s.Addr()).CreateDeveloper("other@example.com", "secret").Send()
+	if err != nil {
+		t.Fatalf("failed to create developer: %v", err)
+	}
+	if err := other.Applications.Delete(DefaultApplicationID).Send(); err == nil {
+		t.Errorf("deleted application of another developer, wanted error")
+	}
+}
+
+func TestApplicationKeys(t *testing.T) {
+	s := NewWithDefaults()
+	if testing.Verbose() {
+		s.SetLogger(t)
+	}
+	defer s.Close()
+
+	devClient := newDevClient(t, s)
+	key, err := devClient.Applications.CreateKey(DefaultApplicationID).Send()
+	if err != nil {
+		t.Fatalf("failed to create key: %v", err)
+	}
+	keys, err := devClient.Applications.ListKeys(DefaultApplicationID).Send()
+	if err != nil {
+		t.Fatalf("failed to list keys: %v", err)
+	}
+	if len(keys.Keys) != 1 || keys.Keys[0].Key != key.Key {
+		t.Errorf("keys: got %+v, want %+v", keys.Keys, key)
+	}
+
+	// A key may be used in place of the application ID
+	appClient := bosgo.NewAppClient(s.Client(), s.Addr(), key.Key)
+	if _, err := appClient.Users.Login(DefaultUsername, DefaultPassword).Send(); err != nil {
+		t.Errorf("failed to login with application key: %v", err)
+	}
+
+	if err := devClient.ApplicationKeys.Delete(key.Key).Send(); err != nil {
+		t.Fatalf("failed to delete key: %v", err)
+	}
+	if _, err := appClient.Users.Login(DefaultUsername, DefaultPassword).Send(); err == nil {
+		t.Errorf("logged in with deleted application key, wanted error")
+	}
+}
+
+func TestApplicationChangesConcurrent(t *testing.T) {
+	s := NewWithDefaults()
+	if testing.Verbose() {
+		s.SetLogger(t)
+	}
+	defer s.Close()
+
+	devClient := newDevClient(t, s)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			devClient.Applications.CreateKey(DefaultApplicationID).Send()
+		}()
+		go func(i int) {
+			defer wg.Done()
+			devClient.Applications.Update(DefaultApplicationID, fmt.Sprintf("label %d", i)).Send()
+		}(i)
+	}
+	wg.Wait()
+
+	keys, err := devClient.Applications.ListKeys(DefaultApplicationID).Send()
+	if err != nil {
+		t.Fatalf("failed to list keys: %v", err)
+	}
+	if len(keys.Keys) != 10 {
+		t.Errorf("got %d keys, wanted 10", len(keys.Keys))
+	}
+}
+
+func TestApplicationSettings(t *testing.T) {
+	s := NewWithDefaults()
+	if testing.Verbose() {
+		s.SetLogger(t)
+	}
+	defer s.Close()
+
+	devClient := newDevClient(t, s)
+	settings, err := devClient.Applications.UpdateSettings(DefaultApplicationID).BackgroundRefresh(true).Send()
+	if err != nil {
+		t.Fatalf("failed to update settings: %v", err)
+	}
+	if !settings.BackgroundRefresh {
+		t.Errorf("updated background refresh: got false, want true")
+	}
+	settings, err = devClient.Applications.Settings(DefaultApplicationID).Send()
+	if err != nil {
+		t.Fatalf("failed to get settings: %v", err)
+	}
+	if !settings.BackgroundRefresh {
+		t.Errorf("background refresh: got false, want true")
+	}
+}
+
+func TestListUsersCursor(t *testing.T) {
+	s := NewWithDefaults()
+	if testing.Verbose() {
+		s.SetLogger(t)
+	}
+	defer s.Close()
+
+	for i := 0; i < 4; i++ {
+		s.SetUser(User{
+			ID:            fmt.Sprintf("user-%d", i),
+			Username:      fmt.Sprintf("user%d@example.com", i),
+			ApplicationID: DefaultApplicationID,
+		})
+	}
+
+	devClient := newDevClient(t, s)
+	var ids []string
+	cursor := ""
+	for pages := 0; ; pages++ {
+		if pages > 5 {
+			t.Fatalf("too many pages")
+		}
+		page, err := devClient.Applications.ListUsers(DefaultApplicationID).Cursor(cursor).Limit(2).Send()
+		if err != nil {
+			t.Fatalf("failed to list users: %v", err)
+		}
+		if len(page.Users) > 2 {
+			t.Fatalf("page size: got %d, want at most 2", len(page.Users))
+		}
+		ids = append(ids, page.Users...)
+		if page.NextCursor == "" {
+			break
+		}
+		cursor = page.NextCursor
+	}
+	if len(ids) != 5 {
+		t.Fatalf("users: got %v, want 5", ids)
+	}
+
+	all, err := devClient.Applications.ListUsers(DefaultApplicationID).Send()
+	if err != nil {
+		t.Fatalf("failed to list users: %v", err)
+	}
+	if fmt.Sprint(all.Users) != fmt.Sprint(ids) || all.NextCursor != "" {
+		t.Errorf("users without limit: got %v, want %v", all.Users, ids)
+	}
+
+	info, err := devClient.Applications.UserInfo(DefaultApplicationID, "user-2").Send()
+	if err != nil {
+		t.Fatalf("failed to get user info: %v", err)
+	}
+	if info.Username != "user2@example.com" {
+		t.Errorf("username: got %q, want %q", info.Username, "user2@example.com")
+	}
+
+	if _, err := devClient.Applications.ListUsers(DefaultApplicationID).Cursor("!").Limit(2).Send(); err == nil {
+		t.Errorf("listed users with invalid cursor, wanted error")
+	}
+}
+
+func TestResetUsers(t *testing.T) {
+	s := NewWithDefaults()
+	if testing.Verbose() {
+		s.SetLogger(t)
+	}
+	defer s.Close()
+
+	appClient := bosgo.NewAppClient(s.Client(), s.Addr(), DefaultApplicationID)
+	userClient, err := appClient.Users.Login(DefaultUsername, DefaultPassword).Send()
+	if err != nil {
+		t.Fatalf("failed to login as user: %v", err)
+	}
+	_, err = userClient.Accesses.Add(DefaultProviderID).
+		ChallengeAnswer(bosgo.ChallengeAnswer{ID: ChallengeLogin, Value: DefaultAccessLogin}).
+		ChallengeAnswer(bosgo.ChallengeAnswer{ID: ChallengePIN, Value: DefaultAccessPIN}).
+		Send()
+	if err != nil {
+		t.Fatalf("failed to add access: %v", err)
+	}
+
+	devClient := newDevClient(t, s)
+	res, err := devClient.Applications.ResetUsers(DefaultApplicationID, []string{DefaultUsername, "nobody@example.com"}).Send()
+	if err != nil {
+		t.Fatalf("failed to reset users: %v", err)
+	}
+	if len(res.Users) != 2 || len(res.Users[0].Problems) != 0 || len(res.Users[1].Problems) != 1 {
+		t.Errorf("outcomes: got %+v", res.Users)
+	}
+
+	page, err := userClient.Accesses.List().Send()
+	if err != nil {
+		t.Fatalf("failed to list accesses: %v", err)
+	}
+	if len(page.Accesses) != 0 {
+		t.Errorf("accesses after reset: got %d, want 0", len(page.Accesses))
+	}
+}
+
+func TestBulkResetListedUsers(t *testing.T) {
+	s := NewWithDefaults()
+	if testing.Verbose() {
+		s.SetLogger(t)
+	}
+	defer s.Close()
+
+	for i := 0; i < 4; i++ {
+		s.SetUser(User{
+			ID:            fmt.Sprintf("user-%d", i),
+			Username:      fmt.Sprintf("user%d@example.com", i),
+			ApplicationID: DefaultApplicationID,
+			Accesses:      []bosgo.Access{{ID: int64(100 + i), ProviderID: DefaultProviderID}},
+		})
+	}
+
+	// The pipeline documented for BulkResetUsers
+	ctx := context.Background()
+	devClient := newDevClient(t, s)
+	ids := devClient.Applications.ListUsers(DefaultApplicationID).Context(ctx).Limit(2).Iter()
+	report, err := devClient.Applications.BulkResetUsers(ctx, DefaultApplicationID,
+		devClient.Applications.ResolveUsernames(ctx, DefaultApplicationID, ids), bosgo.BulkResetOptions{BatchSize: 2})
+	if err != nil {
+		t.Fatalf("failed to reset users: %v", err)
+	}
+	if report.Reset != 5 || report.Failed != 0 {
+		t.Errorf("got %d reset and %d failed, want 5 and 0: %+v", report.Reset, report.Failed, report.Failures())
+	}
+
+	for i := 0; i < 4; i++ {
+		user, _ := s.GetUser(fmt.Sprintf("user-%d", i))
+		if len(user.Accesses) != 0 {
+			t.Errorf("accesses of %s after reset: got %d, want 0", user.Username, len(user.Accesses))
+		}
+	}
+}
+
+func TestDeveloperSessionState(t *testing.T) {
+	s := NewWithDefaults()
+	defer s.Close()
+	devClient := newDevClient(t, s)
+
+	var buf bytes.Buffer
+	if err := s.WriteState(&buf); err != nil {
+		t.Fatalf("failed to write state: %v", err)
+	}
+	s2 := New()
+	defer s2.Close()
+	if err := s2.ReadState(&buf); err != nil {
+		t.Fatalf("failed to read state: %v", err)
+	}
+
+	restored := bosgo.NewDevClient(s2.Client(), s2.Addr(), devClient.SessionToken())
+	if _, err := restored.Applications.List().Send(); err != nil {
+		t.Errorf("failed to use restored developer session: %v", err)
+	}
+}
+
+func TestSessionExpiryState(t *testing.T) {
+	clock := NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	s := NewWithDefaults()
+	defer s.Close()
+	s.SetClock(clock)
+	s.SetTiming(Timing{SessionTTL: time.Hour})
+	devClient := newDevClient(t, s)
+
+	var buf bytes.Buffer
+	if err := s.WriteState(&buf); err != nil {
+		t.Fatalf("failed to write state: %v", err)
+	}
+	s2 := New()
+	defer s2.Close()
+	s2.SetClock(clock)
+	if err := s2.ReadState(&buf); err != nil {
+		t.Fatalf("failed to read state: %v", err)
+	}
+
+	clock.Advance(2 * time.Hour)
+	restored := bosgo.NewDevClient(s2.Client(), s2.Addr(), devClient.SessionToken())
+	if _, err := restored.Applications.List().Send(); err == nil {
+		t.Errorf("used expired developer session after restore, wanted error")
+	}
+}
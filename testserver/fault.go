@@ -0,0 +1,185 @@
+package testserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strconv"
+	"time"
+)
+
+// FaultAction is the failure a fault rule injects.
+type FaultAction int
+
+const (
+	FaultNone      FaultAction = iota // only delay the request by the rule's latency
+	FaultStatus                       // respond with the rule's status code and an error
+	FaultMalformed                    // respond with a body that is not valid JSON
+	FaultTruncated                    // handle the request but cut the response body short
+	FaultDrop                         // close the connection without a response
+)
+
+// FaultRule injects a failure into the requests it matches. Empty match
+// fields match any request.
+type FaultRule struct {
+	Method   string // HTTP method
+	Path     string // path pattern in the syntax of path.Match, e.g. "/v1/accesses/*"
+	Username string // user owning the session of the request
+
+	Action     FaultAction
+	Latency    time.Duration // delay before the request is handled or failed
+	Status     int           // status code of FaultStatus, 500 if zero
+	RetryAfter time.Duration // value of the Retry-After header of FaultStatus, none if zero
+
+	Attempts int // fail only the first attempts with each method, URL and user, all if zero
+	Times    int // maximum number of times the rule fires, unlimited if zero
+}
+
+// FaultHits counts the requests a fault rule matched and those it failed.
+type FaultHits struct {
+	Matched int
+	Fired   int
+}
+
+type fault struct {
+	rule     FaultRule
+	hits     FaultHits
+	attempts map[string]int // attempts made indexed by method, URL and user
+}
+
+// AddFault adds a fault rule and returns its ID. Rules are tried in the order
+// they were added and only the first one that matches a request and has not
+// used up its Times or Attempts fires.
+func (s *Server) AddFault(rule FaultRule) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faultID++
+	if s.faults == nil {
+		s.faults = make(map[int]*fault)
+	}
+	s.faults[s.faultID] = &fault{rule: rule, attempts: make(map[string]int)}
+	s.faultOrder = append(s.faultOrder, s.faultID)
+	return s.faultID
+}
+
+// RemoveFault removes the fault rule with the given ID.
+func (s *Server) RemoveFault(id int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.faults, id)
+	for i, fid := range s.faultOrder {
+		if fid == id {
+			s.faultOrder = append(s.faultOrder[:i:i], s.faultOrder[i+1:]...)
+			break
+		}
+	}
+}
+
+// ClearFaults removes all fault rules.
+func (s *Server) ClearFaults() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = nil
+	s.faultOrder = nil
+}
+
+// FaultHits returns the hit counters of the fault rule with the given ID.
+func (s *Server) FaultHits(id int) FaultHits {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if f, exists := s.faults[id]; exists {
+		return f.hits
+	}
+	return FaultHits{}
+}
+
+// matchFault returns the rule that fires for the request, if any, and counts
+// the hit.
+func (s *Server) matchFault(req *http.Request) (FaultRule, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.faultOrder) == 0 {
+		return FaultRule{}, false
+	}
+
+	var username string
+	if id, exists := s.UserTokens[req.Header.Get("X-Token")]; exists {
+		username = s.Users[id].Username
+	}
+
+	for _, id := range s.faultOrder {
+		f := s.faults[id]
+		r := f.rule
+		if r.Method != "" && r.Method != req.Method {
+			continue
+		}
+		if r.Path != "" {
+			if ok, _ := path.Match(r.Path, req.URL.Path); !ok {
+				continue
+			}
+		}
+		if r.Username != "" && r.Username != username {
+			continue
+		}
+		if r.Times > 0 && f.hits.Fired >= r.Times {
+			continue
+		}
+
+		f.hits.Matched++
+		key := req.Method + " " + req.URL.String() + " " + username
+		f.attempts[key]++
+		if r.Attempts > 0 && f.attempts[key] > r.Attempts {
+			continue
+		}
+		f.hits.Fired++
+		return r, true
+	}
+	return FaultRule{}, false
+}
+
+// serveFault answers the request as the fault rule demands.
+func (s *Server) serveFault(w http.ResponseWriter, req *http.Request, rule FaultRule) {
+	if rule.Latency > 0 {
+		t := time.NewTimer(rule.Latency)
+		select {
+		case <-req.Context().Done():
+			t.Stop()
+			return
+		case <-t.C:
+		}
+	}
+
+	switch rule.Action {
+	case FaultStatus:
+		status := rule.Status
+		if status == 0 {
+			status = http.StatusInternalServerError
+		}
+		if rule.RetryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int((rule.RetryAfter+time.Second-1)/time.Second)))
+		}
+		s.sendError(w, status, "fault_injected_by_test_server")
+
+	case FaultMalformed:
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"errors": [{"code": }`))
+
+	case FaultTruncated:
+		rec := httptest.NewRecorder()
+		s.mux.ServeHTTP(rec, req)
+		for k, v := range rec.Header() {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(rec.Code)
+		body := rec.Body.Bytes()
+		w.Write(body[:len(body)/2])
+
+	case FaultDrop:
+		// Aborting the handler closes the connection without a response
+		panic(http.ErrAbortHandler)
+
+	default:
+		s.mux.ServeHTTP(w, req)
+	}
+}
@@ -0,0 +1,183 @@
+package testserver
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"code.bankrs.com/bosgo"
+)
+
+func TestFaultStatus(t *testing.T) {
+	s := NewWithDefaults()
+	if testing.Verbose() {
+		s.SetLogger(t)
+	}
+	defer s.Close()
+
+	id := s.AddFault(FaultRule{
+		Path:       "/v1/users/login",
+		Action:     FaultStatus,
+		Status:     http.StatusTooManyRequests,
+		RetryAfter: 2 * time.Second,
+		Times:      1,
+	})
+
+	appClient := bosgo.NewAppClient(s.Client(), s.Addr(), DefaultApplicationID)
+	_, err := appClient.Users.Login(DefaultUsername, DefaultPassword).Send()
+	berr, ok := err.(*bosgo.Error)
+	if !ok || berr.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("got error %v, wanted status %d", err, http.StatusTooManyRequests)
+	}
+
+	// The rule fires only once
+	if _, err := appClient.Users.Login(DefaultUsername, DefaultPassword).Send(); err != nil {
+		t.Errorf("failed to login after fault: %v", err)
+	}
+	if hits := s.FaultHits(id); hits.Fired != 1 || hits.Matched != 1 {
+		t.Errorf("hits: got %+v, want 1 matched and fired", hits)
+	}
+}
+
+func TestFaultRetryAfter(t *testing.T) {
+	s := NewWithDefaults()
+	defer s.Close()
+	s.AddFault(FaultRule{Action: FaultStatus, Status: http.StatusTooManyRequests, RetryAfter: 1500 * time.Millisecond})
+
+	req, err := http.NewRequest("GET", s.URL()+"/v1/accounts", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := s.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if got := res.Header.Get("Retry-After"); got != "2" {
+		t.Errorf("Retry-After: got %q, want %q", got, "2")
+	}
+}
+
+func TestFaultFirstAttempts(t *testing.T) {
+	s := NewWithDefaults()
+	if testing.Verbose() {
+		s.SetLogger(t)
+	}
+	defer s.Close()
+
+	id := s.AddFault(FaultRule{
+		Method:   http.MethodPost,
+		Path:     "/v1/users/login",
+		Action:   FaultStatus,
+		Status:   http.StatusBadGateway,
+		Attempts: 2,
+	})
+
+	policy := bosgo.RetryPolicy{MaxRetries: 3, Wait: time.Millisecond}
+	appClient := bosgo.New(s.Client(), s.Addr(), bosgo.WithRetryPolicy(policy)).WithApplicationID(DefaultApplicationID)
+	if _, err := appClient.Users.Login(DefaultUsername, DefaultPassword).Send(); err != nil {
+		t.Fatalf("failed to login with retries: %v", err)
+	}
+	if hits := s.FaultHits(id); hits.Fired != 2 || hits.Matched != 3 {
+		t.Errorf("hits: got %+v, want 3 matched and 2 fired", hits)
+	}
+}
+
+func TestFaultLaterRule(t *testing.T) {
+	s := NewWithDefaults()
+	if testing.Verbose() {
+		s.SetLogger(t)
+	}
+	defer s.Close()
+
+	first := s.AddFault(FaultRule{Path: "/v1/users/login", Action: FaultStatus, Status: http.StatusBadGateway, Attempts: 1})
+	second := s.AddFault(FaultRule{Path: "/v1/users/login", Action: FaultStatus, Status: http.StatusServiceUnavailable, Times: 1})
+
+	policy := bosgo.RetryPolicy{MaxRetries: 3, Wait: time.Millisecond}
+	appClient := bosgo.New(s.Client(), s.Addr(), bosgo.WithRetryPolicy(policy)).WithApplicationID(DefaultApplicationID)
+	if _, err := appClient.Users.Login(DefaultUsername, DefaultPassword).Send(); err != nil {
+		t.Fatalf("failed to login with retries: %v", err)
+	}
+	if hits := s.FaultHits(first); hits.Fired != 1 {
+		t.Errorf("first rule: got %+v, want 1 fired", hits)
+	}
+	if hits := s.FaultHits(second); hits.Fired != 1 {
+		t.Errorf("second rule: got %+v, want 1 fired after the first was used up", hits)
+	}
+}
+
+func TestFaultUser(t *testing.T) {
+	s := NewWithDefaults()
+	if testing.Verbose() {
+		s.SetLogger(t)
+	}
+	defer s.Close()
+
+	s.SetUser(User{ID: "other-user", Username: "other@example.com", Password: "secret", ApplicationID: DefaultApplicationID})
+	s.AddFault(FaultRule{Path: "/v1/accesses", Username: DefaultUsername, Action: FaultStatus})
+
+	appClient := bosgo.NewAppClient(s.Client(), s.Addr(), DefaultApplicationID)
+	def, err := appClient.Users.Login(DefaultUsername, DefaultPassword).Send()
+	if err != nil {
+		t.Fatalf("failed to login: %v", err)
+	}
+	other, err := appClient.Users.Login("other@example.com", "secret").Send()
+	if err != nil {
+		t.Fatalf("failed to login: %v", err)
+	}
+
+	if _, err := def.Accesses.List().Send(); err == nil {
+		t.Errorf("listed accesses of faulty user, wanted error")
+	}
+	if _, err := other.Accesses.List().Send(); err != nil {
+		t.Errorf("failed to list accesses of other user: %v", err)
+	}
+}
+
+func TestFaultBody(t *testing.T) {
+	testCases := []struct {
+		name   string
+		action FaultAction
+	}{
+		{"malformed", FaultMalformed},
+		{"truncated", FaultTruncated},
+		{"drop", FaultDrop},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := NewWithDefaults()
+			defer s.Close()
+			s.AddFault(FaultRule{Path: "/v1/accesses", Action: tc.action})
+
+			appClient := bosgo.NewAppClient(s.Client(), s.Addr(), DefaultApplicationID)
+			userClient, err := appClient.Users.Login(DefaultUsername, DefaultPassword).Send()
+			if err != nil {
+				t.Fatalf("failed to login: %v", err)
+			}
+			if _, err := userClient.Accesses.List().Send(); err == nil {
+				t.Errorf("got no error, wanted one")
+			}
+		})
+	}
+}
+
+func TestFaultLatency(t *testing.T) {
+	s := NewWithDefaults()
+	defer s.Close()
+
+	id := s.AddFault(FaultRule{Path: "/v1/users/login", Latency: time.Second})
+	appClient := bosgo.NewAppClient(s.Client(), s.Addr(), DefaultApplicationID)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := appClient.Users.Login(DefaultUsername, DefaultPassword).Context(ctx).Send(); err == nil {
+		t.Errorf("got no error, wanted timeout")
+	}
+
+	s.RemoveFault(id)
+	if _, err := appClient.Users.Login(DefaultUsername, DefaultPassword).Send(); err != nil {
+		t.Errorf("failed to login after removing fault: %v", err)
+	}
+}
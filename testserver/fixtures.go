@@ -0,0 +1,285 @@
+package testserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+
+	"code.bankrs.com/bosgo"
+	"gopkg.in/yaml.v3"
+)
+
+// Fixtures describes the initial data of a server. Fixtures may be written
+// as JSON or YAML; the field names of the embedded API types are those of
+// their JSON encoding in both cases.
+type Fixtures struct {
+	Defaults     bool                 `json:"defaults"` // Add the data of NewWithDefaults first
+	Developers   []DeveloperFixture   `json:"developers"`
+	Applications []ApplicationFixture `json:"applications"`
+	Providers    []bosgo.Provider     `json:"providers"`
+	Accesses     []AccessFixture      `json:"accesses"`
+	Users        []UserFixture        `json:"users"`
+}
+
+// DeveloperFixture is a developer account.
+type DeveloperFixture struct {
+	ID       string `json:"id"`
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+// ApplicationFixture is an application of a developer.
+type ApplicationFixture struct {
+	ID          string `json:"id"`
+	DeveloperID string `json:"developer_id"`
+	Label       string `json:"label"`
+}
+
+// AccessFixture is an access that users may add with the challenge answers.
+// The access is identified by its provider ID.
+type AccessFixture struct {
+	Access                bosgo.Access                `json:"access"`
+	Challenges            map[string]string           `json:"challenges"` // Answers keyed by challenge ID
+	Transactions          []bosgo.Transaction         `json:"transactions"`
+	ScheduledTransactions []bosgo.Transaction         `json:"scheduled_transactions"`
+	RepeatedTransactions  []bosgo.RepeatedTransaction `json:"repeated_transactions"`
+	TransferAuths         []TransferAuth              `json:"transfer_auths"`
+	Scenario              *Scenario                   `json:"scenario"` // replaces Challenges for jobs if set
+}
+
+// UserFixture is a user of an application. Accesses lists the provider IDs
+// of accesses the user has already added.
+type UserFixture struct {
+	ID            string   `json:"id"`
+	Username      string   `json:"username"`
+	Password      string   `json:"password"`
+	ApplicationID string   `json:"application_id"`
+	Accesses      []string `json:"accesses"`
+}
+
+// ReadFixtures reads fixtures from r in JSON or YAML. Unknown fields are rejected.
+func ReadFixtures(r io.Reader) (*Fixtures, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// JSON is valid YAML, so both are read as YAML and converted to JSON to
+	// decode the API types using their JSON field names.
+	var v interface{}
+	if err := yaml.Unmarshal(data, &v); err != nil {
+		return nil, fmt.Errorf("failed to parse fixtures: %v", err)
+	}
+	data, err = json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse fixtures: %v", err)
+	}
+
+	var f Fixtures
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&f); err != nil {
+		return nil, fmt.Errorf("failed to parse fixtures: %v", err)
+	}
+	return &f, nil
+}
+
+// LoadFixtures reads fixtures from the named JSON or YAML file.
+func LoadFixtures(filename string) (*Fixtures, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ReadFixtures(file)
+}
+
+// Load adds the fixtures to the server. Objects without an ID are assigned
+// one.
+func (s *Server) Load(f *Fixtures) error {
+	if f.Defaults {
+		s.AddDefaults()
+	}
+
+	for _, d := range f.Developers {
+		if d.ID == "" {
+			return fmt.Errorf("developer without id")
+		}
+		s.setDev(Dev{ID: d.ID, Email: d.Email, Password: d.Password})
+	}
+
+	for _, a := range f.Applications {
+		if a.ID == "" {
+			return fmt.Errorf("application without id")
+		}
+		s.setApp(App{ID: a.ID, DeveloperID: a.DeveloperID, Label: a.Label})
+	}
+
+	for _, p := range f.Providers {
+		if p.ID == "" {
+			return fmt.Errorf("provider without id")
+		}
+		s.AddProvider(p)
+	}
+
+	// IDs given in the fixtures must not be handed out again
+	s.mu.Lock()
+	for _, af := range f.Accesses {
+		s.reserveAccessIDs(af)
+	}
+	s.mu.Unlock()
+
+	for _, af := range f.Accesses {
+		if af.Access.ProviderID == "" {
+			return fmt.Errorf("access without provider_id")
+		}
+		s.AddAccess(s.accessDetails(af))
+	}
+
+	// Hexadecimal string IDs may collide with those created by nextIDStr
+	s.mu.Lock()
+	for _, uf := range f.Users {
+		if v, err := strconv.ParseInt(uf.ID, 16, 64); err == nil && v > s.id {
+			s.id = v
+		}
+	}
+	if max := s.maxID(); max > s.id {
+		s.id = max
+	}
+	s.mu.Unlock()
+
+	for _, uf := range f.Users {
+		if uf.Username == "" {
+			return fmt.Errorf("user without username")
+		}
+		if _, exists := s.GetUserByName(uf.Username); exists {
+			return fmt.Errorf("duplicate user: %s", uf.Username)
+		}
+		if _, exists := s.getApp(uf.ApplicationID); !exists {
+			return fmt.Errorf("unknown application for user %s: %s", uf.Username, uf.ApplicationID)
+		}
+
+		user := User{
+			ID:            uf.ID,
+			Username:      uf.Username,
+			Password:      uf.Password,
+			ApplicationID: uf.ApplicationID,
+			StoredAnswers: map[string][]bosgo.ChallengeAnswer{},
+		}
+		if user.ID == "" {
+			user.ID = s.nextIDStr()
+		}
+		for _, providerID := range uf.Accesses {
+			s.mu.Lock()
+			ad, exists := s.Accesses[providerID]
+			s.mu.Unlock()
+			if !exists {
+				return fmt.Errorf("unknown access for user %s: %s", uf.Username, providerID)
+			}
+			user.Accesses = append(user.Accesses, ad.Access)
+			user.Transactions = append(user.Transactions, ad.Transactions...)
+			user.ScheduledTransactions = append(user.ScheduledTransactions, ad.ScheduledTransactions...)
+			user.RepeatedTransactions = append(user.RepeatedTransactions, ad.RepeatedTransactions...)
+		}
+		s.SetUser(user)
+	}
+	return nil
+}
+
+// reserveAccessIDs advances the ID counter past the IDs used by the fixture.
+// The caller must hold s.mu.
+func (s *Server) reserveAccessIDs(af AccessFixture) {
+	ids := []int64{af.Access.ID}
+	for _, ac := range af.Access.Accounts {
+		ids = append(ids, ac.ID)
+	}
+	for _, tx := range af.Transactions {
+		ids = append(ids, tx.ID)
+	}
+	for _, tx := range af.ScheduledTransactions {
+		ids = append(ids, tx.ID)
+	}
+	for _, tx := range af.RepeatedTransactions {
+		ids = append(ids, tx.ID)
+	}
+	for _, id := range ids {
+		if id > s.id {
+			s.id = id
+		}
+	}
+}
+
+// accessDetails converts the fixture, filling in missing IDs and references
+// to the access and its first account.
+func (s *Server) accessDetails(af AccessFixture) AccessDetails {
+	access := af.Access
+	if access.ID == 0 {
+		access.ID = s.nextID()
+	}
+	access.Accounts = append([]bosgo.Account(nil), access.Accounts...)
+	for i := range access.Accounts {
+		ac := &access.Accounts[i]
+		if ac.ID == 0 {
+			ac.ID = s.nextID()
+		}
+		if ac.BankAccessID == 0 {
+			ac.BankAccessID = access.ID
+		}
+		if ac.ProviderID == "" {
+			ac.ProviderID = access.ProviderID
+		}
+	}
+
+	fill := func(txs []bosgo.Transaction) []bosgo.Transaction {
+		txs = append([]bosgo.Transaction(nil), txs...)
+		for i := range txs {
+			tx := &txs[i]
+			if tx.ID == 0 {
+				tx.ID = s.nextID()
+			}
+			if tx.AccessID == 0 {
+				tx.AccessID = access.ID
+			}
+			if tx.UserAccountID == 0 && len(access.Accounts) > 0 {
+				tx.UserAccountID = access.Accounts[0].ID
+				tx.UserAccount = bosgo.AccountRef{
+					ProviderID: access.ProviderID,
+					IBAN:       access.Accounts[0].IBAN,
+				}
+			}
+		}
+		return txs
+	}
+
+	rtxs := append([]bosgo.RepeatedTransaction(nil), af.RepeatedTransactions...)
+	for i := range rtxs {
+		tx := &rtxs[i]
+		if tx.ID == 0 {
+			tx.ID = s.nextID()
+		}
+		if tx.AccessID == 0 {
+			tx.AccessID = access.ID
+		}
+		if tx.UserAccountID == 0 && len(access.Accounts) > 0 {
+			tx.UserAccountID = access.Accounts[0].ID
+		}
+	}
+
+	challenges := af.Challenges
+	if challenges == nil {
+		challenges = map[string]string{}
+	}
+	return AccessDetails{
+		Access:                access,
+		Transactions:          fill(af.Transactions),
+		ScheduledTransactions: fill(af.ScheduledTransactions),
+		RepeatedTransactions:  rtxs,
+		ChallengeMap:          challenges,
+		TransferAuths:         af.TransferAuths,
+		Scenario:              af.Scenario,
+	}
+}
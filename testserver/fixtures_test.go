@@ -0,0 +1,193 @@
+package testserver
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"code.bankrs.com/bosgo"
+)
+
+const testFixtures = `
+developers:
+  - id: dev1
+applications:
+  - id: app1
+    developer_id: dev1
+providers:
+  - id: DE-TEST-1
+    name: Test Bank
+    challenges:
+      - {id: login, description: Login, type: alphanumeric}
+      - {id: pin, description: PIN, type: numeric, secure: true}
+accesses:
+  - access:
+      provider_id: DE-TEST-1
+      name: Test Bank
+      enabled: true
+      accounts:
+        - name: Giro
+          iban: DE89370400440532013000
+          currency: EUR
+          balance: "100.00"
+    challenges:
+      login: jane
+      pin: "1111"
+    transactions:
+      - amount: {currency: EUR, value: "-12.00"}
+        entry_date: 2018-03-01T00:00:00Z
+        usage: Coffee
+  - access:
+      provider_id: DE-TEST-2
+      id: 500
+      name: Other Bank
+users:
+  - username: jane@example.com
+    password: secret
+    application_id: app1
+    accesses: [DE-TEST-1]
+`
+
+func TestLoadFixtures(t *testing.T) {
+	f, err := ReadFixtures(strings.NewReader(testFixtures))
+	if err != nil {
+		t.Fatalf("read fixtures: %v", err)
+	}
+
+	s := New()
+	defer s.Close()
+	if err := s.Load(f); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	appClient := bosgo.NewAppClient(s.Client(), s.Addr(), "app1")
+	userClient, err := appClient.Users.Login("jane@example.com", "secret").Send()
+	if err != nil {
+		t.Fatalf("login: %v", err)
+	}
+
+	page, err := userClient.Accesses.List().Send()
+	if err != nil {
+		t.Fatalf("list accesses: %v", err)
+	}
+	if len(page.Accesses) != 1 || page.Accesses[0].Name != "Test Bank" {
+		t.Fatalf("accesses: got %+v", page.Accesses)
+	}
+	access := page.Accesses[0]
+	if len(access.Accounts) != 1 || access.Accounts[0].BankAccessID != access.ID || access.Accounts[0].ID == 0 {
+		t.Errorf("account references not filled in: %+v", access.Accounts)
+	}
+
+	txs, err := userClient.Transactions.List().Send()
+	if err != nil {
+		t.Fatalf("list transactions: %v", err)
+	}
+	if len(txs.Transactions) != 1 {
+		t.Fatalf("transactions: got %d, want 1", len(txs.Transactions))
+	}
+	tx := txs.Transactions[0]
+	if tx.UserAccountID != access.Accounts[0].ID || !tx.EntryDate.Equal(time.Date(2018, 3, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("transaction: got %+v", tx)
+	}
+
+	provider, err := appClient.Providers.Get("DE-TEST-1").Send()
+	if err != nil {
+		t.Fatalf("get provider: %v", err)
+	}
+	if len(provider.Challenges) != 2 || !provider.Challenges[1].Secure {
+		t.Errorf("provider challenges: got %+v", provider.Challenges)
+	}
+
+	// IDs handed out after loading must not collide with those of the fixtures
+	if id := s.nextID(); id <= 500 {
+		t.Errorf("next ID: got %d, want > 500", id)
+	}
+
+	// The second access may be added with any answers since it has no challenges
+	job, err := userClient.Accesses.Add("DE-TEST-2").Send()
+	if err != nil {
+		t.Fatalf("add access: %v", err)
+	}
+	status, err := userClient.Jobs.Get(job.URI).Send()
+	if err != nil {
+		t.Fatalf("job status: %v", err)
+	}
+	if status.Stage != bosgo.JobStageImported {
+		t.Errorf("job stage: got %s, want %s", status.Stage, bosgo.JobStageImported)
+	}
+}
+
+func TestLoadFixturesErrors(t *testing.T) {
+	testCases := []struct {
+		name     string
+		fixtures string
+		want     string
+	}{
+		{"unknown field", `{"users": [{"name": "x"}]}`, "unknown field"},
+		{"unknown application", `{"users": [{"username": "x", "application_id": "nope"}]}`, "unknown application"},
+		{"unknown access", `{"defaults": true, "users": [{"username": "x", "application_id": "default-app", "accesses": ["nope"]}]}`, "unknown access"},
+		{"duplicate user", `{"defaults": true, "users": [{"username": "username@example.com", "application_id": "default-app"}]}`, "duplicate user"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			f, err := ReadFixtures(strings.NewReader(tc.fixtures))
+			if err == nil {
+				err = NewUnstarted().Load(f)
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("got error %v, want one containing %q", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestReadStateContinuesIDs(t *testing.T) {
+	s := NewUnstarted()
+	s.AddDefaults()
+	used := s.nextID()
+
+	var buf bytes.Buffer
+	if err := s.WriteState(&buf); err != nil {
+		t.Fatalf("write state: %v", err)
+	}
+	s2 := NewUnstarted()
+	if err := s2.ReadState(&buf); err != nil {
+		t.Fatalf("read state: %v", err)
+	}
+	if id := s2.nextID(); id <= used {
+		t.Errorf("next ID after restore: got %d, want more than %d", id, used)
+	}
+}
+
+func TestLoadFixturesReservesStringIDs(t *testing.T) {
+	f, err := ReadFixtures(strings.NewReader(`
+developers:
+  - id: "00000040"
+applications:
+  - id: app1
+    developer_id: "00000040"
+users:
+  - username: jane@example.com
+    application_id: app1
+  - id: "00000020"
+    username: john@example.com
+    application_id: app1
+`))
+	if err != nil {
+		t.Fatalf("read fixtures: %v", err)
+	}
+	s := NewUnstarted()
+	if err := s.Load(f); err != nil {
+		t.Fatalf("load fixtures: %v", err)
+	}
+
+	jane, _ := s.GetUserByName("jane@example.com")
+	if jane.ID == "00000020" || jane.ID == "00000040" {
+		t.Errorf("got user id %s, which is used by the fixtures", jane.ID)
+	}
+	if id := s.nextIDStr(); id <= "00000040" {
+		t.Errorf("next ID after load: got %s, want more than 00000040", id)
+	}
+}
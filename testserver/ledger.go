@@ -0,0 +1,342 @@
+package testserver
+
+import (
+	"strings"
+	"time"
+
+	"code.bankrs.com/bosgo"
+	"code.bankrs.com/bosgo/internal/money"
+)
+
+// ProblemInsufficientFunds is reported for transfers exceeding the balance and
+// credit line of their source account.
+const ProblemInsufficientFunds = "fi_insufficient_funds"
+
+// accountRef locates an account of a user.
+type accountRef struct {
+	userID string
+	access int // index into User.Accesses
+	acc    int // index into Access.Accounts
+}
+
+// findAccountByID returns the location of the user's account with the given
+// ID. The caller must hold s.mu.
+func (s *Server) findAccountByID(userID string, accountID int64) (accountRef, bool) {
+	user := s.Users[userID]
+	for i, ac := range user.Accesses {
+		for k, acc := range ac.Accounts {
+			if acc.ID == accountID {
+				return accountRef{userID: userID, access: i, acc: k}, true
+			}
+		}
+	}
+	return accountRef{}, false
+}
+
+// findAccountByIBAN returns the location of an account of any user with the
+// given IBAN. The caller must hold s.mu.
+func (s *Server) findAccountByIBAN(iban string) (accountRef, bool) {
+	iban = normalizeIBAN(iban)
+	if iban == "" {
+		return accountRef{}, false
+	}
+	for id, user := range s.Users {
+		for i, ac := range user.Accesses {
+			for k, acc := range ac.Accounts {
+				if normalizeIBAN(acc.IBAN) == iban {
+					return accountRef{userID: id, access: i, acc: k}, true
+				}
+			}
+		}
+	}
+	return accountRef{}, false
+}
+
+func normalizeIBAN(iban string) string {
+	return strings.ToUpper(strings.Replace(iban, " ", "", -1))
+}
+
+// account returns the located account. The caller must hold s.mu.
+func (s *Server) account(ref accountRef) (bosgo.Access, bosgo.Account) {
+	ac := s.Users[ref.userID].Accesses[ref.access]
+	return ac, ac.Accounts[ref.acc]
+}
+
+// parseBalance parses a balance of an account. Empty balances are zero.
+func parseBalance(v string) (money.Amount, error) {
+	if v == "" {
+		return 0, nil
+	}
+	return money.Parse(v)
+}
+
+// covers reports whether the balance and credit line of the account cover
+// the amount.
+func covers(acc bosgo.Account, amount money.Amount) bool {
+	balance, err := parseBalance(acc.Balance)
+	if err != nil {
+		return false
+	}
+	credit, err := parseBalance(acc.CreditLine)
+	if err != nil {
+		return false
+	}
+	return balance+credit >= amount
+}
+
+// formatAmount formats an amount with as many decimal places as the most
+// precise of the given decimal strings, but at least the two used by the API,
+// so that balances and amounts written with more places are not rounded.
+func formatAmount(a money.Amount, like ...string) string {
+	places := 2
+	for _, v := range like {
+		if p := money.Places(v); p > places {
+			places = p
+		}
+	}
+	return a.Format(places, ".")
+}
+
+// adjustBalance adds delta, written as value, to the balances of the located
+// account. The caller must hold s.mu.
+func (s *Server) adjustBalance(ref accountRef, delta money.Amount, value string, date time.Time) {
+	user := s.Users[ref.userID]
+	acc := &user.Accesses[ref.access].Accounts[ref.acc]
+	if balance, err := parseBalance(acc.Balance); err == nil {
+		acc.Balance = formatAmount(balance+delta, acc.Balance, value)
+	}
+	if acc.AvailableBalance != "" {
+		if available, err := parseBalance(acc.AvailableBalance); err == nil {
+			acc.AvailableBalance = formatAmount(available+delta, acc.AvailableBalance, value)
+		}
+	}
+	acc.BalanceDate = date
+	s.Users[ref.userID] = user
+}
+
+// transferAmount returns the amount of a transfer, which must be positive.
+func transferAmount(tr *TransferOrder) (money.Amount, bool) {
+	if tr.Transfer.Amount == nil {
+		return 0, false
+	}
+	amount, err := money.Parse(tr.Transfer.Amount.Value)
+	if err != nil || amount <= 0 {
+		return 0, false
+	}
+	return amount, true
+}
+
+// checkFunds reports whether the source account of the transfer covers its
+// amount.
+func (s *Server) checkFunds(tr *TransferOrder) bool {
+	amount, ok := transferAmount(tr)
+	if !ok {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ref, found := s.findAccountByID(tr.UserID, tr.AccountID)
+	if !found {
+		return false
+	}
+	_, acc := s.account(ref)
+	return covers(acc, amount)
+}
+
+// bookTransferLocked debits the source account of the transfer and records
+// the outgoing transaction. If the recipient is a known account it is
+// credited with an incoming transaction too. It reports false without booking
+// anything if the source account does not cover the amount. The caller must
+// hold s.mu.
+func (s *Server) bookTransferLocked(tr *TransferOrder, date time.Time) bool {
+	amount, ok := transferAmount(tr)
+	if !ok {
+		return false
+	}
+	outID, inID := s.nextIDLocked(), s.nextIDLocked()
+
+	from, found := s.findAccountByID(tr.UserID, tr.AccountID)
+	if !found {
+		return false
+	}
+	fromAccess, fromAcc := s.account(from)
+	if !covers(fromAcc, amount) {
+		return false
+	}
+	currency := tr.Transfer.Amount.Currency
+	if currency == "" {
+		currency = fromAcc.Currency
+	}
+
+	value := tr.Transfer.Amount.Value
+	s.adjustBalance(from, -amount, value, date)
+	user := s.Users[from.userID]
+	user.Transactions = append(user.Transactions, bosgo.Transaction{
+		ID:            outID,
+		AccessID:      fromAccess.ID,
+		UserAccountID: fromAcc.ID,
+		UserAccount: bosgo.AccountRef{
+			ProviderID: fromAccess.ProviderID,
+			IBAN:       fromAcc.IBAN,
+		},
+		Counterparty: bosgo.Counterparty{
+			Name:    tr.Transfer.To.Name,
+			Account: bosgo.AccountRef{IBAN: tr.Transfer.To.IBAN},
+		},
+		EntryDate:      date,
+		SettlementDate: date,
+		Amount:         &bosgo.MoneyAmount{Currency: currency, Value: formatAmount(-amount, value)},
+		Usage:          tr.Transfer.Usage,
+	})
+	s.Users[from.userID] = user
+
+	to, found := s.findAccountByIBAN(tr.Transfer.To.IBAN)
+	if !found {
+		return true
+	}
+	toAccess, toAcc := s.account(to)
+	s.adjustBalance(to, amount, value, date)
+	user = s.Users[to.userID]
+	user.Transactions = append(user.Transactions, bosgo.Transaction{
+		ID:            inID,
+		AccessID:      toAccess.ID,
+		UserAccountID: toAcc.ID,
+		UserAccount: bosgo.AccountRef{
+			ProviderID: toAccess.ProviderID,
+			IBAN:       toAcc.IBAN,
+		},
+		Counterparty: bosgo.Counterparty{
+			Name: tr.Transfer.From.Name,
+			Account: bosgo.AccountRef{
+				ProviderID: fromAccess.ProviderID,
+				IBAN:       fromAcc.IBAN,
+			},
+		},
+		EntryDate:      date,
+		SettlementDate: date,
+		Amount:         &bosgo.MoneyAmount{Currency: currency, Value: formatAmount(amount, value)},
+		Usage:          tr.Transfer.Usage,
+	})
+	s.Users[to.userID] = user
+	return true
+}
+
+// completeTransferLocked books a regular transfer that has been authorised or
+// applies a recurring one to the repeated transactions of its user. It fails
+// the transfer if the funds are insufficient or the repeated transaction it
+// changes no longer exists. The caller must hold s.mu.
+func (s *Server) completeTransferLocked(tr *TransferOrder) {
+	now := s.now()
+	tr.Transfer.State = bosgo.TransferStateSucceeded
+	tr.Transfer.Step = bosgo.TransferStep{}
+	tr.Transfer.EntryDate = now
+	tr.Transfer.SettlementDate = now
+
+	if tr.Type == bosgo.TransferTypeRecurring {
+		if !s.completeRecurringTransferLocked(tr, now) {
+			tr.Transfer.State = bosgo.TransferStateFailed
+			tr.Transfer.Errors = append(tr.Transfer.Errors, bosgo.Problem{Code: "resource_not_found"})
+		}
+		return
+	}
+	if !s.bookTransferLocked(tr, now) {
+		tr.Transfer.State = bosgo.TransferStateFailed
+		tr.Transfer.Errors = append(tr.Transfer.Errors, bosgo.Problem{Code: ProblemInsufficientFunds})
+	}
+}
+
+// completeRecurringTransfer adds, changes or deletes the repeated transaction
+// of a recurring transfer, depending on its operation. The transfer replaces
+// the order of a changed or deleted repeated transaction, which is cancelled
+// so that its executions stop. It reports false if the repeated transaction
+// does not exist. The caller must hold s.mu.
+func (s *Server) completeRecurringTransferLocked(tr *TransferOrder, now time.Time) bool {
+	// Executions due today are made
+	y, m, d := now.Date()
+	tr.ExecutedUntil = time.Date(y, m, d, 0, 0, 0, 0, now.Location()).Add(-time.Nanosecond)
+
+	user := s.Users[tr.UserID]
+	rtxs := append([]bosgo.RepeatedTransaction{}, user.RepeatedTransactions...)
+	idx := -1
+	if tr.Operation == OrderOpCreate {
+		tr.RepeatedID = s.nextIDLocked()
+		rtxs = append(rtxs, bosgo.RepeatedTransaction{ID: tr.RepeatedID})
+		idx = len(rtxs) - 1
+	} else {
+		for i, rtx := range rtxs {
+			if rtx.ID == tr.RepeatedID {
+				idx = i
+				break
+			}
+		}
+		if idx == -1 {
+			return false
+		}
+		// The replacement continues where the replaced order or, for
+		// repeated transactions without one, executeTransactions stopped
+		if old, found := s.RecurringTransfers[rtxs[idx].RemoteID]; found && old.Transfer.ID != tr.Transfer.ID {
+			old.Transfer.State = bosgo.TransferStateCancelled
+			old.rev++
+			s.RecurringTransfers[old.Transfer.ID] = old
+			if !old.ExecutedUntil.IsZero() {
+				tr.ExecutedUntil = old.ExecutedUntil
+			}
+		} else if !user.ExecutedUntil.IsZero() {
+			tr.ExecutedUntil = user.ExecutedUntil
+		}
+	}
+
+	if tr.Operation == OrderOpDelete {
+		rtxs = append(rtxs[:idx], rtxs[idx+1:]...)
+	} else {
+		rtx := &rtxs[idx]
+		rtx.RemoteID = tr.Transfer.ID
+		rtx.AccessID = tr.Transfer.From.AccessID
+		rtx.UserAccountID = tr.AccountID
+		rtx.UserAccount = bosgo.AccountRef{IBAN: tr.Transfer.From.IBAN}
+		if ref, found := s.findAccountByID(tr.UserID, tr.AccountID); found {
+			ac, _ := s.account(ref)
+			rtx.UserAccount.ProviderID = ac.ProviderID
+		}
+		rtx.RemoteAccount = bosgo.AccountRef{Label: tr.Transfer.To.Name, IBAN: tr.Transfer.To.IBAN}
+		if tr.Schedule != nil {
+			rtx.Schedule = *tr.Schedule
+		}
+		if tr.Transfer.Amount != nil {
+			amount := *tr.Transfer.Amount
+			rtx.Amount = &amount
+		}
+		rtx.Usage = tr.Transfer.Usage
+	}
+	user.RepeatedTransactions = rtxs
+	s.Users[tr.UserID] = user
+	return true
+}
+
+// executeRecurringTransfers books the executions of the user's recurring
+// transfers that have become due. Executions the source account does not
+// cover are skipped and reported in the transfer's errors.
+func (s *Server) executeRecurringTransfers(userID string) {
+	now := s.now()
+
+	// Due executions are booked and marked as executed together so that
+	// concurrent requests of the user book them once
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, tr := range s.RecurringTransfers {
+		if tr.UserID != userID || tr.Transfer.State != bosgo.TransferStateSucceeded || tr.Schedule == nil || !now.After(tr.ExecutedUntil) {
+			continue
+		}
+		for _, date := range occurrences(*tr.Schedule, tr.ExecutedUntil, now) {
+			if !s.bookTransferLocked(&tr, date) {
+				tr.Transfer.Errors = append(tr.Transfer.Errors, bosgo.Problem{
+					Code: ProblemInsufficientFunds,
+					Info: map[string]interface{}{"date": date},
+				})
+			}
+		}
+		tr.ExecutedUntil = now
+		tr.rev++
+		s.RecurringTransfers[id] = tr
+	}
+}
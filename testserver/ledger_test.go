@@ -0,0 +1,502 @@
+package testserver
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"code.bankrs.com/bosgo"
+	"code.bankrs.com/bosgo/internal/money"
+)
+
+func findAccount(t *testing.T, userClient *bosgo.UserClient, iban string) bosgo.Account {
+	t.Helper()
+	page, err := userClient.Accounts.List().Send()
+	if err != nil {
+		t.Fatalf("failed to list accounts: %v", err)
+	}
+	for _, acc := range page.Accounts {
+		if acc.IBAN == iban {
+			return acc
+		}
+	}
+	t.Fatalf("account %s not found", iban)
+	return bosgo.Account{}
+}
+
+// processFunc processes a step of a transfer and returns its next intent and state.
+type processFunc func(intent bosgo.TransferIntent, ans bosgo.ChallengeAnswer) (bosgo.TransferIntent, bosgo.TransferState)
+
+// authorizeTransfer answers the steps of a transfer with the default answers
+// and returns its final state.
+func authorizeTransfer(t *testing.T, process processFunc) bosgo.TransferState {
+	t.Helper()
+	answers := []bosgo.ChallengeAnswer{
+		{ID: ChallengePIN, Value: DefaultAccessPIN},
+		{ID: "auth_method", Value: DefaultAuthMethod},
+		{ID: "tan", Value: DefaultAuthAnswer},
+	}
+	intent, state := bosgo.TransferIntentProvidePIN, bosgo.TransferStateOngoing
+	for _, ans := range answers {
+		intent, state = process(intent, ans)
+	}
+	return state
+}
+
+func TestTransferBooksTransactions(t *testing.T) {
+	s := NewWithDefaults()
+	if testing.Verbose() {
+		s.SetLogger(t)
+	}
+	defer s.Close()
+
+	userClient := loginUser(t, s)
+	if _, _, err := addDefaultAccess(userClient, false); err != nil {
+		t.Fatalf("failed to add access: %v", err)
+	}
+	if err := s.AssignTransactions(DefaultUsername, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	from := findAccount(t, userClient, "DE84200700245353762745")
+	to := findAccount(t, userClient, "DE56200800950445688921")
+
+	transfer, err := userClient.Transfers.Create(from.ID, bosgo.TransferAddress{Name: "Savings", IBAN: to.IBAN}, bosgo.MoneyAmount{Currency: "EUR", Value: "100.00"}).Send()
+	if err != nil {
+		t.Fatalf("failed to create transfer: %v", err)
+	}
+	state := authorizeTransfer(t, func(intent bosgo.TransferIntent, ans bosgo.ChallengeAnswer) (bosgo.TransferIntent, bosgo.TransferState) {
+		tr, err := userClient.Transfers.Process(transfer.ID, intent, transfer.Version).ChallengeAnswer(ans).Send()
+		if err != nil {
+			t.Fatalf("failed to process transfer: %v", err)
+		}
+		return tr.Step.Intent, tr.State
+	})
+	if state != bosgo.TransferStateSucceeded {
+		t.Fatalf("got state %v, wanted %v", state, bosgo.TransferStateSucceeded)
+	}
+
+	from = findAccount(t, userClient, from.IBAN)
+	if from.Balance != "871.20" || from.AvailableBalance != "1371.20" {
+		t.Errorf("source balances: got %s and %s, wanted 871.20 and 1371.20", from.Balance, from.AvailableBalance)
+	}
+	to = findAccount(t, userClient, to.IBAN)
+	if to.Balance != "145.00" || to.AvailableBalance != "145.00" {
+		t.Errorf("recipient balances: got %s and %s, wanted 145.00 and 145.00", to.Balance, to.AvailableBalance)
+	}
+
+	page, err := userClient.Transactions.List().Send()
+	if err != nil {
+		t.Fatalf("failed to list transactions: %v", err)
+	}
+	if len(page.Transactions) != 2 {
+		t.Fatalf("got %d transactions, wanted 2", len(page.Transactions))
+	}
+	out, in := page.Transactions[0], page.Transactions[1]
+	if out.UserAccountID != from.ID || out.Amount.Value != "-100.00" || out.Counterparty.Account.IBAN != to.IBAN {
+		t.Errorf("outgoing transaction: got %+v", out)
+	}
+	if in.UserAccountID != to.ID || in.Amount.Value != "100.00" || in.Counterparty.Account.IBAN != from.IBAN {
+		t.Errorf("incoming transaction: got %+v", in)
+	}
+}
+
+func TestAdjustBalanceKeepsPrecision(t *testing.T) {
+	s := NewWithDefaults()
+	if testing.Verbose() {
+		s.SetLogger(t)
+	}
+	defer s.Close()
+
+	userClient := loginUser(t, s)
+	if _, _, err := addDefaultAccess(userClient, false); err != nil {
+		t.Fatalf("failed to add access: %v", err)
+	}
+	user, _ := s.GetUserByName(DefaultUsername)
+
+	s.mu.Lock()
+	ref, _ := s.findAccountByIBAN("DE84200700245353762745")
+	acc := &s.Users[user.ID].Accesses[ref.access].Accounts[ref.acc]
+	acc.Balance, acc.AvailableBalance = "971.2050", "1471.2"
+	s.adjustBalance(ref, -money.MustParse("100.005"), "100.005", s.now())
+	_, got := s.account(ref)
+	s.mu.Unlock()
+
+	if got.Balance != "871.2000" || got.AvailableBalance != "1371.195" {
+		t.Errorf("got balances %s and %s, wanted 871.2000 and 1371.195", got.Balance, got.AvailableBalance)
+	}
+}
+
+func TestTransferConcurrentProcesses(t *testing.T) {
+	s := NewWithDefaults()
+	if testing.Verbose() {
+		s.SetLogger(t)
+	}
+	defer s.Close()
+
+	userClient := loginUser(t, s)
+	_, accountID, err := addDefaultAccess(userClient, false)
+	if err != nil {
+		t.Fatalf("failed to add access: %v", err)
+	}
+	if err := s.AssignTransactions(DefaultUsername, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	transfer, err := userClient.Transfers.Create(accountID, bosgo.TransferAddress{Name: "Jane Doe", IBAN: "DE28500105175552834822"}, bosgo.MoneyAmount{Currency: "EUR", Value: "100.00"}).Send()
+	if err != nil {
+		t.Fatalf("failed to create transfer: %v", err)
+	}
+	for _, ans := range []bosgo.ChallengeAnswer{
+		{ID: ChallengePIN, Value: DefaultAccessPIN},
+		{ID: "auth_method", Value: DefaultAuthMethod},
+	} {
+		tr, err := userClient.Transfers.Process(transfer.ID, transfer.Step.Intent, transfer.Version).ChallengeAnswer(ans).Send()
+		if err != nil {
+			t.Fatalf("failed to process transfer: %v", err)
+		}
+		transfer = tr
+	}
+
+	// Both processes read the transfer before either stores it, but only
+	// one books it
+	const processes = 2
+	var ready, wg sync.WaitGroup
+	ready.Add(processes)
+	for i := 0; i < processes; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			first := true
+			s.updateTransfer(transfer.ID, bosgo.TransferTypeRegular, func(tr *TransferOrder) (bool, bool) {
+				if first {
+					first = false
+					ready.Done()
+					ready.Wait()
+				}
+				if tr.Transfer.State != bosgo.TransferStateOngoing {
+					return false, false
+				}
+				return s.progressTransfer(tr, false, []bosgo.ChallengeAnswer{{ID: "tan", Value: DefaultAuthAnswer}}), true
+			})
+		}()
+	}
+	wg.Wait()
+
+	if acc := findAccount(t, userClient, "DE84200700245353762745"); acc.Balance != "871.20" {
+		t.Errorf("got balance %s, wanted 871.20", acc.Balance)
+	}
+	page, err := userClient.Transactions.List().Send()
+	if err != nil {
+		t.Fatalf("failed to list transactions: %v", err)
+	}
+	if len(page.Transactions) != 1 {
+		t.Errorf("got %d transactions, wanted 1", len(page.Transactions))
+	}
+}
+
+func TestTransferInsufficientFunds(t *testing.T) {
+	s := NewWithDefaults()
+	if testing.Verbose() {
+		s.SetLogger(t)
+	}
+	defer s.Close()
+
+	userClient := loginUser(t, s)
+	_, accountID, err := addDefaultAccess(userClient, false)
+	if err != nil {
+		t.Fatalf("failed to add access: %v", err)
+	}
+
+	to := bosgo.TransferAddress{Name: "Jane Doe", IBAN: "DE28500105175552834822"}
+	testCases := []struct {
+		amount string
+		state  bosgo.TransferState
+	}{
+		{"1471.21", bosgo.TransferStateFailed}, // balance plus credit line is 1471.20
+		{"1471.20", bosgo.TransferStateOngoing},
+		{"-5.00", bosgo.TransferStateFailed},
+	}
+	for _, tc := range testCases {
+		transfer, err := userClient.Transfers.Create(accountID, to, bosgo.MoneyAmount{Currency: "EUR", Value: tc.amount}).Send()
+		if err != nil {
+			t.Fatalf("failed to create transfer: %v", err)
+		}
+		if transfer.State != tc.state {
+			t.Errorf("%s: got state %v, wanted %v", tc.amount, transfer.State, tc.state)
+		}
+	}
+
+	transfer, err := userClient.Transfers.Create(accountID, to, bosgo.MoneyAmount{Currency: "EUR", Value: "2000.00"}).Send()
+	if err != nil {
+		t.Fatalf("failed to create transfer: %v", err)
+	}
+	if len(transfer.Errors) != 1 || transfer.Errors[0].Code != ProblemInsufficientFunds {
+		t.Errorf("got errors %+v, wanted %s", transfer.Errors, ProblemInsufficientFunds)
+	}
+}
+
+// createRent creates and authorises a monthly recurring transfer of the
+// amount from the account, starting on 15 January 2020, and returns its ID.
+func createRent(t *testing.T, userClient *bosgo.UserClient, accountID int64, amount string) string {
+	t.Helper()
+	rule := bosgo.RecurrenceRule{
+		Start:     time.Date(2020, 1, 15, 0, 0, 0, 0, time.UTC),
+		Frequency: bosgo.FrequencyMonthly,
+		Interval:  1,
+	}
+	transfer, err := userClient.RecurringTransfers.Create(accountID, bosgo.TransferAddress{Name: "Landlord", IBAN: "DE28500105175552834822"}, bosgo.MoneyAmount{Currency: "EUR", Value: amount}, rule, "Rent").Send()
+	if err != nil {
+		t.Fatalf("failed to create recurring transfer: %v", err)
+	}
+	authorizeRecurringTransfer(t, userClient, transfer)
+	return transfer.ID
+}
+
+// authorizeRecurringTransfer answers the steps of a recurring transfer and
+// fails the test unless it succeeds.
+func authorizeRecurringTransfer(t *testing.T, userClient *bosgo.UserClient, transfer *bosgo.RecurringTransfer) {
+	t.Helper()
+	state := authorizeTransfer(t, func(intent bosgo.TransferIntent, ans bosgo.ChallengeAnswer) (bosgo.TransferIntent, bosgo.TransferState) {
+		tr, err := userClient.RecurringTransfers.Process(transfer.ID, intent, transfer.Version).ChallengeAnswer(ans).Send()
+		if err != nil {
+			t.Fatalf("failed to process recurring transfer: %v", err)
+		}
+		return tr.Step.Intent, tr.State
+	})
+	if state != bosgo.TransferStateSucceeded {
+		t.Fatalf("got state %v, wanted %v", state, bosgo.TransferStateSucceeded)
+	}
+}
+
+// repeatedTransaction returns the user's repeated transaction of the
+// recurring transfer.
+func repeatedTransaction(t *testing.T, userClient *bosgo.UserClient, transferID string) (bosgo.RepeatedTransaction, bool) {
+	t.Helper()
+	page, err := userClient.RepeatedTransactions.List().Send()
+	if err != nil {
+		t.Fatalf("failed to list repeated transactions: %v", err)
+	}
+	for _, rtx := range page.Transactions {
+		if rtx.RemoteID == transferID {
+			return rtx, true
+		}
+	}
+	return bosgo.RepeatedTransaction{}, false
+}
+
+// transactionAmounts returns the amounts of the user's transactions.
+func transactionAmounts(t *testing.T, userClient *bosgo.UserClient) []string {
+	t.Helper()
+	page, err := userClient.Transactions.List().Send()
+	if err != nil {
+		t.Fatalf("failed to list transactions: %v", err)
+	}
+	var amounts []string
+	for _, tx := range page.Transactions {
+		amounts = append(amounts, tx.Amount.Value)
+	}
+	return amounts
+}
+
+func TestRecurringTransferExecutions(t *testing.T) {
+	s := NewWithDefaults()
+	if testing.Verbose() {
+		s.SetLogger(t)
+	}
+	defer s.Close()
+
+	clock := NewFakeClock(time.Date(2020, 1, 10, 9, 0, 0, 0, time.UTC))
+	s.SetClock(clock)
+
+	userClient := loginUser(t, s)
+	_, accountID, err := addDefaultAccess(userClient, false)
+	if err != nil {
+		t.Fatalf("failed to add access: %v", err)
+	}
+	if err := s.AssignTransactions(DefaultUsername, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	transferID := createRent(t, userClient, accountID, "400.00")
+
+	// Nothing is due yet
+	page, err := userClient.Transactions.List().Send()
+	if err != nil {
+		t.Fatalf("failed to list transactions: %v", err)
+	}
+	if len(page.Transactions) != 0 {
+		t.Fatalf("got %d transactions before the first execution, wanted none", len(page.Transactions))
+	}
+
+	// The fourth execution exceeds the balance and credit line of 1471.20
+	clock.Set(time.Date(2020, 4, 20, 0, 0, 0, 0, time.UTC))
+	page, err = userClient.Transactions.List().Send()
+	if err != nil {
+		t.Fatalf("failed to list transactions: %v", err)
+	}
+	if len(page.Transactions) != 3 {
+		t.Fatalf("got %d transactions, wanted 3", len(page.Transactions))
+	}
+	for i, month := range []time.Month{time.January, time.February, time.March} {
+		tx := page.Transactions[i]
+		if want := time.Date(2020, month, 15, 0, 0, 0, 0, time.UTC); !tx.EntryDate.Equal(want) || tx.Amount.Value != "-400.00" || tx.Usage != "Rent" {
+			t.Errorf("execution %d: got %v %s %q, wanted %v -400.00 Rent", i, tx.EntryDate, tx.Amount.Value, tx.Usage, want)
+		}
+	}
+	if acc := findAccount(t, userClient, "DE84200700245353762745"); acc.Balance != "-228.80" {
+		t.Errorf("got balance %s, wanted -228.80", acc.Balance)
+	}
+
+	s.mu.Lock()
+	tr := s.RecurringTransfers[transferID]
+	s.mu.Unlock()
+	if len(tr.Transfer.Errors) != 1 || tr.Transfer.Errors[0].Code != ProblemInsufficientFunds {
+		t.Errorf("got errors %+v, wanted %s", tr.Transfer.Errors, ProblemInsufficientFunds)
+	}
+}
+
+func TestRecurringTransferConcurrentExecutions(t *testing.T) {
+	s := NewWithDefaults()
+	if testing.Verbose() {
+		s.SetLogger(t)
+	}
+	defer s.Close()
+
+	clock := NewFakeClock(time.Date(2020, 1, 10, 9, 0, 0, 0, time.UTC))
+	s.SetClock(clock)
+
+	userClient := loginUser(t, s)
+	_, accountID, err := addDefaultAccess(userClient, false)
+	if err != nil {
+		t.Fatalf("failed to add access: %v", err)
+	}
+	if err := s.AssignTransactions(DefaultUsername, nil); err != nil {
+		t.Fatal(err)
+	}
+	createRent(t, userClient, accountID, "100.00")
+
+	// Every request of the user executes the due transfers, each execution
+	// is booked once
+	clock.Set(time.Date(2020, 3, 20, 0, 0, 0, 0, time.UTC))
+	user, _ := s.GetUserByName(DefaultUsername)
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			s.executeRecurringTransfers(user.ID)
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	page, err := userClient.Transactions.List().Send()
+	if err != nil {
+		t.Fatalf("failed to list transactions: %v", err)
+	}
+	if len(page.Transactions) != 3 {
+		t.Errorf("got %d transactions, wanted 3", len(page.Transactions))
+	}
+}
+
+func TestRepeatedTransactionUpdate(t *testing.T) {
+	s := NewWithDefaults()
+	if testing.Verbose() {
+		s.SetLogger(t)
+	}
+	defer s.Close()
+
+	clock := NewFakeClock(time.Date(2020, 1, 10, 9, 0, 0, 0, time.UTC))
+	s.SetClock(clock)
+
+	userClient := loginUser(t, s)
+	_, accountID, err := addDefaultAccess(userClient, false)
+	if err != nil {
+		t.Fatalf("failed to add access: %v", err)
+	}
+	if err := s.AssignTransactions(DefaultUsername, nil); err != nil {
+		t.Fatal(err)
+	}
+	transferID := createRent(t, userClient, accountID, "100.00")
+
+	rtx, found := repeatedTransaction(t, userClient, transferID)
+	if !found {
+		t.Fatalf("no repeated transaction of transfer %s", transferID)
+	}
+	if rtx.UserAccountID != accountID || rtx.Amount.Value != "100.00" || rtx.Usage != "Rent" || rtx.RemoteAccount.IBAN != "DE28500105175552834822" {
+		t.Errorf("got repeated transaction %+v, wanted the rent of transfer %s", rtx, transferID)
+	}
+
+	clock.Set(time.Date(2020, 2, 20, 0, 0, 0, 0, time.UTC))
+	update, err := userClient.RepeatedTransactions.Update(strconv.FormatInt(rtx.ID, 10), bosgo.TransferAddress{Name: "Landlord", IBAN: "DE28500105175552834822"}, bosgo.MoneyAmount{Currency: "EUR", Value: "200.00"}, "Rent").Send()
+	if err != nil {
+		t.Fatalf("failed to update repeated transaction: %v", err)
+	}
+	authorizeRecurringTransfer(t, userClient, update)
+
+	if _, found := repeatedTransaction(t, userClient, transferID); found {
+		t.Errorf("repeated transaction still belongs to transfer %s", transferID)
+	}
+	updated, found := repeatedTransaction(t, userClient, update.ID)
+	if !found {
+		t.Fatalf("no repeated transaction of transfer %s", update.ID)
+	}
+	if updated.ID != rtx.ID || updated.Amount.Value != "200.00" {
+		t.Errorf("got repeated transaction %+v, wanted %d with the amount 200.00", updated, rtx.ID)
+	}
+
+	// Only the updated order executes from now on
+	clock.Set(time.Date(2020, 4, 20, 0, 0, 0, 0, time.UTC))
+	amounts := transactionAmounts(t, userClient)
+	want := []string{"-100.00", "-100.00", "-200.00", "-200.00"}
+	if strings.Join(amounts, " ") != strings.Join(want, " ") {
+		t.Errorf("got amounts %v, wanted %v", amounts, want)
+	}
+}
+
+func TestRepeatedTransactionDelete(t *testing.T) {
+	s := NewWithDefaults()
+	if testing.Verbose() {
+		s.SetLogger(t)
+	}
+	defer s.Close()
+
+	clock := NewFakeClock(time.Date(2020, 1, 10, 9, 0, 0, 0, time.UTC))
+	s.SetClock(clock)
+
+	userClient := loginUser(t, s)
+	_, accountID, err := addDefaultAccess(userClient, false)
+	if err != nil {
+		t.Fatalf("failed to add access: %v", err)
+	}
+	if err := s.AssignTransactions(DefaultUsername, nil); err != nil {
+		t.Fatal(err)
+	}
+	transferID := createRent(t, userClient, accountID, "100.00")
+
+	clock.Set(time.Date(2020, 2, 20, 0, 0, 0, 0, time.UTC))
+	rtx, found := repeatedTransaction(t, userClient, transferID)
+	if !found {
+		t.Fatalf("no repeated transaction of transfer %s", transferID)
+	}
+	deletion, err := userClient.RepeatedTransactions.Delete(strconv.FormatInt(rtx.ID, 10)).Send()
+	if err != nil {
+		t.Fatalf("failed to delete repeated transaction: %v", err)
+	}
+	authorizeRecurringTransfer(t, userClient, deletion)
+
+	if _, found := repeatedTransaction(t, userClient, transferID); found {
+		t.Errorf("repeated transaction of transfer %s remains after deletion", transferID)
+	}
+
+	// The executions before the deletion remain, no more are made
+	clock.Set(time.Date(2020, 4, 20, 0, 0, 0, 0, time.UTC))
+	if amounts := transactionAmounts(t, userClient); len(amounts) != 2 {
+		t.Errorf("got amounts %v, wanted two executions", amounts)
+	}
+}
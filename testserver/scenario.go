@@ -0,0 +1,327 @@
+package testserver
+
+import (
+	"encoding/json"
+	"time"
+
+	"code.bankrs.com/bosgo"
+)
+
+// Challenge field IDs used by scenarios.
+const (
+	ChallengeNewPIN    = "new_pin"
+	ChallengeDecoupled = "decoupled"
+)
+
+// Scenario scripts the authentication of an access in place of the single
+// round of AccessDetails.ChallengeMap. Scenarios are plain data so they can
+// be written in fixture files.
+type Scenario struct {
+	// Rounds are asked for one after another. Answers given for one round
+	// are not used for the next.
+	Rounds []ChallengeRound `json:"rounds"`
+
+	// MaxAttempts is the number of wrong answers to a round after which the
+	// job fails with user_locked. Zero allows any number.
+	MaxAttempts int `json:"max_attempts"`
+
+	// ExpireConsent makes the next refresh ignore stored answers and ask for
+	// all rounds again, reporting consent_expired.
+	ExpireConsent bool `json:"expire_consent"`
+
+	// RequirePINChange adds a final round asking for a new PIN, which
+	// replaces the expected answer to the pin challenge once given.
+	RequirePINChange bool `json:"require_pin_change"`
+}
+
+// ChallengeRound is a set of challenges answered together, or a decoupled
+// approval the user gives outside of the application.
+type ChallengeRound struct {
+	Fields []ScenarioField `json:"fields"`
+
+	// Decoupled rounds have no fields. They complete by themselves after
+	// ApproveAfter, or fail with user_decoupled_rejected if Reject is set.
+	Decoupled    bool     `json:"decoupled"`
+	Message      string   `json:"message"` // shown to the user while waiting for approval
+	ApproveAfter Duration `json:"approve_after"`
+	Reject       bool     `json:"reject"`
+}
+
+// ScenarioField is a challenge and its expected answer.
+type ScenarioField struct {
+	ID          string              `json:"id"`
+	Description string              `json:"description"`
+	Type        bosgo.ChallengeType `json:"type"`
+	Secure      bool                `json:"secure"`
+	Answer      string              `json:"answer"`     // any non-empty answer is accepted if empty
+	ErrorCode   string              `json:"error_code"` // problem reported for a wrong answer, user_wrong_answer if empty
+}
+
+// Duration is a time.Duration written as a string such as "1.5s" in JSON.
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		// Plain numbers are nanoseconds
+		var n int64
+		if err := json.Unmarshal(data, &n); err != nil {
+			return err
+		}
+		*d = Duration(n)
+		return nil
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// rounds returns the rounds of the scenario including the PIN change.
+func (sc *Scenario) rounds() []ChallengeRound {
+	if !sc.RequirePINChange {
+		return sc.Rounds
+	}
+	return append(sc.Rounds[:len(sc.Rounds):len(sc.Rounds)], ChallengeRound{
+		Fields: []ScenarioField{{
+			ID:          ChallengeNewPIN,
+			Description: "New PIN",
+			Type:        bosgo.ChallengeTypeAlphaNumeric,
+			Secure:      true,
+		}},
+	})
+}
+
+// progressScenario moves a job through the rounds of its scenario as far as
+// the answers allow. Changes to the scenario and PIN are added to fx.
+func (s *Server) progressScenario(j *Job, sc *Scenario, answers []bosgo.ChallengeAnswer, fx *jobEffects) {
+	j.RoundAnswers = append(j.RoundAnswers, answers...)
+	j.LastProblems = nil
+	if j.JobAction == JobActionRefresh && (sc.ExpireConsent || j.ConsentExpired) && !j.ConsentRenewed {
+		j.LastProblems = append(j.LastProblems, bosgo.Problem{Code: "consent_expired"})
+	}
+
+	rounds := sc.rounds()
+	for j.Round < len(rounds) {
+		r := rounds[j.Round]
+		if r.Decoupled {
+			if j.RoundStarted.IsZero() {
+				j.RoundStarted = s.now()
+			}
+			if s.now().Sub(j.RoundStarted) < time.Duration(r.ApproveAfter) {
+				s.waitForAnswers(j)
+				return
+			}
+			if r.Reject {
+				s.failScenario(j, "user_decoupled_rejected")
+				return
+			}
+			s.nextRound(j)
+			continue
+		}
+
+		given := map[string]string{}
+		for _, a := range j.RoundAnswers {
+			given[a.ID] = a.Value
+		}
+		complete, correct := true, true
+		for _, f := range r.Fields {
+			v, answered := given[f.ID]
+			if !answered || v == "" {
+				complete = false
+				continue
+			}
+			if f.Answer != "" && v != f.Answer {
+				correct = false
+				code := f.ErrorCode
+				if code == "" {
+					code = "user_wrong_answer"
+				}
+				j.LastProblems = append(j.LastProblems,
+					bosgo.Problem{Code: code},
+					bosgo.Problem{Code: "connector_field_reset", Info: map[string]interface{}{"field_key": f.ID}},
+				)
+				j.RoundAnswers = withoutAnswer(j.RoundAnswers, f.ID)
+			}
+		}
+
+		if !correct {
+			j.RoundAttempts++
+			if sc.MaxAttempts > 0 && j.RoundAttempts >= sc.MaxAttempts {
+				s.failScenario(j, "user_locked")
+				return
+			}
+		}
+		if !complete || !correct {
+			if j.Round == len(sc.Rounds) && sc.RequirePINChange {
+				j.LastProblems = append(j.LastProblems, bosgo.Problem{Code: "user_pin_change_required"})
+			}
+			s.waitForAnswers(j)
+			return
+		}
+
+		if v, changed := given[ChallengeNewPIN]; changed && j.Round == len(sc.Rounds) {
+			job := *j
+			fx.add(func() { s.changePIN(&job, v) })
+		}
+		s.nextRound(j)
+	}
+
+	j.NeedsAnswers = false
+	j.Stage = bosgo.JobStageImported
+	j.Finished = true
+	if j.JobAction == JobActionRefresh && sc.ExpireConsent {
+		providerID := j.ProviderID
+		fx.add(func() {
+			s.updateScenario(providerID, func(sc *Scenario) { sc.ExpireConsent = false })
+		})
+	}
+}
+
+func (s *Server) waitForAnswers(j *Job) {
+	j.NeedsAnswers = true
+	j.Stage = bosgo.JobStageChallenge
+}
+
+func (s *Server) nextRound(j *Job) {
+	j.Round++
+	j.RoundAttempts = 0
+	j.RoundAnswers = nil
+	j.RoundStarted = time.Time{}
+	if j.JobAction == JobActionRefresh {
+		j.ConsentRenewed = true
+	}
+}
+
+func (s *Server) failScenario(j *Job, code string) {
+	j.NeedsAnswers = false
+	j.Stage = bosgo.JobStageProblem
+	j.Finished = true
+	j.Problems = append(j.Problems, bosgo.Problem{Code: code})
+}
+
+// changePIN replaces the expected answers to the pin challenge of the job's
+// provider and the user's stored PIN, and ends the required PIN change.
+func (s *Server) changePIN(j *Job, pin string) {
+	s.updateUser(j.UserID, func(user *User) {
+		if len(user.StoredAnswers[j.ProviderID]) == 0 {
+			return
+		}
+		answers := append([]bosgo.ChallengeAnswer(nil), user.StoredAnswers[j.ProviderID]...)
+		for i := range answers {
+			if answers[i].ID == ChallengePIN {
+				answers[i].Value = pin
+			}
+		}
+		user.StoredAnswers = withStoredAnswers(user.StoredAnswers, j.ProviderID, answers)
+	})
+
+	s.mu.Lock()
+	if ad, exists := s.Accesses[j.ProviderID]; exists && ad.ChallengeMap[ChallengePIN] != "" {
+		challenges := make(map[string]string, len(ad.ChallengeMap))
+		for id, val := range ad.ChallengeMap {
+			challenges[id] = val
+		}
+		challenges[ChallengePIN] = pin
+		ad.ChallengeMap = challenges
+		s.Accesses[j.ProviderID] = ad
+	}
+	s.mu.Unlock()
+
+	s.updateScenario(j.ProviderID, func(sc *Scenario) {
+		sc.RequirePINChange = false
+		for i := range sc.Rounds {
+			fields := append([]ScenarioField(nil), sc.Rounds[i].Fields...)
+			for k := range fields {
+				if fields[k].ID == ChallengePIN {
+					fields[k].Answer = pin
+				}
+			}
+			sc.Rounds[i].Fields = fields
+		}
+	})
+}
+
+// updateScenario changes a copy of the scenario of the provider's access.
+func (s *Server) updateScenario(providerID string, change func(sc *Scenario)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ad, exists := s.Accesses[providerID]
+	if !exists || ad.Scenario == nil {
+		return
+	}
+	sc := *ad.Scenario
+	sc.Rounds = append([]ChallengeRound(nil), sc.Rounds...)
+	change(&sc)
+	ad.Scenario = &sc
+	s.Accesses[providerID] = ad
+}
+
+// awaitsApproval reports whether the job waits for a decoupled round of its
+// scenario to complete.
+func (s *Server) awaitsApproval(j *Job) bool {
+	sc := j.AccessDetails.Scenario
+	if sc == nil || j.Finished || !j.NeedsAnswers {
+		return false
+	}
+	rounds := sc.rounds()
+	return j.Round < len(rounds) && rounds[j.Round].Decoupled
+}
+
+func withoutAnswer(answers []bosgo.ChallengeAnswer, id string) []bosgo.ChallengeAnswer {
+	var kept []bosgo.ChallengeAnswer
+	for _, a := range answers {
+		if a.ID != id {
+			kept = append(kept, a)
+		}
+	}
+	return kept
+}
+
+// scenarioChallenge describes the current round of a job waiting for answers.
+func scenarioChallenge(j *Job, sc *Scenario) *bosgo.Challenge {
+	c := &bosgo.Challenge{
+		NextChallenges: []bosgo.ChallengeField{},
+		LastProblems:   j.LastProblems,
+	}
+	rounds := sc.rounds()
+	if j.Round >= len(rounds) {
+		return c
+	}
+
+	r := rounds[j.Round]
+	if r.Decoupled {
+		c.NextChallenges = append(c.NextChallenges, bosgo.ChallengeField{
+			ID:            ChallengeDecoupled,
+			Description:   r.Message,
+			ChallengeType: "decoupled",
+			Optional:      true,
+		})
+		return c
+	}
+	for _, f := range r.Fields {
+		c.NextChallenges = append(c.NextChallenges, bosgo.ChallengeField{
+			ID:            f.ID,
+			Description:   f.Description,
+			ChallengeType: string(f.Type),
+			Secure:        f.Secure,
+			Reset:         hasFieldReset(j.LastProblems, f.ID),
+		})
+	}
+	return c
+}
+
+func hasFieldReset(problems []bosgo.Problem, id string) bool {
+	for _, p := range problems {
+		if p.Code == "connector_field_reset" && p.Info["field_key"] == id {
+			return true
+		}
+	}
+	return false
+}
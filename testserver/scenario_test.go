@@ -0,0 +1,424 @@
+package testserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"code.bankrs.com/bosgo"
+)
+
+// setScenario gives the default access a scenario.
+func setScenario(s *Server, sc Scenario) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ad := s.Accesses[DefaultProviderID]
+	ad.Scenario = &sc
+	s.Accesses[DefaultProviderID] = ad
+}
+
+func loginRound() ChallengeRound {
+	return ChallengeRound{Fields: []ScenarioField{
+		{ID: ChallengeLogin, Description: "Login name", Type: bosgo.ChallengeTypeAlphaNumeric, Answer: DefaultAccessLogin},
+		{ID: ChallengePIN, Description: "PIN", Type: bosgo.ChallengeTypeNumeric, Secure: true, Answer: DefaultAccessPIN, ErrorCode: "user_wrong_pin"},
+	}}
+}
+
+func loginUser(t *testing.T, s *Server) *bosgo.UserClient {
+	t.Helper()
+	appClient := bosgo.NewAppClient(s.Client(), s.Addr(), DefaultApplicationID)
+	userClient, err := appClient.Users.Login(DefaultUsername, DefaultPassword).Send()
+	if err != nil {
+		t.Fatalf("failed to login as user: %v", err)
+	}
+	return userClient
+}
+
+// startAccess starts adding the default access with the default login and PIN.
+func startAccess(t *testing.T, userClient *bosgo.UserClient, store bool) string {
+	t.Helper()
+	job, err := userClient.Accesses.Add(DefaultProviderID).
+		ChallengeAnswer(bosgo.ChallengeAnswer{ID: ChallengeLogin, Value: DefaultAccessLogin, Store: store}).
+		ChallengeAnswer(bosgo.ChallengeAnswer{ID: ChallengePIN, Value: DefaultAccessPIN, Store: store}).
+		Send()
+	if err != nil {
+		t.Fatalf("failed to add access: %v", err)
+	}
+	return job.URI
+}
+
+func jobStatus(t *testing.T, userClient *bosgo.UserClient, uri string) *bosgo.JobStatus {
+	t.Helper()
+	status, err := userClient.Jobs.Get(uri).Send()
+	if err != nil {
+		t.Fatalf("failed to get job status: %v", err)
+	}
+	return status
+}
+
+func answer(t *testing.T, userClient *bosgo.UserClient, uri, id, value string) {
+	t.Helper()
+	if err := userClient.Jobs.Answer(uri).ChallengeAnswer(bosgo.ChallengeAnswer{ID: id, Value: value}).Send(); err != nil {
+		t.Fatalf("failed to answer %s: %v", id, err)
+	}
+}
+
+func hasProblem(problems []bosgo.Problem, code string) bool {
+	for _, p := range problems {
+		if p.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+func TestScenarioRounds(t *testing.T) {
+	s := NewWithDefaults()
+	if testing.Verbose() {
+		s.SetLogger(t)
+	}
+	defer s.Close()
+
+	setScenario(s, Scenario{Rounds: []ChallengeRound{
+		loginRound(),
+		{Fields: []ScenarioField{{ID: "tan", Description: "TAN", Type: bosgo.ChallengeTypeNumeric, Answer: "123456"}}},
+	}})
+
+	userClient := loginUser(t, s)
+	uri := startAccess(t, userClient, false)
+
+	status := jobStatus(t, userClient, uri)
+	if status.Stage != bosgo.JobStageChallenge || status.Challenge == nil {
+		t.Fatalf("got stage %v, wanted challenge of second round", status.Stage)
+	}
+	if n := len(status.Challenge.NextChallenges); n != 1 || status.Challenge.NextChallenges[0].ID != "tan" {
+		t.Fatalf("got challenges %+v, wanted tan", status.Challenge.NextChallenges)
+	}
+
+	answer(t, userClient, uri, "tan", "000000")
+	status = jobStatus(t, userClient, uri)
+	if status.Stage != bosgo.JobStageChallenge {
+		t.Fatalf("got stage %v, wanted %v", status.Stage, bosgo.JobStageChallenge)
+	}
+	if !hasProblem(status.Challenge.LastProblems, "user_wrong_answer") || !hasProblem(status.Challenge.LastProblems, "connector_field_reset") {
+		t.Errorf("got last problems %+v, wanted wrong answer and field reset", status.Challenge.LastProblems)
+	}
+	if !status.Challenge.NextChallenges[0].Reset {
+		t.Errorf("tan challenge was not reset")
+	}
+
+	answer(t, userClient, uri, "tan", "123456")
+	status = jobStatus(t, userClient, uri)
+	if status.Stage != bosgo.JobStageImported || !status.Finished {
+		t.Fatalf("got stage %v, wanted %v", status.Stage, bosgo.JobStageImported)
+	}
+
+	accesses, err := userClient.Accesses.List().Send()
+	if err != nil {
+		t.Fatalf("failed to list accesses: %v", err)
+	}
+	if len(accesses.Accesses) != 1 {
+		t.Errorf("got %d accesses, wanted 1", len(accesses.Accesses))
+	}
+}
+
+func TestScenarioLocked(t *testing.T) {
+	s := NewWithDefaults()
+	if testing.Verbose() {
+		s.SetLogger(t)
+	}
+	defer s.Close()
+
+	setScenario(s, Scenario{Rounds: []ChallengeRound{loginRound()}, MaxAttempts: 2})
+
+	userClient := loginUser(t, s)
+	job, err := userClient.Accesses.Add(DefaultProviderID).
+		ChallengeAnswer(bosgo.ChallengeAnswer{ID: ChallengeLogin, Value: DefaultAccessLogin}).
+		ChallengeAnswer(bosgo.ChallengeAnswer{ID: ChallengePIN, Value: "0000"}).
+		Send()
+	if err != nil {
+		t.Fatalf("failed to add access: %v", err)
+	}
+
+	status := jobStatus(t, userClient, job.URI)
+	if status.Stage != bosgo.JobStageChallenge || !hasProblem(status.Challenge.LastProblems, "user_wrong_pin") {
+		t.Fatalf("got stage %v and challenge %+v, wanted wrong pin", status.Stage, status.Challenge)
+	}
+
+	answer(t, userClient, job.URI, ChallengePIN, "1111")
+	status = jobStatus(t, userClient, job.URI)
+	if status.Stage != bosgo.JobStageProblem || !status.Finished || !hasProblem(status.Errors, "user_locked") {
+		t.Errorf("got stage %v and errors %+v, wanted user_locked", status.Stage, status.Errors)
+	}
+}
+
+func TestScenarioDecoupled(t *testing.T) {
+	testCases := []struct {
+		reject bool
+		stage  bosgo.JobStage
+	}{
+		{false, bosgo.JobStageImported},
+		{true, bosgo.JobStageProblem},
+	}
+
+	for _, tc := range testCases {
+		s := NewWithDefaults()
+		if testing.Verbose() {
+			s.SetLogger(t)
+		}
+
+		setScenario(s, Scenario{Rounds: []ChallengeRound{
+			loginRound(),
+			{Decoupled: true, Message: "Approve in your banking app", ApproveAfter: Duration(50 * time.Millisecond), Reject: tc.reject},
+		}})
+
+		userClient := loginUser(t, s)
+		uri := startAccess(t, userClient, false)
+
+		status := jobStatus(t, userClient, uri)
+		if status.Stage != bosgo.JobStageChallenge {
+			t.Fatalf("got stage %v, wanted %v", status.Stage, bosgo.JobStageChallenge)
+		}
+		if ch := status.Challenge.NextChallenges; len(ch) != 1 || ch[0].ChallengeType != "decoupled" || ch[0].Description != "Approve in your banking app" {
+			t.Errorf("got challenges %+v, wanted decoupled approval", ch)
+		}
+
+		time.Sleep(60 * time.Millisecond)
+		status = jobStatus(t, userClient, uri)
+		if status.Stage != tc.stage || !status.Finished {
+			t.Errorf("reject=%v: got stage %v, wanted %v", tc.reject, status.Stage, tc.stage)
+		}
+		if tc.reject && !hasProblem(status.Errors, "user_decoupled_rejected") {
+			t.Errorf("got errors %+v, wanted user_decoupled_rejected", status.Errors)
+		}
+		s.Close()
+	}
+}
+
+func TestScenarioPINChange(t *testing.T) {
+	s := NewWithDefaults()
+	if testing.Verbose() {
+		s.SetLogger(t)
+	}
+	defer s.Close()
+
+	setScenario(s, Scenario{Rounds: []ChallengeRound{loginRound()}, RequirePINChange: true})
+
+	userClient := loginUser(t, s)
+	uri := startAccess(t, userClient, true)
+
+	status := jobStatus(t, userClient, uri)
+	if status.Stage != bosgo.JobStageChallenge || !hasProblem(status.Challenge.LastProblems, "user_pin_change_required") {
+		t.Fatalf("got stage %v and challenge %+v, wanted pin change", status.Stage, status.Challenge)
+	}
+	if ch := status.Challenge.NextChallenges; len(ch) != 1 || ch[0].ID != ChallengeNewPIN {
+		t.Fatalf("got challenges %+v, wanted new pin", ch)
+	}
+
+	before, _ := s.GetUserByName(DefaultUsername)
+	answer(t, userClient, uri, ChallengeNewPIN, "9999")
+	status = jobStatus(t, userClient, uri)
+	if status.Stage != bosgo.JobStageImported {
+		t.Fatalf("got stage %v, wanted %v", status.Stage, bosgo.JobStageImported)
+	}
+
+	// Copies of the user taken before keep the old PIN
+	for _, a := range before.StoredAnswers[DefaultProviderID] {
+		if a.ID == ChallengePIN && a.Value != DefaultAccessPIN {
+			t.Errorf("got stored pin %q in earlier copy of user, wanted %q", a.Value, DefaultAccessPIN)
+		}
+	}
+
+	// Refreshing uses the stored answers, which now hold the new PIN
+	job, err := userClient.Accesses.Refresh(status.Access.ID).Send()
+	if err != nil {
+		t.Fatalf("failed to refresh access: %v", err)
+	}
+	if status := jobStatus(t, userClient, job.URI); status.Stage != bosgo.JobStageImported {
+		t.Errorf("refresh: got stage %v, wanted %v", status.Stage, bosgo.JobStageImported)
+	}
+
+	s.mu.Lock()
+	ad := s.Accesses[DefaultProviderID]
+	s.mu.Unlock()
+	if ad.Scenario.RequirePINChange || ad.Scenario.Rounds[0].Fields[1].Answer != "9999" || ad.ChallengeMap[ChallengePIN] != "9999" {
+		t.Errorf("pin was not changed: %+v", ad.Scenario)
+	}
+}
+
+func TestStoredAnswersConcurrent(t *testing.T) {
+	s := NewWithDefaults()
+	if testing.Verbose() {
+		s.SetLogger(t)
+	}
+	defer s.Close()
+
+	user, _ := s.GetUserByName(DefaultUsername)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(providerID string) {
+			defer wg.Done()
+			s.updateStoredAnswers(user.ID, providerID, []bosgo.ChallengeAnswer{{ID: ChallengePIN, Value: "1234", Store: true}})
+		}(fmt.Sprintf("provider-%d", i))
+	}
+	wg.Wait()
+
+	user, _ = s.GetUser(user.ID)
+	for i := 0; i < 10; i++ {
+		if id := fmt.Sprintf("provider-%d", i); len(user.StoredAnswers[id]) != 1 {
+			t.Errorf("got stored answers %+v for %s, wanted one", user.StoredAnswers[id], id)
+		}
+	}
+}
+
+func TestScenarioExpireConsent(t *testing.T) {
+	s := NewWithDefaults()
+	if testing.Verbose() {
+		s.SetLogger(t)
+	}
+	defer s.Close()
+
+	setScenario(s, Scenario{Rounds: []ChallengeRound{loginRound()}})
+
+	userClient := loginUser(t, s)
+	uri := startAccess(t, userClient, true)
+	status := jobStatus(t, userClient, uri)
+	if status.Stage != bosgo.JobStageImported {
+		t.Fatalf("got stage %v, wanted %v", status.Stage, bosgo.JobStageImported)
+	}
+	accessID := status.Access.ID
+
+	s.mu.Lock()
+	ad := s.Accesses[DefaultProviderID]
+	ad.Scenario.ExpireConsent = true
+	s.mu.Unlock()
+
+	job, err := userClient.Accesses.Refresh(accessID).Send()
+	if err != nil {
+		t.Fatalf("failed to refresh access: %v", err)
+	}
+	status = jobStatus(t, userClient, job.URI)
+	if status.Stage != bosgo.JobStageChallenge || !hasProblem(status.Challenge.LastProblems, "consent_expired") {
+		t.Fatalf("got stage %v and challenge %+v, wanted expired consent", status.Stage, status.Challenge)
+	}
+	err = userClient.Jobs.Answer(job.URI).
+		ChallengeAnswer(bosgo.ChallengeAnswer{ID: ChallengeLogin, Value: DefaultAccessLogin}).
+		ChallengeAnswer(bosgo.ChallengeAnswer{ID: ChallengePIN, Value: DefaultAccessPIN}).
+		Send()
+	if err != nil {
+		t.Fatalf("failed to answer challenges: %v", err)
+	}
+	if status := jobStatus(t, userClient, job.URI); status.Stage != bosgo.JobStageImported {
+		t.Fatalf("got stage %v, wanted %v", status.Stage, bosgo.JobStageImported)
+	}
+
+	// The consent is valid again
+	job, err = userClient.Accesses.Refresh(accessID).Send()
+	if err != nil {
+		t.Fatalf("failed to refresh access: %v", err)
+	}
+	if status := jobStatus(t, userClient, job.URI); status.Stage != bosgo.JobStageImported {
+		t.Errorf("second refresh: got stage %v, wanted %v", status.Stage, bosgo.JobStageImported)
+	}
+}
+
+func TestTransferDecoupledAuth(t *testing.T) {
+	s := NewWithDefaults()
+	if testing.Verbose() {
+		s.SetLogger(t)
+	}
+	defer s.Close()
+
+	s.mu.Lock()
+	ad := s.Accesses[DefaultProviderID]
+	ad.TransferAuths = append(ad.TransferAuths, TransferAuth{
+		Method:       "pushTAN",
+		Message:      "Approve in your banking app",
+		Decoupled:    true,
+		ApproveAfter: Duration(50 * time.Millisecond),
+	})
+	s.Accesses[DefaultProviderID] = ad
+	s.mu.Unlock()
+
+	userClient := loginUser(t, s)
+	_, accountID, err := addDefaultAccess(userClient, false)
+	if err != nil {
+		t.Fatalf("failed to add access: %v", err)
+	}
+
+	transfer, err := userClient.Transfers.Create(accountID, bosgo.TransferAddress{Name: "Jane Doe", IBAN: "DE28500105175552834822"}, bosgo.MoneyAmount{Currency: "EUR", Value: "12.50"}).Send()
+	if err != nil {
+		t.Fatalf("failed to create transfer: %v", err)
+	}
+	process := func(id, value string) *bosgo.Transfer {
+		t.Helper()
+		req := userClient.Transfers.Process(transfer.ID, transfer.Step.Intent, transfer.Version)
+		if id != "" {
+			req.ChallengeAnswer(bosgo.ChallengeAnswer{ID: id, Value: value})
+		}
+		tr, err := req.Send()
+		if err != nil {
+			t.Fatalf("failed to process transfer: %v", err)
+		}
+		return tr
+	}
+
+	transfer = process(ChallengePIN, DefaultAccessPIN)
+	if n := len(transfer.Step.Data.AuthMethods); n != 2 {
+		t.Fatalf("got %d auth methods, wanted 2", n)
+	}
+	transfer = process("auth_method", "pushTAN")
+	if transfer.Step.Intent != bosgo.TransferIntentProvideChallengeAnswer || transfer.Step.Data.TANType != bosgo.TANTypePush {
+		t.Fatalf("got step %+v, wanted push challenge", transfer.Step)
+	}
+
+	transfer = process("", "")
+	if transfer.State != bosgo.TransferStateOngoing {
+		t.Errorf("got state %v before approval, wanted %v", transfer.State, bosgo.TransferStateOngoing)
+	}
+	time.Sleep(60 * time.Millisecond)
+	transfer = process("", "")
+	if transfer.State != bosgo.TransferStateSucceeded {
+		t.Errorf("got state %v after approval, wanted %v", transfer.State, bosgo.TransferStateSucceeded)
+	}
+}
+
+func TestScenarioFixture(t *testing.T) {
+	f, err := ReadFixtures(strings.NewReader(`
+accesses:
+  - access:
+      provider_id: DE-TEST-1
+    scenario:
+      max_attempts: 3
+      rounds:
+        - fields:
+            - {id: pin, type: numeric, secure: true, answer: "1111"}
+        - decoupled: true
+          approve_after: 2s
+    transfer_auths:
+      - {method: chipTAN, tan_type: chip, answer: "123456"}
+`))
+	if err != nil {
+		t.Fatalf("failed to read fixtures: %v", err)
+	}
+
+	sc := f.Accesses[0].Scenario
+	if sc == nil || sc.MaxAttempts != 3 || len(sc.Rounds) != 2 {
+		t.Fatalf("got scenario %+v", sc)
+	}
+	if sc.Rounds[0].Fields[0].Answer != "1111" || !sc.Rounds[1].Decoupled || time.Duration(sc.Rounds[1].ApproveAfter) != 2*time.Second {
+		t.Errorf("got rounds %+v", sc.Rounds)
+	}
+	if ta := f.Accesses[0].TransferAuths[0]; ta.TANType != bosgo.TANTypeChip || ta.Answer != "123456" {
+		t.Errorf("got transfer auth %+v", ta)
+	}
+
+	data, err := json.Marshal(sc.Rounds[1].ApproveAfter)
+	if err != nil || string(data) != `"2s"` {
+		t.Errorf("got duration %s, %v, wanted \"2s\"", data, err)
+	}
+}
@@ -20,12 +20,19 @@ import (
 )
 
 type Dev struct {
-	ID string
+	ID       string
+	Email    string
+	Password string
+	Profile  bosgo.DeveloperProfile
+	Webhooks []bosgo.Webhook
 }
 
 type App struct {
 	ID          string
 	DeveloperID string
+	Label       string
+	Keys        []bosgo.ApplicationKey
+	Settings    bosgo.ApplicationSettings
 }
 
 type User struct {
@@ -38,6 +45,7 @@ type User struct {
 	ScheduledTransactions []bosgo.Transaction
 	RepeatedTransactions  []bosgo.RepeatedTransaction
 	StoredAnswers         map[string][]bosgo.ChallengeAnswer // map of challenge answers indexed by provider ID
+	ExecutedUntil         time.Time                          // time up to which scheduled and repeated transactions were executed
 }
 
 type Job struct {
@@ -52,6 +60,43 @@ type Job struct {
 	NeedsAnswers    bool
 	JobAction       JobAction
 	Problems        []bosgo.Problem
+	StageSince      time.Time               // when the job entered its stage
+	PendingAnswers  []bosgo.ChallengeAnswer // answers given before the job authenticated
+	ConsentExpired  bool                    // the consent of the refreshed access has expired
+
+	// State of the access's scenario, if it has one
+	Round          int                     // index of the current round
+	RoundAttempts  int                     // wrong answers given in the current round
+	RoundStarted   time.Time               // when the current decoupled round started
+	RoundAnswers   []bosgo.ChallengeAnswer // answers given in the current round
+	LastProblems   []bosgo.Problem         // problems with the last answers
+	ConsentRenewed bool                    // an expired consent has been given again
+
+	rev int // incremented whenever the job is updated, see updateJob
+}
+
+// clone returns a copy of the job that does not share the slices the job
+// transitions modify.
+func (j Job) clone() Job {
+	j.SuppliedAnswers = append([]bosgo.ChallengeAnswer(nil), j.SuppliedAnswers...)
+	j.PendingAnswers = append([]bosgo.ChallengeAnswer(nil), j.PendingAnswers...)
+	j.RoundAnswers = append([]bosgo.ChallengeAnswer(nil), j.RoundAnswers...)
+	j.Problems = append([]bosgo.Problem(nil), j.Problems...)
+	j.LastProblems = append([]bosgo.Problem(nil), j.LastProblems...)
+	return j
+}
+
+// jobEffects collects the changes to other state of the server, such as
+// imports and webhook events, caused by a job transition. They are made once
+// the transition has been stored.
+type jobEffects []func()
+
+func (fx *jobEffects) add(f func()) { *fx = append(*fx, f) }
+
+func (fx jobEffects) run() {
+	for _, f := range fx {
+		f()
+	}
 }
 
 type JobAction int
@@ -76,6 +121,24 @@ type TransferOrder struct {
 	Transfer       bosgo.Transfer
 	AccessDetails  AccessDetails
 	ConfirmSimilar bool
+	AuthMethod     string    // auth method selected for the transfer
+	AuthStarted    time.Time // when the selected decoupled auth method was started
+	AccountID      int64     // ID of the source account
+	RepeatedID     int64     // ID of the repeated transaction a recurring transfer creates, changes or deletes
+
+	// Schedule of a recurring transfer and the time up to which it has been
+	// executed
+	Schedule      *bosgo.RecurrenceRule
+	ExecutedUntil time.Time
+
+	rev int // incremented whenever the transfer is updated, see updateTransfer
+}
+
+// clone returns a copy of the transfer that does not share the slices the
+// transfer transitions modify.
+func (tr TransferOrder) clone() TransferOrder {
+	tr.Transfer.Errors = append([]bosgo.Problem(nil), tr.Transfer.Errors...)
+	return tr
 }
 
 type AccessDetails struct {
@@ -86,12 +149,38 @@ type AccessDetails struct {
 	ChallengeMap          map[string]string
 	TransferAuths         []TransferAuth
 	StageProblems         map[bosgo.JobStage][]bosgo.Problem
+	Scenario              *Scenario // replaces ChallengeMap for jobs if not nil
 }
 
 type TransferAuth struct {
-	Method  string
-	Message string
-	Answer  string
+	Method  string        `json:"method"`
+	Message string        `json:"message"`
+	Answer  string        `json:"answer"`
+	TANType bosgo.TANType `json:"tan_type"` // mobile if empty
+
+	// Decoupled methods need no answer and approve the transfer after
+	// ApproveAfter.
+	Decoupled    bool     `json:"decoupled"`
+	ApproveAfter Duration `json:"approve_after"`
+}
+
+func (ta TransferAuth) tanType() bosgo.TANType {
+	switch {
+	case ta.TANType != "":
+		return ta.TANType
+	case ta.Decoupled:
+		return bosgo.TANTypePush
+	}
+	return bosgo.TANTypeMobile
+}
+
+func (ad *AccessDetails) transferAuth(method string) (TransferAuth, bool) {
+	for _, ta := range ad.TransferAuths {
+		if ta.Method == method {
+			return ta, true
+		}
+	}
+	return TransferAuth{}, false
 }
 
 const (
@@ -118,36 +207,96 @@ type Server struct {
 	mu                 sync.Mutex // guards following fields
 	id                 int64
 	logger             Logger
-	Devs               map[string]Dev           // map of developers indexed by ID
-	Apps               map[string]App           // map of applications indexed by ID
-	Users              map[string]User          // map of users indexed by ID
-	UserTokens         map[string]string        // map of user IDs indexed by token
-	Jobs               map[string]Job           // map of jobs indexed by ID
-	Accesses           map[string]AccessDetails // map of access details indexed by provider ID
-	Transfers          map[string]TransferOrder // map of transfer orders indexed by ID
-	RecurringTransfers map[string]TransferOrder // map of recurrings transfers orders indexed by ID
+	Devs               map[string]Dev            // map of developers indexed by ID
+	Apps               map[string]App            // map of applications indexed by ID
+	DevTokens          map[string]string         // map of developer IDs indexed by token
+	Users              map[string]User           // map of users indexed by ID
+	UserTokens         map[string]string         // map of user IDs indexed by token
+	Jobs               map[string]Job            // map of jobs indexed by ID
+	Accesses           map[string]AccessDetails  // map of access details indexed by provider ID
+	Transfers          map[string]TransferOrder  // map of transfer orders indexed by ID
+	RecurringTransfers map[string]TransferOrder  // map of recurrings transfers orders indexed by ID
+	Providers          map[string]bosgo.Provider // map of providers indexed by ID
+	Categories         bosgo.CategoryList
+	Banks              map[string]bosgo.IBANBank // map of banks indexed by country and national bank code
 	confirmSimilar     bool
+	webhookClient      *http.Client
+	webhookAttempts    int
+	webhookBackoff     time.Duration
+	deliveries         []WebhookDelivery
+	deliveriesDropped  int            // number of deliveries dropped from the front of the log
+	faults             map[int]*fault // fault rules indexed by ID
+	faultOrder         []int
+	faultID            int
+	tokenExpiry        map[string]time.Time // expiry of user and developer session tokens indexed by token
+	pendingDeliveries  int                  // number of webhook deliveries in progress
+	deliveriesIdle     chan struct{}        // closed when the last pending delivery ends
+	stopDeliveries     chan struct{}        // closed by Close to cancel pending deliveries
+	closeOnce          sync.Once
+
+	clockMu sync.Mutex // guards following fields, may be locked while holding mu
+	clock   Clock
+	timing  Timing
+}
+
+// New creates a new test server listening on a random local port with TLS.
+func New() *Server {
+	s := NewUnstarted()
+	s.Svr = httptest.NewTLSServer(s)
+	return s
 }
 
-func New() *Server {
+// NewUnstarted creates a new test server that does not listen. It may be used
+// as an http.Handler, for example by an http.Server listening on a fixed
+// address. URL, Addr, Client and Close must not be called on an unstarted
+// server.
+func NewUnstarted() *Server {
 	s := Server{
 		Devs:               make(map[string]Dev),
 		Apps:               make(map[string]App),
+		DevTokens:          make(map[string]string),
 		Users:              make(map[string]User),
 		UserTokens:         make(map[string]string),
 		Jobs:               make(map[string]Job),
 		Accesses:           make(map[string]AccessDetails),
 		Transfers:          make(map[string]TransferOrder),
 		RecurringTransfers: make(map[string]TransferOrder),
+		Providers:          make(map[string]bosgo.Provider),
+		webhookClient:      &http.Client{Timeout: 5 * time.Second},
+		webhookAttempts:    defaultWebhookAttempts,
+		webhookBackoff:     defaultWebhookBackoff,
+		tokenExpiry:        make(map[string]time.Time),
+		stopDeliveries:     make(chan struct{}),
+		clock:              systemClock{},
 	}
-	s.Svr = httptest.NewTLSServer(&s)
+
+	s.seedCatalog()
 
 	s.mux = http.NewServeMux()
+	s.mux.HandleFunc("/v1/developers", s.handleDevelopers)
+	s.mux.HandleFunc("/v1/developers/login", s.handleDevelopersLogin)
+	s.mux.HandleFunc("/v1/developers/logout", s.handleDevelopersLogout)
+	s.mux.HandleFunc("/v1/developers/password", s.handleDevelopersPassword)
+	s.mux.HandleFunc("/v1/developers/profile", s.handleDevelopersProfile)
+	s.mux.HandleFunc("/v1/developers/applications", s.handleApplications)
+	s.mux.HandleFunc("/v1/developers/applications/", s.handleApplication)
+	s.mux.HandleFunc("/v1/developers/application_keys/", s.handleApplicationKey)
+	s.mux.HandleFunc("/v1/developers/users", s.handleDevUsers)
+	s.mux.HandleFunc("/v1/developers/users/reset", s.handleDevUsersReset)
+	s.mux.HandleFunc("/v1/developers/user/", s.handleDevUser)
+	s.mux.HandleFunc("/v1/webhooks", s.handleWebhooks)
+	s.mux.HandleFunc("/v1/webhooks/", s.handleWebhook)
+
 	s.mux.HandleFunc("/v1/users", s.handleUsers)
 	s.mux.HandleFunc("/v1/users/login", s.handleUsersLogin)
 	s.mux.HandleFunc("/v1/users/logout", s.handleUsersLogout)
 	s.mux.HandleFunc("/v1/users/reset_password", s.handleUsersResetPassword)
 
+	s.mux.HandleFunc("/v1/categories", s.handleCategories)
+	s.mux.HandleFunc("/v1/providers", s.handleProviders)
+	s.mux.HandleFunc("/v1/providers/", s.handleProvider)
+	s.mux.HandleFunc("/v1/iban/", s.handleIBAN)
+
 	s.mux.HandleFunc("/v1/accesses", s.handleAccesses)
 	s.mux.HandleFunc("/v1/accesses/", s.handleAccess)
 	s.mux.HandleFunc("/v1/accounts", s.handleAccounts)
@@ -207,13 +356,27 @@ func (s *Server) Client() *http.Client {
 	return &client
 }
 
+// Close cancels pending webhook deliveries, waits for them to end and shuts
+// down the server. Calls after the first do nothing.
 func (s *Server) Close() {
-	s.Svr.Close()
-	s.Svr = nil
+	s.closeOnce.Do(func() {
+		s.mu.Lock()
+		close(s.stopDeliveries)
+		s.mu.Unlock()
+		s.WaitWebhooks()
+
+		s.Svr.Close()
+		s.Svr = nil
+	})
 }
 
 func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	s.Logf("received request: %s %s", req.Method, req.URL.Path)
+	if rule, ok := s.matchFault(req); ok {
+		s.Logf("injecting fault %d into %s %s", rule.Action, req.Method, req.URL.Path)
+		s.serveFault(w, req, rule)
+		return
+	}
 	s.mux.ServeHTTP(w, req)
 }
 
@@ -283,6 +446,11 @@ func (s *Server) nextIDStr() string {
 func (s *Server) nextID() int64 {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	return s.nextIDLocked()
+}
+
+// nextIDLocked is like nextID for callers holding s.mu.
+func (s *Server) nextIDLocked() int64 {
 	s.id++
 	return s.id
 }
@@ -310,6 +478,10 @@ func (s *Server) requireApp(w http.ResponseWriter, req *http.Request) (App, bool
 		return App{}, false
 	}
 	app, exists := s.getApp(id)
+	if !exists {
+		// Keys of an application may be used in place of its ID
+		app, exists = s.getAppByKey(id)
+	}
 	if !exists {
 		s.sendError(w, http.StatusUnauthorized, "authentication_app_id_invalid")
 		return App{}, false
@@ -341,6 +513,22 @@ func (s *Server) GetUserByName(name string) (User, bool) {
 	return User{}, false
 }
 
+// updateUser applies change to the stored user with the given ID while
+// holding s.mu, so that concurrent changes are not lost. Slices and maps of
+// the user are shared with copies handed out before and must be replaced,
+// not changed in place. It reports false if the user does not exist.
+func (s *Server) updateUser(id string, change func(user *User)) (User, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user, exists := s.Users[id]
+	if !exists {
+		return User{}, false
+	}
+	change(&user)
+	s.Users[id] = user
+	return user, true
+}
+
 func (s *Server) SetUser(user User) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -360,13 +548,19 @@ func (s *Server) requireUser(w http.ResponseWriter, req *http.Request) (User, st
 
 	s.mu.Lock()
 	id, exists := s.UserTokens[token]
+	exists = exists && s.tokenValid(token)
 	s.mu.Unlock()
 
 	if !exists {
 		s.sendError(w, http.StatusUnauthorized, "authentication_failed")
 		return User{}, "", false
 	}
-	user, found := s.GetUser(id)
+	s.executeRecurringTransfers(id)
+
+	s.mu.Lock()
+	s.executeTransactions(id)
+	user, found := s.Users[id]
+	s.mu.Unlock()
 	if !found || user.ApplicationID != app.ID {
 		s.sendError(w, http.StatusUnauthorized, "authentication_failed")
 		return User{}, "", false
@@ -380,6 +574,9 @@ func (s *Server) setUserLoggedIn(id string) string {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	s.UserTokens[token] = id
+	if expiry := s.sessionExpiry(); !expiry.IsZero() {
+		s.tokenExpiry[token] = expiry
+	}
 	return token
 }
 
@@ -387,6 +584,7 @@ func (s *Server) setUserLoggedOut(token string) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	delete(s.UserTokens, token)
+	delete(s.tokenExpiry, token)
 }
 
 func (s *Server) newJob(userID string, providerID string, answers []bosgo.ChallengeAnswer, action JobAction) *bosgo.Job {
@@ -395,33 +593,40 @@ func (s *Server) newJob(userID string, providerID string, answers []bosgo.Challe
 		UserID:     userID,
 		ProviderID: providerID,
 		Stage:      bosgo.JobStageUnauthenticated,
+		StageSince: s.now(),
 		JobAction:  action,
 	}
 
+	s.mu.Lock()
+	ad, exists := s.Accesses[providerID]
+	s.mu.Unlock()
+
+	// An expired consent must be given again without stored answers
 	if action == JobActionRefresh {
 		if user, found := s.GetUser(userID); found {
+			job.ConsentExpired = s.consentExpired(user, providerID)
+			expired := job.ConsentExpired || (ad.Scenario != nil && ad.Scenario.ExpireConsent)
 			storedAnswers := user.StoredAnswers[providerID]
-			if len(storedAnswers) > 0 {
+			if len(storedAnswers) > 0 && !expired {
 				job.SuppliedAnswers = append(job.SuppliedAnswers, storedAnswers...)
 			}
 		}
 	}
-
-	s.mu.Lock()
-	ad, exists := s.Accesses[providerID]
-	s.mu.Unlock()
+	var fx jobEffects
 	if !exists {
 		job.Stage = bosgo.JobStageProblem
 		job.Problems = append(job.Problems, bosgo.Problem{Code: "unknown_provider"})
 		job.Finished = true
+		s.notifyJobStage(&job)
 	} else {
 		job.AccessDetails = ad
-		s.progressJob(&job, answers)
+		s.progressJob(&job, answers, &fx)
 	}
 
 	s.mu.Lock()
 	s.Jobs[job.ID] = job
 	s.mu.Unlock()
+	fx.run()
 
 	return &bosgo.Job{
 		URI: "/jobs/" + job.ID,
@@ -429,10 +634,38 @@ func (s *Server) newJob(userID string, providerID string, answers []bosgo.Challe
 
 }
 
-func (s *Server) setJob(job Job) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	s.Jobs[job.ID] = job
+// updateJob applies change to a copy of the stored job and stores the result
+// unless another request updated the job in the meantime, in which case the
+// change is applied again to the newer job. The effects of the change are
+// only made by the request that stored it. It returns the updated job.
+func (s *Server) updateJob(id string, change func(j *Job, fx *jobEffects)) (Job, bool) {
+	for {
+		job, exists := s.getJob(id)
+		if !exists {
+			return Job{}, false
+		}
+
+		next := job.clone()
+		var fx jobEffects
+		change(&next, &fx)
+
+		s.mu.Lock()
+		cur, exists := s.Jobs[id]
+		if !exists {
+			s.mu.Unlock()
+			return Job{}, false
+		}
+		if cur.rev != job.rev {
+			s.mu.Unlock()
+			continue
+		}
+		next.rev++
+		s.Jobs[id] = next
+		s.mu.Unlock()
+
+		fx.run()
+		return next, true
+	}
 }
 
 func (s *Server) getJob(id string) (Job, bool) {
@@ -466,17 +699,107 @@ func (s *Server) requireJob(w http.ResponseWriter, req *http.Request) (Job, bool
 	return job, true
 }
 
-func (s *Server) progressJob(j *Job, answers []bosgo.ChallengeAnswer) {
-	// Once finished jobs are immutable
-	if j.Finished {
+// progressJob checks the answers given to the job and moves it on to the
+// stage they allow. Its effects on the rest of the server are added to fx.
+func (s *Server) progressJob(j *Job, answers []bosgo.ChallengeAnswer, fx *jobEffects) {
+	// Once finished jobs are immutable and authenticated jobs only wait for
+	// the import
+	if j.Finished || j.Stage == bosgo.JobStageAuthenticated {
+		return
+	}
+
+	// Answers are checked once the job has authenticated
+	timing := s.getTiming()
+	if j.Stage == bosgo.JobStageUnauthenticated && s.now().Before(j.StageSince.Add(timing.JobAuthentication)) {
+		j.PendingAnswers = append(j.PendingAnswers, answers...)
 		return
 	}
-	s.updateStoredAnswers(j.UserID, j.ProviderID, answers)
+	answers = append(j.PendingAnswers, answers...)
+	j.PendingAnswers = nil
 
+	userID, providerID, stored := j.UserID, j.ProviderID, answers
+	fx.add(func() { s.updateStoredAnswers(userID, providerID, stored) })
+
+	prevStage := j.Stage
 	j.SuppliedAnswers = append(j.SuppliedAnswers, answers...)
 	j.NeedsAnswers = false
 	j.Problems = make([]bosgo.Problem, 0)
 
+	if sc := j.AccessDetails.Scenario; sc != nil {
+		// The first round may be answered by stored answers too
+		if prevStage == bosgo.JobStageUnauthenticated {
+			answers = j.SuppliedAnswers
+		}
+		s.progressScenario(j, sc, answers, fx)
+	} else {
+		s.checkChallengeMap(j)
+	}
+	if j.Stage == bosgo.JobStageImported && timing.JobImport > 0 {
+		j.Stage = bosgo.JobStageAuthenticated
+		j.Finished = false
+	}
+	if j.Stage != prevStage {
+		j.StageSince = s.now()
+		s.stageChanged(j, fx)
+	}
+}
+
+// advanceJob moves a job on to the stages whose time has come. Its effects on
+// the rest of the server are added to fx.
+func (s *Server) advanceJob(j *Job, fx *jobEffects) {
+	if j.Stage == bosgo.JobStageUnauthenticated || s.awaitsApproval(j) {
+		s.progressJob(j, nil, fx)
+	}
+	if j.Stage == bosgo.JobStageAuthenticated && !j.Finished && !s.now().Before(j.StageSince.Add(s.getTiming().JobImport)) {
+		j.Stage = bosgo.JobStageImported
+		j.StageSince = s.now()
+		j.Finished = true
+		s.stageChanged(j, fx)
+	}
+}
+
+// stageChanged adds the notification of the job's new stage to fx and the
+// import if the job has been imported.
+func (s *Server) stageChanged(j *Job, fx *jobEffects) {
+	job := *j
+	fx.add(func() { s.notifyJobStage(&job) })
+	if job.Stage == bosgo.JobStageImported {
+		fx.add(func() { s.importJob(&job) })
+	}
+}
+
+// importJob adds the access of a newly imported job to its user or renews
+// the consent of a refreshed access.
+func (s *Server) importJob(j *Job) {
+	expiry := s.consentExpiry()
+	if j.JobAction == JobActionRefresh {
+		s.updateUser(j.UserID, func(user *User) {
+			accesses := append([]bosgo.Access(nil), user.Accesses...)
+			for i := range accesses {
+				if accesses[i].ProviderID == j.ProviderID {
+					accesses[i].ConsentExpiration = expiry
+				}
+			}
+			user.Accesses = accesses
+		})
+		return
+	}
+
+	access := j.AccessDetails.Access
+	access.ConsentExpiration = expiry
+	if _, found := s.updateUser(j.UserID, func(user *User) {
+		user.Accesses = append(user.Accesses[:len(user.Accesses):len(user.Accesses)], access)
+		user.Transactions = append(user.Transactions[:len(user.Transactions):len(user.Transactions)], j.AccessDetails.Transactions...)
+		user.RepeatedTransactions = append(user.RepeatedTransactions[:len(user.RepeatedTransactions):len(user.RepeatedTransactions)], j.AccessDetails.RepeatedTransactions...)
+		user.ScheduledTransactions = append(user.ScheduledTransactions[:len(user.ScheduledTransactions):len(user.ScheduledTransactions)], j.AccessDetails.ScheduledTransactions...)
+	}); found {
+		s.notifyTransactionsImported(j.UserID, j.AccessDetails)
+	}
+}
+
+// checkChallengeMap checks the answers of a job against the single round of
+// challenges of its access.
+func (s *Server) checkChallengeMap(j *Job) {
 	for id, val := range j.AccessDetails.ChallengeMap {
 		if !j.isAnswered(id, val) {
 			j.NeedsAnswers = true
@@ -506,46 +829,38 @@ func (s *Server) progressJob(j *Job, answers []bosgo.ChallengeAnswer) {
 		j.Stage = bosgo.JobStageImported
 		j.Finished = true
 	}
-
-	if j.JobAction == JobActionRefresh {
-		return
-	}
-
-	user, found := s.GetUser(j.UserID)
-	if !found {
-		return
-	}
-	user.Accesses = append(user.Accesses, j.AccessDetails.Access)
-	user.Transactions = append(user.Transactions, j.AccessDetails.Transactions...)
-	user.RepeatedTransactions = append(user.RepeatedTransactions, j.AccessDetails.RepeatedTransactions...)
-	user.ScheduledTransactions = append(user.ScheduledTransactions, j.AccessDetails.ScheduledTransactions...)
-
-	s.SetUser(user)
 }
 
 func (s *Server) updateStoredAnswers(userID string, providerID string, answers []bosgo.ChallengeAnswer) {
-	user, found := s.GetUser(userID)
-	if !found {
-		return
-	}
+	s.updateUser(userID, func(user *User) {
+		stored := map[string]bosgo.ChallengeAnswer{}
+		for _, a := range user.StoredAnswers[providerID] {
+			stored[a.ID] = a
+		}
 
-	stored := map[string]bosgo.ChallengeAnswer{}
-	for _, a := range user.StoredAnswers[providerID] {
-		stored[a.ID] = a
-	}
+		for _, a := range answers {
+			if a.Store {
+				stored[a.ID] = a
+			}
+		}
 
-	for _, a := range answers {
-		if a.Store {
-			stored[a.ID] = a
+		list := []bosgo.ChallengeAnswer{}
+		for _, a := range stored {
+			list = append(list, a)
 		}
-	}
+		user.StoredAnswers = withStoredAnswers(user.StoredAnswers, providerID, list)
+	})
+}
 
-	user.StoredAnswers[providerID] = []bosgo.ChallengeAnswer{}
-	for _, a := range stored {
-		user.StoredAnswers[providerID] = append(user.StoredAnswers[providerID], a)
+// withStoredAnswers returns a copy of the stored answers of a user in which
+// the answers for the provider are replaced.
+func withStoredAnswers(stored map[string][]bosgo.ChallengeAnswer, providerID string, answers []bosgo.ChallengeAnswer) map[string][]bosgo.ChallengeAnswer {
+	next := make(map[string][]bosgo.ChallengeAnswer, len(stored)+1)
+	for id, as := range stored {
+		next[id] = as
 	}
-
-	s.SetUser(user)
+	next[providerID] = answers
+	return next
 }
 
 func (s *Server) requireAccess(w http.ResponseWriter, req *http.Request) (bosgo.Access, bool) {
@@ -587,16 +902,37 @@ func (s *Server) SetConfirmSimilar(v bool) {
 	s.confirmSimilar = v
 }
 
-func (s *Server) newTransfer(userID string, providerID string, trp *transferParams) TransferOrder {
+func (s *Server) newTransfer(userID string, providerID string, op OrderOp, repeatedID int64, trp *transferParams) TransferOrder {
+	amount := trp.Amount
 	tr := TransferOrder{
+		Operation:  op,
+		RepeatedID: repeatedID,
 		Transfer: bosgo.Transfer{
-			ID: s.nextIDStr(),
+			ID:      s.nextIDStr(),
+			To:      trp.To,
+			Amount:  &amount,
+			Usage:   trp.Usage,
+			Created: s.now(),
 		},
 		UserID:         userID,
 		Type:           trp.Type,
 		ConfirmSimilar: s.confirmSimilar,
+		AccountID:      trp.From,
+		Schedule:       trp.Schedule,
 	}
 
+	s.mu.Lock()
+	if ref, found := s.findAccountByID(userID, trp.From); found {
+		ac, acc := s.account(ref)
+		tr.Transfer.From = bosgo.TransferAddress{
+			Name:      acc.Holder,
+			IBAN:      acc.IBAN,
+			AccessID:  ac.ID,
+			AccountID: acc.ID,
+		}
+	}
+	s.mu.Unlock()
+
 	s.mu.Lock()
 	ad, exists := s.Accesses[providerID]
 	s.mu.Unlock()
@@ -604,6 +940,23 @@ func (s *Server) newTransfer(userID string, providerID string, trp *transferPara
 		tr.Transfer.State = bosgo.TransferStateFailed
 		tr.Transfer.Errors = append(tr.Transfer.Errors, bosgo.Problem{Code: "resource_not_found"})
 		s.setTransfer(tr)
+		s.notifyTransferState(&tr)
+		return tr
+	}
+
+	// Changes and deletions of repeated transactions carry no amount
+	if _, ok := transferAmount(&tr); !ok && (tr.Type == bosgo.TransferTypeRegular || tr.Schedule != nil) {
+		tr.Transfer.State = bosgo.TransferStateFailed
+		tr.Transfer.Errors = append(tr.Transfer.Errors, bosgo.Problem{Code: "validation_bad_parameters"})
+		s.setTransfer(tr)
+		s.notifyTransferState(&tr)
+		return tr
+	}
+	if tr.Type == bosgo.TransferTypeRegular && !s.checkFunds(&tr) {
+		tr.Transfer.State = bosgo.TransferStateFailed
+		tr.Transfer.Errors = append(tr.Transfer.Errors, bosgo.Problem{Code: ProblemInsufficientFunds})
+		s.setTransfer(tr)
+		s.notifyTransferState(&tr)
 		return tr
 	}
 
@@ -612,8 +965,10 @@ func (s *Server) newTransfer(userID string, providerID string, trp *transferPara
 	tr.Transfer.Step = bosgo.TransferStep{
 		Intent: transferInit,
 	}
-	s.progressTransfer(&tr, false, trp.ChallengeAnswers)
 	s.setTransfer(tr)
+	tr, _ = s.updateTransfer(tr.Transfer.ID, tr.Type, func(tr *TransferOrder) (bool, bool) {
+		return s.progressTransfer(tr, false, trp.ChallengeAnswers), true
+	})
 	return tr
 
 }
@@ -629,6 +984,54 @@ func (s *Server) setTransfer(tr TransferOrder) {
 	}
 }
 
+// updateTransfer applies change to the stored transfer with the given ID. The
+// change is made to a copy and only stored if the transfer has not been
+// updated in the meantime, otherwise it is retried with the updated transfer.
+// change reports whether the transfer has been authorised, in which case it
+// is completed together with storing it so that it is booked once, and
+// whether it is to be stored at all. A change that is not stored is returned
+// as it is. Events of a changed state are sent once the transfer is stored.
+func (s *Server) updateTransfer(id string, typ bosgo.TransferType, change func(tr *TransferOrder) (authorized, store bool)) (TransferOrder, bool) {
+	for {
+		tr, exists := s.getTransfer(id, typ)
+		if !exists {
+			return TransferOrder{}, false
+		}
+
+		next := tr.clone()
+		authorized, store := change(&next)
+		if !store {
+			return next, true
+		}
+
+		s.mu.Lock()
+		transfers := s.Transfers
+		if typ == bosgo.TransferTypeRecurring {
+			transfers = s.RecurringTransfers
+		}
+		cur, exists := transfers[id]
+		if !exists {
+			s.mu.Unlock()
+			return TransferOrder{}, false
+		}
+		if cur.rev != tr.rev {
+			s.mu.Unlock()
+			continue
+		}
+		if authorized {
+			s.completeTransferLocked(&next)
+		}
+		next.rev++
+		transfers[id] = next
+		s.mu.Unlock()
+
+		if next.Transfer.State != tr.Transfer.State {
+			s.notifyTransferState(&next)
+		}
+		return next, true
+	}
+}
+
 func (s *Server) getTransfer(id string, typ bosgo.TransferType) (TransferOrder, bool) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -670,7 +1073,9 @@ func (s *Server) requireTransfer(w http.ResponseWriter, req *http.Request, trans
 	return tr, true
 }
 
-func (s *Server) progressTransfer(tr *TransferOrder, confirm bool, answers []bosgo.ChallengeAnswer) {
+// progressTransfer moves the transfer on to its next step. It reports whether
+// the transfer has been authorised and is to be completed.
+func (s *Server) progressTransfer(tr *TransferOrder, confirm bool, answers []bosgo.ChallengeAnswer) bool {
 	combinedAnswers := append([]bosgo.ChallengeAnswer{}, answers...)
 	u, _ := s.GetUser(tr.UserID)
 	combinedAnswers = append(combinedAnswers, u.StoredAnswers[tr.AccessDetails.Access.ProviderID]...)
@@ -709,7 +1114,7 @@ func (s *Server) progressTransfer(tr *TransferOrder, confirm bool, answers []bos
 				}
 
 				tr.Transfer.Errors = nil
-				return
+				return false
 			}
 		}
 
@@ -729,9 +1134,12 @@ func (s *Server) progressTransfer(tr *TransferOrder, confirm bool, answers []bos
 							Intent: bosgo.TransferIntentProvideChallengeAnswer,
 							Data: &bosgo.TransferStepData{
 								ChallengeMessage: ta.Message,
+								TANType:          ta.tanType(),
 							},
 						}
-						return
+						tr.AuthMethod = ta.Method
+						tr.AuthStarted = s.now()
+						return false
 					}
 				}
 			}
@@ -741,16 +1149,20 @@ func (s *Server) progressTransfer(tr *TransferOrder, confirm bool, answers []bos
 		tr.Transfer.Step = bosgo.TransferStep{}
 
 	case bosgo.TransferIntentProvideChallengeAnswer:
+		// Decoupled methods are approved outside of the application and
+		// need no answer
+		if ta, ok := tr.AccessDetails.transferAuth(tr.AuthMethod); ok && ta.Decoupled {
+			if s.now().Sub(tr.AuthStarted) < time.Duration(ta.ApproveAfter) {
+				return false
+			}
+			return true
+		}
+
 		for _, ans := range combinedAnswers {
 			if ans.ID == "tan" {
 				for _, ta := range tr.AccessDetails.TransferAuths {
 					if ans.Value == ta.Answer {
-						tr.Transfer.State = bosgo.TransferStateSucceeded
-						tr.Transfer.Step = bosgo.TransferStep{}
-						now := time.Now()
-						tr.Transfer.EntryDate = now
-						tr.Transfer.SettlementDate = now
-						return
+						return true
 					}
 				}
 			}
@@ -764,6 +1176,7 @@ func (s *Server) progressTransfer(tr *TransferOrder, confirm bool, answers []bos
 			Intent: bosgo.TransferIntentProvidePIN,
 		}
 	}
+	return false
 }
 
 // AddAccess adds configuration for an access with its transactions so it can be added to a user via the server API
@@ -1049,6 +1462,14 @@ func (s *Server) handleJobStatus(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	// Jobs progress in the background while they are polled
+	if !job.Finished {
+		if job, found = s.updateJob(job.ID, s.advanceJob); !found {
+			s.sendError(w, http.StatusNotFound, "resource_not_found")
+			return
+		}
+	}
+
 	if problems := job.AccessDetails.StageProblems[job.Stage]; len(problems) > 0 {
 		job.Problems = problems
 	}
@@ -1069,8 +1490,14 @@ func (s *Server) handleJobAnswer(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	s.progressJob(&job, answers.Answers)
-	s.setJob(job)
+	job, found = s.updateJob(job.ID, func(j *Job, fx *jobEffects) {
+		s.advanceJob(j, fx)
+		s.progressJob(j, answers.Answers, fx)
+	})
+	if !found {
+		s.sendError(w, http.StatusNotFound, "resource_not_found")
+		return
+	}
 
 	s.sendJSON(w, http.StatusOK, s.jobStatus(&job))
 }
@@ -1091,7 +1518,9 @@ func (s *Server) jobStatus(job *Job) *bosgo.JobStatus {
 		URI:      "/jobs/" + job.ID,
 	}
 
-	if job.NeedsAnswers {
+	if job.NeedsAnswers && job.AccessDetails.Scenario != nil {
+		status.Challenge = scenarioChallenge(job, job.AccessDetails.Scenario)
+	} else if job.NeedsAnswers {
 		status.Challenge = &bosgo.Challenge{}
 
 		for id := range job.AccessDetails.ChallengeMap {
@@ -1108,6 +1537,9 @@ func (s *Server) jobStatus(job *Job) *bosgo.JobStatus {
 				Previous: previous,
 			})
 		}
+		if job.ConsentExpired {
+			status.Challenge.LastProblems = append(status.Challenge.LastProblems, bosgo.Problem{Code: "consent_expired"})
+		}
 
 	}
 
@@ -1430,7 +1862,12 @@ func (s *Server) deleteRepeatedTransaction(w http.ResponseWriter, req *http.Requ
 	if !s.readJSON(w, req, &data) {
 		return
 	}
-	data.Type = bosgo.TransferTypeRecurring
+	data = transferParams{
+		From:             rtx.UserAccountID,
+		To:               bosgo.TransferAddress{Name: rtx.RemoteAccount.Label, IBAN: rtx.RemoteAccount.IBAN},
+		Type:             bosgo.TransferTypeRecurring,
+		ChallengeAnswers: data.ChallengeAnswers,
+	}
 
 	var providerID string
 accessloop:
@@ -1447,7 +1884,7 @@ accessloop:
 		return
 	}
 
-	tr := s.newTransfer(user.ID, providerID, &data)
+	tr := s.newTransfer(user.ID, providerID, OrderOpDelete, rtx.ID, &data)
 	s.sendJSON(w, http.StatusCreated, &tr.Transfer)
 }
 
@@ -1478,7 +1915,14 @@ func (s *Server) updateRepeatedTransaction(w http.ResponseWriter, req *http.Requ
 	if !s.readJSON(w, req, &data) {
 		return
 	}
-	// TODO: check which params are immutable and set them from rtx
+	// The source account cannot be changed and the schedule is kept unless
+	// a new one is given
+	data.From = rtx.UserAccountID
+	data.Type = bosgo.TransferTypeRecurring
+	if data.Schedule == nil {
+		schedule := rtx.Schedule
+		data.Schedule = &schedule
+	}
 
 	var providerID string
 accessloop:
@@ -1495,7 +1939,7 @@ accessloop:
 		return
 	}
 
-	tr := s.newTransfer(user.ID, providerID, &data)
+	tr := s.newTransfer(user.ID, providerID, OrderOpUpdate, rtx.ID, &data)
 	s.sendJSON(w, http.StatusCreated, &tr.Transfer)
 }
 
@@ -1592,9 +2036,10 @@ accessloop:
 	}
 	if data.Type != bosgo.TransferTypeRegular && data.Type != bosgo.TransferTypeRecurring {
 		s.sendError(w, http.StatusBadRequest, "validation_bad_parameters")
+		return
 	}
 
-	tr := s.newTransfer(user.ID, providerID, &data)
+	tr := s.newTransfer(user.ID, providerID, OrderOpCreate, 0, &data)
 
 	s.sendJSON(w, http.StatusCreated, &tr.Transfer)
 }
@@ -1638,29 +2083,32 @@ func (s *Server) handleTransferProcess(w http.ResponseWriter, req *http.Request)
 
 	if data.Type != bosgo.TransferTypeRegular && data.Type != bosgo.TransferTypeRecurring {
 		s.sendError(w, http.StatusBadRequest, "validation_bad_parameters")
-	}
-
-	if data.Version != tr.Transfer.Version {
-		tr.Transfer.Errors = append(tr.Transfer.Errors, bosgo.Problem{Code: "versions_mismatch"})
-		s.sendJSON(w, http.StatusOK, &tr.Transfer)
-		return
-	}
-
-	if data.Intent != tr.Transfer.Step.Intent {
-		tr.Transfer.Errors = append(tr.Transfer.Errors, bosgo.Problem{Code: "intents_mismatch"})
-		s.sendJSON(w, http.StatusOK, &tr.Transfer)
 		return
 	}
 
-	if tr.Transfer.State != bosgo.TransferStateOngoing {
-		tr.Transfer.Errors = append(tr.Transfer.Errors, bosgo.Problem{Code: "state_" + string(tr.Transfer.State) + "_unprocessable"})
-		s.sendJSON(w, http.StatusOK, &tr.Transfer)
+	// The transfer is checked again each time the update is retried, a
+	// concurrent request may have moved it on
+	tr, found = s.updateTransfer(tr.Transfer.ID, data.Type, func(tr *TransferOrder) (bool, bool) {
+		var problem string
+		switch {
+		case data.Version != tr.Transfer.Version:
+			problem = "versions_mismatch"
+		case data.Intent != tr.Transfer.Step.Intent:
+			problem = "intents_mismatch"
+		case tr.Transfer.State != bosgo.TransferStateOngoing:
+			problem = "state_" + string(tr.Transfer.State) + "_unprocessable"
+		}
+		if problem != "" {
+			tr.Transfer.Errors = append(tr.Transfer.Errors, bosgo.Problem{Code: problem})
+			return false, false
+		}
+		return s.progressTransfer(tr, data.Confirm, data.ChallengeAnswers), true
+	})
+	if !found {
+		s.sendError(w, http.StatusNotFound, "resource_not_found")
 		return
 	}
 
-	s.progressTransfer(&tr, data.Confirm, data.ChallengeAnswers)
-	s.setTransfer(tr)
-
 	s.sendJSON(w, http.StatusOK, &tr.Transfer)
 }
 
@@ -1721,6 +2169,9 @@ func deleteAccess(user User, access bosgo.Access) (User, bosgo.Access) {
 
 // WriteState writes the current state of the server to w as a series of JSON documents.
 func (s *Server) WriteState(w io.Writer) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	var buf bytes.Buffer
 	enc := json.NewEncoder(&buf)
 	if err := enc.Encode(s.Devs); err != nil {
@@ -1747,6 +2198,24 @@ func (s *Server) WriteState(w io.Writer) error {
 	if err := enc.Encode(s.RecurringTransfers); err != nil {
 		return err
 	}
+	if err := enc.Encode(s.DevTokens); err != nil {
+		return err
+	}
+	if err := enc.Encode(s.Providers); err != nil {
+		return err
+	}
+	if err := enc.Encode(s.Categories); err != nil {
+		return err
+	}
+	if err := enc.Encode(s.Banks); err != nil {
+		return err
+	}
+	if err := enc.Encode(s.id); err != nil {
+		return err
+	}
+	if err := enc.Encode(s.tokenExpiry); err != nil {
+		return err
+	}
 
 	if _, err := buf.WriteTo(w); err != nil {
 		return err
@@ -1783,7 +2252,25 @@ func (s *Server) ReadState(r io.Reader) error {
 	if err := dec.Decode(&tmp.RecurringTransfers); err != nil {
 		return err
 	}
+	// Developer sessions, the catalog, the ID counter and session expiries
+	// were added later, states written before lack them and keep the current
+	// catalog.
+	for _, v := range []interface{}{&tmp.DevTokens, &tmp.Providers, &tmp.Categories, &tmp.Banks, &tmp.id, &tmp.tokenExpiry} {
+		if err := dec.Decode(v); err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+	}
+	if tmp.DevTokens == nil {
+		tmp.DevTokens = make(map[string]string)
+	}
+	if tmp.tokenExpiry == nil {
+		tmp.tokenExpiry = make(map[string]time.Time)
+	}
 
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	s.Devs = tmp.Devs
 	s.Apps = tmp.Apps
 	s.Users = tmp.Users
@@ -1792,6 +2279,101 @@ func (s *Server) ReadState(r io.Reader) error {
 	s.Accesses = tmp.Accesses
 	s.Transfers = tmp.Transfers
 	s.RecurringTransfers = tmp.RecurringTransfers
+	s.DevTokens = tmp.DevTokens
+	s.tokenExpiry = tmp.tokenExpiry
+	if tmp.Providers != nil {
+		s.Providers = tmp.Providers
+	}
+	if tmp.Categories != nil {
+		s.Categories = tmp.Categories
+	}
+	if tmp.Banks != nil {
+		s.Banks = tmp.Banks
+	}
+
+	// Continue numbering after the restored counter and objects so new IDs
+	// do not collide
+	if tmp.id > s.id {
+		s.id = tmp.id
+	}
+	if max := s.maxID(); max > s.id {
+		s.id = max
+	}
 
 	return nil
 }
+
+// maxID returns the highest ID used by the server's objects. IDs created by
+// nextIDStr are hexadecimal. The caller must hold s.mu.
+func (s *Server) maxID() int64 {
+	var max int64
+	see := func(id int64) {
+		if id > max {
+			max = id
+		}
+	}
+	seeStr := func(id string) {
+		if v, err := strconv.ParseInt(id, 16, 64); err == nil {
+			see(v)
+		}
+	}
+	seeAccess := func(a bosgo.Access) {
+		see(a.ID)
+		for _, ac := range a.Accounts {
+			see(ac.ID)
+		}
+	}
+	seeTxs := func(txs []bosgo.Transaction) {
+		for _, tx := range txs {
+			see(tx.ID)
+		}
+	}
+	seeRepeated := func(txs []bosgo.RepeatedTransaction) {
+		for _, tx := range txs {
+			see(tx.ID)
+		}
+	}
+
+	for _, u := range s.Users {
+		for _, a := range u.Accesses {
+			seeAccess(a)
+		}
+		seeTxs(u.Transactions)
+		seeTxs(u.ScheduledTransactions)
+		seeRepeated(u.RepeatedTransactions)
+	}
+	for _, ad := range s.Accesses {
+		seeAccess(ad.Access)
+		seeTxs(ad.Transactions)
+		seeTxs(ad.ScheduledTransactions)
+		seeRepeated(ad.RepeatedTransactions)
+	}
+	for id := range s.Devs {
+		seeStr(id)
+	}
+	for id, app := range s.Apps {
+		seeStr(id)
+		for _, k := range app.Keys {
+			seeStr(k.Key)
+		}
+	}
+	for id := range s.Users {
+		seeStr(id)
+	}
+	for token := range s.UserTokens {
+		seeStr(token)
+	}
+	for token := range s.DevTokens {
+		seeStr(token)
+	}
+	for id := range s.Jobs {
+		seeStr(id)
+	}
+	for id := range s.Transfers {
+		seeStr(id)
+	}
+	for id := range s.RecurringTransfers {
+		seeStr(id)
+	}
+	return max
+}
@@ -0,0 +1,459 @@
+package testserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"code.bankrs.com/bosgo"
+)
+
+// Events sent to webhooks by the test server.
+const (
+	EventJobStageChanged      = "job.stage_changed"      // a job moved to another stage
+	EventTransferStateChanged = "transfer.state_changed" // a transfer moved to another state
+	EventTransactionsImported = "transactions.imported"  // the transactions of a new access were imported
+)
+
+const (
+	defaultWebhookAttempts = 3
+	defaultWebhookBackoff  = 100 * time.Millisecond
+)
+
+// MaxWebhookDeliveries is the number of deliveries kept in the log returned
+// by WebhookDeliveries. Older deliveries are dropped.
+const MaxWebhookDeliveries = 1000
+
+// WebhookDelivery records the delivery of an event to a webhook.
+type WebhookDelivery struct {
+	WebhookID string
+	URL       string
+	Payload   bosgo.WebhookPayload
+	Attempts  []WebhookAttempt
+	Delivered bool // whether an attempt was answered with a 2xx status
+}
+
+// WebhookAttempt is a single attempt to deliver an event.
+type WebhookAttempt struct {
+	Time       time.Time
+	StatusCode int    // zero if no response was received
+	Err        string // the error if no response was received
+}
+
+// SetWebhookClient sets the client used to deliver webhook events. It
+// defaults to a client with a timeout of 5 seconds.
+func (s *Server) SetWebhookClient(hc *http.Client) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.webhookClient = hc
+}
+
+// SetWebhookRetry sets the number of attempts made to deliver an event and
+// the wait before the first retry, which doubles with every further retry.
+func (s *Server) SetWebhookRetry(attempts int, backoff time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.webhookAttempts = attempts
+	s.webhookBackoff = backoff
+}
+
+// WebhookDeliveries returns the log of the last MaxWebhookDeliveries
+// deliveries in the order the events occurred. Deliveries still in progress
+// may gain further attempts.
+func (s *Server) WebhookDeliveries() []WebhookDelivery {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	deliveries := make([]WebhookDelivery, len(s.deliveries))
+	for i, d := range s.deliveries {
+		d.Attempts = append([]WebhookAttempt(nil), d.Attempts...)
+		deliveries[i] = d
+	}
+	return deliveries
+}
+
+// ResetWebhookDeliveries clears the log of deliveries. Deliveries still in
+// progress continue but their attempts are not logged.
+func (s *Server) ResetWebhookDeliveries() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deliveriesDropped += len(s.deliveries)
+	s.deliveries = nil
+}
+
+// WaitWebhooks waits until all pending deliveries have succeeded or run out
+// of attempts.
+func (s *Server) WaitWebhooks() {
+	s.mu.Lock()
+	if s.pendingDeliveries == 0 {
+		s.mu.Unlock()
+		return
+	}
+	idle := s.deliveriesIdle
+	s.mu.Unlock()
+	<-idle
+}
+
+// notify sends an event to the webhooks of the developer owning the user's
+// application that are subscribed to it.
+func (s *Server) notify(userID string, event string, data map[string]interface{}) {
+	s.mu.Lock()
+	var hooks []bosgo.Webhook
+	if user, exists := s.Users[userID]; exists {
+		if app, exists := s.Apps[user.ApplicationID]; exists {
+			for _, wh := range s.Devs[app.DeveloperID].Webhooks {
+				if wh.Enabled && subscribed(wh, event) {
+					hooks = append(hooks, wh)
+				}
+			}
+		}
+	}
+	s.mu.Unlock()
+
+	for _, wh := range hooks {
+		payload := s.payload(wh, event, data)
+
+		s.mu.Lock()
+		select {
+		case <-s.stopDeliveries:
+			// The server has been closed
+			s.mu.Unlock()
+			return
+		default:
+		}
+		seq, d := s.addDeliveryLocked(wh, payload)
+		if s.pendingDeliveries == 0 {
+			s.deliveriesIdle = make(chan struct{})
+		}
+		s.pendingDeliveries++
+		s.mu.Unlock()
+
+		go func() {
+			s.deliver(seq, d)
+
+			s.mu.Lock()
+			s.pendingDeliveries--
+			if s.pendingDeliveries == 0 {
+				close(s.deliveriesIdle)
+			}
+			s.mu.Unlock()
+		}()
+	}
+}
+
+func subscribed(wh bosgo.Webhook, event string) bool {
+	for _, e := range wh.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) payload(wh bosgo.Webhook, event string, data map[string]interface{}) bosgo.WebhookPayload {
+	return bosgo.WebhookPayload{
+		Event: bosgo.WebhookEventDetail{
+			ID:          s.nextIDStr(),
+			Type:        event,
+			URL:         wh.URL,
+			APIVersion:  wh.APIVersion,
+			Environment: wh.Environment,
+			CreatedAt:   s.now().UTC(),
+		},
+		Data: data,
+	}
+}
+
+func (s *Server) addDelivery(wh bosgo.Webhook, payload bosgo.WebhookPayload) (int, WebhookDelivery) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.addDeliveryLocked(wh, payload)
+}
+
+// addDeliveryLocked logs a delivery, dropping the oldest one if the log is
+// full. It returns the delivery and its sequence number, which locates it in
+// the log while it is kept. The caller must hold s.mu.
+func (s *Server) addDeliveryLocked(wh bosgo.Webhook, payload bosgo.WebhookPayload) (int, WebhookDelivery) {
+	d := WebhookDelivery{
+		WebhookID: wh.ID,
+		URL:       wh.URL,
+		Payload:   payload,
+	}
+	s.deliveries = append(s.deliveries, d)
+	if n := len(s.deliveries) - MaxWebhookDeliveries; n > 0 {
+		s.deliveries = s.deliveries[n:]
+		s.deliveriesDropped += n
+	}
+	return s.deliveriesDropped + len(s.deliveries) - 1, d
+}
+
+// deliver posts the payload of a delivery until it succeeds, the attempts
+// are used up or the server is closed.
+func (s *Server) deliver(seq int, d WebhookDelivery) {
+	s.mu.Lock()
+	attempts, backoff := s.webhookAttempts, s.webhookBackoff
+	s.mu.Unlock()
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	for i := 0; i < attempts; i++ {
+		if i > 0 {
+			t := time.NewTimer(backoff)
+			select {
+			case <-s.stopDeliveries:
+				t.Stop()
+				return
+			case <-t.C:
+			}
+			backoff *= 2
+		}
+		if s.attempt(seq, d).StatusCode/100 == 2 {
+			return
+		}
+	}
+}
+
+// attempt posts the payload of a delivery once and logs the attempt if the
+// delivery is still in the log.
+func (s *Server) attempt(seq int, d WebhookDelivery) WebhookAttempt {
+	s.mu.Lock()
+	hc := s.webhookClient
+	s.mu.Unlock()
+
+	// Closing the server aborts the attempt
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-s.stopDeliveries:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	a := WebhookAttempt{Time: s.now()}
+	body, err := json.Marshal(d.Payload)
+	if err != nil {
+		a.Err = err.Error()
+	} else if req, err := http.NewRequest(http.MethodPost, d.URL, bytes.NewReader(body)); err != nil {
+		a.Err = err.Error()
+	} else {
+		req.Header.Set("Content-Type", "application/json")
+		if res, err := hc.Do(req.WithContext(ctx)); err != nil {
+			a.Err = err.Error()
+		} else {
+			res.Body.Close()
+			a.StatusCode = res.StatusCode
+		}
+	}
+
+	s.Logf("webhook delivery to %s: status %d %s", d.URL, a.StatusCode, a.Err)
+	s.mu.Lock()
+	if i := seq - s.deliveriesDropped; i >= 0 && i < len(s.deliveries) {
+		logged := &s.deliveries[i]
+		logged.Attempts = append(logged.Attempts, a)
+		if a.StatusCode/100 == 2 {
+			logged.Delivered = true
+		}
+	}
+	s.mu.Unlock()
+	return a
+}
+
+func (s *Server) notifyJobStage(j *Job) {
+	s.notify(j.UserID, EventJobStageChanged, map[string]interface{}{
+		"job_id":      j.ID,
+		"provider_id": j.ProviderID,
+		"stage":       string(j.Stage),
+		"finished":    j.Finished,
+	})
+}
+
+func (s *Server) notifyTransferState(tr *TransferOrder) {
+	s.notify(tr.UserID, EventTransferStateChanged, map[string]interface{}{
+		"transfer_id": tr.Transfer.ID,
+		"type":        string(tr.Type),
+		"state":       string(tr.Transfer.State),
+	})
+}
+
+func (s *Server) notifyTransactionsImported(userID string, ad AccessDetails) {
+	s.notify(userID, EventTransactionsImported, map[string]interface{}{
+		"access_id": ad.Access.ID,
+		"count":     len(ad.Transactions),
+	})
+}
+
+type webhookParams struct {
+	URL        string   `json:"url"`
+	Events     []string `json:"events"`
+	APIVersion int      `json:"api_version"`
+}
+
+func (p *webhookParams) valid() bool {
+	u, err := url.Parse(p.URL)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" && len(p.Events) > 0
+}
+
+func (s *Server) handleWebhooks(w http.ResponseWriter, req *http.Request) {
+	dev, _, found := s.requireDev(w, req)
+	if !found {
+		return
+	}
+
+	switch req.Method {
+	case http.MethodGet:
+		hooks := dev.Webhooks
+		if hooks == nil {
+			hooks = []bosgo.Webhook{}
+		}
+		s.sendJSON(w, http.StatusOK, hooks)
+		return
+
+	case http.MethodPost:
+		var params webhookParams
+		if !s.readJSON(w, req, &params) {
+			return
+		}
+		if !params.valid() {
+			s.sendError(w, http.StatusBadRequest, "validation_bad_parameters")
+			return
+		}
+
+		env := req.Header.Get("X-Environment")
+		if env == "" {
+			env = "sandbox"
+		}
+		wh := bosgo.Webhook{
+			ID:          s.nextIDStr(),
+			URL:         params.URL,
+			Events:      params.Events,
+			APIVersion:  params.APIVersion,
+			Enabled:     true,
+			Environment: env,
+			CreatedAt:   s.now().UTC(),
+		}
+		if _, found := s.updateDev(dev.ID, func(dev *Dev) bool {
+			dev.Webhooks = append(dev.Webhooks[:len(dev.Webhooks):len(dev.Webhooks)], wh)
+			return true
+		}); !found {
+			s.sendError(w, http.StatusUnauthorized, "authentication_failed")
+			return
+		}
+		s.sendJSON(w, http.StatusCreated, map[string]string{"id": wh.ID})
+		return
+	}
+
+	http.Error(w, "405 Method Not Allowed", http.StatusMethodNotAllowed)
+}
+
+func (s *Server) handleWebhook(w http.ResponseWriter, req *http.Request) {
+	dev, _, found := s.requireDev(w, req)
+	if !found {
+		return
+	}
+
+	id := strings.TrimPrefix(req.URL.Path, "/v1/webhooks/")
+	idx := webhookIndex(dev.Webhooks, id)
+	if idx == -1 {
+		s.sendError(w, http.StatusNotFound, "resource_not_found")
+		return
+	}
+
+	// Changes are applied to the stored webhooks, which may have changed
+	// since the developer was read
+	update := func(change func(hooks []bosgo.Webhook, idx int) []bosgo.Webhook) {
+		if _, found := s.updateDev(dev.ID, func(dev *Dev) bool {
+			idx := webhookIndex(dev.Webhooks, id)
+			if idx == -1 {
+				return false
+			}
+			dev.Webhooks = change(append([]bosgo.Webhook(nil), dev.Webhooks...), idx)
+			return true
+		}); !found {
+			s.sendError(w, http.StatusNotFound, "resource_not_found")
+			return
+		}
+		s.sendNoContent(w)
+	}
+
+	switch req.Method {
+	case http.MethodGet:
+		s.sendJSON(w, http.StatusOK, dev.Webhooks[idx])
+		return
+
+	case http.MethodPut:
+		var params webhookParams
+		if !s.readJSON(w, req, &params) {
+			return
+		}
+		if !params.valid() {
+			s.sendError(w, http.StatusBadRequest, "validation_bad_parameters")
+			return
+		}
+		update(func(hooks []bosgo.Webhook, idx int) []bosgo.Webhook {
+			hooks[idx].URL = params.URL
+			hooks[idx].Events = params.Events
+			hooks[idx].APIVersion = params.APIVersion
+			return hooks
+		})
+		return
+
+	case http.MethodDelete:
+		update(func(hooks []bosgo.Webhook, idx int) []bosgo.Webhook {
+			return append(hooks[:idx], hooks[idx+1:]...)
+		})
+		return
+
+	case http.MethodPost:
+		s.handleWebhookTest(w, req, dev.Webhooks[idx])
+		return
+	}
+
+	http.Error(w, "405 Method Not Allowed", http.StatusMethodNotAllowed)
+}
+
+// webhookIndex returns the index of the webhook with the given ID or -1.
+func webhookIndex(hooks []bosgo.Webhook, id string) int {
+	for i, wh := range hooks {
+		if wh.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// handleWebhookTest delivers a test event once, without retrying, and
+// reports the webhook's response.
+func (s *Server) handleWebhookTest(w http.ResponseWriter, req *http.Request, wh bosgo.Webhook) {
+	var params struct {
+		Event string `json:"event"`
+	}
+	if !s.readJSON(w, req, &params) {
+		return
+	}
+	if params.Event == "" {
+		s.sendError(w, http.StatusBadRequest, "validation_bad_parameters")
+		return
+	}
+
+	payload := s.payload(wh, params.Event, map[string]interface{}{"test": true})
+	a := s.attempt(s.addDelivery(wh, payload))
+
+	res := bosgo.WebhookTestResult{
+		Payload: payload,
+		Response: bosgo.WebhookTestResponse{
+			ID:     payload.Event.ID,
+			Code:   a.StatusCode,
+			Status: http.StatusText(a.StatusCode),
+		},
+	}
+	if a.Err != "" {
+		res.Response.Status = a.Err
+	}
+	s.sendJSON(w, http.StatusOK, res)
+}
@@ -0,0 +1,315 @@
+package testserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"code.bankrs.com/bosgo"
+)
+
+// receiver records the events posted to it. It answers the first failures
+// requests with an internal server error.
+type receiver struct {
+	mu       sync.Mutex
+	failures int
+	events   []bosgo.WebhookPayload
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if rc.failures > 0 {
+		rc.failures--
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	var p bosgo.WebhookPayload
+	if err := json.NewDecoder(req.Body).Decode(&p); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	rc.events = append(rc.events, p)
+}
+
+func (rc *receiver) types() []string {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	var types []string
+	for _, p := range rc.events {
+		types = append(types, p.Event.Type)
+	}
+	return types
+}
+
+func TestWebhookCRUD(t *testing.T) {
+	s := NewWithDefaults()
+	if testing.Verbose() {
+		s.SetLogger(t)
+	}
+	defer s.Close()
+
+	devClient := newDevClient(t, s)
+	if _, err := devClient.Webhooks.Create(1, "not a url", []string{EventJobStageChanged}).Send(); err == nil {
+		t.Errorf("created webhook with invalid url, wanted error")
+	}
+
+	id, err := devClient.Webhooks.Create(1, "https://example.com/hook", []string{EventJobStageChanged}).Send()
+	if err != nil {
+		t.Fatalf("failed to create webhook: %v", err)
+	}
+	if err := devClient.Webhooks.Update(id, 2, "https://example.com/other", []string{EventTransferStateChanged}).Send(); err != nil {
+		t.Fatalf("failed to update webhook: %v", err)
+	}
+	wh, err := devClient.Webhooks.Get(id).Send()
+	if err != nil {
+		t.Fatalf("failed to get webhook: %v", err)
+	}
+	if wh.URL != "https://example.com/other" || wh.APIVersion != 2 || !wh.Enabled || len(wh.Events) != 1 || wh.Events[0] != EventTransferStateChanged {
+		t.Errorf("webhook: got %+v", wh)
+	}
+
+	page, err := devClient.Webhooks.List().Send()
+	if err != nil {
+		t.Fatalf("failed to list webhooks: %v", err)
+	}
+	if len(page.Webhooks) != 1 {
+		t.Errorf("webhooks: got %d, want 1", len(page.Webhooks))
+	}
+
+	if err := devClient.Webhooks.Delete(id).Send(); err != nil {
+		t.Fatalf("failed to delete webhook: %v", err)
+	}
+	if _, err := devClient.Webhooks.Get(id).Send(); err == nil {
+		t.Errorf("got deleted webhook, wanted error")
+	}
+}
+
+func TestWebhookTest(t *testing.T) {
+	s := NewWithDefaults()
+	if testing.Verbose() {
+		s.SetLogger(t)
+	}
+	defer s.Close()
+
+	rc := &receiver{}
+	hook := httptest.NewServer(rc)
+	defer hook.Close()
+
+	devClient := newDevClient(t, s)
+	id, err := devClient.Webhooks.Create(1, hook.URL, []string{EventJobStageChanged}).Send()
+	if err != nil {
+		t.Fatalf("failed to create webhook: %v", err)
+	}
+	res, err := devClient.Webhooks.Test(id, "ping").Send()
+	if err != nil {
+		t.Fatalf("failed to test webhook: %v", err)
+	}
+	if res.Response.Code != http.StatusOK || res.Payload.Event.Type != "ping" {
+		t.Errorf("test result: got %+v", res)
+	}
+	if types := rc.types(); len(types) != 1 || types[0] != "ping" {
+		t.Errorf("received events: got %v, want [ping]", types)
+	}
+}
+
+func TestWebhookDelivery(t *testing.T) {
+	s := NewWithDefaults()
+	if testing.Verbose() {
+		s.SetLogger(t)
+	}
+	defer s.Close()
+	s.SetWebhookRetry(3, time.Millisecond)
+
+	rc := &receiver{failures: 1}
+	hook := httptest.NewServer(rc)
+	defer hook.Close()
+
+	devClient := newDevClient(t, s)
+	_, err := devClient.Webhooks.Create(1, hook.URL, []string{EventJobStageChanged, EventTransactionsImported}).Send()
+	if err != nil {
+		t.Fatalf("failed to create webhook: %v", err)
+	}
+
+	appClient := bosgo.NewAppClient(s.Client(), s.Addr(), DefaultApplicationID)
+	userClient, err := appClient.Users.Login(DefaultUsername, DefaultPassword).Send()
+	if err != nil {
+		t.Fatalf("failed to login as user: %v", err)
+	}
+	job, err := userClient.Accesses.Add(DefaultProviderID).
+		ChallengeAnswer(bosgo.ChallengeAnswer{ID: ChallengeLogin, Value: DefaultAccessLogin}).
+		Send()
+	if err != nil {
+		t.Fatalf("failed to add access: %v", err)
+	}
+	err = userClient.Jobs.Answer(job.URI).
+		ChallengeAnswer(bosgo.ChallengeAnswer{ID: ChallengePIN, Value: DefaultAccessPIN}).
+		Send()
+	if err != nil {
+		t.Fatalf("failed to answer challenge: %v", err)
+	}
+	s.WaitWebhooks()
+
+	deliveries := s.WebhookDeliveries()
+	var types []string
+	for _, d := range deliveries {
+		if !d.Delivered {
+			t.Errorf("delivery of %s failed: %+v", d.Payload.Event.Type, d.Attempts)
+		}
+		types = append(types, d.Payload.Event.Type)
+	}
+	want := []string{EventJobStageChanged, EventJobStageChanged, EventTransactionsImported}
+	if len(types) != len(want) {
+		t.Fatalf("delivered events: got %v, want %v", types, want)
+	}
+	for i := range want {
+		if types[i] != want[i] {
+			t.Errorf("event %d: got %s, want %s", i, types[i], want[i])
+		}
+	}
+	if stage := deliveries[1].Payload.Data["stage"]; stage != string(bosgo.JobStageImported) {
+		t.Errorf("stage of second event: got %v, want %s", stage, bosgo.JobStageImported)
+	}
+
+	retried := 0
+	for _, d := range deliveries {
+		if len(d.Attempts) > 1 {
+			retried++
+		}
+	}
+	if retried != 1 {
+		t.Errorf("retried deliveries: got %d, want 1", retried)
+	}
+	if n := len(rc.types()); n != len(want) {
+		t.Errorf("received events: got %d, want %d", n, len(want))
+	}
+}
+
+func TestCloseCancelsWebhookRetries(t *testing.T) {
+	s := NewWithDefaults()
+	if testing.Verbose() {
+		s.SetLogger(t)
+	}
+	s.SetWebhookRetry(3, time.Hour)
+
+	clock := NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	s.SetClock(clock)
+
+	rc := &receiver{failures: 10}
+	hook := httptest.NewServer(rc)
+	defer hook.Close()
+
+	devClient := newDevClient(t, s)
+	if _, err := devClient.Webhooks.Create(1, hook.URL, []string{EventJobStageChanged}).Send(); err != nil {
+		t.Fatalf("failed to create webhook: %v", err)
+	}
+	userClient := loginUser(t, s)
+	startAccess(t, userClient, false)
+
+	// Wait for the first attempt, after which the delivery waits an hour
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if d := s.WebhookDeliveries(); len(d) > 0 && len(d[0].Attempts) > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("no delivery attempt was made")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		s.Close()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close waited for the retry of a delivery")
+	}
+
+	d := s.WebhookDeliveries()[0]
+	if len(d.Attempts) != 1 || d.Delivered {
+		t.Errorf("got attempts %+v, wanted one failed attempt", d.Attempts)
+	}
+	if !d.Payload.Event.CreatedAt.Equal(clock.Now()) || !d.Attempts[0].Time.Equal(clock.Now()) {
+		t.Errorf("got event created at %v and attempted at %v, wanted the time of the clock", d.Payload.Event.CreatedAt, d.Attempts[0].Time)
+	}
+
+	// Closing again does nothing
+	s.Close()
+}
+
+func TestWebhookDeliveriesLimit(t *testing.T) {
+	s := NewWithDefaults()
+	if testing.Verbose() {
+		s.SetLogger(t)
+	}
+	defer s.Close()
+
+	wh := bosgo.Webhook{ID: "hook", URL: "https://example.com/hook"}
+	for i := 0; i < MaxWebhookDeliveries+5; i++ {
+		s.addDelivery(wh, bosgo.WebhookPayload{Event: bosgo.WebhookEventDetail{ID: fmt.Sprint(i)}})
+	}
+	deliveries := s.WebhookDeliveries()
+	if len(deliveries) != MaxWebhookDeliveries {
+		t.Fatalf("got %d deliveries, wanted %d", len(deliveries), MaxWebhookDeliveries)
+	}
+	if id := deliveries[0].Payload.Event.ID; id != "5" {
+		t.Errorf("got oldest delivery %s, wanted 5", id)
+	}
+
+	s.ResetWebhookDeliveries()
+	if n := len(s.WebhookDeliveries()); n != 0 {
+		t.Fatalf("got %d deliveries after reset, wanted 0", n)
+	}
+
+	// Attempts are logged for deliveries made after the reset
+	rc := &receiver{}
+	hook := httptest.NewServer(rc)
+	defer hook.Close()
+	devClient := newDevClient(t, s)
+	id, err := devClient.Webhooks.Create(1, hook.URL, []string{EventJobStageChanged}).Send()
+	if err != nil {
+		t.Fatalf("failed to create webhook: %v", err)
+	}
+	if _, err := devClient.Webhooks.Test(id, "ping").Send(); err != nil {
+		t.Fatalf("failed to test webhook: %v", err)
+	}
+	deliveries = s.WebhookDeliveries()
+	if len(deliveries) != 1 || !deliveries[0].Delivered || len(deliveries[0].Attempts) != 1 {
+		t.Errorf("got deliveries %+v, wanted one delivered", deliveries)
+	}
+}
+
+func TestWebhookCreateConcurrent(t *testing.T) {
+	s := NewWithDefaults()
+	if testing.Verbose() {
+		s.SetLogger(t)
+	}
+	defer s.Close()
+
+	devClient := newDevClient(t, s)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			devClient.Webhooks.Create(1, "https://example.com/hook", []string{EventJobStageChanged}).Send()
+		}()
+	}
+	wg.Wait()
+
+	page, err := devClient.Webhooks.List().Send()
+	if err != nil {
+		t.Fatalf("failed to list webhooks: %v", err)
+	}
+	if len(page.Webhooks) != 10 {
+		t.Errorf("got %d webhooks, wanted 10", len(page.Webhooks))
+	}
+}
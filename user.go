@@ -18,6 +18,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
 	"strconv"
@@ -583,13 +584,7 @@ func (r *JobAnswerReq) ChallengeAnswer(answer ChallengeAnswer) *JobAnswerReq {
 
 // Send sends the request to get answer a challenge needed by a job.
 func (r *JobAnswerReq) Send() error {
-	data := struct {
-		Answers ChallengeAnswerList `json:"challenge_answers"`
-	}{
-		Answers: r.answers,
-	}
-
-	_, cleanup, err := r.req.putJSON(&data)
+	_, cleanup, err := r.put()
 	defer cleanup()
 	if err != nil {
 		return err
@@ -598,6 +593,37 @@ func (r *JobAnswerReq) Send() error {
 	return nil
 }
 
+// SendStatus is like Send but also returns the status of the job that is
+// reported in response to the answers. The status is nil if the response
+// does not report one, for example because the answers are checked
+// asynchronously.
+func (r *JobAnswerReq) SendStatus() (*JobStatus, error) {
+	res, cleanup, err := r.put()
+	defer cleanup()
+	if err != nil {
+		return nil, err
+	}
+
+	var status JobStatus
+	if err := json.NewDecoder(res.Body).Decode(&status); err != nil {
+		if err == io.EOF {
+			return nil, nil
+		}
+		return nil, decodeError(err, res)
+	}
+
+	return &status, nil
+}
+
+func (r *JobAnswerReq) put() (*http.Response, func(), error) {
+	data := struct {
+		Answers ChallengeAnswerList `json:"challenge_answers"`
+	}{
+		Answers: r.answers,
+	}
+	return r.req.putJSON(&data)
+}
+
 // Cancel returns a request that may be used to cancel a job.
 func (j *JobsService) Cancel(uri string) *JobCancelReq {
 	return &JobCancelReq{